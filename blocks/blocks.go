@@ -21,12 +21,29 @@ func NewBlock(data []byte) *Block {
 	return &Block{Data: data, Multihash: u.Hash(data)}
 }
 
+// NewBlockWithHashFunc creates a Block object from opaque data, hashing it
+// with the given multihash function (e.g. mh.SHA3) instead of the default.
+func NewBlockWithHashFunc(data []byte, code int) (*Block, error) {
+	h, err := mh.Sum(data, code, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &Block{Data: data, Multihash: h}, nil
+}
+
 // NewBlockWithHash creates a new block when the hash of the data
 // is already known, this is used to save time in situations where
 // we are able to be confident that the data is correct
 func NewBlockWithHash(data []byte, h mh.Multihash) (*Block, error) {
 	if u.Debug {
-		chk := u.Hash(data)
+		dh, err := mh.Decode(h)
+		if err != nil {
+			return nil, err
+		}
+		chk, err := mh.Sum(data, dh.Code, dh.Length)
+		if err != nil {
+			return nil, err
+		}
 		if string(chk) != string(h) {
 			return nil, errors.New("Data did not match given hash!")
 		}
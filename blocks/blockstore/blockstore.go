@@ -4,6 +4,7 @@ package blockstore
 
 import (
 	"errors"
+	"strings"
 
 	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	dsns "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/namespace"
@@ -13,6 +14,7 @@ import (
 	blocks "github.com/jbenet/go-ipfs/blocks"
 	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	u "github.com/jbenet/go-ipfs/util"
+	ds2 "github.com/jbenet/go-ipfs/util/datastore2"
 )
 
 var log = eventlog.Logger("blockstore")
@@ -20,6 +22,9 @@ var log = eventlog.Logger("blockstore")
 // BlockPrefix namespaces blockstore datastores
 var BlockPrefix = ds.NewKey("b")
 
+// blockKeyPrefix is what the datastore keys of the blocks start with.
+var blockKeyPrefix = BlockPrefix.String() + "/"
+
 var ValueTypeMismatch = errors.New("The retrieved value is not a Block")
 
 var ErrNotFound = errors.New("blockstore: block not found")
@@ -31,6 +36,10 @@ type Blockstore interface {
 	Get(u.Key) (*blocks.Block, error)
 	Put(*blocks.Block) error
 
+	// PutMany stores the given blocks in a single batch, written at once,
+	// and atomically if the datastore is datastore2.Batching.
+	PutMany([]*blocks.Block) error
+
 	AllKeys(ctx context.Context) ([]u.Key, error)
 	AllKeysChan(ctx context.Context) (<-chan u.Key, error)
 
@@ -42,6 +51,7 @@ func NewBlockstore(d ds.ThreadSafeDatastore) Blockstore {
 	dd := dsns.Wrap(d, BlockPrefix)
 	return &blockstore{
 		datastore: dd,
+		child:     d,
 	}
 }
 
@@ -49,6 +59,10 @@ type blockstore struct {
 	datastore ds.Datastore
 	// cant be ThreadSafeDatastore cause namespace.Datastore doesnt support it.
 	// we do check it on `NewBlockstore` though.
+
+	// child is the datastore under the namespace, which hides whether it
+	// is Batching
+	child ds.Datastore
 }
 
 func (bs *blockstore) Get(k u.Key) (*blocks.Block, error) {
@@ -77,6 +91,19 @@ func (bs *blockstore) Put(block *blocks.Block) error {
 	return bs.datastore.Put(k, block.Data)
 }
 
+func (bs *blockstore) PutMany(bls []*blocks.Block) error {
+	b, err := ds2.NewBatch(bs.child)
+	if err != nil {
+		return err
+	}
+	for _, block := range bls {
+		if err := b.Put(BlockPrefix.Child(block.Key().DsKey()), block.Data); err != nil {
+			return err
+		}
+	}
+	return b.Commit()
+}
+
 func (bs *blockstore) Has(k u.Key) (bool, error) {
 	return bs.datastore.Has(k.DsKey())
 }
@@ -119,9 +146,12 @@ func (bs *blockstore) AllKeysRange(ctx context.Context, offset int, limit int) (
 // AllKeysRangeChan respects context
 func (bs *blockstore) AllKeysRangeChan(ctx context.Context, offset int, limit int) (<-chan u.Key, error) {
 
-	// KeysOnly, because that would be _a lot_ of data.
-	q := dsq.Query{KeysOnly: true, Offset: offset, Limit: limit}
-	res, err := bs.datastore.Query(q)
+	// KeysOnly, because that would be _a lot_ of data. The offset and limit
+	// are applied here, as the datastore would count the keys outside the
+	// blockstore namespace too. The child is queried rather than the
+	// namespace, which would clean the keys it returns once more.
+	q := dsq.Query{KeysOnly: true, Prefix: BlockPrefix.String()}
+	res, err := bs.child.Query(q)
 	if err != nil {
 		return nil, err
 	}
@@ -140,14 +170,16 @@ func (bs *blockstore) AllKeysRangeChan(ctx context.Context, offset int, limit in
 				return k, false
 			}
 
-			// need to convert to u.Key using u.KeyFromDsKey.
-			k = u.KeyFromDsKey(ds.NewKey(e.Key))
+			if !strings.HasPrefix(e.Key, blockKeyPrefix) {
+				return "", true // only shares the first letters of the prefix
+			}
+			k = u.Key(e.Key[len(blockKeyPrefix):])
 			log.Debug("blockstore: query got key", k)
 
-			// key must be a multihash. else ignore it.
-			_, err := mh.Cast([]byte(k))
-			if err != nil {
-				return "", true
+			// key must be a multihash. else it was mangled when cleaned
+			// into a datastore key, or is not a block.
+			if _, err := mh.Cast([]byte(k)); err != nil {
+				return bs.rehash(e.Key), true
 			}
 
 			return k, true
@@ -161,7 +193,7 @@ func (bs *blockstore) AllKeysRangeChan(ctx context.Context, offset int, limit in
 			close(output)
 		}()
 
-		for {
+		for skipped, sent := 0, 0; limit <= 0 || sent < limit; {
 			k, ok := get()
 			if !ok {
 				return
@@ -169,14 +201,40 @@ func (bs *blockstore) AllKeysRangeChan(ctx context.Context, offset int, limit in
 			if k == "" {
 				continue
 			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
 
 			select {
 			case <-ctx.Done():
 				return
 			case output <- k:
+				sent++
 			}
 		}
 	}()
 
 	return output, nil
 }
+
+// rehash returns the key of the block stored under dsk, a datastore key that
+// does not hold a multihash. Cleaning a block key into a datastore key drops
+// the empty and "." path elements a multihash may contain, so such blocks can
+// only be listed by hashing their data again. It returns "" if the value under
+// dsk is not a block.
+func (bs *blockstore) rehash(dsk string) u.Key {
+	data, err := bs.child.Get(ds.NewKey(dsk))
+	if err != nil {
+		return ""
+	}
+	bdata, ok := data.([]byte)
+	if !ok {
+		return ""
+	}
+	k := blocks.NewBlock(bdata).Key()
+	if BlockPrefix.Child(k.DsKey()).String() != dsk {
+		return ""
+	}
+	return k
+}
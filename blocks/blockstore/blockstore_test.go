@@ -3,6 +3,9 @@ package blockstore
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
@@ -12,6 +15,7 @@ import (
 
 	blocks "github.com/jbenet/go-ipfs/blocks"
 	u "github.com/jbenet/go-ipfs/util"
+	ds2 "github.com/jbenet/go-ipfs/util/datastore2"
 )
 
 // TODO(brian): TestGetReturnsNil
@@ -95,6 +99,72 @@ func TestAllKeysOffsetAndLimit(t *testing.T) {
 	}
 }
 
+func TestAllKeysMangledByCleaning(t *testing.T) {
+	// find data whose multihash holds "//", which cleaning the key into a
+	// datastore key collapses
+	var block *blocks.Block
+	for i := 0; block == nil; i++ {
+		b := blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+		if strings.Contains(string(b.Key()), "//") {
+			block = b
+		}
+	}
+
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	if err := bs.Put(block); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := bs.AllKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != block.Key() {
+		t.Fatalf("expected only key %s, got %v", block.Key(), keys)
+	}
+}
+
+func TestAllKeysRangeSkipsOtherKeys(t *testing.T) {
+	N := 10
+	d := ds.NewMapDatastore()
+	bs, keys := newBlockStoreWithKeys(t, d, N)
+	// keys outside the blockstore namespace must not count for the range
+	for i := 0; i < N; i++ {
+		if err := d.Put(ds.NewKey(fmt.Sprintf("/other/%d", i)), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	var all []u.Key
+	for offset := 0; offset < N+3; offset += 3 {
+		page, err := bs.AllKeysRange(ctx, offset, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := N - offset
+		if expected > 3 {
+			expected = 3
+		} else if expected < 0 {
+			expected = 0
+		}
+		if len(page) != expected {
+			t.Fatalf("expected %d keys from offset %d, got %d", expected, offset, len(page))
+		}
+		all = append(all, page...)
+	}
+	// the map datastore lists its keys in no stable order, so the pages
+	// may overlap: only check that they are all blocks
+	for _, k := range all {
+		found := false
+		for _, bk := range keys {
+			found = found || k == bk
+		}
+		if !found {
+			t.Fatalf("unexpected key %s", k)
+		}
+	}
+}
+
 func TestAllKeysRespectsContext(t *testing.T) {
 	N := 100
 
@@ -225,6 +295,65 @@ func TestValueTypeMismatch(t *testing.T) {
 	}
 }
 
+func TestPutMany(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lds, err := ds2.NewLevelDatastore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lds.Close()
+
+	for _, d := range []ds.ThreadSafeDatastore{
+		ds_sync.MutexWrap(ds.NewMapDatastore()),
+		&countingBatches{LevelDatastore: lds},
+	} {
+		bs := NewBlockstore(d)
+		var bls []*blocks.Block
+		var keys []u.Key
+		for i := 0; i < 100; i++ {
+			b := blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+			bls = append(bls, b)
+			keys = append(keys, b.Key())
+		}
+		if err := bs.PutMany(bls); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, b := range bls {
+			got, err := bs.Get(b.Key())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Data, b.Data) {
+				t.Fatalf("got the wrong data for block %s", b.Key())
+			}
+		}
+		all, err := bs.AllKeys(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectMatches(t, keys, all)
+
+		if cb, ok := d.(*countingBatches); ok && cb.batches != 1 {
+			t.Fatalf("expected the blocks to be put in 1 batch, got %d", cb.batches)
+		}
+	}
+}
+
+type countingBatches struct {
+	*ds2.LevelDatastore
+	batches int
+}
+
+func (d *countingBatches) Batch() (ds2.Batch, error) {
+	d.batches++
+	return d.LevelDatastore.Batch()
+}
+
 func expectMatches(t *testing.T, expect, actual []u.Key) {
 
 	if len(expect) != len(actual) {
@@ -0,0 +1,116 @@
+package blockstore
+
+import (
+	"sync"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// CountingBlockstore is a Blockstore that discards the blocks put into it,
+// only remembering their keys and sizes. It tells how much data a set of
+// blocks amounts to without storing them. Get always fails with ErrNotFound.
+type CountingBlockstore struct {
+	lk    sync.Mutex
+	sizes map[u.Key]int
+	bytes uint64
+}
+
+// NewCountingBlockstore returns an empty CountingBlockstore
+func NewCountingBlockstore() *CountingBlockstore {
+	return &CountingBlockstore{sizes: make(map[u.Key]int)}
+}
+
+// Counts returns the number of distinct blocks put and their total size.
+func (bs *CountingBlockstore) Counts() (blocks int, bytes uint64) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	return len(bs.sizes), bs.bytes
+}
+
+func (bs *CountingBlockstore) Put(b *blocks.Block) error {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	if _, ok := bs.sizes[b.Key()]; !ok {
+		bs.sizes[b.Key()] = len(b.Data)
+		bs.bytes += uint64(len(b.Data))
+	}
+	return nil
+}
+
+func (bs *CountingBlockstore) PutMany(bls []*blocks.Block) error {
+	for _, b := range bls {
+		bs.Put(b)
+	}
+	return nil
+}
+
+func (bs *CountingBlockstore) Has(k u.Key) (bool, error) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	_, ok := bs.sizes[k]
+	return ok, nil
+}
+
+func (bs *CountingBlockstore) Get(k u.Key) (*blocks.Block, error) {
+	return nil, ErrNotFound
+}
+
+func (bs *CountingBlockstore) DeleteBlock(k u.Key) error {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	if size, ok := bs.sizes[k]; ok {
+		delete(bs.sizes, k)
+		bs.bytes -= uint64(size)
+	}
+	return nil
+}
+
+func (bs *CountingBlockstore) AllKeys(ctx context.Context) ([]u.Key, error) {
+	return bs.AllKeysRange(ctx, 0, 0)
+}
+
+func (bs *CountingBlockstore) AllKeysChan(ctx context.Context) (<-chan u.Key, error) {
+	return bs.AllKeysRangeChan(ctx, 0, 0)
+}
+
+// AllKeysRange returns the keys of the counted blocks, in no particular
+// order. A limit of zero means no limit.
+func (bs *CountingBlockstore) AllKeysRange(ctx context.Context, offset int, limit int) ([]u.Key, error) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	var keys []u.Key
+	i := 0
+	for k := range bs.sizes {
+		if i >= offset {
+			if limit > 0 && len(keys) >= limit {
+				break
+			}
+			keys = append(keys, k)
+		}
+		i++
+	}
+	return keys, nil
+}
+
+func (bs *CountingBlockstore) AllKeysRangeChan(ctx context.Context, offset int, limit int) (<-chan u.Key, error) {
+	keys, err := bs.AllKeysRange(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan u.Key)
+	go func() {
+		defer close(out)
+		for _, k := range keys {
+			select {
+			case out <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,205 @@
+package blockstore
+
+import (
+	"errors"
+	"sync"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// ErrQuotaExceeded is returned by the blockstores returned by Quota when
+// storing a block would take the size of the blocks stored over the limit.
+var ErrQuotaExceeded = errors.New("blockstore: storage quota exceeded")
+
+// Counter is implemented by blockstores keeping count of the blocks they
+// hold, like CountingBlockstore and the blockstores returned by Quota.
+type Counter interface {
+	// Counts returns the number of blocks stored and their total size.
+	Counts() (blocks int, bytes uint64)
+}
+
+// QuotaBlockstore is the blockstore returned by Quota.
+type QuotaBlockstore interface {
+	Blockstore
+
+	// Flush flushes the wrapped blockstore, if it is a Flusher.
+	Flusher
+
+	Counter
+
+	// Limit returns the maximum size of the blocks stored, zero meaning
+	// no limit.
+	Limit() uint64
+}
+
+// Quota returns a blockstore refusing to store more than max bytes of block
+// data in bs: the puts that would go over the limit fail with
+// ErrQuotaExceeded, and store nothing. A max of zero means no limit, in which
+// case the blockstore only keeps count of the blocks.
+//
+// The blocks already in bs are counted first, which reads all of them and
+// respects ctx. From then on, bs must only be changed through the returned
+// blockstore, or the counts drift. Puts and deletes are serialized so that
+// the counts stay exact.
+func Quota(ctx context.Context, bs Blockstore, max uint64) (QuotaBlockstore, error) {
+	q := &quota{blockstore: bs, max: max}
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k := range keys {
+		b, err := bs.Get(k)
+		if err == ErrNotFound {
+			continue // deleted since listed
+		}
+		if err != nil {
+			return nil, err
+		}
+		q.blocks++
+		q.bytes += uint64(len(b.Data))
+	}
+	// AllKeysChan closes its channel when ctx is cancelled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+type quota struct {
+	blockstore Blockstore
+	max        uint64
+
+	lk     sync.Mutex
+	blocks int
+	bytes  uint64
+}
+
+func (q *quota) Counts() (blocks int, bytes uint64) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	return q.blocks, q.bytes
+}
+
+func (q *quota) Limit() uint64 {
+	return q.max
+}
+
+func (q *quota) Flush() error {
+	if f, ok := q.blockstore.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// fits reports whether size more bytes can be stored. q.lk must be held.
+func (q *quota) fits(size uint64) bool {
+	return q.max == 0 || q.bytes+size <= q.max
+}
+
+func (q *quota) Put(b *blocks.Block) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	has, err := q.blockstore.Has(b.Key())
+	if err != nil {
+		return err
+	}
+	if has {
+		return nil // already stored and counted
+	}
+	size := uint64(len(b.Data))
+	if !q.fits(size) {
+		return ErrQuotaExceeded
+	}
+	if err := q.blockstore.Put(b); err != nil {
+		return err
+	}
+	q.blocks++
+	q.bytes += size
+	return nil
+}
+
+// PutMany puts the blocks not stored already, if they all fit. Otherwise it
+// fails with ErrQuotaExceeded and puts none of them.
+func (q *quota) PutMany(bls []*blocks.Block) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	var missing []*blocks.Block
+	var size uint64
+	seen := make(map[u.Key]struct{})
+	for _, b := range bls {
+		if _, ok := seen[b.Key()]; ok {
+			continue
+		}
+		seen[b.Key()] = struct{}{}
+
+		has, err := q.blockstore.Has(b.Key())
+		if err != nil {
+			return err
+		}
+		if !has {
+			missing = append(missing, b)
+			size += uint64(len(b.Data))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if !q.fits(size) {
+		return ErrQuotaExceeded
+	}
+	if err := q.blockstore.PutMany(missing); err != nil {
+		return err
+	}
+	q.blocks += len(missing)
+	q.bytes += size
+	return nil
+}
+
+// DeleteBlock reads the block before deleting it, to learn its size.
+func (q *quota) DeleteBlock(k u.Key) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	b, err := q.blockstore.Get(k)
+	if err == ErrNotFound {
+		return q.blockstore.DeleteBlock(k)
+	}
+	if err != nil {
+		return err
+	}
+	if err := q.blockstore.DeleteBlock(k); err != nil {
+		return err
+	}
+	q.blocks--
+	q.bytes -= uint64(len(b.Data))
+	return nil
+}
+
+func (q *quota) Has(k u.Key) (bool, error) {
+	return q.blockstore.Has(k)
+}
+
+func (q *quota) Get(k u.Key) (*blocks.Block, error) {
+	return q.blockstore.Get(k)
+}
+
+func (q *quota) AllKeys(ctx context.Context) ([]u.Key, error) {
+	return q.blockstore.AllKeysRange(ctx, 0, 0)
+}
+
+func (q *quota) AllKeysChan(ctx context.Context) (<-chan u.Key, error) {
+	return q.blockstore.AllKeysRangeChan(ctx, 0, 0)
+}
+
+func (q *quota) AllKeysRange(ctx context.Context, offset int, limit int) ([]u.Key, error) {
+	return q.blockstore.AllKeysRange(ctx, offset, limit)
+}
+
+func (q *quota) AllKeysRangeChan(ctx context.Context, offset int, limit int) (<-chan u.Key, error) {
+	return q.blockstore.AllKeysRangeChan(ctx, offset, limit)
+}
@@ -0,0 +1,84 @@
+package blockstore
+
+import (
+	"testing"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	syncds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	existing := blocks.NewBlock([]byte("existing"))
+	if err := bs.Put(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := Quota(ctx, bs, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCounts := func(n int, size uint64) {
+		if b, s := q.Counts(); b != n || s != size {
+			t.Fatalf("expected %d blocks of %d bytes, got %d blocks of %d bytes", n, size, b, s)
+		}
+	}
+	checkCounts(1, 8)
+
+	foo := blocks.NewBlock([]byte("foo"))
+	if err := q.Put(foo); err != nil {
+		t.Fatal(err)
+	}
+	// blocks already stored are not counted twice
+	if err := q.Put(foo); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(2, 11)
+
+	large := blocks.NewBlock([]byte("ten bytes!"))
+	if err := q.Put(large); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if has, _ := bs.Has(large.Key()); has {
+		t.Fatal("expected the block over the quota not to be stored")
+	}
+
+	// a batch over the quota is refused as a whole
+	bar := blocks.NewBlock([]byte("bar"))
+	if err := q.PutMany([]*blocks.Block{bar, large}); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if has, _ := bs.Has(bar.Key()); has {
+		t.Fatal("expected no block of the batch to be stored")
+	}
+	if err := q.PutMany([]*blocks.Block{foo, bar, bar}); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(3, 14)
+
+	// deleting makes room
+	if err := q.DeleteBlock(existing.Key()); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(2, 6)
+	if err := q.Put(large); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(3, 16)
+}
+
+func TestQuotaUnlimited(t *testing.T) {
+	q, err := Quota(context.Background(), NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore())), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Put(blocks.NewBlock(make([]byte, 1<<20))); err != nil {
+		t.Fatal(err)
+	}
+	if b, s := q.Counts(); b != 1 || s != 1<<20 {
+		t.Fatalf("expected 1 block of 1MiB, got %d blocks of %d bytes", b, s)
+	}
+}
@@ -0,0 +1,52 @@
+package blockstore
+
+import (
+	"errors"
+
+	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// ErrHashMismatch is returned by the blockstores returned by Verifying when
+// the data read for a block does not hash to its key.
+var ErrHashMismatch = errors.New("blockstore: block data does not match its key")
+
+// Verifying returns a blockstore rehashing the data of every block read from
+// bs, so that corrupt data is caught by Get, which fails with
+// ErrHashMismatch, instead of being passed on.
+func Verifying(bs Blockstore) Blockstore {
+	return &verifying{bs}
+}
+
+type verifying struct {
+	Blockstore
+}
+
+func (v *verifying) Get(k u.Key) (*blocks.Block, error) {
+	b, err := v.Blockstore.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	dh, err := mh.Decode(mh.Multihash(k))
+	if err != nil {
+		return nil, err
+	}
+	chk, err := mh.Sum(b.Data, dh.Code, dh.Length)
+	if err != nil {
+		return nil, err
+	}
+	if string(chk) != string(k) {
+		log.Errorf("blockstore: data read for block %s does not match its key", k)
+		return nil, ErrHashMismatch
+	}
+	return b, nil
+}
+
+// Flush flushes the wrapped blockstore, if it is a Flusher.
+func (v *verifying) Flush() error {
+	if f, ok := v.Blockstore.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package blockstore
+
+import (
+	"testing"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	syncds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+)
+
+func TestVerifyingGet(t *testing.T) {
+	d := ds.NewMapDatastore()
+	bs := Verifying(NewBlockstore(syncds.MutexWrap(d)))
+
+	good := blocks.NewBlock([]byte("good"))
+	if err := bs.Put(good); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(good.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the stored data
+	bad := blocks.NewBlock([]byte("bad"))
+	if err := d.Put(BlockPrefix.Child(bad.Key().DsKey()), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(bad.Key()); err != ErrHashMismatch {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+	if _, err := bs.Get(blocks.NewBlock([]byte("missing")).Key()); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -1,14 +1,37 @@
 package blockstore
 
 import (
+	"sync/atomic"
+
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/hashicorp/golang-lru"
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/jbenet/go-ipfs/blocks"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
+// Flusher is implemented by blockstores buffering writes. Flush makes the
+// blocks put so far durable.
+type Flusher interface {
+	Flush() error
+}
+
+// CachedBlockstore is the blockstore returned by WriteCached.
+type CachedBlockstore interface {
+	Blockstore
+
+	// Flush flushes the wrapped blockstore, if it is a Flusher. Writes are
+	// not held back by the cache itself, which only remembers the blocks
+	// written.
+	Flusher
+
+	// CacheStats returns how many of the Has and Put calls were answered by
+	// the cache, how many went to the wrapped blockstore, and the number of
+	// blocks currently cached.
+	CacheStats() (hits, misses, size int)
+}
+
 // WriteCached returns a blockstore that caches up to |size| unique writes (bs.Put).
-func WriteCached(bs Blockstore, size int) (Blockstore, error) {
+func WriteCached(bs Blockstore, size int) (CachedBlockstore, error) {
 	c, err := lru.New(size)
 	if err != nil {
 		return nil, err
@@ -17,17 +40,41 @@ func WriteCached(bs Blockstore, size int) (Blockstore, error) {
 }
 
 type writecache struct {
+	// accessed atomically, first for alignment
+	hits, misses int64
+
 	cache      *lru.Cache // pointer b/c Cache contains a Mutex as value (complicates copying)
 	blockstore Blockstore
 }
 
+// cached looks k up in the cache, counting the hit or miss.
+func (w *writecache) cached(k u.Key) bool {
+	if _, ok := w.cache.Get(k); ok {
+		atomic.AddInt64(&w.hits, 1)
+		return true
+	}
+	atomic.AddInt64(&w.misses, 1)
+	return false
+}
+
+func (w *writecache) Flush() error {
+	if f, ok := w.blockstore.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (w *writecache) CacheStats() (hits, misses, size int) {
+	return int(atomic.LoadInt64(&w.hits)), int(atomic.LoadInt64(&w.misses)), w.cache.Len()
+}
+
 func (w *writecache) DeleteBlock(k u.Key) error {
 	w.cache.Remove(k)
 	return w.blockstore.DeleteBlock(k)
 }
 
 func (w *writecache) Has(k u.Key) (bool, error) {
-	if _, ok := w.cache.Get(k); ok {
+	if w.cached(k) {
 		return true, nil
 	}
 	return w.blockstore.Has(k)
@@ -38,13 +85,33 @@ func (w *writecache) Get(k u.Key) (*blocks.Block, error) {
 }
 
 func (w *writecache) Put(b *blocks.Block) error {
-	if _, ok := w.cache.Get(b.Key()); ok {
+	if w.cached(b.Key()) {
 		return nil
 	}
 	w.cache.Add(b.Key(), struct{}{})
 	return w.blockstore.Put(b)
 }
 
+// PutMany puts the blocks that are not known to be stored already.
+func (w *writecache) PutMany(bs []*blocks.Block) error {
+	var missing []*blocks.Block
+	for _, b := range bs {
+		if !w.cached(b.Key()) {
+			missing = append(missing, b)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := w.blockstore.PutMany(missing); err != nil {
+		return err
+	}
+	for _, b := range missing {
+		w.cache.Add(b.Key(), struct{}{})
+	}
+	return nil
+}
+
 func (w *writecache) AllKeys(ctx context.Context) ([]u.Key, error) {
 	return w.blockstore.AllKeysRange(ctx, 0, 0)
 }
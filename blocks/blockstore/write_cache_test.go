@@ -57,6 +57,28 @@ func TestElideDuplicateWrite(t *testing.T) {
 	cachedbs.Put(b1)
 }
 
+func TestElideDuplicatePutMany(t *testing.T) {
+	cd := &callbackDatastore{f: func() {}, ds: ds.NewMapDatastore()}
+	bs := NewBlockstore(syncds.MutexWrap(cd))
+	cachedbs, err := WriteCached(bs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b1 := blocks.NewBlock([]byte("foo"))
+	b2 := blocks.NewBlock([]byte("bar"))
+
+	if err := cachedbs.PutMany([]*blocks.Block{b1, b2}); err != nil {
+		t.Fatal(err)
+	}
+	cd.SetFunc(func() {
+		t.Fatal("write hit the datastore")
+	})
+	if err := cachedbs.PutMany([]*blocks.Block{b1, b2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 type callbackDatastore struct {
 	f  func()
 	ds ds.Datastore
@@ -88,3 +110,55 @@ func (c *callbackDatastore) Query(q dsq.Query) (dsq.Results, error) {
 	c.f()
 	return c.ds.Query(q)
 }
+
+func TestCacheStats(t *testing.T) {
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	cachedbs, err := WriteCached(bs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b1 := blocks.NewBlock([]byte("foo"))
+	b2 := blocks.NewBlock([]byte("bar"))
+	cachedbs.Put(b1) // miss
+	cachedbs.Put(b1) // hit
+	cachedbs.Has(b1.Key())
+	cachedbs.Has(b2.Key()) // miss
+
+	if hits, misses, size := cachedbs.CacheStats(); hits != 2 || misses != 2 || size != 1 {
+		t.Fatalf("expected 2 hits, 2 misses and 1 cached block, got %d, %d and %d", hits, misses, size)
+	}
+}
+
+func TestFlushWrappedBlockstore(t *testing.T) {
+	fbs := &flushingBlockstore{Blockstore: NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))}
+	cachedbs, err := WriteCached(fbs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cachedbs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if fbs.flushes != 1 {
+		t.Fatal("wrapped blockstore not flushed")
+	}
+
+	// nothing to flush
+	cachedbs, err = WriteCached(NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore())), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cachedbs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type flushingBlockstore struct {
+	Blockstore
+	flushes int
+}
+
+func (f *flushingBlockstore) Flush() error {
+	f.flushes++
+	return nil
+}
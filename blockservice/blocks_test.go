@@ -2,6 +2,7 @@ package blockservice
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	blockstore "github.com/jbenet/go-ipfs/blocks/blockstore"
 	blocksutil "github.com/jbenet/go-ipfs/blocks/blocksutil"
 	offline "github.com/jbenet/go-ipfs/exchange/offline"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
@@ -91,3 +93,173 @@ func TestGetBlocksSequential(t *testing.T) {
 		}
 	}
 }
+
+func TestAddBlockTooLarge(t *testing.T) {
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs, err := New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	bs.MaxBlockSize = 16
+
+	small := blocks.NewBlock(make([]byte, 16))
+	if _, err := bs.AddBlock(small); err != nil {
+		t.Fatal(err)
+	}
+
+	large := blocks.NewBlock(make([]byte, 17))
+	_, err = bs.AddBlock(large)
+	if tle, ok := err.(*BlockTooLargeError); !ok || tle.Size != 17 || tle.Max != 16 {
+		t.Fatalf("expected a BlockTooLargeError, got %v", err)
+	}
+	if has, _ := bstore.Has(large.Key()); has {
+		t.Fatal("refused block was stored")
+	}
+
+	// blocks stored already remain readable
+	if err := bstore.Put(large); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := bs.GetBlock(ctx, large.Key()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetExchangeDuringAdds(t *testing.T) {
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs, err := New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for i := 0; i < 1000; i++ {
+			if _, err := bs.AddBlock(blocks.NewBlock([]byte(fmt.Sprint(i)))); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("adding while replacing the exchange failed: %s", err)
+			}
+			return
+		default:
+			bs.SetExchange(offline.Exchange(bstore))
+		}
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	servs := Mocks(t, 2)
+	for _, s := range servs {
+		defer s.Close()
+	}
+	missing := blocks.NewBlock([]byte("stored nowhere"))
+	present := blocks.NewBlock([]byte("stored by the first instance"))
+	if _, err := servs[0].AddBlock(present); err != nil {
+		t.Fatal(err)
+	}
+	bs := servs[1]
+	bs.FetchTimeout = 100 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		_, err := bs.GetBlock(context.Background(), missing.Key())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != ErrBlockNotFound {
+			t.Fatalf("expected ErrBlockNotFound, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetBlock did not give up on the missing block")
+	}
+
+	// a deadline of the caller overrides the timeout
+	bs.FetchTimeout = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := bs.GetBlock(ctx, missing.Key()); err == nil || err == ErrBlockNotFound {
+		t.Fatalf("expected the error of the context, got %v", err)
+	}
+
+	bs.FetchTimeout = 100 * time.Millisecond
+	var got []*blocks.Block
+	out := bs.GetBlocks(context.Background(), []u.Key{present.Key(), missing.Key()})
+	timeout := time.After(5 * time.Second)
+	for loop := true; loop; {
+		select {
+		case b, ok := <-out:
+			if !ok {
+				loop = false
+				break
+			}
+			got = append(got, b)
+		case <-timeout:
+			t.Fatal("GetBlocks did not give up on the missing block")
+		}
+	}
+	if len(got) != 1 || got[0].Key() != present.Key() {
+		t.Fatalf("expected only the present block, got %d blocks", len(got))
+	}
+}
+
+func TestGetBlockEvents(t *testing.T) {
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs, err := New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+
+	stored := blocks.NewBlock([]byte("stored"))
+	if _, err := bs.AddBlock(stored); err != nil {
+		t.Fatal(err)
+	}
+	missing := blocks.NewBlock([]byte("missing"))
+
+	var events []eventlog.Event
+	stop := eventlog.Observe(func(e eventlog.Event) {
+		if e.System == "blockservice" && e.Name == "getBlock" {
+			events = append(events, e)
+		}
+	})
+	defer stop()
+
+	if _, err := bs.GetBlock(context.Background(), stored.Key()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.GetBlock(context.Background(), missing.Key()); err == nil {
+		t.Fatal("expected the missing block not to be found")
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 getBlock events, got %d", len(events))
+	}
+	for i, b := range []*blocks.Block{stored, missing} {
+		md := events[i].Metadata
+		if md["key"] != b.Key().String() {
+			t.Fatalf("expected key %s, got %v", b.Key(), md["key"])
+		}
+		if _, ok := md["duration"].(time.Duration); !ok {
+			t.Fatal("getBlock event has no duration")
+		}
+	}
+	if events[0].Metadata["source"] != "local" {
+		t.Fatalf("expected the stored block to be local, got %v", events[0].Metadata["source"])
+	}
+	if events[1].Metadata["source"] != "network" || events[1].Metadata["error"] == nil {
+		t.Fatalf("expected a network error for the missing block, got %v", events[1].Metadata)
+	}
+}
@@ -6,12 +6,15 @@ package blockservice
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/jbenet/go-ipfs/blocks"
 	"github.com/jbenet/go-ipfs/blocks/blockstore"
 	worker "github.com/jbenet/go-ipfs/blockservice/worker"
 	exchange "github.com/jbenet/go-ipfs/exchange"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
@@ -32,9 +35,34 @@ var wc = worker.Config{
 	WorkerBufferSize: 0,
 }
 
-var log = u.Logger("blockservice")
+var log = eventlog.Logger("blockservice")
 var ErrNotFound = errors.New("blockservice: key not found")
 
+// ErrBlockNotFound is returned when a block could not be found on the
+// network within the FetchTimeout of the service.
+var ErrBlockNotFound = errors.New("blockservice: block not found on the network")
+
+// DefaultFetchTimeout is how long a new BlockService searches the network
+// for a block before giving up on it.
+const DefaultFetchTimeout = time.Minute
+
+// DefaultMaxBlockSize is the size in bytes above which a new BlockService
+// refuses to add blocks. Larger blocks are troublesome to transfer with
+// bitswap, and other peers may refuse them.
+const DefaultMaxBlockSize = 1024 * 1024
+
+// BlockTooLargeError is returned by AddBlock for blocks larger than the
+// MaxBlockSize of the service.
+type BlockTooLargeError struct {
+	Key  u.Key
+	Size int
+	Max  int
+}
+
+func (e *BlockTooLargeError) Error() string {
+	return fmt.Sprintf("blockservice: block %s is %d bytes, above the maximum block size of %d bytes", e.Key, e.Size, e.Max)
+}
+
 // BlockService is a hybrid block datastore. It stores data in a local
 // datastore and may retrieve data from a remote Exchange.
 // It uses an internal `datastore.Datastore` instance to store values.
@@ -43,7 +71,20 @@ type BlockService struct {
 	Blockstore blockstore.Blockstore
 	Exchange   exchange.Interface
 
+	// MaxBlockSize is the size in bytes above which AddBlock refuses blocks.
+	// Zero means no limit. Blocks already stored can be read whatever their
+	// size.
+	MaxBlockSize int
+
+	// FetchTimeout is how long GetBlock searches the exchange for a block,
+	// and GetBlocks waits for the next one, unless the context passed in has
+	// a deadline. Zero means waiting until the context is done.
+	FetchTimeout time.Duration
+
 	worker *worker.Worker
+
+	// guards Exchange and worker, which may be swapped out by SetExchange
+	lk sync.RWMutex
 }
 
 // NewBlockService creates a BlockService with given datastore instance.
@@ -56,9 +97,11 @@ func New(bs blockstore.Blockstore, rem exchange.Interface) (*BlockService, error
 	}
 
 	return &BlockService{
-		Blockstore: bs,
-		Exchange:   rem,
-		worker:     worker.NewWorker(rem, wc),
+		Blockstore:   bs,
+		Exchange:     rem,
+		MaxBlockSize: DefaultMaxBlockSize,
+		FetchTimeout: DefaultFetchTimeout,
+		worker:       worker.NewWorker(rem, wc),
 	}, nil
 }
 
@@ -66,29 +109,81 @@ func New(bs blockstore.Blockstore, rem exchange.Interface) (*BlockService, error
 // TODO pass a context into this if the remote.HasBlock is going to remain here.
 func (s *BlockService) AddBlock(b *blocks.Block) (u.Key, error) {
 	k := b.Key()
+	if s.MaxBlockSize > 0 && len(b.Data) > s.MaxBlockSize {
+		return "", &BlockTooLargeError{Key: k, Size: len(b.Data), Max: s.MaxBlockSize}
+	}
 	err := s.Blockstore.Put(b)
 	if err != nil {
 		return k, err
 	}
+	// held until the worker has the block, so SetExchange does not close
+	// the worker under us
+	s.lk.RLock()
+	defer s.lk.RUnlock()
 	if err := s.worker.HasBlock(b); err != nil {
 		return "", errors.New("blockservice is closed")
 	}
 	return k, nil
 }
 
+// AddBlocks adds many blocks to the service at once, with a single write to
+// the blockstore (see Blockstore.PutMany). If any block is above the
+// MaxBlockSize of the service, none is added.
+func (s *BlockService) AddBlocks(bs []*blocks.Block) ([]u.Key, error) {
+	keys := make([]u.Key, len(bs))
+	for i, b := range bs {
+		keys[i] = b.Key()
+		if s.MaxBlockSize > 0 && len(b.Data) > s.MaxBlockSize {
+			return nil, &BlockTooLargeError{Key: keys[i], Size: len(b.Data), Max: s.MaxBlockSize}
+		}
+	}
+	if err := s.Blockstore.PutMany(bs); err != nil {
+		return nil, err
+	}
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	for _, b := range bs {
+		if err := s.worker.HasBlock(b); err != nil {
+			return nil, errors.New("blockservice is closed")
+		}
+	}
+	return keys, nil
+}
+
 // GetBlock retrieves a particular block from the service,
 // Getting it from the datastore using the key (hash).
 func (s *BlockService) GetBlock(ctx context.Context, k u.Key) (*blocks.Block, error) {
+	return s.getBlock(ctx, k, s.exchange())
+}
+
+// getBlock gets a block like GetBlock, fetching it with exch if it is not
+// stored.
+func (s *BlockService) getBlock(ctx context.Context, k u.Key, exch exchange.Fetcher) (blk *blocks.Block, err error) {
 	log.Debugf("BlockService GetBlock: '%s'", k)
+	e := log.EventBegin(ctx, "getBlock", &k)
+	defer func() {
+		if err != nil {
+			e.SetError(err)
+		}
+		e.Done()
+	}()
+
 	block, err := s.Blockstore.Get(k)
 	if err == nil {
+		e.Append(eventlog.LoggableMap{"source": "local"})
 		return block, nil
 		// TODO be careful checking ErrNotFound. If the underlying
 		// implementation changes, this will break.
-	} else if err == blockstore.ErrNotFound && s.Exchange != nil {
+	} else if err == blockstore.ErrNotFound && exch != nil {
 		log.Debug("Blockservice: Searching bitswap.")
-		blk, err := s.Exchange.GetBlock(ctx, k)
+		e.Append(eventlog.LoggableMap{"source": "network"})
+		fetchCtx, cancel := s.fetchContext(ctx)
+		defer cancel()
+		blk, err := exch.GetBlock(fetchCtx, k)
 		if err != nil {
+			if ctx.Err() == nil && fetchCtx.Err() == context.DeadlineExceeded {
+				return nil, ErrBlockNotFound
+			}
 			return nil, err
 		}
 		return blk, nil
@@ -102,9 +197,22 @@ func (s *BlockService) GetBlock(ctx context.Context, k u.Key) (*blocks.Block, er
 // the returned channel.
 // NB: No guarantees are made about order.
 func (s *BlockService) GetBlocks(ctx context.Context, ks []u.Key) <-chan *blocks.Block {
+	return s.getBlocks(ctx, ks, s.exchange())
+}
+
+// getBlocks gets blocks like GetBlocks, fetching the ones that are not
+// stored with exch.
+func (s *BlockService) getBlocks(ctx context.Context, ks []u.Key, exch exchange.Fetcher) <-chan *blocks.Block {
 	out := make(chan *blocks.Block, 0)
 	go func() {
 		defer close(out)
+		e := log.EventBegin(ctx, "getBlocks", eventlog.LoggableMap{"keys": len(ks)})
+		fetched := 0
+		defer func() {
+			e.Append(eventlog.LoggableMap{"fetched": fetched})
+			e.Done()
+		}()
+
 		var misses []u.Key
 		for _, k := range ks {
 			hit, err := s.Blockstore.Get(k)
@@ -120,13 +228,43 @@ func (s *BlockService) GetBlocks(ctx context.Context, ks []u.Key) <-chan *blocks
 			}
 		}
 
-		rblocks, err := s.Exchange.GetBlocks(ctx, misses)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		rblocks, err := exch.GetBlocks(ctx, misses)
 		if err != nil {
 			log.Debugf("Error with GetBlocks: %s", err)
+			e.SetError(err)
 			return
 		}
 
-		for b := range rblocks {
+		// give up on the remaining blocks once none arrives for a whole
+		// FetchTimeout
+		_, hasDeadline := ctx.Deadline()
+		for {
+			var timeout <-chan time.Time
+			var timer *time.Timer
+			if !hasDeadline && s.FetchTimeout > 0 {
+				timer = time.NewTimer(s.FetchTimeout)
+				timeout = timer.C
+			}
+
+			var b *blocks.Block
+			var ok bool
+			select {
+			case b, ok = <-rblocks:
+			case <-timeout:
+				log.Debugf("Blockservice GetBlocks: no block found within %s", s.FetchTimeout)
+			case <-ctx.Done():
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			if !ok {
+				return
+			}
+			fetched++
+			log.Event(ctx, "blockFetched", b)
+
 			select {
 			case out <- b:
 			case <-ctx.Done():
@@ -137,12 +275,69 @@ func (s *BlockService) GetBlocks(ctx context.Context, ks []u.Key) <-chan *blocks
 	return out
 }
 
+// Session gets blocks like the BlockService it belongs to, but fetches them
+// within one session of the exchange, if it supports sessions (see
+// exchange.SessionExchange). Use a session for related blocks, e.g. the
+// blocks of one file.
+type Session struct {
+	bs   *BlockService
+	exch exchange.Fetcher
+}
+
+// NewSession returns a Session of the BlockService, which ends with ctx.
+func (s *BlockService) NewSession(ctx context.Context) *Session {
+	exch := s.exchange()
+	if se, ok := exch.(exchange.SessionExchange); ok {
+		return &Session{bs: s, exch: se.NewSession(ctx)}
+	}
+	return &Session{bs: s, exch: exch}
+}
+
+func (ss *Session) GetBlock(ctx context.Context, k u.Key) (*blocks.Block, error) {
+	return ss.bs.getBlock(ctx, k, ss.exch)
+}
+
+func (ss *Session) GetBlocks(ctx context.Context, ks []u.Key) <-chan *blocks.Block {
+	return ss.bs.getBlocks(ctx, ks, ss.exch)
+}
+
+// fetchContext returns the context to search the exchange for a block with:
+// ctx, bounded by the FetchTimeout unless it has a deadline already.
+func (s *BlockService) fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || s.FetchTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.FetchTimeout)
+}
+
 // DeleteBlock deletes a block in the blockservice from the datastore
 func (s *BlockService) DeleteBlock(k u.Key) error {
 	return s.Blockstore.DeleteBlock(k)
 }
 
+// SetExchange replaces the exchange used to fetch and announce blocks. It
+// waits for the adds in flight to hand their blocks over, then closes the
+// worker announcing added blocks through the previous exchange, dropping
+// the announcements it has not made yet. Fetches already in flight complete
+// through the previous exchange. The exchange itself is left open: it is
+// up to the caller to close it.
+func (s *BlockService) SetExchange(rem exchange.Interface) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.worker.Close()
+	s.Exchange = rem
+	s.worker = worker.NewWorker(rem, wc)
+}
+
+func (s *BlockService) exchange() exchange.Interface {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.Exchange
+}
+
 func (s *BlockService) Close() error {
 	log.Debug("blockservice is shutting down...")
+	s.lk.RLock()
+	defer s.lk.RUnlock()
 	return s.worker.Close()
 }
@@ -100,13 +100,24 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 	// sure we are permitted to access the resources (datastore, etc.)
 	repo := fsrepo.At(req.Context().ConfigRoot)
 	if err := repo.Open(); err != nil {
-		res.SetError(debugerror.Errorf("Couldn't obtain lock. Is another daemon already running?"), cmds.ErrNormal)
+		switch err {
+		case fsrepo.ErrRepoLocked:
+			err = debugerror.Errorf("Couldn't obtain lock. Is another daemon already running?")
+			if pid, _ := fsrepo.LockStatus(req.Context().ConfigRoot); pid != 0 {
+				err = debugerror.Errorf("Couldn't obtain lock. Is another daemon already running? The lock is held by process %d.", pid)
+			}
+		case fsrepo.ErrStaleLock:
+			pid, _ := fsrepo.LockStatus(req.Context().ConfigRoot)
+			err = debugerror.Errorf("The repo lock was left behind by process %d, which is no longer running. Remove the lock in %s to start the daemon.", pid, req.Context().ConfigRoot)
+		}
+		res.SetError(err, cmds.ErrNormal)
 		return
 	}
 
 	// Start assembling corebuilder
 	nb := core.NewNodeBuilder().Online()
 	nb.SetRepo(repo)
+	nb.SetPassphrase(envPassphrase)
 
 	routingOption, _, err := req.Option(routingOptionKwd).String()
 	if err != nil {
@@ -256,3 +267,13 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 }
+
+// envPassphrase reads the passphrase of an encrypted private key from the
+// environment.
+func envPassphrase() (string, error) {
+	pass := os.Getenv(EnvPassphrase)
+	if pass == "" {
+		return "", debugerror.Errorf("the private key is encrypted, set %s to its passphrase", EnvPassphrase)
+	}
+	return pass, nil
+}
@@ -36,6 +36,7 @@ var errHelpRequested = errors.New("Help Requested")
 
 const (
 	EnvEnableProfiling = "IPFS_PROF"
+	EnvPassphrase      = "IPFS_PASSPHRASE"
 	cpuProfile         = "ipfs.cpuprof"
 	heapProfile        = "ipfs.memprof"
 	errorFormat        = "ERROR: %v\n\n"
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"io"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	files "github.com/jbenet/go-ipfs/commands/files"
+	adder "github.com/jbenet/go-ipfs/importer/adder"
+	chunk "github.com/jbenet/go-ipfs/importer/chunk"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// AddStats tells how many of the blocks of an add were new to the blockstore,
+// and how many were already stored, e.g. by an earlier add of the same data.
+type AddStats adder.Stats
+
+// AddReader chunks the data read from r into a unixfs file, stores it and
+// pins it recursively, returning the key of its root and how much of it was
+// newly stored. The data is streamed:
+// only the chunks being assembled are held in memory, however long r is.
+//
+// If reading r fails or ctx is cancelled before the whole file is added,
+// nothing is pinned, and the blocks stored so far are left for the garbage
+// collector.
+func (n *IpfsNode) AddReader(ctx context.Context, r io.Reader) (u.Key, AddStats, error) {
+	return n.add(func(a *adder.Adder) (*merkledag.Node, adder.Stats, error) {
+		return a.AddReader(ctx, r)
+	})
+}
+
+// AddDirectory adds the tree of files yielded by dir, like AddReader does
+// for a single file, and returns the key of its root. Every directory is
+// stored as a single unixfs directory node linking to its entries by name.
+// Entries reporting a symlink mode through files.StatFile are stored as
+// unixfs symlinks to the target read from the filesystem.
+func (n *IpfsNode) AddDirectory(ctx context.Context, dir files.File) (u.Key, AddStats, error) {
+	return n.add(func(a *adder.Adder) (*merkledag.Node, adder.Stats, error) {
+		return a.AddFile(ctx, dir)
+	})
+}
+
+// AddPath adds the file or directory at root from the local filesystem like
+// AddDirectory, leaving out the entries whose name matches any of the ignore
+// patterns (see path.Match). Symlinks are stored as such, not followed, and
+// special files such as devices and named pipes are skipped.
+func (n *IpfsNode) AddPath(ctx context.Context, root string, ignore []string) (u.Key, AddStats, error) {
+	return n.add(func(a *adder.Adder) (*merkledag.Node, adder.Stats, error) {
+		return a.AddPath(ctx, root, ignore)
+	})
+}
+
+// Adder returns an adder storing into the node's DAG and pinning with its
+// pinner, cutting chunks to the maximum block size of the node. Adds through
+// it must hold the PinLock.
+func (n *IpfsNode) Adder() *adder.Adder {
+	return &adder.Adder{
+		DAG:        n.DAG,
+		Blockstore: n.Blockstore,
+		Pinner:     n.Pinning,
+
+		MaxBlockSize: n.Blocks.MaxBlockSize,
+	}
+}
+
+// CapSplitter returns spl, cutting its chunks to fit in the largest blocks
+// the node takes.
+func (n *IpfsNode) CapSplitter(spl chunk.BlockSplitter) chunk.BlockSplitter {
+	if n.Blocks.MaxBlockSize <= 0 {
+		return spl
+	}
+	return chunk.Cap(spl, chunk.MaxSizeFor(n.Blocks.MaxBlockSize))
+}
+
+// add runs addFunc with the node's adder, holding the PinLock.
+func (n *IpfsNode) add(addFunc func(*adder.Adder) (*merkledag.Node, adder.Stats, error)) (u.Key, AddStats, error) {
+	// added blocks must survive until the pin is recorded
+	defer n.PinLock()()
+
+	root, stats, err := addFunc(n.Adder())
+	if err != nil {
+		return "", AddStats{}, err
+	}
+	k, err := root.Key()
+	return k, AddStats(stats), err
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	path "github.com/jbenet/go-ipfs/path"
+	repo "github.com/jbenet/go-ipfs/repo"
+	config "github.com/jbenet/go-ipfs/repo/config"
+	ft "github.com/jbenet/go-ipfs/unixfs"
+	uio "github.com/jbenet/go-ipfs/unixfs/io"
+	ftpb "github.com/jbenet/go-ipfs/unixfs/pb"
+	u "github.com/jbenet/go-ipfs/util"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+// failingReader fails after reading the data in it
+type failingReader struct {
+	r io.Reader
+}
+
+var errRead = errors.New("read failed")
+
+func (fr failingReader) Read(b []byte) (int, error) {
+	n, err := fr.r.Read(b)
+	if err == io.EOF {
+		return n, errRead
+	}
+	return n, err
+}
+
+func TestAddReader(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), 1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, stats, err := n.AddReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, mode, _ := n.IsPinned(k); mode != "recursive" {
+		t.Fatalf("expected a recursive pin, got %q", mode)
+	}
+	root, err := n.DAG.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := uio.ReadAll(ctx, root, n.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("read back the wrong data")
+	}
+
+	stored, err := n.Blockstore.AllKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NewBlocks != len(stored) || stats.NewBytes < uint64(len(data)) || stats.ExistingBlocks != 0 {
+		t.Fatalf("wrong stats for a new file: %+v", stats)
+	}
+
+	// adding it again stores nothing new
+	k2, again, err := n.AddReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k2 != k {
+		t.Fatal("the same data was added under another key")
+	}
+	if again.NewBlocks != 0 || again.ExistingBlocks != stats.NewBlocks || again.ExistingBytes != stats.NewBytes {
+		t.Fatalf("wrong stats for a file added again: %+v", again)
+	}
+
+	// a failed add pins nothing, so collecting garbage removes its blocks
+	// and keeps the ones stored before
+	more, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), 1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := io.MultiReader(bytes.NewReader(data[:512*1024]), bytes.NewReader(more))
+	if _, _, err := n.AddReader(ctx, failingReader{src}); err != errRead {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	if _, err := n.GarbageCollect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after, err := n.Blockstore.AllKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(stored) {
+		t.Fatalf("expected %d blocks after collecting a failed add, got %d", len(stored), len(after))
+	}
+	if _, err := uio.ReadAll(ctx, root, n.LocalDAG()); err != nil {
+		t.Fatal("a failed add removed blocks of an earlier one")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := n.AddReader(cctx, bytes.NewReader(more)); err != context.Canceled {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
+
+func TestAddPath(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "addpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// large enough to span several blocks
+	big, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), 600*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"big":       big,
+		"sub/small": []byte("small"),
+		"skip.tmp":  []byte("ignored"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("sub/small", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nowhere", filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := n.AddPath(ctx, dir, []string{"[x"}); err == nil {
+		t.Fatal("expected a malformed pattern to fail")
+	}
+	k, _, err := n.AddPath(ctx, dir, []string{"*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, mode, _ := n.IsPinned(k); mode != "recursive" {
+		t.Fatalf("expected a recursive pin, got %q", mode)
+	}
+
+	root, err := n.DAG.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, l := range root.Links {
+		names = append(names, l.Name)
+	}
+	if strings.Join(names, " ") != "big dangling link sub" {
+		t.Fatalf("wrong directory entries: %v", names)
+	}
+
+	read := func(p string) []byte {
+		nd, err := n.Resolver.ResolvePath(context.Background(), path.Path(k.B58String()+"/"+p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := uio.ReadAll(ctx, nd, n.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if !bytes.Equal(read("big"), big) {
+		t.Fatal("read back the wrong data")
+	}
+	if string(read("sub/small")) != "small" {
+		t.Fatal("read back the wrong data")
+	}
+
+	link, err := n.Resolver.ResolvePath(context.Background(), path.Path(k.B58String()+"/link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := ft.FromBytes(link.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb.GetType() != ftpb.Data_Symlink || string(pb.GetData()) != "sub/small" {
+		t.Fatal("expected the symlink to be stored as such")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := n.AddPath(cctx, dir, nil); err != context.Canceled {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
+
+func TestAddUnderBlockSizeLimit(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity:  testIdentity,
+			Datastore: config.Datastore{MaxBlockSize: 256 * 1024},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// default chunks would not fit in the blocks along with their framing
+	data, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), 1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, _, err := n.AddReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := n.DAG.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Links) < 5 {
+		t.Fatalf("expected the file to be cut in at least 5 chunks, got %d", len(root.Links))
+	}
+	out, err := uio.ReadAll(ctx, root, n.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("read back the wrong data")
+	}
+}
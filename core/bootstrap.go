@@ -26,6 +26,14 @@ import (
 // peers to bootstrap correctly.
 var ErrNotEnoughBootstrapPeers = errors.New("not enough bootstrap peers to bootstrap")
 
+// ErrNotBootstrapped signals that the node is offline or has not been
+// asked to bootstrap, so there is nothing to wait for.
+var ErrNotBootstrapped = errors.New("node is not bootstrapping")
+
+// bootstrapPollInterval is how often WaitForBootstrap checks the number of
+// connected peers.
+const bootstrapPollInterval = 100 * time.Millisecond
+
 // BootstrapConfig specifies parameters used in an IpfsNode's network
 // bootstrapping process.
 type BootstrapConfig struct {
@@ -2,6 +2,9 @@ package core
 
 import (
 	"testing"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	peer "github.com/jbenet/go-ipfs/p2p/peer"
 	testutil "github.com/jbenet/go-ipfs/util/testutil"
@@ -23,3 +26,46 @@ func TestSubsetWhenMaxIsGreaterThanLengthOfSlice(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestWaitForBootstrap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	cfg := BootstrapConfigWithPeers(nil)
+	cfg.MinPeerThreshold = 0
+	if err := n.Bootstrap(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.WaitForBootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// there is nobody to connect to, so this should time out
+	cfg.MinPeerThreshold = 1
+	if err := n.Bootstrap(cfg); err != nil {
+		t.Fatal(err)
+	}
+	tctx, tcancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer tcancel()
+	if err := n.WaitForBootstrap(tctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// going offline ends the wait
+	errs := make(chan error, 1)
+	go func() {
+		errs <- n.WaitForBootstrap(ctx)
+	}()
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != ErrNotBootstrapped {
+		t.Fatalf("expected ErrNotBootstrapped, got %v", err)
+	}
+	if err := n.WaitForBootstrap(ctx); err != ErrNotBootstrapped {
+		t.Fatalf("expected ErrNotBootstrapped, got %v", err)
+	}
+}
@@ -16,15 +16,20 @@ type NodeBuilder struct {
 	online   bool
 	routing  RoutingOption
 	peerhost HostOption
+	hostcfg  ConfiguredHostOption
+	pinner   PinnerOption
+	bstore   BlockstoreOption
 	repo     repo.Repo
+	pass     PassphraseFunc
 	built    bool
 }
 
 func NewNodeBuilder() *NodeBuilder {
 	return &NodeBuilder{
-		online:   false,
-		routing:  DHTOption,
-		peerhost: DefaultHostOption,
+		online:  false,
+		routing: DHTOption,
+		pinner:  DefaultPinnerOption,
+		bstore:  DefaultBlockstoreOption,
 	}
 }
 
@@ -51,6 +56,32 @@ func (nb *NodeBuilder) SetRouting(ro RoutingOption) *NodeBuilder {
 
 func (nb *NodeBuilder) SetHost(ho HostOption) *NodeBuilder {
 	nb.peerhost = ho
+	nb.hostcfg = nil
+	return nb
+}
+
+// SetConfiguredHost sets the host option to construct the peer host with,
+// as set up in the Swarm section of the config.
+func (nb *NodeBuilder) SetConfiguredHost(ho ConfiguredHostOption) *NodeBuilder {
+	nb.hostcfg = ho
+	nb.peerhost = nil
+	return nb
+}
+
+func (nb *NodeBuilder) SetPinner(po PinnerOption) *NodeBuilder {
+	nb.pinner = po
+	return nb
+}
+
+func (nb *NodeBuilder) SetBlockstore(bo BlockstoreOption) *NodeBuilder {
+	nb.bstore = bo
+	return nb
+}
+
+// SetPassphrase sets how the passphrase of an encrypted private key is
+// obtained.
+func (nb *NodeBuilder) SetPassphrase(pf PassphraseFunc) *NodeBuilder {
+	nb.pass = pf
 	return nb
 }
 
@@ -67,6 +98,13 @@ func (nb *NodeBuilder) Build(ctx context.Context) (*IpfsNode, error) {
 	if nb.repo == nil {
 		nb.repo = defaultRepo()
 	}
-	conf := standardWithRouting(nb.repo, nb.online, nb.routing, nb.peerhost)
+	hostOption := nb.hostcfg
+	if hostOption == nil {
+		hostOption = DefaultConfiguredHostOption
+		if nb.peerhost != nil {
+			hostOption = nb.peerhost.Configured()
+		}
+	}
+	conf := standardWithRouting(nb.repo, nb.online, nb.routing, hostOption, nb.pinner, nb.bstore, nb.pass)
 	return NewIPFSNode(ctx, conf)
 }
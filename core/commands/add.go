@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"path"
@@ -14,7 +13,6 @@ import (
 	importer "github.com/jbenet/go-ipfs/importer"
 	"github.com/jbenet/go-ipfs/importer/chunk"
 	dag "github.com/jbenet/go-ipfs/merkledag"
-	pinning "github.com/jbenet/go-ipfs/pin"
 	ft "github.com/jbenet/go-ipfs/unixfs"
 	u "github.com/jbenet/go-ipfs/util"
 
@@ -30,6 +28,7 @@ const progressReaderIncrement = 1024 * 256
 const (
 	progressOptionName = "progress"
 	wrapOptionName     = "wrap-with-directory"
+	chunkerOptionName  = "chunker"
 )
 
 type AddedObject struct {
@@ -58,6 +57,7 @@ remains to be implemented.
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data"),
 		cmds.BoolOption(wrapOptionName, "w", "Wrap files with a directory object"),
 		cmds.BoolOption("t", "trickle", "Use trickle-dag format for dag generation"),
+		cmds.StringOption(chunkerOptionName, "s", "Chunking algorithm to use: size-<bytes>, rabin or rabin-<avg bytes>"),
 	},
 	PreRun: func(req cmds.Request) error {
 		if quiet, _, _ := req.Option("quiet").Bool(); quiet {
@@ -91,6 +91,14 @@ remains to be implemented.
 
 		progress, _, _ := req.Option(progressOptionName).Bool()
 		wrap, _, _ := req.Option(wrapOptionName).Bool()
+		chunker, _, _ := req.Option(chunkerOptionName).String()
+
+		spl, err := chunk.FromString(chunker)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		spl = n.CapSplitter(spl)
 
 		outChan := make(chan interface{})
 		res.SetOutput((<-chan interface{})(outChan))
@@ -98,13 +106,16 @@ remains to be implemented.
 		go func() {
 			defer close(outChan)
 
+			// keep the garbage collector away until everything is pinned
+			defer n.PinLock()()
+
 			for {
 				file, err := req.Files().NextFile()
 				if (err != nil && err != io.EOF) || file == nil {
 					return
 				}
 
-				_, err = addFile(n, file, outChan, progress, wrap)
+				_, err = addFile(n, file, outChan, progress, wrap, spl)
 				if err != nil {
 					return
 				}
@@ -197,16 +208,13 @@ remains to be implemented.
 	Type: AddedObject{},
 }
 
-func add(n *core.IpfsNode, readers []io.Reader) ([]*dag.Node, error) {
-	mp, ok := n.Pinning.(pinning.ManualPinner)
-	if !ok {
-		return nil, errors.New("invalid pinner type! expected manual pinner")
-	}
+func add(n *core.IpfsNode, readers []io.Reader, spl chunk.BlockSplitter) ([]*dag.Node, error) {
+	mp := n.Pinning.GetManual()
 
 	dagnodes := make([]*dag.Node, 0)
 
 	for _, reader := range readers {
-		node, err := importer.BuildDagFromReader(reader, n.DAG, mp, chunk.DefaultSplitter)
+		node, err := importer.BuildDagFromReader(reader, n.DAG, mp, spl)
 		if err != nil {
 			return nil, err
 		}
@@ -235,9 +243,9 @@ func addNode(n *core.IpfsNode, node *dag.Node) error {
 	return nil
 }
 
-func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress bool, wrap bool) (*dag.Node, error) {
+func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress bool, wrap bool, spl chunk.BlockSplitter) (*dag.Node, error) {
 	if file.IsDirectory() {
-		return addDir(n, file, out, progress)
+		return addDir(n, file, out, progress, spl)
 	}
 
 	// if the progress flag was specified, wrap the file so that we can send
@@ -248,7 +256,7 @@ func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress b
 	}
 
 	if wrap {
-		p, dagnode, err := coreunix.AddWrapped(n, reader, path.Base(file.FileName()))
+		p, dagnode, err := coreunix.AddWrappedWithSplitter(n, reader, path.Base(file.FileName()), spl)
 		if err != nil {
 			return nil, err
 		}
@@ -259,7 +267,7 @@ func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress b
 		return dagnode, nil
 	}
 
-	dns, err := add(n, []io.Reader{reader})
+	dns, err := add(n, []io.Reader{reader}, spl)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +279,7 @@ func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress b
 	return dns[len(dns)-1], nil // last dag node is the file.
 }
 
-func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress bool) (*dag.Node, error) {
+func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress bool, spl chunk.BlockSplitter) (*dag.Node, error) {
 	log.Infof("adding directory: %s", dir.FileName())
 
 	tree := &dag.Node{Data: ft.FolderPBData()}
@@ -285,7 +293,7 @@ func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress boo
 			break
 		}
 
-		node, err := addFile(n, file, out, progress, false)
+		node, err := addFile(n, file, out, progress, false, spl)
 		if err != nil {
 			return nil, err
 		}
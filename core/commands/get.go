@@ -16,6 +16,7 @@ import (
 	utar "github.com/jbenet/go-ipfs/unixfs/tar"
 
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
 var ErrInvalidCompressionLevel = errors.New("Compression level must be between 1 and 9")
@@ -62,7 +63,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 
-		reader, err := get(node, req.Arguments()[0], cmplvl)
+		reader, err := get(req.Context().Context, node, req.Arguments()[0], cmplvl)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -165,6 +166,6 @@ func getCompressOptions(req cmds.Request) (int, error) {
 	return gzip.NoCompression, nil
 }
 
-func get(node *core.IpfsNode, p string, compression int) (io.Reader, error) {
-	return utar.NewReader(path.Path(p), node.DAG, node.Resolver, compression)
+func get(ctx context.Context, node *core.IpfsNode, p string, compression int) (io.Reader, error) {
+	return utar.NewReader(ctx, path.Path(p), node.DAG, node.Resolver, compression)
 }
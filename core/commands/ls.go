@@ -53,7 +53,7 @@ it contains, with the following format:
 
 		dagnodes := make([]*merkledag.Node, 0)
 		for _, fpath := range paths {
-			dagnode, err := node.Resolver.ResolvePath(path.Path(fpath))
+			dagnode, err := node.Resolver.ResolvePath(req.Context().Context, path.Path(fpath))
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
@@ -68,7 +68,7 @@ it contains, with the following format:
 				Links: make([]Link, len(dagnode.Links)),
 			}
 			for j, link := range dagnode.Links {
-				link.Node, err = link.GetNode(node.DAG)
+				link.Node, err = link.GetNode(req.Context().Context, node.DAG)
 				if err != nil {
 					res.SetError(err, cmds.ErrNormal)
 					return
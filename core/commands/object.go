@@ -12,6 +12,7 @@ import (
 
 	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	cmds "github.com/jbenet/go-ipfs/commands"
 	core "github.com/jbenet/go-ipfs/core"
 	dag "github.com/jbenet/go-ipfs/merkledag"
@@ -81,7 +82,7 @@ output is the raw data of the object.
 		}
 
 		fpath := path.Path(req.Arguments()[0])
-		output, err := objectData(n, fpath)
+		output, err := objectData(req.Context().Context, n, fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -111,7 +112,7 @@ multihash.
 		}
 
 		fpath := path.Path(req.Arguments()[0])
-		output, err := objectLinks(n, fpath)
+		output, err := objectLinks(req.Context().Context, n, fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -163,7 +164,7 @@ This command outputs data in the following encodings:
 
 		fpath := path.Path(req.Arguments()[0])
 
-		object, err := objectGet(n, fpath)
+		object, err := objectGet(req.Context().Context, n, fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -229,7 +230,7 @@ var objectStatCmd = &cmds.Command{
 
 		fpath := path.Path(req.Arguments()[0])
 
-		object, err := objectGet(n, fpath)
+		object, err := objectGet(req.Context().Context, n, fpath)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -322,8 +323,8 @@ Data should be in the format specified by <encoding>.
 }
 
 // objectData takes a key string and writes out the raw bytes of that node (if there is one)
-func objectData(n *core.IpfsNode, fpath path.Path) (io.Reader, error) {
-	dagnode, err := n.Resolver.ResolvePath(fpath)
+func objectData(ctx context.Context, n *core.IpfsNode, fpath path.Path) (io.Reader, error) {
+	dagnode, err := n.Resolver.ResolvePath(ctx, fpath)
 	if err != nil {
 		return nil, err
 	}
@@ -334,8 +335,8 @@ func objectData(n *core.IpfsNode, fpath path.Path) (io.Reader, error) {
 }
 
 // objectLinks takes a key string and lists the links it points to
-func objectLinks(n *core.IpfsNode, fpath path.Path) (*Object, error) {
-	dagnode, err := n.Resolver.ResolvePath(fpath)
+func objectLinks(ctx context.Context, n *core.IpfsNode, fpath path.Path) (*Object, error) {
+	dagnode, err := n.Resolver.ResolvePath(ctx, fpath)
 	if err != nil {
 		return nil, err
 	}
@@ -346,8 +347,8 @@ func objectLinks(n *core.IpfsNode, fpath path.Path) (*Object, error) {
 }
 
 // objectGet takes a key string from args and a format option and serializes the dagnode to that format
-func objectGet(n *core.IpfsNode, fpath path.Path) (*dag.Node, error) {
-	dagnode, err := n.Resolver.ResolvePath(fpath)
+func objectGet(ctx context.Context, n *core.IpfsNode, fpath path.Path) (*dag.Node, error) {
+	dagnode, err := n.Resolver.ResolvePath(ctx, fpath)
 	if err != nil {
 		return nil, err
 	}
@@ -183,7 +183,7 @@ ipfs swarm connect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3
 		for i, pi := range pis {
 			output[i] = "connect " + pi.ID.Pretty()
 
-			err := n.PeerHost.Connect(ctx, pi)
+			err := n.Connect(ctx, pi)
 			if err != nil {
 				output[i] += " failure: " + err.Error()
 			} else {
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bsmsg "github.com/jbenet/go-ipfs/exchange/bitswap/message"
+	bsnet "github.com/jbenet/go-ipfs/exchange/bitswap/network"
+	p2phost "github.com/jbenet/go-ipfs/p2p/host"
+	connmgr "github.com/jbenet/go-ipfs/p2p/net/connmgr"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	debugerror "github.com/jbenet/go-ipfs/util/debugerror"
+)
+
+// startConnManager limits the connections of the host as specified in the
+// config. Bootstrap peers are never disconnected from. No connection manager
+// is started if the high watermark is zero.
+func (n *IpfsNode) startConnManager(host p2phost.Host) error {
+	cfg := n.Repo.Config().ConnMgr
+	if cfg.HighWater <= 0 {
+		return nil
+	}
+	if cfg.LowWater < 0 || cfg.LowWater >= cfg.HighWater {
+		return debugerror.Errorf("ConnMgr.LowWater (%d) must be between 0 and ConnMgr.HighWater (%d)", cfg.LowWater, cfg.HighWater)
+	}
+
+	var grace time.Duration
+	if cfg.GracePeriod != "" {
+		var err error
+		grace, err = time.ParseDuration(cfg.GracePeriod)
+		if err != nil {
+			return debugerror.Errorf("invalid ConnMgr.GracePeriod in config: %s", err)
+		}
+	}
+
+	bootstrap, err := n.Repo.Config().BootstrapPeers()
+	if err != nil {
+		return err
+	}
+
+	cm := connmgr.New(host.Network(), cfg.LowWater, cfg.HighWater, grace)
+	for _, bp := range bootstrap {
+		cm.Protect(bp.ID())
+	}
+	n.ConnManager = cm
+	return nil
+}
+
+// usefulPeerNetwork is a bitswap network telling the connection manager
+// about the peers we exchange blocks with.
+type usefulPeerNetwork struct {
+	bsnet.BitSwapNetwork
+	cm *connmgr.ConnManager
+}
+
+func (un *usefulPeerNetwork) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	if len(msg.Blocks()) > 0 {
+		un.cm.TagUseful(p)
+	}
+	return un.BitSwapNetwork.SendMessage(ctx, p, msg)
+}
+
+func (un *usefulPeerNetwork) SetDelegate(r bsnet.Receiver) {
+	un.BitSwapNetwork.SetDelegate(&usefulPeerReceiver{r, un.cm})
+}
+
+type usefulPeerReceiver struct {
+	bsnet.Receiver
+	cm *connmgr.ConnManager
+}
+
+func (ur *usefulPeerReceiver) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg.BitSwapMessage) (peer.ID, bsmsg.BitSwapMessage) {
+	if len(incoming.Blocks()) > 0 {
+		ur.cm.TagUseful(p)
+	}
+	return ur.Receiver.ReceiveMessage(ctx, p, incoming)
+}
@@ -3,8 +3,12 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
+	"sync"
 	"time"
 
 	b58 "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
@@ -19,15 +23,22 @@ import (
 	ic "github.com/jbenet/go-ipfs/p2p/crypto"
 	p2phost "github.com/jbenet/go-ipfs/p2p/host"
 	p2pbhost "github.com/jbenet/go-ipfs/p2p/host/basic"
+	meteredhost "github.com/jbenet/go-ipfs/p2p/host/metered"
 	rhost "github.com/jbenet/go-ipfs/p2p/host/routed"
+	connmgr "github.com/jbenet/go-ipfs/p2p/net/connmgr"
+	filter "github.com/jbenet/go-ipfs/p2p/net/filter"
 	swarm "github.com/jbenet/go-ipfs/p2p/net/swarm"
 	addrutil "github.com/jbenet/go-ipfs/p2p/net/swarm/addr"
 	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	protocol "github.com/jbenet/go-ipfs/p2p/protocol"
 
 	routing "github.com/jbenet/go-ipfs/routing"
 	dht "github.com/jbenet/go-ipfs/routing/dht"
+	nilrouting "github.com/jbenet/go-ipfs/routing/none"
 	offroute "github.com/jbenet/go-ipfs/routing/offline"
+	tiered "github.com/jbenet/go-ipfs/routing/tiered"
 
+	blocks "github.com/jbenet/go-ipfs/blocks"
 	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
 	bserv "github.com/jbenet/go-ipfs/blockservice"
 	exchange "github.com/jbenet/go-ipfs/exchange"
@@ -37,12 +48,14 @@ import (
 	rp "github.com/jbenet/go-ipfs/exchange/reprovide"
 
 	mount "github.com/jbenet/go-ipfs/fuse/mount"
+	keystore "github.com/jbenet/go-ipfs/keystore"
 	merkledag "github.com/jbenet/go-ipfs/merkledag"
 	namesys "github.com/jbenet/go-ipfs/namesys"
 	path "github.com/jbenet/go-ipfs/path"
 	pin "github.com/jbenet/go-ipfs/pin"
 	repo "github.com/jbenet/go-ipfs/repo"
 	config "github.com/jbenet/go-ipfs/repo/config"
+	u "github.com/jbenet/go-ipfs/util"
 )
 
 const IpnsValidatorTag = "ipns"
@@ -51,6 +64,29 @@ const kReprovideFrequency = time.Hour * 12
 
 var log = eventlog.Logger("core")
 
+// ErrNodeOffline is returned by operations that need the network when the
+// node is not online.
+var ErrNodeOffline = errors.New("node is offline")
+
+// ErrNodeOnline is returned by operations meant for offline nodes when the
+// node is online.
+var ErrNodeOnline = errors.New("node is online")
+
+// ErrNotMetered is returned when asking for bandwidth stats of a node whose
+// peer host does not count its traffic.
+var ErrNotMetered = errors.New("peer host is not metered")
+
+// ErrNoPassphrase is returned when the private key is encrypted, but the node
+// has no way to ask for the passphrase.
+var ErrNoPassphrase = errors.New("private key is encrypted and no passphrase was given")
+
+// PassphraseFunc returns the passphrase of the node's encrypted private key,
+// e.g. by prompting the user. It is only called if the key is encrypted.
+type PassphraseFunc func() (string, error)
+
+// ErrNoPinner is returned by pin queries on a node without a pinner.
+var ErrNoPinner = errors.New("node has no pinner")
+
 type mode int
 
 const (
@@ -81,17 +117,65 @@ type IpfsNode struct {
 	Resolver   *path.Resolver       // the path resolution system
 
 	// Online
-	PeerHost     p2phost.Host        // the network host (server+client)
-	Bootstrapper io.Closer           // the periodic bootstrapper
-	Routing      routing.IpfsRouting // the routing system. recommend ipfs-dht
-	Exchange     exchange.Interface  // the block exchange + strategy (bitswap)
-	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
-	Diagnostics  *diag.Diagnostics   // the diagnostics service
-	Reprovider   *rp.Reprovider      // the value reprovider system
+	PeerHost     p2phost.Host         // the network host (server+client)
+	Bootstrapper io.Closer            // the periodic bootstrapper
+	Routing      routing.IpfsRouting  // the routing system. recommend ipfs-dht
+	Exchange     exchange.Interface   // the block exchange + strategy (bitswap)
+	Namesys      namesys.NameSystem   // the name system, resolves paths to hashes
+	Diagnostics  *diag.Diagnostics    // the diagnostics service
+	Reprovider   *rp.Reprovider       // the value reprovider system
+	Republisher  *namesys.Republisher // the ipns record republisher
+	Keystore     *keystore.Keystore   // extra keys to publish names with
+	ConnManager  *connmgr.ConnManager // keeps the number of connections in check
 
 	ctxgroup.ContextGroup
 
-	mode mode
+	mode   mode
+	modeLk sync.RWMutex // guards transitions between online and offline
+
+	// cancels the context the online services were started with
+	cancelOnline context.CancelFunc
+	// the context the online services were started with
+	onlineCtx context.Context
+
+	// the routing system the online services use, and the host it was
+	// constructed with, as needed by RestartRouting
+	routing     *routingRef
+	routingHost p2phost.Host
+
+	// reads only from the blockstore, see LocalDAG
+	localBlocks *bserv.BlockService
+	localDAG    merkledag.DAGService
+
+	// used to (re)start the online services
+	routingOption RoutingOption
+	hostOption    ConfiguredHostOption
+
+	// constructs the pinning manager once the DAG service is set up
+	pinnerOption PinnerOption
+
+	// the configuration Bootstrap ran with last, which RestartRouting
+	// bootstraps with again and WaitForBootstrap takes the number of peers
+	// to wait for from
+	bootstrapConfig BootstrapConfig
+
+	// held for writing while garbage collecting, see PinLock
+	gcLock sync.RWMutex
+
+	// keeps count of the blocks stored when a storage quota is configured,
+	// see RepoUsage
+	blockCounter bstore.Counter
+
+	// asked for the passphrase of an encrypted private key
+	passphrase PassphraseFunc
+
+	// counts the traffic of the peer host, if it is metered
+	bwMeter *meteredhost.Meter
+
+	// the peer host, if it is a basic host, as needed by NATStatus
+	basicHost *p2pbhost.BasicHost
+	// whether NAT port mapping is enabled in the config
+	natPortMap bool
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -132,10 +216,37 @@ func NewIPFSNode(parent context.Context, option ConfigOption) (*IpfsNode, error)
 	if node.Peerstore == nil {
 		node.Peerstore = peer.NewPeerstore()
 	}
+	if node.Keystore == nil {
+		node.Keystore = keystore.New()
+	}
 	node.DAG = merkledag.NewDAGService(node.Blocks)
-	node.Pinning, err = pin.LoadPinner(node.Repo.Datastore(), node.DAG)
+	node.localBlocks, err = bserv.New(node.Blockstore, offline.Exchange(node.Blockstore))
+	if err != nil {
+		return nil, debugerror.Wrap(err)
+	}
+	node.localDAG = merkledag.NewDAGService(node.localBlocks)
+	if max := node.Repo.Config().Datastore.MaxBlockSize; max != 0 {
+		// negative sizes disable the limit, like zero does for the service
+		if max < 0 {
+			max = 0
+		}
+		node.Blocks.MaxBlockSize = max
+		node.localBlocks.MaxBlockSize = max
+	}
+	if timeout := node.Repo.Config().Exchange.FetchTimeout; timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, debugerror.Errorf("invalid Exchange.FetchTimeout in config: %s", err)
+		}
+		node.Blocks.FetchTimeout = d
+	}
+	pinnerOption := node.pinnerOption
+	if pinnerOption == nil {
+		pinnerOption = DefaultPinnerOption
+	}
+	node.Pinning, err = pinnerOption(node.Repo.Datastore(), node.DAG)
 	if err != nil {
-		node.Pinning = pin.NewPinner(node.Repo.Datastore(), node.DAG)
+		return nil, debugerror.Wrap(err)
 	}
 	node.Resolver = &path.Resolver{DAG: node.DAG}
 	success = true
@@ -147,7 +258,11 @@ func Offline(r repo.Repo) ConfigOption {
 }
 
 func OnlineWithOptions(r repo.Repo, router RoutingOption, ho HostOption) ConfigOption {
-	return standardWithRouting(r, true, router, ho)
+	hostOption := DefaultConfiguredHostOption
+	if ho != nil {
+		hostOption = ho.Configured()
+	}
+	return standardWithRouting(r, true, router, hostOption, DefaultPinnerOption, DefaultBlockstoreOption, nil)
 }
 
 func Online(r repo.Repo) ConfigOption {
@@ -156,11 +271,11 @@ func Online(r repo.Repo) ConfigOption {
 
 // DEPRECATED: use Online, Offline functions
 func Standard(r repo.Repo, online bool) ConfigOption {
-	return standardWithRouting(r, online, DHTOption, DefaultHostOption)
+	return standardWithRouting(r, online, DHTOption, DefaultConfiguredHostOption, DefaultPinnerOption, DefaultBlockstoreOption, nil)
 }
 
 // TODO refactor so maybeRouter isn't special-cased in this way
-func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption, hostOption HostOption) ConfigOption {
+func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption, hostOption ConfiguredHostOption, pinnerOption PinnerOption, blockstoreOption BlockstoreOption, passphrase PassphraseFunc) ConfigOption {
 	return func(ctx context.Context) (n *IpfsNode, err error) {
 		// FIXME perform node construction in the main constructor so it isn't
 		// necessary to perform this teardown in this scope.
@@ -178,6 +293,10 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 		if r == nil {
 			return nil, debugerror.Errorf("repo required")
 		}
+		// a repo in another format would be misread, or even damaged
+		if err := repo.CheckVersion(r); err != nil {
+			return nil, err
+		}
 		n = &IpfsNode{
 			mode: func() mode {
 				if online {
@@ -185,7 +304,12 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 				}
 				return offlineMode
 			}(),
-			Repo: r,
+			Repo:          r,
+			Keystore:      keystore.New(),
+			pinnerOption:  pinnerOption,
+			routingOption: routingOption,
+			hostOption:    hostOption,
+			passphrase:    passphrase,
 		}
 
 		// setup Peerstore
@@ -196,10 +320,21 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 			return nil, err
 		}
 
-		n.Blockstore, err = bstore.WriteCached(bstore.NewBlockstore(n.Repo.Datastore()), kSizeBlockstoreWriteCache)
+		n.Blockstore, err = blockstoreOption(n.Repo.Datastore())
 		if err != nil {
 			return nil, debugerror.Wrap(err)
 		}
+		if max := n.Repo.Config().Datastore.StorageMax; max > 0 {
+			qbs, err := bstore.Quota(ctx, n.Blockstore, max)
+			if err != nil {
+				return nil, debugerror.Wrap(err)
+			}
+			n.Blockstore = qbs
+			n.blockCounter = qbs
+		}
+		if n.Repo.Config().Datastore.VerifyBlocks {
+			n.Blockstore = bstore.Verifying(n.Blockstore)
+		}
 
 		if online {
 			if err := n.startOnlineServices(ctx, routingOption, hostOption); err != nil {
@@ -214,18 +349,31 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 	}
 }
 
-func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption RoutingOption, hostOption HostOption) error {
+func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption RoutingOption, hostOption ConfiguredHostOption) error {
 
 	if n.PeerHost != nil { // already online.
 		return debugerror.New("node already online")
 	}
 
-	// load private key
-	if err := n.LoadPrivateKey(); err != nil {
+	// online services get their own context, so that they can be shut down
+	// without tearing down the whole node.
+	ctx, n.cancelOnline = context.WithCancel(ctx)
+	n.onlineCtx = ctx
+
+	// load private key, unless we were online before
+	if n.PrivateKey == nil {
+		if err := n.LoadPrivateKey(); err != nil {
+			return err
+		}
+	}
+
+	hcfg, err := hostConfig(n.Repo.Config())
+	if err != nil {
 		return err
 	}
 
-	peerhost, err := hostOption(ctx, n.Identity, n.Peerstore)
+	n.natPortMap = hcfg.NATPortMap
+	peerhost, err := hostOption(ctx, n.Identity, n.Peerstore, hcfg)
 	if err != nil {
 		return debugerror.Wrap(err)
 	}
@@ -239,74 +387,283 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 		return debugerror.Wrap(err)
 	}
 
-	n.Reprovider = rp.NewReprovider(n.Routing, n.Blockstore)
-	go n.Reprovider.ProvideEvery(ctx, kReprovideFrequency)
+	if err := n.startReprovider(ctx); err != nil {
+		return err
+	}
 
 	return n.Bootstrap(DefaultBootstrapConfig)
 }
 
+// startReprovider sets up the reprovider as specified in the config. No
+// reprovider is started if the configured interval is zero.
+func (n *IpfsNode) startReprovider(ctx context.Context) error {
+	cfg := n.Repo.Config().Reprovider
+
+	interval := kReprovideFrequency
+	if cfg.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(cfg.Interval)
+		if err != nil {
+			return debugerror.Errorf("invalid Reprovider.Interval in config: %s", err)
+		}
+	}
+	if interval == 0 {
+		return nil
+	}
+
+	var keyProvider rp.KeyChanFunc
+	switch cfg.Strategy {
+	case "", "all":
+		keyProvider = rp.NewBlockstoreProvider(n.Blockstore)
+	case "roots":
+		// the pinner is not set up yet during node construction
+		keyProvider = func(ctx context.Context) (<-chan u.Key, error) {
+			return rp.NewPinnedRootsProvider(n.Pinning)(ctx)
+		}
+	default:
+		return debugerror.Errorf("unknown Reprovider.Strategy in config: %s", cfg.Strategy)
+	}
+
+	n.Reprovider = rp.NewReproviderWithStrategy(n.routing, keyProvider)
+	go n.Reprovider.ProvideEvery(ctx, interval)
+	return nil
+}
+
 // startOnlineServicesWithHost  is the set of services which need to be
 // initialized with the host and _before_ we start listening.
 func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost.Host, routingOption RoutingOption) error {
 	// setup diagnostics service
 	n.Diagnostics = diag.NewDiagnostics(n.Identity, host)
 
+	inner := host
+	if mh, ok := host.(*meteredhost.MeteredHost); ok {
+		n.bwMeter = mh.Meter()
+		inner = mh.Host()
+	}
+	if bh, ok := inner.(*p2pbhost.BasicHost); ok {
+		n.basicHost = bh
+	}
+
+	if err := n.startConnManager(host); err != nil {
+		return err
+	}
+
 	// setup routing service
 	r, err := routingOption(ctx, host, n.Repo.Datastore())
 	if err != nil {
 		return debugerror.Wrap(err)
 	}
 	n.Routing = r
+	n.routing = &routingRef{r: r}
+	n.routingHost = host
 
 	// Wrap standard peer host with routing system to allow unknown peer lookups
-	n.PeerHost = rhost.Wrap(host, n.Routing)
+	n.PeerHost = rhost.Wrap(host, n.routing)
 
 	// setup exchange service
 	const alwaysSendToPeer = true // use YesManStrategy
-	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.Routing)
-	n.Exchange = bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer)
+	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.routing)
+	if n.ConnManager != nil {
+		bitswapNetwork = &usefulPeerNetwork{bitswapNetwork, n.ConnManager}
+	}
+	searchDelay := bitswap.DefaultProviderSearchDelay
+	if d := n.Repo.Config().Exchange.ProviderSearchDelay; d != "" {
+		searchDelay, err = time.ParseDuration(d)
+		if err != nil {
+			return debugerror.Errorf("invalid Exchange.ProviderSearchDelay in config: %s", err)
+		}
+	}
+	bs := bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer).(*bitswap.Bitswap)
+	bs.ProviderSearchDelay.Set(searchDelay)
+	n.Exchange = bs
 
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing)
+	ns, err := n.newNameSystem(n.Routing)
+	if err != nil {
+		return err
+	}
+	n.Namesys = ns
+
+	return n.startRepublisher(ctx)
+}
+
+// startRepublisher sets up periodic republishing of the node's own name, as
+// specified in the config. Nothing is started if the period is zero.
+func (n *IpfsNode) startRepublisher(ctx context.Context) error {
+	cfg := n.Repo.Config().Ipns
+
+	period := namesys.DefaultRepublishInterval
+	if cfg.RepublishPeriod != "" {
+		var err error
+		period, err = time.ParseDuration(cfg.RepublishPeriod)
+		if err != nil {
+			return debugerror.Errorf("invalid Ipns.RepublishPeriod in config: %s", err)
+		}
+	}
+	if period == 0 {
+		return nil
+	}
+
+	lifetime := namesys.DefaultRecordLifetime
+	if cfg.RecordLifetime != "" {
+		var err error
+		lifetime, err = time.ParseDuration(cfg.RecordLifetime)
+		if err != nil {
+			return debugerror.Errorf("invalid Ipns.RecordLifetime in config: %s", err)
+		}
+	}
+	if lifetime <= period {
+		return debugerror.Errorf("Ipns.RecordLifetime (%s) must be longer than Ipns.RepublishPeriod (%s)", lifetime, period)
+	}
+
+	n.Republisher = namesys.NewRepublisher(n.routing, period, lifetime)
+	if err := n.Republisher.AddName(n.PrivateKey); err != nil {
+		return err
+	}
+	for _, id := range n.Keystore.List() {
+		sk, err := n.Keystore.Get(id)
+		if err != nil {
+			continue // removed meanwhile
+		}
+		if err := n.Republisher.AddName(sk); err != nil {
+			return err
+		}
+	}
+	go n.Republisher.Run(ctx)
 	return nil
 }
 
-// teardown closes owned children. If any errors occur, this function returns
-// the first error.
+// newNameSystem constructs the name system on top of r, caching
+// resolutions and delegating them to a proxy as set in the Ipns config
+// section.
+func (n *IpfsNode) newNameSystem(r routing.IpfsRouting) (namesys.NameSystem, error) {
+	cfg := n.Repo.Config().Ipns
+
+	ttl := namesys.DefaultResolveCacheTTL
+	if cfg.ResolveCacheTTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(cfg.ResolveCacheTTL)
+		if err != nil {
+			return nil, debugerror.Errorf("invalid Ipns.ResolveCacheTTL in config: %s", err)
+		}
+	}
+	if cfg.ResolveProxy != "" {
+		api, err := url.Parse(cfg.ResolveProxy)
+		if err != nil || api.Scheme == "" || api.Host == "" {
+			return nil, debugerror.Errorf("invalid Ipns.ResolveProxy in config: %q", cfg.ResolveProxy)
+		}
+		proxy := namesys.NewProxyResolver(cfg.ResolveProxy)
+		return namesys.NewProxyNameSystem(r, proxy, ttl), nil
+	}
+	if ttl == 0 {
+		return namesys.NewNameSystem(r), nil
+	}
+	return namesys.NewCachedNameSystem(r, ttl), nil
+}
+
+// teardown closes owned children. Each gets at most TeardownTimeout to do
+// so, and all of them are closed even if some fail or time out. They are
+// closed in this order:
+//
+//   - the bootstrapper, so no new connections are made
+//   - the exchange, which stores the blocks it receives in the blockstore
+//   - the block services
+//   - the routing system
+//   - the repo, holding the datastore all of the above use
+//   - the connection manager, which stops watching the network
+//   - the peer host, last, since the others may use the network until closed
 func (n *IpfsNode) teardown() error {
 	log.Debug("core is shutting down...")
 	// owned objects are closed in this teardown to ensure that they're closed
 	// regardless of which constructor was used to add them to the node.
-	closers := []io.Closer{
-		n.Blocks,
-		n.Exchange,
-		n.Repo,
+	var closers []namedCloser
+	if n.Bootstrapper != nil {
+		closers = append(closers, namedCloser{"bootstrapper", n.Bootstrapper})
 	}
-	addCloser := func(c io.Closer) { // use when field may be nil
-		if c != nil {
-			closers = append(closers, c)
-		}
+	if n.Exchange != nil {
+		closers = append(closers, namedCloser{"exchange", n.Exchange})
 	}
-
-	addCloser(n.Bootstrapper)
-	if dht, ok := n.Routing.(*dht.IpfsDHT); ok {
-		addCloser(dht)
+	if n.Blocks != nil {
+		closers = append(closers, namedCloser{"block service", n.Blocks})
+	}
+	if n.localBlocks != nil {
+		closers = append(closers, namedCloser{"local block service", n.localBlocks})
+	}
+	if r, ok := n.Routing.(io.Closer); ok {
+		closers = append(closers, namedCloser{"routing", r})
+	}
+	if n.Repo != nil {
+		closers = append(closers, namedCloser{"repo", n.Repo})
+	}
+	if n.ConnManager != nil {
+		closers = append(closers, namedCloser{"connection manager", n.ConnManager})
 	}
-	addCloser(n.PeerHost)
+	if n.PeerHost != nil {
+		closers = append(closers, namedCloser{"peer host", n.PeerHost})
+	}
+
+	return closeAll(closers)
+}
+
+// TeardownTimeout is how long each subsystem gets to close when the node
+// shuts down or goes offline.
+var TeardownTimeout = 10 * time.Second
+
+// CloseTimeoutError is returned for subsystems that did not finish closing
+// within TeardownTimeout.
+type CloseTimeoutError struct {
+	Subsystem string
+}
 
-	var errs []error
-	for _, closer := range closers {
-		if err := closer.Close(); err != nil {
+func (e CloseTimeoutError) Error() string {
+	return fmt.Sprintf("closing the %s timed out", e.Subsystem)
+}
+
+// namedCloser is a subsystem to close, named for error reporting
+type namedCloser struct {
+	name string
+	io.Closer
+}
+
+// closeAll closes all closers in order, even if some fail or time out. A
+// single error is returned as is, several ones as a util.MultiErr.
+func closeAll(closers []namedCloser) error {
+	var errs u.MultiErr
+	for _, c := range closers {
+		if err := closeWithTimeout(c); err != nil {
 			errs = append(errs, err)
 		}
 	}
-	if len(errs) > 0 {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
 		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// closeWithTimeout closes c, giving up after TeardownTimeout. The Close
+// call is left running in the background if it times out.
+func closeWithTimeout(c namedCloser) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(TeardownTimeout):
+		log.Errorf("closing the %s did not finish within %s", c.name, TeardownTimeout)
+		return CloseTimeoutError{c.name}
 	}
-	return nil
 }
 
 func (n *IpfsNode) OnlineMode() bool {
+	n.modeLk.RLock()
+	defer n.modeLk.RUnlock()
 	switch n.mode {
 	case onlineMode:
 		return true
@@ -315,8 +672,108 @@ func (n *IpfsNode) OnlineMode() bool {
 	}
 }
 
-func (n *IpfsNode) Resolve(fpath string) (*merkledag.Node, error) {
-	return n.Resolver.ResolvePath(path.Path(fpath))
+// GoOffline shuts down the network services of an online node (the peer
+// host, routing, bitswap, reproviding and bootstrapping), while keeping the
+// blockstore and DAG usable through an offline exchange. Calling it on a node
+// that is already offline does nothing.
+func (n *IpfsNode) GoOffline() error {
+	n.modeLk.Lock()
+	defer n.modeLk.Unlock()
+
+	if n.mode != onlineMode {
+		return nil
+	}
+	return n.stopOnlineServices()
+}
+
+// GoOnline starts the network services of an offline node, using the
+// routing and host options the node was constructed with. The services run
+// until ctx is cancelled, GoOffline is called, or the node is closed.
+func (n *IpfsNode) GoOnline(ctx context.Context) error {
+	n.modeLk.Lock()
+	defer n.modeLk.Unlock()
+
+	if n.mode == onlineMode || n.PeerHost != nil {
+		return debugerror.New("node already online")
+	}
+
+	routingOption := n.routingOption
+	if routingOption == nil {
+		routingOption = DHTOption
+	}
+	hostOption := n.hostOption
+	if hostOption == nil {
+		hostOption = DefaultConfiguredHostOption
+	}
+
+	offlineExchange := n.Exchange
+	if err := n.startOnlineServices(ctx, routingOption, hostOption); err != nil {
+		n.stopOnlineServices()
+		return err
+	}
+	if n.Blocks != nil {
+		n.Blocks.SetExchange(n.Exchange)
+	}
+	if offlineExchange != nil {
+		offlineExchange.Close()
+	}
+
+	n.mode = onlineMode
+	return nil
+}
+
+// stopOnlineServices closes all network services and switches the node to
+// an offline exchange. n.modeLk must be held.
+func (n *IpfsNode) stopOnlineServices() error {
+	// switch the exchange first, so new requests are served locally while
+	// the network services are closing.
+	var closers []namedCloser
+	if n.Exchange != nil {
+		closers = append(closers, namedCloser{"exchange", n.Exchange})
+	}
+	n.Exchange = offline.Exchange(n.Blockstore)
+	if n.Blocks != nil {
+		n.Blocks.SetExchange(n.Exchange)
+	}
+
+	if n.Bootstrapper != nil {
+		closers = append(closers, namedCloser{"bootstrapper", n.Bootstrapper})
+	}
+	if r, ok := n.Routing.(io.Closer); ok {
+		closers = append(closers, namedCloser{"routing", r})
+	}
+	if n.ConnManager != nil {
+		closers = append(closers, namedCloser{"connection manager", n.ConnManager})
+	}
+	if n.PeerHost != nil {
+		closers = append(closers, namedCloser{"peer host", n.PeerHost})
+	}
+
+	err := closeAll(closers)
+	if n.cancelOnline != nil {
+		n.cancelOnline() // stops the reprovider, among others
+		n.cancelOnline = nil
+	}
+
+	n.Bootstrapper = nil
+	n.Reprovider = nil
+	n.Republisher = nil
+	n.Namesys = nil
+	n.Diagnostics = nil
+	n.Routing = nil
+	n.routing = nil
+	n.routingHost = nil
+	n.onlineCtx = nil
+	n.PeerHost = nil
+	n.ConnManager = nil
+	n.bwMeter = nil
+	n.basicHost = nil
+	n.mode = offlineMode
+	return err
+}
+
+func (n *IpfsNode) Resolve(ctx context.Context, fpath string) (*merkledag.Node, error) {
+	return n.Resolver.ResolvePath(ctx, path.Path(fpath))
 }
 
 func (n *IpfsNode) Bootstrap(cfg BootstrapConfig) error {
@@ -345,7 +802,522 @@ func (n *IpfsNode) Bootstrap(cfg BootstrapConfig) error {
 
 	var err error
 	n.Bootstrapper, err = Bootstrap(n, cfg)
-	return err
+	if err != nil {
+		return err
+	}
+	n.bootstrapConfig = cfg
+	return nil
+}
+
+// WaitForBootstrap blocks until the node is connected to at least the
+// MinPeerThreshold of the BootstrapConfig passed to Bootstrap, or until
+// ctx is cancelled. It fails with ErrNotBootstrapped if the node is not
+// bootstrapping, which it stops doing when it goes offline.
+func (n *IpfsNode) WaitForBootstrap(ctx context.Context) error {
+	tick := time.NewTicker(bootstrapPollInterval)
+	defer tick.Stop()
+	for {
+		host, min, err := n.bootstrapTarget()
+		if err != nil {
+			return err
+		}
+		if len(host.Network().Peers()) >= min {
+			return nil
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// bootstrapTarget returns the peer host and the number of peers it must be
+// connected to for the node to be bootstrapped, or ErrNotBootstrapped.
+func (n *IpfsNode) bootstrapTarget() (p2phost.Host, int, error) {
+	n.modeLk.RLock()
+	defer n.modeLk.RUnlock()
+
+	if n.PeerHost == nil || n.Bootstrapper == nil {
+		return nil, 0, ErrNotBootstrapped
+	}
+	return n.PeerHost, n.bootstrapConfig.MinPeerThreshold, nil
+}
+
+// Connect ensures there is a connection to the peer described by pi. The
+// addresses in pi are added to the peerstore before dialing.
+func (n *IpfsNode) Connect(ctx context.Context, pi peer.PeerInfo) error {
+	host, err := n.peerHost()
+	if err != nil {
+		return err
+	}
+	return host.Connect(ctx, pi)
+}
+
+// Disconnect closes all connections to the given peer.
+func (n *IpfsNode) Disconnect(p peer.ID) error {
+	host, err := n.peerHost()
+	if err != nil {
+		return err
+	}
+	return host.Network().ClosePeer(p)
+}
+
+// peerHost returns the peer host, or ErrNodeOffline if the node is offline.
+func (n *IpfsNode) peerHost() (p2phost.Host, error) {
+	n.modeLk.RLock()
+	defer n.modeLk.RUnlock()
+
+	if n.PeerHost == nil {
+		return nil, ErrNodeOffline
+	}
+	return n.PeerHost, nil
+}
+
+// ConnectedPeer describes a peer the node currently has connections to.
+type ConnectedPeer struct {
+	ID      peer.ID
+	Addrs   []ma.Multiaddr // remote addresses of the open connections
+	Latency time.Duration  // latency EWMA recorded in the peerstore
+}
+
+// Peers lists the peers the node is currently connected to. An offline node
+// returns an empty list.
+func (n *IpfsNode) Peers() []ConnectedPeer {
+	out := []ConnectedPeer{}
+	host, err := n.peerHost()
+	if err != nil {
+		return out
+	}
+
+	index := make(map[peer.ID]int)
+	for _, c := range host.Network().Conns() {
+		p := c.RemotePeer()
+		i, found := index[p]
+		if !found {
+			i = len(out)
+			index[p] = i
+			out = append(out, ConnectedPeer{
+				ID:      p,
+				Latency: host.Peerstore().LatencyEWMA(p),
+			})
+		}
+		out[i].Addrs = append(out[i].Addrs, c.RemoteMultiaddr())
+	}
+	return out
+}
+
+// AddKey registers an extra key the node can publish names with, and
+// returns its id. The node's network identity is not affected. Names
+// published with the key are republished like the node's own.
+func (n *IpfsNode) AddKey(sk ic.PrivKey) (peer.ID, error) {
+	id, err := n.Keystore.Add(sk)
+	if err != nil {
+		return "", err
+	}
+	if n.Republisher != nil {
+		if err := n.Republisher.AddName(sk); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// RemoveKey removes a key registered with AddKey.
+func (n *IpfsNode) RemoveKey(id peer.ID) error {
+	sk, err := n.Keystore.Get(id)
+	if err != nil {
+		return err
+	}
+	if n.Republisher != nil {
+		if err := n.Republisher.RemoveName(sk); err != nil {
+			return err
+		}
+	}
+	return n.Keystore.Remove(id)
+}
+
+// ListKeys returns the ids of the keys registered with AddKey.
+func (n *IpfsNode) ListKeys() []peer.ID {
+	return n.Keystore.List()
+}
+
+// PublishWithKey publishes value under the name of the given key, which is
+// either the node's own identity or a key registered with AddKey.
+func (n *IpfsNode) PublishWithKey(ctx context.Context, id peer.ID, value u.Key) error {
+	ns, err := n.nameSystem()
+	if err != nil {
+		return err
+	}
+
+	sk := n.PrivateKey
+	if id != n.Identity {
+		sk, err = n.Keystore.Get(id)
+		if err != nil {
+			return err
+		}
+	}
+	return ns.Publish(ctx, sk, value)
+}
+
+// nameSystem returns the name system, or ErrNodeOffline if the node has none,
+// as after GoOffline.
+func (n *IpfsNode) nameSystem() (namesys.NameSystem, error) {
+	n.modeLk.RLock()
+	defer n.modeLk.RUnlock()
+
+	if n.Namesys == nil {
+		return nil, ErrNodeOffline
+	}
+	return n.Namesys, nil
+}
+
+// PublishOffline publishes value under the name of key without using the
+// network, e.g. from a command line tool while the daemon is not running.
+// The signed record is stored in the datastore of the repo by the offline
+// router, so a node using the repo serves it once online. key is the b58 id
+// of either the node's own identity or a key registered with AddKey; ""
+// stands for the node's identity. Paths other than a bare /ipfs/ hash are
+// resolved with the blocks stored locally.
+//
+// Offline routing is set up if the node has no name system yet, as after
+// GoOffline. It fails with ErrNodeOnline if the node is online: use
+// PublishWithKey then.
+func (n *IpfsNode) PublishOffline(ctx context.Context, key string, value path.Path) error {
+	n.modeLk.Lock()
+	if n.mode == onlineMode {
+		n.modeLk.Unlock()
+		return ErrNodeOnline
+	}
+	if n.Namesys == nil {
+		if err := n.SetupOfflineRouting(); err != nil {
+			n.modeLk.Unlock()
+			return err
+		}
+	}
+	n.modeLk.Unlock()
+
+	id := n.Identity
+	if key != "" {
+		var err error
+		id, err = peer.IDB58Decode(key)
+		if err != nil {
+			return debugerror.Errorf("invalid key id %q: %s", key, err)
+		}
+	}
+
+	var k u.Key
+	if h, rest, err := path.SplitAbsPath(value); err == nil && len(rest) == 0 {
+		k = u.Key(h)
+	} else {
+		nd, err := n.ResolvePath(ctx, value.String())
+		if err != nil {
+			return err
+		}
+		k, err = nd.Key()
+		if err != nil {
+			return err
+		}
+	}
+	return n.PublishWithKey(ctx, id, k)
+}
+
+// PublishWithLifetime publishes value under the node's own name, in a record
+// valid until eol rather than for namesys.DefaultRecordLifetime.
+func (n *IpfsNode) PublishWithLifetime(ctx context.Context, value u.Key, eol time.Time) error {
+	ns, err := n.nameSystem()
+	if err != nil {
+		return err
+	}
+	lp, ok := ns.(namesys.LifetimePublisher)
+	if !ok {
+		return namesys.ErrPublishFailed
+	}
+	return lp.PublishWithLifetime(ctx, n.PrivateKey, value, eol)
+}
+
+// AddBlockWithHash stores data as a block whose key is hashed with the given
+// multihash function (e.g. mh.SHA3) rather than the default sha2-256.
+func (n *IpfsNode) AddBlockWithHash(data []byte, mhType int) (u.Key, error) {
+	b, err := blocks.NewBlockWithHashFunc(data, mhType)
+	if err != nil {
+		return "", err
+	}
+	return n.Blocks.AddBlock(b)
+}
+
+// AddBlocks stores many blocks in one batch, atomically if the datastore of
+// the repo supports it, like a leveldb one does. It is much faster than
+// adding the blocks one by one, e.g. when importing a large DAG. The blocks
+// are announced like added ones are; nothing is pinned.
+func (n *IpfsNode) AddBlocks(bs []*blocks.Block) ([]u.Key, error) {
+	return n.Blocks.AddBlocks(bs)
+}
+
+// GetBlockFrom returns the block for k, asking the peer p for it first
+// when it is not stored locally. Use it when p is known to have the block,
+// e.g. from a diagnostic, to skip searching the network. If p does not send
+// it, the block is searched for as usual.
+func (n *IpfsNode) GetBlockFrom(ctx context.Context, k u.Key, p peer.ID) (*blocks.Block, error) {
+	if b, err := n.Blockstore.Get(k); err == nil {
+		return b, nil
+	}
+	if !n.OnlineMode() {
+		return nil, ErrNodeOffline
+	}
+	bs := n.bitswapAgent()
+	if bs == nil {
+		return n.Blocks.GetBlock(ctx, k)
+	}
+	return bs.GetBlockFrom(ctx, k, p)
+}
+
+// Provide announces to the routing system right away that this node can
+// provide the block for k, instead of waiting for the reprovider. If
+// recursive is set, the blocks of all the nodes below it are announced too;
+// they must all be stored locally. It returns ErrNodeOffline if the node is
+// offline.
+func (n *IpfsNode) Provide(ctx context.Context, k u.Key, recursive bool) error {
+	routing, err := n.onlineRouting()
+	if err != nil {
+		return err
+	}
+
+	keys := []u.Key{k}
+	if recursive {
+		root, err := n.localDAG.Get(ctx, k)
+		if err != nil {
+			return err
+		}
+		visit := func(k u.Key) { keys = append(keys, k) }
+		if err := merkledag.EnumerateChildrenAsync(ctx, root, n.localDAG, visit, 1, nil); err != nil {
+			return err
+		}
+	} else if has, err := n.Blockstore.Has(k); err != nil {
+		return err
+	} else if !has {
+		return bstore.ErrNotFound
+	}
+
+	for _, k := range keys {
+		if err := routing.Provide(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindProviders searches the routing system for up to limit peers providing
+// the block for k. They are sent on the returned channel as they are found;
+// it is closed once limit providers were found, the search is over, or ctx
+// is cancelled. It returns ErrNodeOffline if the node is offline.
+func (n *IpfsNode) FindProviders(ctx context.Context, k u.Key, limit int) (<-chan peer.PeerInfo, error) {
+	if limit < 1 {
+		return nil, debugerror.Errorf("invalid provider limit: %d", limit)
+	}
+	routing, err := n.onlineRouting()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	provs := routing.FindProvidersAsync(ctx, k, limit)
+	out := make(chan peer.PeerInfo)
+	go func() {
+		defer close(out)
+		defer cancel()
+		for i := 0; i < limit; i++ {
+			select {
+			case pi, ok := <-provs:
+				if !ok {
+					return
+				}
+				select {
+				case out <- pi:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// LocalDAG returns a DAG service that only reads from the local blockstore.
+// Unlike n.DAG, it never fetches nodes from the network, even when the node
+// is online. Getting a node that is not stored fails right away, with
+// blockstore.ErrNotFound from Get and merkledag.ErrNotFound from the
+// promises of GetNodes, instead of waiting for the exchange to find it.
+func (n *IpfsNode) LocalDAG() merkledag.DAGService {
+	return n.localDAG
+}
+
+// NewSession returns a DAG service like n.DAG, whose network requests are
+// grouped in one bitswap session: once peers sent some of the requested
+// blocks, the next ones are asked of them rather than of every partner. Use
+// it for related nodes, such as the ones of a file read with a DagReader.
+// The session ends with ctx, which should not outlive the work.
+func (n *IpfsNode) NewSession(ctx context.Context) merkledag.DAGService {
+	return merkledag.NewSession(ctx, n.DAG)
+}
+
+// Has reports whether the block for k is in the local blockstore. Unlike
+// fetching it through the DAG or block service, it never goes to the network.
+func (n *IpfsNode) Has(ctx context.Context, k u.Key) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return n.Blockstore.Has(k)
+}
+
+// Flush makes the blocks added and the pins changed so far durable, as far
+// as the blockstore and the pinner buffer them.
+func (n *IpfsNode) Flush() error {
+	if n.Pinning != nil {
+		if err := n.Pinning.Flush(); err != nil {
+			return err
+		}
+	}
+	if f, ok := n.Blockstore.(bstore.Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// AllKeys streams the keys of all the blocks in the local blockstore, in no
+// particular order. The keys are read from the datastore as they are sent,
+// not loaded in memory first. The channel is closed once all the keys are
+// sent, or when ctx is done.
+func (n *IpfsNode) AllKeys(ctx context.Context) (<-chan u.Key, error) {
+	return n.Blockstore.AllKeysChan(ctx)
+}
+
+// AllKeysRange is like AllKeys, but skips the first offset keys and sends at
+// most limit keys, a limit of zero meaning no limit. Pages are only stable if
+// the datastore lists its keys in order, as leveldb does, and the blockstore
+// is not changed in between.
+func (n *IpfsNode) AllKeysRange(ctx context.Context, offset, limit int) (<-chan u.Key, error) {
+	return n.Blockstore.AllKeysRangeChan(ctx, offset, limit)
+}
+
+// RepoUsage returns the number of blocks in the local blockstore and their
+// total size. When Datastore.StorageMax is set in the config, the blocks are
+// kept count of; otherwise they are counted now, by reading all of them, which
+// respects ctx.
+func (n *IpfsNode) RepoUsage(ctx context.Context) (numBlocks int, size uint64, err error) {
+	if n.blockCounter != nil {
+		numBlocks, size = n.blockCounter.Counts()
+		return numBlocks, size, nil
+	}
+	q, err := bstore.Quota(ctx, n.Blockstore, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	numBlocks, size = q.Counts()
+	return numBlocks, size, nil
+}
+
+// HasAll reports whether the blocks for all the given keys are in the local
+// blockstore, without going to the network.
+func (n *IpfsNode) HasAll(keys []u.Key) (bool, error) {
+	for _, k := range keys {
+		has, err := n.Blockstore.Has(k)
+		if err != nil || !has {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// IsPinned reports whether k is pinned, and if so whether it is pinned
+// "direct", "recursive" or "indirect" (as a child of a recursive pin).
+func (n *IpfsNode) IsPinned(k u.Key) (bool, string, error) {
+	if n.Pinning == nil {
+		return false, "", ErrNoPinner
+	}
+	mode := n.Pinning.Mode(k)
+	if mode == pin.NotPinned {
+		return false, "", nil
+	}
+	return true, mode.String(), nil
+}
+
+// Pins returns the keys of all direct and recursive pins. Blocks pinned
+// indirectly are not listed.
+func (n *IpfsNode) Pins() ([]u.Key, error) {
+	if n.Pinning == nil {
+		return nil, ErrNoPinner
+	}
+	keys := n.Pinning.DirectKeys()
+	return append(keys, n.Pinning.RecursiveKeys()...), nil
+}
+
+// Wantlist returns the keys bitswap is currently requesting from the
+// network, or nil if the node is offline.
+func (n *IpfsNode) Wantlist() []u.Key {
+	bs := n.bitswapAgent()
+	if bs == nil {
+		return nil
+	}
+	return bs.GetWantlist()
+}
+
+// BitswapStat returns diagnostic information about the bitswap agent,
+// including the number of blocks sent and received. It returns
+// ErrNodeOffline if the node is not running bitswap.
+func (n *IpfsNode) BitswapStat() (*bitswap.Stat, error) {
+	bs := n.bitswapAgent()
+	if bs == nil {
+		return nil, ErrNodeOffline
+	}
+	return bs.Stat()
+}
+
+// bitswapAgent returns the exchange if it is bitswap, or nil, as when the
+// node is offline.
+func (n *IpfsNode) bitswapAgent() *bitswap.Bitswap {
+	n.modeLk.RLock()
+	defer n.modeLk.RUnlock()
+
+	bs, _ := n.Exchange.(*bitswap.Bitswap)
+	return bs
+}
+
+// RunDiagnostics runs a network diagnostic, collecting the info reported by
+// every peer reached before ctx is done or the timeout expires. The info of
+// this node comes first.
+func (n *IpfsNode) RunDiagnostics(ctx context.Context, timeout time.Duration) ([]*diag.DiagInfo, error) {
+	if !n.OnlineMode() || n.Diagnostics == nil {
+		return nil, ErrNodeOffline
+	}
+	return n.Diagnostics.GetDiagnosticContext(ctx, timeout)
+}
+
+// BandwidthStats returns the number of bytes exchanged with each peer, by
+// protocol.
+func (n *IpfsNode) BandwidthStats() (map[protocol.ID]map[peer.ID]meteredhost.Stats, error) {
+	if !n.OnlineMode() {
+		return nil, ErrNodeOffline
+	}
+	if n.bwMeter == nil {
+		return nil, ErrNotMetered
+	}
+	return n.bwMeter.Stats(), nil
+}
+
+// ResetBandwidthStats sets the counts returned by BandwidthStats back to zero.
+func (n *IpfsNode) ResetBandwidthStats() error {
+	if !n.OnlineMode() {
+		return ErrNodeOffline
+	}
+	if n.bwMeter == nil {
+		return ErrNotMetered
+	}
+	n.bwMeter.Reset()
+	return nil
 }
 
 func (n *IpfsNode) loadID() error {
@@ -374,7 +1346,7 @@ func (n *IpfsNode) LoadPrivateKey() error {
 		return debugerror.New("private key already loaded")
 	}
 
-	sk, err := loadPrivateKey(&n.Repo.Config().Identity, n.Identity)
+	sk, err := loadPrivateKey(&n.Repo.Config().Identity, n.Identity, n.passphrase)
 	if err != nil {
 		return err
 	}
@@ -393,13 +1365,14 @@ func (n *IpfsNode) loadBootstrapPeers() ([]peer.PeerInfo, error) {
 	return toPeerInfos(parsed), nil
 }
 
-// SetupOfflineRouting loads the local nodes private key and
-// uses it to instantiate a routing system in offline mode.
+// SetupOfflineRouting loads the local nodes private key, unless it is
+// loaded already, and uses it to instantiate a routing system in offline mode.
 // This is primarily used for offline ipns modifications.
 func (n *IpfsNode) SetupOfflineRouting() error {
-	err := n.LoadPrivateKey()
-	if err != nil {
-		return err
+	if n.PrivateKey == nil {
+		if err := n.LoadPrivateKey(); err != nil {
+			return err
+		}
 	}
 
 	n.Routing = offroute.NewOfflineRouter(n.Repo.Datastore(), n.PrivateKey)
@@ -409,8 +1382,21 @@ func (n *IpfsNode) SetupOfflineRouting() error {
 	return nil
 }
 
-func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
-	sk, err := cfg.DecodePrivateKey("passphrase todo!")
+func loadPrivateKey(cfg *config.Identity, id peer.ID, passphrase PassphraseFunc) (ic.PrivKey, error) {
+	var pass string
+	if cfg.Encrypted() {
+		if passphrase == nil {
+			return nil, ErrNoPassphrase
+		}
+		var err error
+		pass, err = passphrase()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// fails with config.ErrWrongPassphrase if pass is wrong
+	sk, err := cfg.DecodePrivateKey(pass)
 	if err != nil {
 		return nil, err
 	}
@@ -440,21 +1426,99 @@ func listenAddresses(cfg *config.Config) ([]ma.Multiaddr, error) {
 	return listen, nil
 }
 
+// HostConfig tells a ConfiguredHostOption how to set up the peer host, as specified
+// in the Swarm section of the config.
+type HostConfig struct {
+	// Filters block the addresses the host must not listen on, dial or
+	// advertise.
+	Filters *filter.Filters
+
+	// NATPortMap asks the host to open port mappings for its listeners in
+	// the NAT device, if one is found.
+	NATPortMap bool
+}
+
+func hostConfig(cfg *config.Config) (HostConfig, error) {
+	filters, err := addrFilters(cfg)
+	if err != nil {
+		return HostConfig{}, err
+	}
+	return HostConfig{
+		Filters:    filters,
+		NATPortMap: !cfg.Swarm.DisableNatPortMap,
+	}, nil
+}
+
+// addrFilters builds the address filters specified in the Swarm section of
+// the config.
+func addrFilters(cfg *config.Config) (*filter.Filters, error) {
+	fs := filter.New()
+	for _, s := range cfg.Swarm.AllowCIDRs {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, debugerror.Errorf("invalid Swarm.AllowCIDRs entry in config: %s", err)
+		}
+		fs.Allow(ipnet)
+	}
+	for _, s := range cfg.Swarm.DenyCIDRs {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, debugerror.Errorf("invalid Swarm.DenyCIDRs entry in config: %s", err)
+		}
+		fs.Deny(ipnet)
+	}
+	return fs, nil
+}
+
+// HostOption constructs the peer host of a node going online.
 type HostOption func(ctx context.Context, id peer.ID, ps peer.Peerstore) (p2phost.Host, error)
 
 var DefaultHostOption HostOption = constructPeerHost
 
+// Configured returns a ConfiguredHostOption constructing the host with ho.
+// Of cfg, only the filters are applied, to the swarm of the host if it has
+// one; port mapping is up to ho.
+func (ho HostOption) Configured() ConfiguredHostOption {
+	return func(ctx context.Context, id peer.ID, ps peer.Peerstore, cfg HostConfig) (p2phost.Host, error) {
+		h, err := ho(ctx, id, ps)
+		if err != nil {
+			return nil, err
+		}
+		if sn, ok := h.Network().(*swarm.Network); ok && cfg.Filters != nil {
+			sn.Swarm().SetFilters(cfg.Filters)
+		}
+		return h, nil
+	}
+}
+
+// ConfiguredHostOption constructs the peer host of a node going online, set
+// up as described by cfg.
+type ConfiguredHostOption func(ctx context.Context, id peer.ID, ps peer.Peerstore, cfg HostConfig) (p2phost.Host, error)
+
+var DefaultConfiguredHostOption ConfiguredHostOption = constructConfiguredPeerHost
+
 // isolates the complex initialization steps
 func constructPeerHost(ctx context.Context, id peer.ID, ps peer.Peerstore) (p2phost.Host, error) {
+	return constructConfiguredPeerHost(ctx, id, ps, HostConfig{NATPortMap: true})
+}
+
+func constructConfiguredPeerHost(ctx context.Context, id peer.ID, ps peer.Peerstore, cfg HostConfig) (p2phost.Host, error) {
 
 	// no addresses to begin with. we'll start later.
 	network, err := swarm.NewNetwork(ctx, nil, id, ps)
 	if err != nil {
 		return nil, debugerror.Wrap(err)
 	}
+	if cfg.Filters != nil {
+		network.Swarm().SetFilters(cfg.Filters)
+	}
 
-	host := p2pbhost.New(network, p2pbhost.NATPortMap)
-	return host, nil
+	var opts []p2pbhost.Option
+	if cfg.NATPortMap {
+		opts = append(opts, p2pbhost.NATPortMap)
+	}
+	host := p2pbhost.New(network, opts...)
+	return meteredhost.Wrap(host, meteredhost.NewMeter()), nil
 }
 
 // startListening on the network addresses
@@ -495,3 +1559,51 @@ func constructDHTRouting(ctx context.Context, host p2phost.Host, dstore ds.Threa
 type RoutingOption func(context.Context, p2phost.Host, ds.ThreadSafeDatastore) (routing.IpfsRouting, error)
 
 var DHTOption RoutingOption = constructDHTRouting
+
+// NilRoutingOption runs the node without a routing system: nothing is found
+// or announced, and blocks are only exchanged with peers connected to
+// explicitly.
+var NilRoutingOption RoutingOption = nilrouting.ConstructNilRouting
+
+// TieredRoutingOption combines the routing systems built by the given
+// options. Lookups try them in order, announcements go to all of them.
+func TieredRoutingOption(opts ...RoutingOption) RoutingOption {
+	return func(ctx context.Context, host p2phost.Host, dstore ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
+		var routers tiered.Tiered
+		for _, opt := range opts {
+			r, err := opt(ctx, host, dstore)
+			if err != nil {
+				routers.Close()
+				return nil, err
+			}
+			routers = append(routers, r)
+		}
+		return routers, nil
+	}
+}
+
+type PinnerOption func(ds.ThreadSafeDatastore, merkledag.DAGService) (pin.Pinner, error)
+
+var DefaultPinnerOption PinnerOption = loadPinner
+
+// loadPinner loads the pin state stored in the datastore, starting with an
+// empty pinner if there is none.
+func loadPinner(dstore ds.ThreadSafeDatastore, dserv merkledag.DAGService) (pin.Pinner, error) {
+	p, err := pin.LoadPinner(dstore, dserv)
+	if err != nil {
+		return pin.NewPinner(dstore, dserv), nil
+	}
+	return p, nil
+}
+
+type BlockstoreOption func(ds.ThreadSafeDatastore) (bstore.Blockstore, error)
+
+var DefaultBlockstoreOption = WriteCachedBlockstoreOption(kSizeBlockstoreWriteCache)
+
+// WriteCachedBlockstoreOption constructs a datastore backed blockstore that
+// caches up to size unique writes.
+func WriteCachedBlockstoreOption(size int) BlockstoreOption {
+	return func(dstore ds.ThreadSafeDatastore) (bstore.Blockstore, error) {
+		return bstore.WriteCached(bstore.NewBlockstore(dstore), size)
+	}
+}
@@ -1,11 +1,35 @@
 package core
 
 import (
+	"encoding/base64"
+	"errors"
 	"testing"
+	"time"
 
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	bserv "github.com/jbenet/go-ipfs/blockservice"
+	bitswap "github.com/jbenet/go-ipfs/exchange/bitswap"
+	bsnet "github.com/jbenet/go-ipfs/exchange/bitswap/network"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	ci "github.com/jbenet/go-ipfs/p2p/crypto"
+	p2phost "github.com/jbenet/go-ipfs/p2p/host"
+	meteredhost "github.com/jbenet/go-ipfs/p2p/host/metered"
+	inet "github.com/jbenet/go-ipfs/p2p/net"
+	mocknet "github.com/jbenet/go-ipfs/p2p/net/mock"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	path "github.com/jbenet/go-ipfs/path"
+	pin "github.com/jbenet/go-ipfs/pin"
 	"github.com/jbenet/go-ipfs/repo"
 	config "github.com/jbenet/go-ipfs/repo/config"
+	routing "github.com/jbenet/go-ipfs/routing"
+	dht "github.com/jbenet/go-ipfs/routing/dht"
+	tiered "github.com/jbenet/go-ipfs/routing/tiered"
+	u "github.com/jbenet/go-ipfs/util"
 	"github.com/jbenet/go-ipfs/util/testutil"
 )
 
@@ -66,7 +90,1640 @@ func TestInitialization(t *testing.T) {
 	}
 }
 
+func TestCustomPinner(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+
+	var custom pin.Pinner
+	po := func(d ds.ThreadSafeDatastore, dserv merkledag.DAGService) (pin.Pinner, error) {
+		custom = pin.NewPinner(d, dserv)
+		return custom, nil
+	}
+
+	n, err := NewNodeBuilder().SetRepo(r).SetPinner(po).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom == nil || n.Pinning != custom {
+		t.Fatal("node did not use the custom pinner")
+	}
+}
+
+func TestCustomBlockstore(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+
+	var custom bstore.Blockstore
+	bo := func(d ds.ThreadSafeDatastore) (bstore.Blockstore, error) {
+		custom = bstore.NewBlockstore(d)
+		return custom, nil
+	}
+
+	n, err := NewNodeBuilder().SetRepo(r).SetBlockstore(bo).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom == nil || n.Blockstore != custom {
+		t.Fatal("node did not use the custom blockstore")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+
+	var flushed bool
+	bo := func(d ds.ThreadSafeDatastore) (bstore.Blockstore, error) {
+		return &flushingBlockstore{bstore.NewBlockstore(d), &flushed}, nil
+	}
+	n, err := NewNodeBuilder().SetRepo(r).SetBlockstore(bo).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !flushed {
+		t.Fatal("blockstore not flushed")
+	}
+}
+
+type flushingBlockstore struct {
+	bstore.Blockstore
+	flushed *bool
+}
+
+func (f *flushingBlockstore) Flush() error {
+	*f.flushed = true
+	return nil
+}
+
+func TestRepoNeedsMigration(t *testing.T) {
+	r := &versionedRepo{
+		Mock: &repo.Mock{
+			C: config.Config{Identity: testIdentity},
+			D: testutil.ThreadSafeCloserMapDatastore(),
+		},
+		version: repo.CurrentVersion + 1,
+	}
+	_, err := NewIPFSNode(context.TODO(), Offline(r))
+	if nm, ok := err.(*repo.ErrNeedsMigration); !ok || nm.From != r.version || nm.To != repo.CurrentVersion {
+		t.Fatalf("expected ErrNeedsMigration, got %v", err)
+	}
+
+	r.version = repo.CurrentVersion
+	n, err := NewIPFSNode(context.TODO(), Offline(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Close()
+}
+
+type versionedRepo struct {
+	*repo.Mock
+	version int
+}
+
+func (r *versionedRepo) Version() (int, error) { return r.version, nil }
+
+func TestMemoryRepo(t *testing.T) {
+	r, err := repo.NewMemory(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewIPFSNode(context.TODO(), Offline(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if n.Identity.Pretty() != r.Config().Identity.PeerID {
+		t.Fatal("node does not use the identity of the repo")
+	}
+	k, err := n.AddBlockWithHash([]byte("in memory"), mh.SHA2_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, err := n.Has(context.TODO(), k); err != nil || !has {
+		t.Fatalf("added block not found: %v", err)
+	}
+}
+
+func TestGoOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	if !n.OnlineMode() {
+		t.Fatal("node should have started online")
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if n.OnlineMode() || n.PeerHost != nil || n.Routing != nil {
+		t.Fatal("node should be offline")
+	}
+
+	// the DAG must still be usable
+	k, err := n.DAG.Add(&merkledag.Node{Data: []byte("still here")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.DAG.Get(context.Background(), k); err != nil {
+		t.Fatal(err)
+	}
+
+	// going offline twice is fine
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoOnline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	k, err := n.DAG.Add(&merkledag.Node{Data: []byte("stays around")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.GoOnline(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !n.OnlineMode() || n.PeerHost == nil || n.Routing == nil {
+		t.Fatal("node should be online")
+	}
+	if _, err := n.DAG.Get(context.Background(), k); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.GoOnline(ctx); err == nil {
+		t.Fatal("expected an error starting an online node")
+	}
+}
+
+// newMockOnlineNode builds an online node on top of a mock network.
+func newMockOnlineNode(t *testing.T, ctx context.Context) *IpfsNode {
+	return newMockNetNode(t, ctx, mocknet.New(ctx))
+}
+
+// newMockNetNode builds an online node whose host is part of the given mocknet
+func newMockNetNode(t *testing.T, ctx context.Context, mn mocknet.Mocknet) *IpfsNode {
+	return newMockRoutedNode(t, ctx, mn, testIdentity, DHTOption)
+}
+
+// newMockRoutedNode is newMockNetNode with the given identity and routing
+// system
+func newMockRoutedNode(t *testing.T, ctx context.Context, mn mocknet.Mocknet, ident config.Identity, ro RoutingOption) *IpfsNode {
+	cfg := config.Config{
+		Identity: ident,
+		Addresses: config.Addresses{
+			Swarm: []string{"/ip4/127.0.0.1/tcp/4001"},
+		},
+	}
+	n, err := buildMockNetNode(ctx, mn, cfg, ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// buildMockNetNode builds an online node with the given config, whose host is
+// part of the given mocknet
+func buildMockNetNode(ctx context.Context, mn mocknet.Mocknet, cfg config.Config, ro RoutingOption) (*IpfsNode, error) {
+	ho := func(ctx context.Context, id peer.ID, ps peer.Peerstore) (p2phost.Host, error) {
+		a, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+		if err != nil {
+			return nil, err
+		}
+		h, err := mn.AddPeer(ps.PrivKey(id), a)
+		if err != nil {
+			return nil, err
+		}
+		// like constructPeerHost
+		return meteredhost.Wrap(h, meteredhost.NewMeter()), nil
+	}
+
+	r := &repo.Mock{
+		C: cfg,
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	return NewNodeBuilder().Online().SetRepo(r).SetHost(ho).SetRouting(ro).Build(ctx)
+}
+
+func TestRestartRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var fail bool
+	failing := func(ctx context.Context, h p2phost.Host, d ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
+		if fail {
+			return nil, errors.New("routing unavailable")
+		}
+		return DHTOption(ctx, h, d)
+	}
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, failing)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), DHTOption)
+	defer b.Close()
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Connect(ctx, b.PeerHost.Peerstore().PeerInfo(b.Identity)); err != nil {
+		t.Fatal(err)
+	}
+	bcfg := BootstrapConfigWithPeers(nil)
+	bcfg.MinPeerThreshold = 1
+	if err := a.Bootstrap(bcfg); err != nil {
+		t.Fatal(err)
+	}
+
+	old := a.Routing.(*dht.IpfsDHT)
+	if err := a.RestartRouting(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-old.Closing():
+	default:
+		t.Fatal("old routing system not closed")
+	}
+	d, ok := a.Routing.(*dht.IpfsDHT)
+	if !ok || d == old {
+		t.Fatal("routing system not replaced")
+	}
+	if a.routing.get() != a.Routing {
+		t.Fatal("online services not switched to the new routing system")
+	}
+	if d.FindLocal(b.Identity).ID != b.Identity {
+		t.Fatal("connected peer missing from the new routing table")
+	}
+
+	// lookups go through the new routing system
+	k := u.Key(u.Hash([]byte("provided")))
+	if err := b.Routing.Provide(ctx, k); err != nil {
+		t.Fatal(err)
+	}
+	fctx, fcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer fcancel()
+	var found bool
+	for pi := range a.Routing.FindProvidersAsync(fctx, k, 1) {
+		found = found || pi.ID == b.Identity
+	}
+	if !found {
+		t.Fatal("provider not found after restarting routing")
+	}
+	if a.bootstrapConfig.MinPeerThreshold != 1 {
+		t.Fatal("expected to bootstrap again with the same configuration")
+	}
+
+	// a failed restart keeps the routing system working
+	fail = true
+	if err := a.RestartRouting(ctx); err == nil {
+		t.Fatal("expected the restart to fail")
+	}
+	select {
+	case <-d.Closing():
+		t.Fatal("routing system closed by a failed restart")
+	default:
+	}
+	if a.Routing != d || a.routing.get() != d {
+		t.Fatal("routing system replaced by a failed restart")
+	}
+	if _, err := a.Routing.FindPeer(ctx, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RestartRouting(ctx); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestProvide(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, DHTOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), DHTOption)
+	defer b.Close()
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Connect(ctx, b.PeerHost.Peerstore().PeerInfo(b.Identity)); err != nil {
+		t.Fatal(err)
+	}
+
+	child := &merkledag.Node{Data: []byte("child")}
+	root := &merkledag.Node{Data: []byte("root")}
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	// added without announcing them
+	if _, err := a.LocalDAG().Add(child); err != nil {
+		t.Fatal(err)
+	}
+	rk, err := a.LocalDAG().Add(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ck, _ := child.Key()
+
+	if err := a.Provide(ctx, rk, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []u.Key{rk, ck} {
+		fctx, fcancel := context.WithTimeout(ctx, 5*time.Second)
+		var found bool
+		for pi := range b.Routing.FindProvidersAsync(fctx, k, 1) {
+			found = found || pi.ID == a.Identity
+		}
+		fcancel()
+		if !found {
+			t.Fatalf("provider of %s not found", k)
+		}
+	}
+
+	missing := u.Key(u.Hash([]byte("missing")))
+	if err := a.Provide(ctx, missing, false); err != bstore.ErrNotFound {
+		t.Fatalf("expected blockstore.ErrNotFound, got %v", err)
+	}
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Provide(ctx, rk, false); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestProvideWhileGoingOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	k, err := n.DAG.Add(&merkledag.Node{Data: []byte("provided")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// other errors are fine: the routing system has no peers
+		for i := 0; n.Provide(ctx, k, false) != ErrNodeOffline; i++ {
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestPublishWhileGoingOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	k := u.Key(u.Hash([]byte("published")))
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// other errors are fine: the routing system has no peers
+		for i := 0; n.PublishWithKey(ctx, n.Identity, k) != ErrNodeOffline; i++ {
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestFindProvidersWhileGoingOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	k := u.Key(u.Hash([]byte("searched")))
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			provs, err := n.FindProviders(ctx, k, 1)
+			if err == ErrNodeOffline {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _ = range provs {
+			}
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestFindProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, DHTOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), DHTOption)
+	defer b.Close()
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Connect(ctx, b.PeerHost.Peerstore().PeerInfo(b.Identity)); err != nil {
+		t.Fatal(err)
+	}
+
+	k := u.Key(u.Hash([]byte("provided")))
+	if err := b.Routing.Provide(ctx, k); err != nil {
+		t.Fatal(err)
+	}
+	fctx, fcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer fcancel()
+	provs, err := a.FindProviders(fctx, k, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []peer.ID
+	for pi := range provs {
+		found = append(found, pi.ID)
+	}
+	if len(found) != 1 || found[0] != b.Identity {
+		t.Fatalf("expected to find %s, found %v", b.Identity, found)
+	}
+
+	// cancelling closes the channel, however long the search would go on
+	cctx, ccancel := context.WithCancel(ctx)
+	provs, err = a.FindProviders(cctx, u.Key(u.Hash([]byte("unknown"))), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccancel()
+	select {
+	case <-provs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancelling")
+	}
+
+	if _, err := a.FindProviders(ctx, k, 0); err == nil {
+		t.Fatal("expected an error for a limit of zero")
+	}
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.FindProviders(ctx, k, 1); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestNilRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, NilRoutingOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	bi := peer.PeerInfo{ID: b.Identity, Addrs: b.PeerHost.Addrs()}
+	if err := a.Connect(ctx, bi); err != nil {
+		t.Fatal(err)
+	}
+
+	// without routing, blocks come from the peers we are connected to
+	nd := &merkledag.Node{Data: []byte("no dht needed")}
+	k, err := a.DAG.Add(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tctx, tcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer tcancel()
+	got, err := b.DAG.GetNodes(tctx, []u.Key{k})[0].Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Data) != "no dht needed" {
+		t.Fatal("got the wrong node")
+	}
+}
+
+func TestTieredRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := newMockRoutedNode(t, ctx, mocknet.New(ctx), testIdentity, TieredRoutingOption(DHTOption))
+	defer n.Close()
+
+	routers, ok := n.Routing.(tiered.Tiered)
+	if !ok || len(routers) != 1 {
+		t.Fatalf("expected a tiered router, got %T", n.Routing)
+	}
+	d, ok := routers[0].(*dht.IpfsDHT)
+	if !ok {
+		t.Fatalf("expected the dht behind the tiered router, got %T", routers[0])
+	}
+	if _, ok := d.Validator[IpnsValidatorTag]; !ok {
+		t.Fatal("ipns validator not registered")
+	}
+}
+
+func TestConnectDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	n := newMockNetNode(t, ctx, mn)
+	defer n.Close()
+
+	other, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mn.LinkPeers(n.Identity, other.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	pi := peer.PeerInfo{ID: other.ID(), Addrs: other.Addrs()}
+	if err := n.Connect(ctx, pi); err != nil {
+		t.Fatal(err)
+	}
+	if n.PeerHost.Network().Connectedness(other.ID()) != inet.Connected {
+		t.Fatal("expected to be connected to peer")
+	}
+
+	if err := n.Disconnect(other.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if n.PeerHost.Network().Connectedness(other.ID()) == inet.Connected {
+		t.Fatal("expected to be disconnected from peer")
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Connect(ctx, pi); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+	if err := n.Disconnect(other.ID()); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestDisconnectWhileGoingOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; n.Disconnect(peer.ID("other")) != ErrNodeOffline; i++ {
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	n := newMockNetNode(t, ctx, mn)
+	defer n.Close()
+
+	if ps := n.Peers(); len(ps) != 0 {
+		t.Fatalf("expected no peers, got %d", len(ps))
+	}
+
+	other, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mn.LinkPeers(n.Identity, other.ID()); err != nil {
+		t.Fatal(err)
+	}
+	n.PeerHost.Peerstore().RecordLatency(other.ID(), 50*time.Millisecond)
+
+	if err := n.Connect(ctx, peer.PeerInfo{ID: other.ID(), Addrs: other.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := n.Peers()
+	if len(ps) != 1 {
+		t.Fatalf("expected one peer, got %d", len(ps))
+	}
+	if ps[0].ID != other.ID() {
+		t.Fatal("wrong peer listed")
+	}
+	if len(ps[0].Addrs) == 0 {
+		t.Fatal("expected connection addresses")
+	}
+	if ps[0].Latency != 50*time.Millisecond {
+		t.Fatalf("wrong latency: %s", ps[0].Latency)
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if ps := n.Peers(); ps == nil || len(ps) != 0 {
+		t.Fatal("expected an empty list when offline")
+	}
+}
+
+func TestBitswapInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	if wl := n.Wantlist(); len(wl) != 0 {
+		t.Fatalf("expected an empty wantlist, got %d keys", len(wl))
+	}
+	st, err := n.BitswapStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.BlocksReceived != 0 || st.BlocksSent != 0 {
+		t.Fatal("expected no blocks to have been exchanged")
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if wl := n.Wantlist(); wl != nil {
+		t.Fatal("expected no wantlist when offline")
+	}
+	if _, err := n.BitswapStat(); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestBitswapStatWhileGoingOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			n.Wantlist()
+			if _, err := n.BitswapStat(); err == ErrNodeOffline {
+				return
+			}
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestProviderSearchDelayConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.Config{
+		Identity: testIdentity,
+		Addresses: config.Addresses{
+			Swarm: []string{"/ip4/127.0.0.1/tcp/4001"},
+		},
+		Exchange: config.Exchange{ProviderSearchDelay: "250ms"},
+	}
+	n, err := buildMockNetNode(ctx, mocknet.New(ctx), cfg, DHTOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	if d := n.Exchange.(*bitswap.Bitswap).ProviderSearchDelay.Get(); d != 250*time.Millisecond {
+		t.Fatalf("expected a provider search delay of 250ms, got %s", d)
+	}
+
+	cfg.Exchange.ProviderSearchDelay = "soon"
+	if _, err := buildMockNetNode(ctx, mocknet.New(ctx), cfg, DHTOption); err == nil {
+		t.Fatal("expected an invalid provider search delay to be refused")
+	}
+}
+
+func TestHas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	local, err := n.DAG.Add(&merkledag.Node{Data: []byte("local")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := (&merkledag.Node{Data: []byte("missing")}).Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if has, err := n.Has(ctx, local); err != nil || !has {
+		t.Fatalf("expected the added block to be local: %v", err)
+	}
+	// an online node must not block waiting for bitswap
+	if has, err := n.Has(ctx, missing); err != nil || has {
+		t.Fatalf("expected the block to be missing: %v", err)
+	}
+
+	if has, err := n.HasAll([]u.Key{local}); err != nil || !has {
+		t.Fatalf("expected all blocks to be local: %v", err)
+	}
+	if has, err := n.HasAll([]u.Key{local, missing}); err != nil || has {
+		t.Fatalf("expected a block to be missing: %v", err)
+	}
+}
+
+func TestAddrFilters(t *testing.T) {
+	cfg := &config.Config{Swarm: config.Swarm{
+		AllowCIDRs: []string{"10.0.0.0/8"},
+		DenyCIDRs:  []string{"10.1.0.0/16"},
+	}}
+	fs, err := addrFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"/ip4/10.0.0.1/tcp/4001": false,
+		"/ip4/10.1.0.1/tcp/4001": true,
+		"/ip4/8.8.8.8/tcp/4001":  true,
+	}
+	for s, blocked := range cases {
+		if fs.AddrBlocked(ma.StringCast(s)) != blocked {
+			t.Fatalf("expected %s blocked: %t", s, blocked)
+		}
+	}
+
+	cfg.Swarm.DenyCIDRs = []string{"10.1.0.0"}
+	if _, err := addrFilters(cfg); err == nil {
+		t.Fatal("expected an error for a malformed CIDR")
+	}
+}
+
+func TestNATStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+	status, err := n.NATStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mock host maps no ports
+	if !status.Enabled || status.DeviceFound || status.Mapped() {
+		t.Fatalf("unexpected NAT status: %+v", status)
+	}
+
+	cfg := config.Config{
+		Identity: testIdentity,
+		Addresses: config.Addresses{
+			Swarm: []string{"/ip4/127.0.0.1/tcp/4001"},
+		},
+		Swarm: config.Swarm{DisableNatPortMap: true},
+	}
+	disabled, err := buildMockNetNode(ctx, mocknet.New(ctx), cfg, NilRoutingOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disabled.Close()
+	if status, err := disabled.NATStatus(); err != nil || status.Enabled {
+		t.Fatalf("expected NAT port mapping to be disabled: %+v, %v", status, err)
+	}
+
+	if err := disabled.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := disabled.NATStatus(); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestMaxBlockSizeConfig(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity:  testIdentity,
+			Datastore: config.Datastore{MaxBlockSize: 64},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if _, err := n.DAG.Add(&merkledag.Node{Data: []byte("small")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = n.DAG.Add(&merkledag.Node{Data: make([]byte, 64)})
+	if _, ok := err.(*bserv.BlockTooLargeError); !ok {
+		t.Fatalf("expected a BlockTooLargeError, got %v", err)
+	}
+}
+
+func TestPinQueries(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := &merkledag.Node{Data: []byte("child")}
+	root := &merkledag.Node{Data: []byte("root")}
+	if err := root.AddNodeLink("c", child); err != nil {
+		t.Fatal(err)
+	}
+	direct := &merkledag.Node{Data: []byte("direct")}
+	for _, nd := range []*merkledag.Node{root, direct} {
+		if err := n.DAG.AddRecursive(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := n.Pinning.Pin(root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Pinning.Pin(direct, false); err != nil {
+		t.Fatal(err)
+	}
+
+	rk, _ := root.Key()
+	ck, _ := child.Key()
+	dk, _ := direct.Key()
+	nk, _ := (&merkledag.Node{Data: []byte("not pinned")}).Key()
+
+	for k, mode := range map[u.Key]string{rk: "recursive", ck: "indirect", dk: "direct", nk: ""} {
+		pinned, m, err := n.IsPinned(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pinned != (mode != "") || m != mode {
+			t.Fatalf("%s: expected mode %q, got %q", k, mode, m)
+		}
+	}
+
+	pins, err := n.Pins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("expected two pins, got %d", len(pins))
+	}
+}
+
+func TestExtraKeys(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk, _, err := ci.GenerateKeyPair(ci.RSA, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := n.AddKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := n.ListKeys(); len(ids) != 1 || ids[0] != id {
+		t.Fatal("added key not listed")
+	}
+
+	val, err := (&merkledag.Node{Data: []byte("published")}).Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PublishWithKey(ctx, id, val); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+
+	if err := n.SetupOfflineRouting(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PublishWithKey(ctx, id, val); err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.Namesys.Resolve(ctx, id.Pretty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != val {
+		t.Fatalf("resolved to %s, expected %s", got, val)
+	}
+	// the node's own name is untouched
+	if _, err := n.Namesys.Resolve(ctx, n.Identity.Pretty()); err == nil {
+		t.Fatal("expected the node's own name to be unpublished")
+	}
+
+	if err := n.RemoveKey(id); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.ListKeys()) != 0 {
+		t.Fatal("removed key still listed")
+	}
+	if err := n.PublishWithKey(ctx, id, val); err == nil {
+		t.Fatal("expected publishing with a removed key to fail")
+	}
+}
+
+func TestEncryptedPrivateKey(t *testing.T) {
+	ident := testIdentity
+	if err := ident.EncryptPrivateKey("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(pf PassphraseFunc) error {
+		r := &repo.Mock{
+			C: config.Config{Identity: ident},
+			D: testutil.ThreadSafeCloserMapDatastore(),
+		}
+		n, err := NewNodeBuilder().SetRepo(r).SetPassphrase(pf).Build(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.LoadPrivateKey()
+	}
+	pass := func(p string) PassphraseFunc {
+		return func() (string, error) { return p, nil }
+	}
+
+	if err := load(nil); err != ErrNoPassphrase {
+		t.Fatalf("expected ErrNoPassphrase, got %v", err)
+	}
+	if err := load(pass("wrong")); err != config.ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := load(pass("secret")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type errCloser struct {
+	err    error
+	closed bool
+}
+
+func (c *errCloser) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestCloseAllReportsAllErrors(t *testing.T) {
+	errA, errB := errors.New("a failed"), errors.New("b failed")
+	a, ok, b := &errCloser{err: errA}, &errCloser{}, &errCloser{err: errB}
+
+	err := closeAll([]namedCloser{{"a", a}, {"ok", ok}, {"b", b}})
+	if !a.closed || !ok.closed || !b.closed {
+		t.Fatal("not all closers were closed")
+	}
+	merr, isMulti := err.(u.MultiErr)
+	if !isMulti || len(merr) != 2 || merr[0] != errA || merr[1] != errB {
+		t.Fatalf("expected both errors, got %v", err)
+	}
+
+	if err := closeAll([]namedCloser{{"ok", ok}, {"a", a}}); err != errA {
+		t.Fatalf("expected a single error as is, got %v", err)
+	}
+	if err := closeAll([]namedCloser{{"ok", ok}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type hangingCloser chan struct{}
+
+func (c hangingCloser) Close() error {
+	<-c
+	return nil
+}
+
+func TestCloseAllTimesOut(t *testing.T) {
+	prev := TeardownTimeout
+	TeardownTimeout = 10 * time.Millisecond
+	defer func() { TeardownTimeout = prev }()
+
+	hang := make(hangingCloser)
+	defer close(hang)
+	after := &errCloser{}
+
+	err := closeAll([]namedCloser{{"hanging", hang}, {"after", after}})
+	if err != (CloseTimeoutError{"hanging"}) {
+		t.Fatalf("expected a timeout for the hanging closer, got %v", err)
+	}
+	if !after.closed {
+		t.Fatal("closers after the hanging one were not closed")
+	}
+}
+
+// newTestIdentity generates a fresh identity, for tests needing several
+// nodes.
+func newTestIdentity(t *testing.T) config.Identity {
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skbytes, err := sk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.Identity{
+		PeerID:  id.Pretty(),
+		PrivKey: base64.StdEncoding.EncodeToString(skbytes),
+	}
+}
+
 var testIdentity = config.Identity{
 	PeerID:  "QmNgdzLieYi8tgfo2WfTUzNVH5hQK9oAYGVf6dxN12NrHt",
 	PrivKey: "CAASrRIwggkpAgEAAoICAQCwt67GTUQ8nlJhks6CgbLKOx7F5tl1r9zF4m3TUrG3Pe8h64vi+ILDRFd7QJxaJ/n8ux9RUDoxLjzftL4uTdtv5UXl2vaufCc/C0bhCRvDhuWPhVsD75/DZPbwLsepxocwVWTyq7/ZHsCfuWdoh/KNczfy+Gn33gVQbHCnip/uhTVxT7ARTiv8Qa3d7qmmxsR+1zdL/IRO0mic/iojcb3Oc/PRnYBTiAZFbZdUEit/99tnfSjMDg02wRayZaT5ikxa6gBTMZ16Yvienq7RwSELzMQq2jFA4i/TdiGhS9uKywltiN2LrNDBcQJSN02pK12DKoiIy+wuOCRgs2NTQEhU2sXCk091v7giTTOpFX2ij9ghmiRfoSiBFPJA5RGwiH6ansCHtWKY1K8BS5UORM0o3dYk87mTnKbCsdz4bYnGtOWafujYwzueGx8r+IWiys80IPQKDeehnLW6RgoyjszKgL/2XTyP54xMLSW+Qb3BPgDcPaPO0hmop1hW9upStxKsefW2A2d46Ds4HEpJEry7PkS5M4gKL/zCKHuxuXVk14+fZQ1rstMuvKjrekpAC2aVIKMI9VRA3awtnje8HImQMdj+r+bPmv0N8rTTr3eS4J8Yl7k12i95LLfK+fWnmUh22oTNzkRlaiERQrUDyE4XNCtJc0xs1oe1yXGqazCIAQIDAQABAoICAQCk1N/ftahlRmOfAXk//8wNl7FvdJD3le6+YSKBj0uWmN1ZbUSQk64chr12iGCOM2WY180xYjy1LOS44PTXaeW5bEiTSnb3b3SH+HPHaWCNM2EiSogHltYVQjKW+3tfH39vlOdQ9uQ+l9Gh6iTLOqsCRyszpYPqIBwi1NMLY2Ej8PpVU7ftnFWouHZ9YKS7nAEiMoowhTu/7cCIVwZlAy3AySTuKxPMVj9LORqC32PVvBHZaMPJ+X1Xyijqg6aq39WyoztkXg3+Xxx5j5eOrK6vO/Lp6ZUxaQilHDXoJkKEJjgIBDZpluss08UPfOgiWAGkW+L4fgUxY0qDLDAEMhyEBAn6KOKVL1JhGTX6GjhWziI94bddSpHKYOEIDzUy4H8BXnKhtnyQV6ELS65C2hj9D0IMBTj7edCF1poJy0QfdK0cuXgMvxHLeUO5uc2YWfbNosvKxqygB9rToy4b22YvNwsZUXsTY6Jt+p9V2OgXSKfB5VPeRbjTJL6xqvvUJpQytmII/C9JmSDUtCbYceHj6X9jgigLk20VV6nWHqCTj3utXD6NPAjoycVpLKDlnWEgfVELDIk0gobxUqqSm3jTPEKRPJgxkgPxbwxYumtw++1UY2y35w3WRDc2xYPaWKBCQeZy+mL6ByXp9bWlNvxS3Knb6oZp36/ovGnf2pGvdQKCAQEAyKpipz2lIUySDyE0avVWAmQb2tWGKXALPohzj7AwkcfEg2GuwoC6GyVE2sTJD1HRazIjOKn3yQORg2uOPeG7sx7EKHxSxCKDrbPawkvLCq8JYSy9TLvhqKUVVGYPqMBzu2POSLEA81QXas+aYjKOFWA2Zrjq26zV9ey3+6Lc6WULePgRQybU8+RHJc6fdjUCCfUxgOrUO2IQOuTJ+FsDpVnrMUGlokmWn23OjL4qTL9wGDnWGUs2pjSzNbj3qA0d8iqaiMUyHX/D/VS0wpeT1osNBSm8suvSibYBn+7wbIApbwXUxZaxMv2OHGz3empae4ckvNZs7r8wsI9UwFt8mwKCAQEA4XK6gZkv9t+3YCcSPw2ensLvL/xU7i2bkC9tfTGdjnQfzZXIf5KNdVuj/SerOl2S1s45NMs3ysJbADwRb4ahElD/V71nGzV8fpFTitC20ro9fuX4J0+twmBolHqeH9pmeGTjAeL1rvt6vxs4FkeG/yNft7GdXpXTtEGaObn8Mt0tPY+aB3UnKrnCQoQAlPyGHFrVRX0UEcp6wyyNGhJCNKeNOvqCHTFObhbhO+KWpWSN0MkVHnqaIBnIn1Te8FtvP/iTwXGnKc0YXJUG6+LM6LmOguW6tg8ZqiQeYyyR+e9eCFH4csLzkrTl1GxCxwEsoSLIMm7UDcjttW6tYEghkwKCAQEAmeCO5lCPYImnN5Lu71ZTLmI2OgmjaANTnBBnDbi+hgv61gUCToUIMejSdDCTPfwv61P3TmyIZs0luPGxkiKYHTNqmOE9Vspgz8Mr7fLRMNApESuNvloVIY32XVImj/GEzh4rAfM6F15U1sN8T/EUo6+0B/Glp+9R49QzAfRSE2g48/rGwgf1JVHYfVWFUtAzUA+GdqWdOixo5cCsYJbqpNHfWVZN/bUQnBFIYwUwysnC29D+LUdQEQQ4qOm+gFAOtrWU62zMkXJ4iLt8Ify6kbrvsRXgbhQIzzGS7WH9XDarj0eZciuslr15TLMC1Azadf+cXHLR9gMHA13mT9vYIQKCAQA/DjGv8cKCkAvf7s2hqROGYAs6Jp8yhrsN1tYOwAPLRhtnCs+rLrg17M2vDptLlcRuI/vIElamdTmylRpjUQpX7yObzLO73nfVhpwRJVMdGU394iBIDncQ+JoHfUwgqJskbUM40dvZdyjbrqc/Q/4z+hbZb+oN/GXb8sVKBATPzSDMKQ/xqgisYIw+wmDPStnPsHAaIWOtni47zIgilJzD0WEk78/YjmPbUrboYvWziK5JiRRJFA1rkQqV1c0M+OXixIm+/yS8AksgCeaHr0WUieGcJtjT9uE8vyFop5ykhRiNxy9wGaq6i7IEecsrkd6DqxDHWkwhFuO1bSE83q/VAoIBAEA+RX1i/SUi08p71ggUi9WFMqXmzELp1L3hiEjOc2AklHk2rPxsaTh9+G95BvjhP7fRa/Yga+yDtYuyjO99nedStdNNSg03aPXILl9gs3r2dPiQKUEXZJ3FrH6tkils/8BlpOIRfbkszrdZIKTO9GCdLWQ30dQITDACs8zV/1GFGrHFrqnnMe/NpIFHWNZJ0/WZMi8wgWO6Ik8jHEpQtVXRiXLqy7U6hk170pa4GHOzvftfPElOZZjy9qn7KjdAQqy6spIrAE94OEL+fBgbHQZGLpuTlj6w6YGbMtPU8uo7sXKoc6WOCb68JWft3tejGLDa1946HAWqVM9B/UcneNc=",
 }
+
+func TestRunDiagnostics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockNetNode(t, ctx, mn)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	bi := peer.PeerInfo{ID: b.Identity, Addrs: b.PeerHost.Addrs()}
+	if err := a.Connect(ctx, bi); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := a.RunDiagnostics(ctx, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info) != 2 {
+		t.Fatalf("expected info from 2 nodes, got %d", len(info))
+	}
+	if info[0].ID != a.Identity.Pretty() {
+		t.Fatal("expected our own info first")
+	}
+	if info[1].ID != b.Identity.Pretty() {
+		t.Fatal("expected info from the connected peer")
+	}
+	if len(info[1].Connections) != 1 || info[1].Connections[0].ID != a.Identity.Pretty() {
+		t.Fatal("expected the peer to report its connection to us")
+	}
+
+	if err := a.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.RunDiagnostics(ctx, time.Second); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestBandwidthStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, NilRoutingOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	bi := peer.PeerInfo{ID: b.Identity, Addrs: b.PeerHost.Addrs()}
+	if err := a.Connect(ctx, bi); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := a.DAG.Add(&merkledag.Node{Data: make([]byte, 4096)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tctx, tcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer tcancel()
+	if _, err := b.DAG.GetNodes(tctx, []u.Key{k})[0].Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := b.BandwidthStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := stats[bsnet.ProtocolBitswap][a.Identity]; st.TotalIn < 4096 {
+		t.Fatalf("expected to have received the block over bitswap, got %+v", st)
+	}
+
+	if err := b.ResetBandwidthStats(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = b.BandwidthStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := stats[bsnet.ProtocolBitswap][a.Identity]; st.TotalIn != 0 || st.TotalOut != 0 {
+		t.Fatalf("expected reset stats, got %+v", st)
+	}
+
+	if err := b.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.BandwidthStats(); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+}
+
+func TestConnManager(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+	c := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer c.Close()
+
+	cfg := config.Config{
+		Identity: testIdentity,
+		Addresses: config.Addresses{
+			Swarm: []string{"/ip4/127.0.0.1/tcp/4001"},
+		},
+		Bootstrap: []string{"/ip4/127.0.0.1/tcp/4001/ipfs/" + b.Identity.Pretty()},
+		ConnMgr:   config.ConnMgr{HighWater: 1, LowWater: 0},
+	}
+	a, err := buildMockNetNode(ctx, mn, cfg, NilRoutingOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if a.ConnManager == nil {
+		t.Fatal("expected a connection manager")
+	}
+
+	for _, other := range []*IpfsNode{b, c} {
+		if _, err := mn.LinkPeers(a.Identity, other.Identity); err != nil {
+			t.Fatal(err)
+		}
+		pi := peer.PeerInfo{ID: other.Identity, Addrs: other.PeerHost.Addrs()}
+		if err := a.Connect(ctx, pi); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// going over the high watermark trims the connections
+	net := a.PeerHost.Network()
+	for i := 0; len(net.Conns()) > 1; i++ {
+		if i > 100 {
+			t.Fatalf("still %d connections open", len(net.Conns()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if net.Connectedness(b.Identity) != inet.Connected {
+		t.Fatal("expected the bootstrap peer to stay connected")
+	}
+
+	cfg.ConnMgr.LowWater = 1
+	if _, err := buildMockNetNode(ctx, mocknet.New(ctx), cfg, NilRoutingOption); err == nil {
+		t.Fatal("expected a low watermark that is not below the high one to fail")
+	}
+}
+
+func TestAddBlockWithHash(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, NilRoutingOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+
+	k, err := a.AddBlockWithHash([]byte("sha3 block"), mh.SHA3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh, err := mh.Decode([]byte(k))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dh.Code != mh.SHA3 {
+		t.Fatalf("expected a sha3 key, got code %x", dh.Code)
+	}
+
+	if _, err := a.AddBlockWithHash([]byte("nope"), 0x99); err == nil {
+		t.Fatal("expected an unsupported hash function to fail")
+	}
+
+	// the key works with bitswap like any other
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	bi := peer.PeerInfo{ID: b.Identity, Addrs: b.PeerHost.Addrs()}
+	if err := a.Connect(ctx, bi); err != nil {
+		t.Fatal(err)
+	}
+	tctx, tcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer tcancel()
+	blk, err := b.Blocks.GetBlock(tctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(blk.Data) != "sha3 block" {
+		t.Fatal("got the wrong block")
+	}
+}
+
+func TestAddBlocks(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity:  testIdentity,
+			Datastore: config.Datastore{MaxBlockSize: 64},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	bs := []*blocks.Block{
+		blocks.NewBlock([]byte("foo")),
+		blocks.NewBlock([]byte("bar")),
+	}
+	keys, err := n.AddBlocks(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != bs[0].Key() || keys[1] != bs[1].Key() {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if has, err := n.HasAll(keys); err != nil || !has {
+		t.Fatalf("expected the blocks to be stored, got %v, %v", has, err)
+	}
+
+	large := blocks.NewBlock(make([]byte, 65))
+	_, err = n.AddBlocks([]*blocks.Block{blocks.NewBlock([]byte("baz")), large})
+	if _, ok := err.(*bserv.BlockTooLargeError); !ok {
+		t.Fatalf("expected a BlockTooLargeError, got %v", err)
+	}
+	if has, _ := n.Blockstore.Has(blocks.NewBlock([]byte("baz")).Key()); has {
+		t.Fatal("expected no block to be added along with a too large one")
+	}
+}
+
+func TestGetBlockFrom(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, NilRoutingOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	b.PeerHost.Peerstore().AddAddrs(a.Identity, a.PeerHost.Addrs(), peer.PermanentAddrTTL)
+
+	// without routing, b only finds the block through the hint
+	k, err := a.Blocks.AddBlock(blocks.NewBlock([]byte("only on a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tctx, tcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer tcancel()
+	blk, err := b.GetBlockFrom(tctx, k, a.Identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blk.Key() != k {
+		t.Fatal("got the wrong block")
+	}
+	if has, _ := b.Blockstore.Has(k); !has {
+		t.Fatal("expected the block to be stored")
+	}
+}
+
+func TestLocalDAG(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a := newMockRoutedNode(t, ctx, mn, testIdentity, NilRoutingOption)
+	defer a.Close()
+	b := newMockRoutedNode(t, ctx, mn, newTestIdentity(t), NilRoutingOption)
+	defer b.Close()
+	if _, err := mn.LinkPeers(a.Identity, b.Identity); err != nil {
+		t.Fatal(err)
+	}
+	bi := peer.PeerInfo{ID: b.Identity, Addrs: b.PeerHost.Addrs()}
+	if err := a.Connect(ctx, bi); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := a.DAG.Add(&merkledag.Node{Data: []byte("only on a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b is online, yet does not go looking for the node
+	if _, err := b.LocalDAG().Get(context.Background(), k); err != bstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	tctx, tcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer tcancel()
+	if _, err := b.LocalDAG().GetNodes(tctx, []u.Key{k})[0].Get(); err != merkledag.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// once fetched, it is local
+	if _, err := b.DAG.GetNodes(tctx, []u.Key{k})[0].Get(); err != nil {
+		t.Fatal(err)
+	}
+	nd, err := b.LocalDAG().Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "only on a" {
+		t.Fatal("got the wrong node")
+	}
+}
+
+func TestPublishWithLifetime(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := (&merkledag.Node{Data: []byte("short lived")}).Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eol := time.Now().Add(time.Hour)
+	if err := n.PublishWithLifetime(ctx, val, eol); err != ErrNodeOffline {
+		t.Fatalf("expected ErrNodeOffline, got %v", err)
+	}
+
+	if err := n.SetupOfflineRouting(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PublishWithLifetime(ctx, val, eol); err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.Namesys.Resolve(ctx, n.Identity.Pretty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != val {
+		t.Fatalf("resolved to %s, expected %s", got, val)
+	}
+}
+
+func TestPublishOffline(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &merkledag.Node{Data: []byte("published offline")}
+	dir := &merkledag.Node{}
+	if err := dir.AddNodeLink("file", file); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+	dirk, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filek, err := file.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sets up offline routing by itself
+	if err := n.PublishOffline(ctx, "", path.Path("/ipfs/"+dirk.B58String())); err != nil {
+		t.Fatal(err)
+	}
+
+	sk, _, err := ci.GenerateKeyPair(ci.RSA, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := n.AddKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PublishOffline(ctx, id.Pretty(), path.Path("/ipfs/"+dirk.B58String()+"/file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PublishOffline(ctx, "not a key", path.Path("/ipfs/"+dirk.B58String())); err == nil {
+		t.Fatal("expected an invalid key id to fail")
+	}
+
+	// another node using the repo reads the records
+	n2, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n2.SetupOfflineRouting(); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]u.Key{n.Identity.Pretty(): dirk, id.Pretty(): filek} {
+		got, err := n2.Namesys.Resolve(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Fatalf("%s resolved to %s, expected %s", name, got, expected)
+		}
+	}
+}
+
+func TestPublishOfflineAfterGoOffline(t *testing.T) {
+	ctx := context.Background()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	k, err := n.DAG.Add(&merkledag.Node{Data: []byte("published after going offline")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := path.Path("/ipfs/" + k.B58String())
+	if err := n.PublishOffline(ctx, "", value); err != ErrNodeOnline {
+		t.Fatalf("expected ErrNodeOnline, got %v", err)
+	}
+
+	// the private key stays loaded while offline
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.PublishOffline(ctx, "", value); err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.Namesys.Resolve(ctx, n.Identity.Pretty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != k {
+		t.Fatalf("resolved to %s, expected %s", got, k)
+	}
+}
+
+func TestAllKeys(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	expected := make(map[u.Key]bool)
+	for _, data := range []string{"foo", "bar", "baz"} {
+		b := blocks.NewBlock([]byte(data))
+		if err := n.Blockstore.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		expected[b.Key()] = true
+	}
+
+	keys, err := n.AllKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[u.Key]bool)
+	for k := range keys {
+		if !expected[k] || listed[k] {
+			t.Fatalf("unexpected key %s", k)
+		}
+		listed[k] = true
+	}
+	if len(listed) != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), len(listed))
+	}
+
+	// the map datastore lists its keys in no stable order, so only the
+	// sizes of the pages can be checked
+	for _, c := range []struct{ offset, limit, size int }{{0, 2, 2}, {2, 2, 1}, {1, 0, 2}} {
+		page, err := n.AllKeysRange(ctx, c.offset, c.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := 0
+		for k := range page {
+			if !expected[k] {
+				t.Fatalf("unexpected key %s", k)
+			}
+			size++
+		}
+		if size != c.size {
+			t.Fatalf("expected %d keys from offset %d with limit %d, got %d", c.size, c.offset, c.limit, size)
+		}
+	}
+
+	// the channel is closed once ctx is cancelled
+	cctx, cancel := context.WithCancel(ctx)
+	keys, err = n.AllKeys(cctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-keys
+	cancel()
+	for range keys {
+	}
+}
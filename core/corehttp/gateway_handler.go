@@ -18,6 +18,7 @@ import (
 	dag "github.com/jbenet/go-ipfs/merkledag"
 	path "github.com/jbenet/go-ipfs/path"
 	"github.com/jbenet/go-ipfs/routing"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	ufs "github.com/jbenet/go-ipfs/unixfs"
 	uio "github.com/jbenet/go-ipfs/unixfs/io"
 	u "github.com/jbenet/go-ipfs/util"
@@ -32,7 +33,7 @@ type gateway interface {
 	ResolvePath(string) (*dag.Node, error)
 	NewDagFromReader(io.Reader) (*dag.Node, error)
 	AddNodeToDAG(nd *dag.Node) (u.Key, error)
-	NewDagReader(nd *dag.Node) (uio.ReadSeekCloser, error)
+	NewDagReader(ctx context.Context, nd *dag.Node) (uio.ReadSeekCloser, error)
 }
 
 // shortcut for templating
@@ -101,7 +102,7 @@ func (i *gatewayHandler) ResolvePath(ctx context.Context, p string) (*dag.Node,
 		return nil, "", err
 	}
 
-	node, err := i.node.Resolver.ResolvePath(path.Path(p))
+	node, err := i.node.Resolver.ResolvePath(ctx, path.Path(p))
 	if err != nil {
 		return nil, "", err
 	}
@@ -110,7 +111,7 @@ func (i *gatewayHandler) ResolvePath(ctx context.Context, p string) (*dag.Node,
 
 func (i *gatewayHandler) NewDagFromReader(r io.Reader) (*dag.Node, error) {
 	return importer.BuildDagFromReader(
-		r, i.node.DAG, i.node.Pinning.GetManual(), chunk.DefaultSplitter)
+		r, i.node.DAG, i.node.Pinning.GetManual(), i.node.CapSplitter(chunk.DefaultSplitter))
 }
 
 func NewDagEmptyDir() *dag.Node {
@@ -121,8 +122,16 @@ func (i *gatewayHandler) AddNodeToDAG(nd *dag.Node) (u.Key, error) {
 	return i.node.DAG.Add(nd)
 }
 
-func (i *gatewayHandler) NewDagReader(nd *dag.Node) (uio.ReadSeekCloser, error) {
-	return uio.NewDagReader(i.node.Context(), nd, i.node.DAG)
+func (i *gatewayHandler) NewDagReader(ctx context.Context, nd *dag.Node) (uio.ReadSeekCloser, error) {
+	return uio.NewDagReader(ctx, nd, i.node.DAG)
+}
+
+// requestContext returns the context of a request: it ends with the node,
+// and carries a request ID so the events logged while serving the request
+// can be told apart from those of the others.
+func (i *gatewayHandler) requestContext() (context.Context, context.CancelFunc) {
+	ctx := eventlog.ContextWithLoggable(i.node.Context(), eventlog.Uuid("gatewayRequest"))
+	return context.WithCancel(ctx)
 }
 
 // TODO(btc): break this apart into separate handlers using a more expressive
@@ -161,7 +170,7 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i *gatewayHandler) getHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithCancel(i.node.Context())
+	ctx, cancel := i.requestContext()
 	defer cancel()
 
 	urlPath := r.URL.Path
@@ -200,7 +209,7 @@ func (i *gatewayHandler) getHandler(w http.ResponseWriter, r *http.Request) {
 	pathRoot := strings.SplitN(urlPath, "/", 4)[2]
 	w.Header().Set("Suborigin", pathRoot)
 
-	dr, err := i.NewDagReader(nd)
+	dr, err := i.NewDagReader(ctx, nd)
 	if err != nil && err != uio.ErrIsDir {
 		// not a directory and still an error
 		internalWebError(w, err)
@@ -246,7 +255,7 @@ func (i *gatewayHandler) getHandler(w http.ResponseWriter, r *http.Request) {
 				internalWebError(w, err)
 				return
 			}
-			dr, err := i.NewDagReader(nd)
+			dr, err := i.NewDagReader(ctx, nd)
 			if err != nil {
 				internalWebError(w, err)
 				return
@@ -325,7 +334,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	ctx, cancel := context.WithCancel(i.node.Context())
+	ctx, cancel := i.requestContext()
 	defer cancel()
 
 	ipfspath, err := i.resolveNamePath(ctx, urlPath)
@@ -349,7 +358,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rootnd, err := i.node.Resolver.DAG.Get(u.Key(h))
+	rootnd, err := i.node.Resolver.DAG.Get(ctx, u.Key(h))
 	if err != nil {
 		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
 		return
@@ -357,7 +366,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 
 	// resolving path components into merkledag nodes. if a component does not
 	// resolve, create empty directories (which will be linked and populated below.)
-	path_nodes, err := i.node.Resolver.ResolveLinks(rootnd, components[:len(components)-1])
+	path_nodes, err := i.node.Resolver.ResolveLinks(ctx, rootnd, components[:len(components)-1])
 	if _, ok := err.(path.ErrNoLink); ok {
 		// Create empty directories, links will be made further down the code
 		for len(path_nodes) < len(components) {
@@ -395,7 +404,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 
 func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	urlPath := r.URL.Path
-	ctx, cancel := context.WithCancel(i.node.Context())
+	ctx, cancel := i.requestContext()
 	defer cancel()
 
 	ipfspath, err := i.resolveNamePath(ctx, urlPath)
@@ -411,13 +420,13 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rootnd, err := i.node.Resolver.DAG.Get(u.Key(h))
+	rootnd, err := i.node.Resolver.DAG.Get(ctx, u.Key(h))
 	if err != nil {
 		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
 		return
 	}
 
-	path_nodes, err := i.node.Resolver.ResolveLinks(rootnd, components[:len(components)-1])
+	path_nodes, err := i.node.Resolver.ResolveLinks(ctx, rootnd, components[:len(components)-1])
 	if err != nil {
 		webError(w, "Could not resolve parent object", err, http.StatusBadRequest)
 		return
@@ -15,50 +15,24 @@ type KeyRemoved struct {
 }
 
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // in case error occurs during operation
-	keychan, err := n.Blockstore.AllKeysChan(ctx)
-	if err != nil {
-		return err
-	}
-	for k := range keychan { // rely on AllKeysChan to close chan
-		if !n.Pinning.IsPinned(k) {
-			err := n.Blockstore.DeleteBlock(k)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	_, err := n.GarbageCollect(ctx)
+	return err
 }
 
+// GarbageCollectAsync runs the garbage collector in the background, sending
+// the removed keys on the returned channel once it is done.
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemoved, error) {
-
-	keychan, err := n.Blockstore.AllKeysChan(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	output := make(chan *KeyRemoved)
 	go func() {
 		defer close(output)
-		for {
+
+		removed, err := n.GarbageCollect(ctx)
+		if err != nil {
+			log.Debugf("Error collecting garbage: %s", err)
+		}
+		for _, k := range removed {
 			select {
-			case k, ok := <-keychan:
-				if !ok {
-					return
-				}
-				if !n.Pinning.IsPinned(k) {
-					err := n.Blockstore.DeleteBlock(k)
-					if err != nil {
-						log.Debugf("Error removing key from blockstore: %s", err)
-						continue
-					}
-					select {
-					case output <- &KeyRemoved{k}:
-					case <-ctx.Done():
-					}
-				}
+			case output <- &KeyRemoved{k}:
 			case <-ctx.Done():
 				return
 			}
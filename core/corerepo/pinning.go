@@ -3,20 +3,33 @@ package corerepo
 import (
 	"fmt"
 
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/jbenet/go-ipfs/core"
 	"github.com/jbenet/go-ipfs/merkledag"
 	path "github.com/jbenet/go-ipfs/path"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
-func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
+// fetchWorkers is how many nodes Pin fetches at a time
+const fetchWorkers = 8
+
+func Pin(ctx context.Context, n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
+	// the blocks to pin must not be collected before they are pinned
+	defer n.PinLock()()
 
 	dagnodes := make([]*merkledag.Node, 0)
 	for _, fpath := range paths {
-		dagnode, err := n.Resolver.ResolvePath(path.Path(fpath))
+		dagnode, err := n.Resolver.ResolvePath(ctx, path.Path(fpath))
 		if err != nil {
 			return nil, fmt.Errorf("pin: %s", err)
 		}
+		// fetch the dag concurrently, so pinning it finds its nodes local
+		if recursive {
+			err := merkledag.EnumerateChildrenAsync(ctx, dagnode, n.DAG, func(u.Key) {}, fetchWorkers, nil)
+			if err != nil {
+				return nil, fmt.Errorf("pin: %s", err)
+			}
+		}
 		dagnodes = append(dagnodes, dagnode)
 	}
 
@@ -42,11 +55,11 @@ func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
 	return out, nil
 }
 
-func Unpin(n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
+func Unpin(ctx context.Context, n *core.IpfsNode, paths []string, recursive bool) ([]u.Key, error) {
 
 	dagnodes := make([]*merkledag.Node, 0)
 	for _, fpath := range paths {
-		dagnode, err := n.Resolver.ResolvePath(path.Path(fpath))
+		dagnode, err := n.Resolver.ResolvePath(ctx, path.Path(fpath))
 		if err != nil {
 			return nil, err
 		}
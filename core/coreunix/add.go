@@ -1,20 +1,19 @@
 package coreunix
 
 import (
-	"errors"
 	"io"
-	"io/ioutil"
-	"os"
 	gopath "path"
 
-	"github.com/jbenet/go-ipfs/commands/files"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	bserv "github.com/jbenet/go-ipfs/blockservice"
 	core "github.com/jbenet/go-ipfs/core"
-	importer "github.com/jbenet/go-ipfs/importer"
+	offline "github.com/jbenet/go-ipfs/exchange/offline"
+	adder "github.com/jbenet/go-ipfs/importer/adder"
 	chunk "github.com/jbenet/go-ipfs/importer/chunk"
 	merkledag "github.com/jbenet/go-ipfs/merkledag"
-	"github.com/jbenet/go-ipfs/pin"
 	"github.com/jbenet/go-ipfs/thirdparty/eventlog"
-	unixfs "github.com/jbenet/go-ipfs/unixfs"
+	u "github.com/jbenet/go-ipfs/util"
 )
 
 var log = eventlog.Logger("coreunix")
@@ -22,43 +21,17 @@ var log = eventlog.Logger("coreunix")
 // Add builds a merkledag from the a reader, pinning all objects to the local
 // datastore. Returns a key representing the root node.
 func Add(n *core.IpfsNode, r io.Reader) (string, error) {
-	// TODO more attractive function signature importer.BuildDagFromReader
-	dagNode, err := importer.BuildDagFromReader(
-		r,
-		n.DAG,
-		n.Pinning.GetManual(), // Fix this interface
-		chunk.DefaultSplitter,
-	)
+	k, _, err := n.AddReader(n.Context(), r)
 	if err != nil {
 		return "", err
 	}
-	if err := n.Pinning.Flush(); err != nil {
-		return "", err
-	}
-	k, err := dagNode.Key()
-	if err != nil {
-		return "", err
-	}
-
 	return k.String(), nil
 }
 
-// AddR recursively adds files in |path|.
+// AddR recursively adds files in |path|. Symlinks are stored as such, see
+// core.IpfsNode.AddPath.
 func AddR(n *core.IpfsNode, root string) (key string, err error) {
-	f, err := os.Open(root)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-	ff, err := files.NewSerialFile(root, f)
-	if err != nil {
-		return "", err
-	}
-	dagnode, err := addFile(n, ff)
-	if err != nil {
-		return "", err
-	}
-	k, err := dagnode.Key()
+	k, _, err := n.AddPath(n.Context(), root, nil)
 	if err != nil {
 		return "", err
 	}
@@ -70,9 +43,20 @@ func AddR(n *core.IpfsNode, root string) (key string, err error) {
 // Returns the path of the added file ("<dir hash>/filename"), the DAG node of
 // the directory, and and error if any.
 func AddWrapped(n *core.IpfsNode, r io.Reader, filename string) (string, *merkledag.Node, error) {
-	file := files.NewReaderFile(filename, ioutil.NopCloser(r), nil)
-	dir := files.NewSliceFile("", []files.File{file})
-	dagnode, err := addDir(n, dir)
+	defer n.PinLock()()
+	return addWrapped(n, r, filename, nil)
+}
+
+// AddWrappedWithSplitter is AddWrapped chunking the data with spl, for
+// callers holding the PinLock of n already.
+func AddWrappedWithSplitter(n *core.IpfsNode, r io.Reader, filename string, spl chunk.BlockSplitter) (string, *merkledag.Node, error) {
+	return addWrapped(n, r, filename, spl)
+}
+
+func addWrapped(n *core.IpfsNode, r io.Reader, filename string, spl chunk.BlockSplitter) (string, *merkledag.Node, error) {
+	a := n.Adder()
+	a.Splitter = spl
+	dagnode, _, err := a.AddWrapped(n.Context(), r, filename)
 	if err != nil {
 		return "", nil, err
 	}
@@ -83,81 +67,48 @@ func AddWrapped(n *core.IpfsNode, r io.Reader, filename string) (string, *merkle
 	return gopath.Join(k.String(), filename), dagnode, nil
 }
 
-func add(n *core.IpfsNode, readers []io.Reader) ([]*merkledag.Node, error) {
-	mp, ok := n.Pinning.(pin.ManualPinner)
-	if !ok {
-		return nil, errors.New("invalid pinner type! expected manual pinner")
-	}
-	dagnodes := make([]*merkledag.Node, 0)
-	for _, reader := range readers {
-		node, err := importer.BuildDagFromReader(reader, n.DAG, mp, chunk.DefaultSplitter)
-		if err != nil {
-			return nil, err
-		}
-		dagnodes = append(dagnodes, node)
-	}
-	err := n.Pinning.Flush()
-	if err != nil {
-		return nil, err
-	}
-	return dagnodes, nil
+// AddEstimate describes what adding some data would store
+type AddEstimate struct {
+	Root   u.Key  // key of the root object
+	Blocks int    // number of distinct blocks
+	Bytes  uint64 // total size of the blocks
 }
 
-func addNode(n *core.IpfsNode, node *merkledag.Node) error {
-	err := n.DAG.AddRecursive(node) // add the file to the graph + local storage
-	if err != nil {
-		return err
-	}
-	err = n.Pinning.Pin(node, true) // ensure we keep it
-	if err != nil {
-		return err
-	}
-	return nil
+// EstimateAdd chunks and hashes the data from a reader like Add does, but
+// without storing anything, and returns what Add would store.
+func EstimateAdd(r io.Reader) (*AddEstimate, error) {
+	return estimate(func(a *adder.Adder) (*merkledag.Node, adder.Stats, error) {
+		return a.AddReader(context.Background(), r)
+	})
 }
 
-func addFile(n *core.IpfsNode, file files.File) (*merkledag.Node, error) {
-	if file.IsDirectory() {
-		return addDir(n, file)
-	}
+// EstimateAddR is EstimateAdd for the files in |path|, added recursively as
+// by AddR.
+func EstimateAddR(root string) (*AddEstimate, error) {
+	return estimate(func(a *adder.Adder) (*merkledag.Node, adder.Stats, error) {
+		return a.AddPath(context.Background(), root, nil)
+	})
+}
 
-	dns, err := add(n, []io.Reader{file})
+// estimate runs the import in addFunc against a blockstore that only counts
+// the blocks put into it.
+func estimate(addFunc func(*adder.Adder) (*merkledag.Node, adder.Stats, error)) (*AddEstimate, error) {
+	bs := bstore.NewCountingBlockstore()
+	bsrv, err := bserv.New(bs, offline.Exchange(bs))
 	if err != nil {
 		return nil, err
 	}
+	defer bsrv.Close()
 
-	return dns[len(dns)-1], nil // last dag node is the file.
-}
-
-func addDir(n *core.IpfsNode, dir files.File) (*merkledag.Node, error) {
-
-	tree := &merkledag.Node{Data: unixfs.FolderPBData()}
-
-Loop:
-	for {
-		file, err := dir.NextFile()
-		switch {
-		case err != nil && err != io.EOF:
-			return nil, err
-		case err == io.EOF:
-			break Loop
-		}
-
-		node, err := addFile(n, file)
-		if err != nil {
-			return nil, err
-		}
-
-		_, name := gopath.Split(file.FileName())
-
-		err = tree.AddNodeLink(name, node)
-		if err != nil {
-			return nil, err
-		}
+	root, _, err := addFunc(&adder.Adder{DAG: merkledag.NewDAGService(bsrv), Blockstore: bs})
+	if err != nil {
+		return nil, err
 	}
-
-	err := addNode(n, tree)
+	k, err := root.Key()
 	if err != nil {
 		return nil, err
 	}
-	return tree, nil
+
+	blocks, bytes := bs.Counts()
+	return &AddEstimate{Root: k, Blocks: blocks, Bytes: bytes}, nil
 }
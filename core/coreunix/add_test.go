@@ -1,14 +1,20 @@
 package coreunix
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"testing"
 
+	dsq "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
 	"github.com/jbenet/go-ipfs/core"
 	"github.com/jbenet/go-ipfs/repo"
 	"github.com/jbenet/go-ipfs/repo/config"
+	u "github.com/jbenet/go-ipfs/util"
 	"github.com/jbenet/go-ipfs/util/testutil"
 )
 
@@ -35,3 +41,82 @@ func TestAddRecursive(t *testing.T) {
 		t.Fatal("keys do not match")
 	}
 }
+
+func TestEstimateAdd(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "Qmfoo", // required by offline node
+			},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	node, err := core.NewIPFSNode(context.Background(), core.Offline(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 1000000)
+	u.NewTimeSeededRand().Read(data)
+
+	est, err := EstimateAdd(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Bytes < uint64(len(data)) {
+		t.Fatalf("estimated %d bytes for %d bytes of data", est.Bytes, len(data))
+	}
+	if has, _ := node.Blockstore.Has(est.Root); has {
+		t.Fatal("estimating should not store anything")
+	}
+
+	k, err := Add(node, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != est.Root.String() {
+		t.Fatalf("estimated root %s, added %s", est.Root, k)
+	}
+	// count the block entries of the datastore itself: listing the keys
+	// through the blockstore decodes them, which may go wrong with some
+	// hashes and would make the test depend on the data
+	res, err := r.D.Query(dsq.Query{Prefix: bstore.BlockPrefix.String(), KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != est.Blocks {
+		t.Fatalf("estimated %d blocks, added %d", est.Blocks, len(entries))
+	}
+}
+
+func TestEstimateAddR(t *testing.T) {
+	dir, err := ioutil.TempDir("", "estimate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, size := range []int{10, 300000} {
+		data := make([]byte, size)
+		u.NewTimeSeededRand().Read(data)
+		if err := ioutil.WriteFile(path.Join(dir, fmt.Sprint(i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	est, err := EstimateAddR(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a directory object, a small file, a large file and its chunks
+	if est.Blocks < 4 {
+		t.Fatalf("expected at least 4 blocks, got %d", est.Blocks)
+	}
+	if est.Bytes < 300010 {
+		t.Fatalf("estimated only %d bytes", est.Bytes)
+	}
+}
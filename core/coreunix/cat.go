@@ -10,9 +10,10 @@ import (
 
 func Cat(n *core.IpfsNode, pstr string) (io.Reader, error) {
 	p := path.FromString(pstr)
-	dagNode, err := n.Resolver.ResolvePath(p)
+	ctx := n.ContextGroup.Context()
+	dagNode, err := n.Resolver.ResolvePath(ctx, p)
 	if err != nil {
 		return nil, err
 	}
-	return uio.NewDagReader(n.ContextGroup.Context(), dagNode, n.DAG)
+	return uio.NewDagReader(ctx, dagNode, n.DAG)
 }
@@ -4,7 +4,6 @@ import (
 	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	fsds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/fs"
 	ktds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/keytransform"
-	lds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/leveldb"
 	syncds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
 	ldbopts "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
 
@@ -44,9 +43,11 @@ func makeLevelDBDatastore(cfg config.Datastore) (ds2.ThreadSafeDatastoreCloser,
 		return nil, debugerror.Errorf("config datastore.path required for leveldb")
 	}
 
-	ds, err := lds.NewDatastore(cfg.Path, &lds.Options{
-		// TODO don't import ldbopts. Get from go-datastore.leveldb
+	ds, err := ds2.NewLevelDatastore(cfg.Path, &ldbopts.Options{
 		Compression: ldbopts.NoCompression,
 	})
-	return ds, debugerror.Wrap(err)
+	if err != nil {
+		return nil, debugerror.Wrap(err)
+	}
+	return ds, nil
 }
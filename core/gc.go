@@ -0,0 +1,125 @@
+package core
+
+import (
+	"errors"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blockstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// ErrBlockPinned is returned when removing a pinned block.
+var ErrBlockPinned = errors.New("block is pinned")
+
+// PinLock keeps the garbage collector from running until the returned
+// function is called. Hold it while adding and pinning content, so blocks
+// that are stored but not pinned yet are not swept.
+func (n *IpfsNode) PinLock() (unlock func()) {
+	n.gcLock.RLock()
+	return n.gcLock.RUnlock
+}
+
+// GarbageCollect removes every block from the blockstore that is not
+// reachable from a direct or recursive pin, and returns the keys removed.
+// Only local blocks are considered, nothing is fetched from the network.
+func (n *IpfsNode) GarbageCollect(ctx context.Context) ([]u.Key, error) {
+	n.gcLock.Lock()
+	defer n.gcLock.Unlock()
+
+	marked, err := n.markPinned(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := n.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []u.Key
+	for k := range keys {
+		if _, ok := marked[k]; ok {
+			continue
+		}
+		if err := n.Blockstore.DeleteBlock(k); err != nil {
+			return removed, err
+		}
+		removed = append(removed, k)
+	}
+	// AllKeysChan closes its channel when ctx is cancelled
+	return removed, ctx.Err()
+}
+
+// RemoveBlock deletes the block for k from the local blockstore. It fails
+// with ErrBlockPinned if the block is pinned in any way, unless force is set,
+// in which case the block is deleted and the pin left in place.
+func (n *IpfsNode) RemoveBlock(k u.Key, force bool) error {
+	n.gcLock.Lock()
+	defer n.gcLock.Unlock()
+
+	if !force && n.Pinning != nil && n.Pinning.IsPinned(k) {
+		return ErrBlockPinned
+	}
+
+	has, err := n.Blockstore.Has(k)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return blockstore.ErrNotFound
+	}
+	return n.Blocks.DeleteBlock(k)
+}
+
+// markPinned returns the set of keys that must survive garbage collection.
+func (n *IpfsNode) markPinned(ctx context.Context) (map[u.Key]struct{}, error) {
+	marked := make(map[u.Key]struct{})
+	for _, k := range n.Pinning.DirectKeys() {
+		marked[k] = struct{}{}
+	}
+	// the pinner tracks the children of recursive pins as indirect pins,
+	// but walking the pinned dags is the authoritative answer
+	for _, k := range n.Pinning.IndirectKeys() {
+		marked[k] = struct{}{}
+	}
+	visited := make(map[u.Key]struct{})
+	for _, k := range n.Pinning.RecursiveKeys() {
+		if err := n.markLocalDAG(ctx, k, marked, visited); err != nil {
+			return nil, err
+		}
+	}
+	return marked, nil
+}
+
+// markLocalDAG marks k and everything below it that is in the blockstore.
+func (n *IpfsNode) markLocalDAG(ctx context.Context, k u.Key, marked, visited map[u.Key]struct{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := visited[k]; ok {
+		return nil
+	}
+	visited[k] = struct{}{}
+	marked[k] = struct{}{}
+
+	blk, err := n.Blockstore.Get(k)
+	if err == blockstore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nd, err := merkledag.Decoded(blk.Data)
+	if err != nil {
+		// not a dag node, so it has no children
+		return nil
+	}
+	for _, lnk := range nd.Links {
+		if err := n.markLocalDAG(ctx, u.Key(lnk.Hash), marked, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
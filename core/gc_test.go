@@ -0,0 +1,196 @@
+package core
+
+import (
+	"testing"
+
+	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+	blockstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	repo "github.com/jbenet/go-ipfs/repo"
+	config "github.com/jbenet/go-ipfs/repo/config"
+	u "github.com/jbenet/go-ipfs/util"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestGarbageCollect(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(nd *merkledag.Node) u.Key {
+		if err := n.DAG.AddRecursive(nd); err != nil {
+			t.Fatal(err)
+		}
+		k, err := nd.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	child := &merkledag.Node{Data: []byte("child")}
+	grandchild := &merkledag.Node{Data: []byte("grandchild")}
+	if err := child.AddNodeLink("gc", grandchild); err != nil {
+		t.Fatal(err)
+	}
+	root := &merkledag.Node{Data: []byte("root")}
+	if err := root.AddNodeLink("c", child); err != nil {
+		t.Fatal(err)
+	}
+	direct := &merkledag.Node{Data: []byte("direct")}
+	if err := direct.AddNodeLink("c", &merkledag.Node{Data: []byte("unpinned child")}); err != nil {
+		t.Fatal(err)
+	}
+	loose := &merkledag.Node{Data: []byte("loose")}
+
+	keep := []u.Key{add(root), add(child), add(grandchild), add(direct)}
+	add(loose)
+	looseKey, _ := loose.Key()
+	directChild, _ := direct.Links[0].Node.Key()
+
+	if err := n.Pinning.Pin(root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Pinning.Pin(direct, false); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := n.GarbageCollect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[u.Key]bool{looseKey: true, directChild: true}
+	if len(removed) != len(expected) {
+		t.Fatalf("expected %d blocks removed, got %d", len(expected), len(removed))
+	}
+	for _, k := range removed {
+		if !expected[k] {
+			t.Fatalf("removed unexpected block %s", k)
+		}
+	}
+	for _, k := range keep {
+		if has, err := n.Has(ctx, k); err != nil || !has {
+			t.Fatalf("pinned block %s was removed", k)
+		}
+	}
+}
+
+func TestRemoveBlock(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := &merkledag.Node{Data: []byte("pinned")}
+	loose := &merkledag.Node{Data: []byte("loose")}
+	pk, err := n.DAG.Add(pinned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lk, err := n.DAG.Add(loose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Pinning.Pin(pinned, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.RemoveBlock(lk, false); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := n.Has(ctx, lk); has {
+		t.Fatal("block not removed")
+	}
+	if err := n.RemoveBlock(lk, false); err != blockstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := n.RemoveBlock(pk, false); err != ErrBlockPinned {
+		t.Fatalf("expected ErrBlockPinned, got %v", err)
+	}
+	if has, _ := n.Has(ctx, pk); !has {
+		t.Fatal("pinned block removed")
+	}
+	if err := n.RemoveBlock(pk, true); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := n.Has(ctx, pk); has {
+		t.Fatal("block not removed with force")
+	}
+}
+
+func TestStorageMaxConfig(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity:  testIdentity,
+			Datastore: config.Datastore{StorageMax: 64},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	// put directly, as the exchange may put the blocks added through the
+	// block service again after the garbage collection
+	if err := n.Blockstore.Put(blocks.NewBlock([]byte("small"))); err != nil {
+		t.Fatal(err)
+	}
+	numBlocks, size, err := n.RepoUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numBlocks != 1 || size != 5 {
+		t.Fatalf("expected 1 block of 5 bytes, got %d blocks of %d bytes", numBlocks, size)
+	}
+
+	large := &merkledag.Node{Data: make([]byte, 64)}
+	if _, err := n.DAG.Add(large); err != blockstore.ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// garbage collection frees the space of the unpinned block
+	if _, err := n.GarbageCollect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if numBlocks, size, _ := n.RepoUsage(ctx); numBlocks != 0 || size != 0 {
+		t.Fatalf("expected no block left, got %d blocks of %d bytes", numBlocks, size)
+	}
+}
+
+func TestRepoUsageWithoutQuota(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if _, err := n.AddBlockWithHash([]byte("foo"), mh.SHA2_256); err != nil {
+		t.Fatal(err)
+	}
+	if numBlocks, size, err := n.RepoUsage(ctx); err != nil || numBlocks != 1 || size != 3 {
+		t.Fatalf("expected 1 block of 3 bytes, got %d blocks of %d bytes, %v", numBlocks, size, err)
+	}
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+)
+
+// NATStatus describes the port mappings the node opened in its NAT device,
+// telling whether the node is reachable from outside its network.
+type NATStatus struct {
+	// Enabled is whether NAT port mapping is enabled in the config.
+	Enabled bool
+
+	// DeviceFound is whether a NAT device supporting port mappings was
+	// found. Searching for one takes a while after the node goes online.
+	DeviceFound bool
+
+	// ExternalAddrs are the external addresses of the port mappings that
+	// succeeded.
+	ExternalAddrs []ma.Multiaddr
+}
+
+// Mapped returns whether a port mapping succeeded.
+func (s NATStatus) Mapped() bool {
+	return len(s.ExternalAddrs) > 0
+}
+
+// NATStatus returns the state of the port mappings of the node.
+func (n *IpfsNode) NATStatus() (NATStatus, error) {
+	if !n.OnlineMode() {
+		return NATStatus{}, ErrNodeOffline
+	}
+
+	status := NATStatus{Enabled: n.natPortMap}
+	if n.basicHost == nil {
+		return status, nil
+	}
+	if nat := n.basicHost.NAT(); nat != nil {
+		status.DeviceFound = true
+		status.ExternalAddrs = nat.ExternalAddrs()
+	}
+	return status, nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"strings"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	u "github.com/jbenet/go-ipfs/util"
+	debugerror "github.com/jbenet/go-ipfs/util/debugerror"
+)
+
+// PatchAddLink adds a link named name to child to the node root, replacing
+// any link of that name, and returns the key of the modified node. Only the
+// modified node is stored: the other links keep pointing to the subtrees
+// they pointed to. Neither root nor the modified node is pinned.
+func (n *IpfsNode) PatchAddLink(ctx context.Context, root u.Key, name string, child u.Key) (u.Key, error) {
+	if err := checkLinkName(name); err != nil {
+		return "", err
+	}
+	nd, err := n.DAG.Get(ctx, root)
+	if err != nil {
+		return "", err
+	}
+	// the link records the size of the child
+	childnd, err := n.DAG.Get(ctx, child)
+	if err != nil {
+		return "", err
+	}
+
+	nd = nd.Copy()
+	if err := nd.RemoveNodeLink(name); err != nil && err != merkledag.ErrNotFound {
+		return "", err
+	}
+	if err := nd.AddNodeLinkClean(name, childnd); err != nil {
+		return "", err
+	}
+	return n.DAG.Add(nd)
+}
+
+// PatchRemoveLink removes the link named name from the node root, like
+// PatchAddLink adds one, and returns the key of the modified node. It fails
+// with merkledag.ErrNotFound if root has no such link.
+func (n *IpfsNode) PatchRemoveLink(ctx context.Context, root u.Key, name string) (u.Key, error) {
+	if err := checkLinkName(name); err != nil {
+		return "", err
+	}
+	nd, err := n.DAG.Get(ctx, root)
+	if err != nil {
+		return "", err
+	}
+
+	nd = nd.Copy()
+	if err := nd.RemoveNodeLink(name); err != nil {
+		return "", err
+	}
+	return n.DAG.Add(nd)
+}
+
+// PatchSetData replaces the data of the node root by data, keeping its
+// links, and returns the key of the modified node. Like with any node added,
+// it fails with a *blockservice.BlockTooLargeError if the modified node is
+// above the maximum block size.
+func (n *IpfsNode) PatchSetData(ctx context.Context, root u.Key, data []byte) (u.Key, error) {
+	return n.patchData(ctx, root, func(old []byte) []byte {
+		return data
+	})
+}
+
+// PatchAppendData appends data to the data of the node root, like
+// PatchSetData replaces it.
+func (n *IpfsNode) PatchAppendData(ctx context.Context, root u.Key, data []byte) (u.Key, error) {
+	return n.patchData(ctx, root, func(old []byte) []byte {
+		return append(old, data...)
+	})
+}
+
+// patchData stores a copy of the node root with its data updated by update.
+func (n *IpfsNode) patchData(ctx context.Context, root u.Key, update func([]byte) []byte) (u.Key, error) {
+	nd, err := n.DAG.Get(ctx, root)
+	if err != nil {
+		return "", err
+	}
+
+	// Copy copies the data, so the cached node is left alone
+	nd = nd.Copy()
+	nd.Data = update(nd.Data)
+	return n.DAG.Add(nd)
+}
+
+// checkLinkName rejects names that could not be resolved as a path
+// component.
+func checkLinkName(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return debugerror.Errorf("invalid link name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bserv "github.com/jbenet/go-ipfs/blockservice"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	repo "github.com/jbenet/go-ipfs/repo"
+	config "github.com/jbenet/go-ipfs/repo/config"
+	u "github.com/jbenet/go-ipfs/util"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestPatchLinks(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(nd *merkledag.Node) u.Key {
+		k, err := n.DAG.Add(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	links := func(k u.Key) map[string]u.Key {
+		nd, err := n.DAG.Get(context.Background(), k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]u.Key)
+		for _, l := range nd.Links {
+			m[l.Name] = u.Key(l.Hash)
+		}
+		return m
+	}
+
+	a := &merkledag.Node{Data: []byte("a")}
+	ak := add(a)
+	bk := add(&merkledag.Node{Data: []byte("b")})
+	root := &merkledag.Node{Data: []byte("root")}
+	if err := root.AddNodeLinkClean("a", a); err != nil {
+		t.Fatal(err)
+	}
+	rk := add(root)
+
+	added, err := n.PatchAddLink(context.Background(), rk, "b", bk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := links(added); len(l) != 2 || l["a"] != ak || l["b"] != bk {
+		t.Fatalf("unexpected links after adding: %v", l)
+	}
+	if l := links(rk); len(l) != 1 {
+		t.Fatalf("the original root changed: %v", l)
+	}
+
+	replaced, err := n.PatchAddLink(context.Background(), added, "a", bk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := links(replaced); len(l) != 2 || l["a"] != bk || l["b"] != bk {
+		t.Fatalf("unexpected links after replacing: %v", l)
+	}
+
+	removed, err := n.PatchRemoveLink(context.Background(), added, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != rk {
+		t.Fatalf("expected removing the added link to give back %s, got %s", rk, removed)
+	}
+
+	if _, err := n.PatchRemoveLink(context.Background(), rk, "b"); err != merkledag.ErrNotFound {
+		t.Fatalf("expected ErrNotFound removing a missing link, got %v", err)
+	}
+	if _, err := n.PatchAddLink(context.Background(), rk, "x/y", bk); err == nil {
+		t.Fatal("expected a link name with a slash to be rejected")
+	}
+}
+
+func TestPatchData(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity:  testIdentity,
+			Datastore: config.Datastore{MaxBlockSize: 64},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := &merkledag.Node{Data: []byte("child")}
+	root := &merkledag.Node{Data: []byte("foo")}
+	if err := root.AddNodeLinkClean("c", child); err != nil {
+		t.Fatal(err)
+	}
+	rk, err := n.DAG.Add(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(k u.Key, data string) {
+		nd, err := n.DAG.Get(context.Background(), k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(nd.Data) != data {
+			t.Fatalf("expected data %q, got %q", data, nd.Data)
+		}
+		if len(nd.Links) != 1 || nd.Links[0].Name != "c" {
+			t.Fatalf("expected the links to be kept, got %v", nd.Links)
+		}
+	}
+
+	set, err := n.PatchSetData(context.Background(), rk, []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(set, "bar")
+
+	appended, err := n.PatchAppendData(context.Background(), set, []byte("baz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(appended, "barbaz")
+	check(set, "bar")
+	check(rk, "foo")
+
+	_, err = n.PatchAppendData(context.Background(), rk, make([]byte, 64))
+	if _, ok := err.(*bserv.BlockTooLargeError); !ok {
+		t.Fatalf("expected a BlockTooLargeError, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"errors"
+	gopath "path"
+	"strings"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	path "github.com/jbenet/go-ipfs/path"
+	debugerror "github.com/jbenet/go-ipfs/util/debugerror"
+)
+
+const ipnsPathPrefix = "/ipns/"
+
+// ErrNoNamesys is returned when resolving an /ipns/ path on a node without
+// a name system, i.e. an offline node that hasn't set up offline routing.
+var ErrNoNamesys = errors.New("core/resolve: no Namesys on IpfsNode - can't resolve ipns entry")
+
+// ResolvePath resolves the given path to a merkledag node. Paths starting
+// with /ipns/ are first resolved through the name system to an /ipfs/ path.
+func (n *IpfsNode) ResolvePath(ctx context.Context, p string) (*merkledag.Node, error) {
+	p, err := n.resolveIpns(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return n.Resolver.ResolvePath(ctx, path.Path(p))
+}
+
+// ResolvePathWithRemainder is like ResolvePath, but stops at the first
+// segment without a matching link instead of failing. It returns the last
+// node resolved and the segments left, see path.Resolver.
+func (n *IpfsNode) ResolvePathWithRemainder(ctx context.Context, p string) (*merkledag.Node, []string, error) {
+	p, err := n.resolveIpns(ctx, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return n.Resolver.ResolvePathWithRemainder(ctx, path.Path(p))
+}
+
+// resolveIpns turns an /ipns/ path into the /ipfs/ path it points to. Other
+// paths are returned cleaned, but otherwise unchanged.
+func (n *IpfsNode) resolveIpns(ctx context.Context, p string) (string, error) {
+	p = gopath.Clean(p)
+	if !strings.HasPrefix(p, ipnsPathPrefix) {
+		return p, nil
+	}
+
+	if n.Namesys == nil {
+		return "", ErrNoNamesys
+	}
+
+	segments := strings.Split(p[len(ipnsPathPrefix):], "/")
+	k, err := n.Namesys.Resolve(ctx, segments[0])
+	if err != nil {
+		if !n.OnlineMode() {
+			return "", debugerror.Errorf("could not resolve %s while offline, it was not published locally: %s", segments[0], err)
+		}
+		return "", err
+	}
+
+	segments[0] = k.B58String()
+	return gopath.Join(segments...), nil
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"sync"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	repo "github.com/jbenet/go-ipfs/repo"
+	config "github.com/jbenet/go-ipfs/repo/config"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestResolvePath(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &merkledag.Node{Data: []byte("beep")}
+	dir := &merkledag.Node{}
+	if err := dir.AddNodeLink("file", file); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+	k, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := n.ResolvePath(ctx, "/ipfs/"+k.B58String()+"/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "beep" {
+		t.Fatal("resolved the wrong node")
+	}
+
+	ipnsPath := "/ipns/" + n.Identity.Pretty() + "/file"
+	if _, err := n.ResolvePath(ctx, ipnsPath); err != ErrNoNamesys {
+		t.Fatalf("expected ErrNoNamesys, got %v", err)
+	}
+
+	if err := n.SetupOfflineRouting(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.ResolvePath(ctx, ipnsPath); err == nil {
+		t.Fatal("expected resolving an unpublished name to fail")
+	}
+
+	if err := n.Namesys.Publish(ctx, n.PrivateKey, k); err != nil {
+		t.Fatal(err)
+	}
+	nd, err = n.ResolvePath(ctx, ipnsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "beep" {
+		t.Fatal("resolved the wrong node through ipns")
+	}
+}
+
+func TestResolvePathWithRemainder(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &merkledag.Node{Data: []byte("beep")}
+	dir := &merkledag.Node{}
+	if err := dir.AddNodeLink("file", file); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+	k, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := "/ipfs/" + k.B58String()
+
+	nd, rest, err := n.ResolvePathWithRemainder(ctx, root+"/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "beep" || len(rest) != 0 {
+		t.Fatalf("expected the file with nothing left, got %d segments left", len(rest))
+	}
+
+	nd, rest, err = n.ResolvePathWithRemainder(ctx, root+"/file/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "beep" {
+		t.Fatal("expected resolution to stop at the file")
+	}
+	if len(rest) != 2 || rest[0] != "a" || rest[1] != "b" {
+		t.Fatalf("wrong remainder: %v", rest)
+	}
+
+	if _, err := n.ResolvePath(ctx, root+"/file/a"); err == nil {
+		t.Fatal("expected ResolvePath to fail on a missing link")
+	}
+}
+
+func TestResolvePathByLinkIndex(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &merkledag.Node{Data: []byte("a")}
+	b := &merkledag.Node{Data: []byte("b")}
+	named := &merkledag.Node{Data: []byte("named")}
+	root := &merkledag.Node{}
+	for _, child := range []*merkledag.Node{a, b} {
+		if err := root.AddNodeLink("", child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := root.AddNodeLink("@0", named); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	k, err := root.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := "/ipfs/" + k.B58String()
+
+	// links are sorted by name when encoded, the unnamed ones come first
+	nd, err := n.ResolvePath(ctx, p+"/@1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Data == nil || string(nd.Data) == "named" {
+		t.Fatal("expected an unnamed link")
+	}
+
+	// a link named like an index wins
+	nd, err = n.ResolvePath(ctx, p+"/@0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "named" {
+		t.Fatal("expected the named link to take precedence")
+	}
+
+	for _, bad := range []string{"/@3", "/@-1", "/@x"} {
+		if _, err := n.ResolvePath(ctx, p+bad); err == nil {
+			t.Fatalf("expected %s to fail", bad)
+		}
+	}
+}
+
+func TestResolvePathCarriesContext(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.SetupOfflineRouting(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &merkledag.Node{Data: []byte("beep")}
+	dir := &merkledag.Node{}
+	if err := dir.AddNodeLink("file", file); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+	k, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Namesys.Publish(ctx, n.PrivateKey, k); err != nil {
+		t.Fatal(err)
+	}
+
+	var lk sync.Mutex
+	seen := make(map[string]bool)
+	stop := eventlog.Observe(func(e eventlog.Event) {
+		if e.Metadata["requestId"] == "r1" {
+			lk.Lock()
+			seen[e.System+"/"+e.Name] = true
+			lk.Unlock()
+		}
+	})
+	defer stop()
+
+	rctx := eventlog.ContextWithLoggable(ctx, eventlog.Metadata{"requestId": "r1"})
+	if _, err := n.ResolvePath(rctx, "/ipns/"+n.Identity.Pretty()+"/file"); err != nil {
+		t.Fatal(err)
+	}
+
+	lk.Lock()
+	defer lk.Unlock()
+	for _, event := range []string{"namesys/resolve", "path/resolvePath", "blockservice/getBlock"} {
+		if !seen[event] {
+			t.Fatalf("no %s event carried the request ID, got %v", event, seen)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// pinFetchWorkers is how many nodes PinRecursive fetches at a time
+const pinFetchWorkers = 8
+
+// PinRecursive fetches the whole dag rooted at k, from the network if the
+// node is online, and then pins it recursively. If any block cannot be
+// fetched before ctx expires, nothing is pinned.
+func (n *IpfsNode) PinRecursive(ctx context.Context, k u.Key) error {
+	if n.Pinning == nil {
+		return ErrNoPinner
+	}
+
+	// fetched blocks must survive until the pin is recorded
+	defer n.PinLock()()
+
+	dag := n.NewSession(ctx)
+	root, err := dag.GetNodes(ctx, []u.Key{k})[0].Get()
+	if err != nil {
+		return err
+	}
+	if err := merkledag.EnumerateChildrenAsync(ctx, root, dag, func(u.Key) {}, pinFetchWorkers, nil); err != nil {
+		return err
+	}
+
+	// everything is local now, so pinning does not hit the network
+	if err := n.Pinning.Pin(root, true); err != nil {
+		return err
+	}
+	return n.Pinning.Flush()
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	repo "github.com/jbenet/go-ipfs/repo"
+	config "github.com/jbenet/go-ipfs/repo/config"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestPinRecursive(t *testing.T) {
+	ctx := context.TODO()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewNodeBuilder().SetRepo(r).Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := &merkledag.Node{Data: []byte("child")}
+	root := &merkledag.Node{Data: []byte("root")}
+	if err := root.AddNodeLink("c", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	rk, _ := root.Key()
+	ck, _ := child.Key()
+
+	if err := n.PinRecursive(ctx, rk); err != nil {
+		t.Fatal(err)
+	}
+	if _, mode, _ := n.IsPinned(rk); mode != "recursive" {
+		t.Fatalf("expected a recursive pin, got %q", mode)
+	}
+	if _, mode, _ := n.IsPinned(ck); mode != "indirect" {
+		t.Fatalf("expected an indirect pin, got %q", mode)
+	}
+
+	// a dag with a block that can't be fetched must not get pinned
+	incomplete := &merkledag.Node{Data: []byte("incomplete")}
+	if err := incomplete.AddNodeLink("missing", &merkledag.Node{Data: []byte("missing")}); err != nil {
+		t.Fatal(err)
+	}
+	ik, err := n.DAG.Add(incomplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := n.PinRecursive(tctx, ik); err == nil {
+		t.Fatal("expected pinning an incomplete dag to fail")
+	}
+	if pinned, _, _ := n.IsPinned(ik); pinned {
+		t.Fatal("incomplete dag was pinned")
+	}
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	routing "github.com/jbenet/go-ipfs/routing"
+	dht "github.com/jbenet/go-ipfs/routing/dht"
+	u "github.com/jbenet/go-ipfs/util"
+	debugerror "github.com/jbenet/go-ipfs/util/debugerror"
+)
+
+// RestartRouting replaces the routing system of an online node by a new one,
+// built with the routing option the node was constructed with, e.g. to
+// recover a DHT whose routing table emptied during a network partition. The
+// old routing system is closed once the new one is built, the new one starts
+// out with the peers connected to already, and the node bootstraps again with
+// the configuration it bootstrapped with last. The peer host, the exchange,
+// the reprovider and the republisher use the new routing system from then
+// on; the name system is rebuilt on top of it. If building the new routing
+// system fails, the node keeps the old one.
+//
+// The new routing system runs along with the other online services, until
+// GoOffline is called or the node is closed. ctx only aborts a restart that
+// has not started yet.
+func (n *IpfsNode) RestartRouting(ctx context.Context) error {
+	n.modeLk.Lock()
+	defer n.modeLk.Unlock()
+
+	if n.mode != onlineMode || n.routing == nil {
+		return ErrNodeOffline
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	routingOption := n.routingOption
+	if routingOption == nil {
+		routingOption = DHTOption
+	}
+
+	// the new routing system takes over the stream handlers of the old one
+	r, err := routingOption(n.onlineCtx, n.routingHost, n.Repo.Datastore())
+	if err != nil {
+		return debugerror.Wrap(err)
+	}
+	ns, err := n.newNameSystem(r)
+	if err != nil {
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		return err
+	}
+	if d, ok := r.(*dht.IpfsDHT); ok {
+		// it learns of new connections only, not of the ones already open
+		for _, p := range n.routingHost.Network().Peers() {
+			d.Update(n.onlineCtx, p)
+		}
+	}
+
+	if c, ok := n.Routing.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Debugf("closing the routing system: %s", err)
+		}
+	}
+	n.Routing = r
+	n.routing.set(r)
+	n.Namesys = ns
+
+	return n.Bootstrap(n.bootstrapConfig)
+}
+
+// onlineRouting returns the routing system the online services are built
+// with, which forwards to the one RestartRouting set last, or ErrNodeOffline
+// if the node is offline.
+func (n *IpfsNode) onlineRouting() (routing.IpfsRouting, error) {
+	n.modeLk.RLock()
+	defer n.modeLk.RUnlock()
+
+	if n.mode != onlineMode || n.routing == nil {
+		return nil, ErrNodeOffline
+	}
+	return n.routing, nil
+}
+
+// routingRef is the routing system the online services of a node are built
+// with. It forwards to the routing system set last, so that the services
+// keep working when RestartRouting replaces it.
+type routingRef struct {
+	lk sync.RWMutex
+	r  routing.IpfsRouting
+}
+
+func (rr *routingRef) get() routing.IpfsRouting {
+	rr.lk.RLock()
+	defer rr.lk.RUnlock()
+	return rr.r
+}
+
+func (rr *routingRef) set(r routing.IpfsRouting) {
+	rr.lk.Lock()
+	defer rr.lk.Unlock()
+	rr.r = r
+}
+
+func (rr *routingRef) FindProvidersAsync(ctx context.Context, k u.Key, count int) <-chan peer.PeerInfo {
+	return rr.get().FindProvidersAsync(ctx, k, count)
+}
+
+func (rr *routingRef) PutValue(ctx context.Context, k u.Key, v []byte) error {
+	return rr.get().PutValue(ctx, k, v)
+}
+
+func (rr *routingRef) GetValue(ctx context.Context, k u.Key) ([]byte, error) {
+	return rr.get().GetValue(ctx, k)
+}
+
+func (rr *routingRef) Provide(ctx context.Context, k u.Key) error {
+	return rr.get().Provide(ctx, k)
+}
+
+func (rr *routingRef) FindPeer(ctx context.Context, p peer.ID) (peer.PeerInfo, error) {
+	return rr.get().FindPeer(ctx, p)
+}
+
+func (rr *routingRef) Ping(ctx context.Context, p peer.ID) (time.Duration, error) {
+	return rr.get().Ping(ctx, p)
+}
+
+func (rr *routingRef) Bootstrap(ctx context.Context) error {
+	return rr.get().Bootstrap(ctx)
+}
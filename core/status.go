@@ -0,0 +1,53 @@
+package core
+
+import (
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	bitswap "github.com/jbenet/go-ipfs/exchange/bitswap"
+)
+
+// statusProbeKey is looked up to check that the datastore responds.
+var statusProbeKey = ds.NewKey("/local/status-probe")
+
+// NodeStatus summarizes the health of a node, see IpfsNode.Status.
+type NodeStatus struct {
+	Online       bool // whether the network services run
+	Peers        int  // number of connected peers
+	Bootstrapped bool // whether the bootstrap peer threshold is reached
+
+	DatastoreOK    bool   // whether the repo datastore responds
+	DatastoreError string // why it does not, if it doesn't
+
+	WantlistLen    int // number of blocks bitswap is looking for
+	BlocksReceived int // blocks received by bitswap so far
+	BlocksSent     int // blocks sent by bitswap so far
+}
+
+// Status collects the state of the node's subsystems. Services that are
+// not set up (yet) are reported with zero values, so it is safe to call at
+// any time.
+func (n *IpfsNode) Status() NodeStatus {
+	var st NodeStatus
+	st.Online = n.OnlineMode()
+
+	if n.PeerHost != nil {
+		st.Peers = len(n.PeerHost.Network().Peers())
+		st.Bootstrapped = n.Bootstrapper != nil && st.Peers >= n.bootstrapConfig.MinPeerThreshold
+	}
+
+	if n.Repo != nil && n.Repo.Datastore() != nil {
+		if _, err := n.Repo.Datastore().Has(statusProbeKey); err != nil {
+			st.DatastoreError = err.Error()
+		} else {
+			st.DatastoreOK = true
+		}
+	}
+
+	if bs, ok := n.Exchange.(*bitswap.Bitswap); ok {
+		if bst, err := bs.Stat(); err == nil {
+			st.WantlistLen = len(bst.Wantlist)
+			st.BlocksReceived = bst.BlocksReceived
+			st.BlocksSent = bst.BlocksSent
+		}
+	}
+	return st
+}
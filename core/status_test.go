@@ -0,0 +1,34 @@
+package core
+
+import (
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestStatus(t *testing.T) {
+	// a node nothing was set up on yet
+	if st := new(IpfsNode).Status(); st != (NodeStatus{}) {
+		t.Fatalf("expected a zero status, got %+v", st)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newMockOnlineNode(t, ctx)
+	defer n.Close()
+
+	st := n.Status()
+	if !st.Online || !st.DatastoreOK {
+		t.Fatalf("expected an online node with a working datastore, got %+v", st)
+	}
+	if st.Bootstrapped {
+		t.Fatal("node was never asked to bootstrap")
+	}
+
+	if err := n.GoOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if st := n.Status(); st.Online || st.Peers != 0 {
+		t.Fatalf("expected an offline node, got %+v", st)
+	}
+}
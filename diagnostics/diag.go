@@ -59,18 +59,20 @@ func NewDiagnostics(self peer.ID, h host.Host) *Diagnostics {
 	return d
 }
 
-type connDiagInfo struct {
+// ConnDiagInfo describes the connections of a node to one of its peers
+type ConnDiagInfo struct {
 	Latency time.Duration
 	ID      string
 	Count   int
 }
 
+// DiagInfo is the information a node reports about itself in a diagnostic
 type DiagInfo struct {
 	// This nodes ID
 	ID string
 
 	// A list of peers this node currently has open connections to
-	Connections []connDiagInfo
+	Connections []ConnDiagInfo
 
 	// A list of keys provided by this node
 	//    (currently not filled)
@@ -119,7 +121,7 @@ func (d *Diagnostics) getDiagInfo() *DiagInfo {
 	// di.BwIn, di.BwOut = d.host.BandwidthTotals() //TODO fix this.
 
 	for p, n := range d.getPeers() {
-		d := connDiagInfo{
+		d := ConnDiagInfo{
 			Latency: d.host.Peerstore().LatencyEWMA(p),
 			ID:      p.Pretty(),
 			Count:   n,
@@ -137,8 +139,16 @@ func newID() string {
 
 // GetDiagnostic runs a diagnostics request across the entire network
 func (d *Diagnostics) GetDiagnostic(timeout time.Duration) ([]*DiagInfo, error) {
+	return d.GetDiagnosticContext(context.TODO(), timeout)
+}
+
+// GetDiagnosticContext runs a diagnostics request across the entire network,
+// giving up when either ctx is done or the timeout expires. The info of the
+// local node comes first.
+func (d *Diagnostics) GetDiagnosticContext(ctx context.Context, timeout time.Duration) ([]*DiagInfo, error) {
 	log.Debug("Getting diagnostic.")
-	ctx, _ := context.WithTimeout(context.TODO(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	diagID := newID()
 	d.diagLock.Lock()
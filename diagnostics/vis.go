@@ -101,7 +101,7 @@ func (w *DotWriter) WriteNode(i int, di *DiagInfo) error {
 	return w.err
 }
 
-func (w *DotWriter) WriteEdge(i, j int, di *DiagInfo, conn connDiagInfo) error {
+func (w *DotWriter) WriteEdge(i, j int, di *DiagInfo, conn ConnDiagInfo) error {
 
 	n := fmt.Sprintf("%s ... %s (%d)", di.ID, conn.ID, conn.Latency)
 	s := "[label=\" %d\" weight=%d tooltip=\"%s\" labeltooltip=\"%s\" style=\"dotted\"]"
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	process "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/jbenet/go-ipfs/blocks"
@@ -42,10 +43,17 @@ const (
 
 	HasBlockBufferSize = 256
 	provideWorkers     = 4
+
+	// DefaultProviderSearchDelay is the default ProviderSearchDelay.
+	DefaultProviderSearchDelay = time.Second
 )
 
 var (
 	rebroadcastDelay = delay.Fixed(time.Second * 10)
+
+	// providerHintTimeout is how long GetBlockFrom waits for the hinted
+	// peer before searching the network for the block.
+	providerHintTimeout = time.Second * 5
 )
 
 // New initializes a BitSwap instance that communicates over the provided
@@ -87,8 +95,12 @@ func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
 		network:       network,
 		wantlist:      wantlist.NewThreadSafe(),
 		batchRequests: make(chan *blockRequest, sizeBatchRequestChan),
+		findProviders: make(chan *blockRequest, sizeBatchRequestChan),
 		process:       px,
 		newBlocks:     make(chan *blocks.Block, HasBlockBufferSize),
+		sessions:      make(map[*requestSession]struct{}),
+
+		ProviderSearchDelay: delay.Fixed(DefaultProviderSearchDelay),
 	}
 	network.SetDelegate(bs)
 
@@ -117,6 +129,17 @@ type Bitswap struct {
 	// have more than a single block in the set
 	batchRequests chan *blockRequest
 
+	// the requests whose providers are to be searched for, once they waited
+	// for ProviderSearchDelay
+	findProviders chan *blockRequest
+
+	// ProviderSearchDelay is how long the blocks of a request are only
+	// asked of our partners, before their providers are searched for with
+	// the routing system. Blocks that arrive in the meantime are not searched
+	// for, which spares the routing system on well connected nodes. It may
+	// be changed at any time.
+	ProviderSearchDelay delay.D
+
 	engine *decision.Engine
 
 	wantlist *wantlist.ThreadSafe
@@ -124,6 +147,14 @@ type Bitswap struct {
 	process process.Process
 
 	newBlocks chan *blocks.Block
+
+	counterLk      sync.Mutex
+	blocksRecvd    int
+	dupBlocksRecvd int
+	blocksSent     int
+
+	sessionsLk sync.Mutex
+	sessions   map[*requestSession]struct{}
 }
 
 type blockRequest struct {
@@ -134,6 +165,12 @@ type blockRequest struct {
 // GetBlock attempts to retrieve a particular block from peers within the
 // deadline enforced by the context.
 func (bs *Bitswap) GetBlock(parent context.Context, k u.Key) (*blocks.Block, error) {
+	return bs.getBlock(parent, k, nil)
+}
+
+// getBlock retrieves a block like GetBlock, on behalf of the session s if it
+// is not nil.
+func (bs *Bitswap) getBlock(parent context.Context, k u.Key, s *requestSession) (*blocks.Block, error) {
 
 	// Any async work initiated by this function must end when this function
 	// returns. To ensure this, derive a new context. Note that it is okay to
@@ -151,7 +188,7 @@ func (bs *Bitswap) GetBlock(parent context.Context, k u.Key) (*blocks.Block, err
 		cancelFunc()
 	}()
 
-	promise, err := bs.GetBlocks(ctx, []u.Key{k})
+	promise, err := bs.getBlocks(ctx, []u.Key{k}, s)
 	if err != nil {
 		return nil, err
 	}
@@ -172,14 +209,98 @@ func (bs *Bitswap) GetBlock(parent context.Context, k u.Key) (*blocks.Block, err
 	}
 }
 
+// GetBlockFrom retrieves a block like GetBlock, but first asks the peer p,
+// which is expected to have it, instead of broadcasting the want. If p
+// cannot be reached or does not send the block within a few seconds, the
+// block is requested from the network as usual; p may still send it then.
+func (bs *Bitswap) GetBlockFrom(parent context.Context, k u.Key, p peer.ID) (*blocks.Block, error) {
+	select {
+	case <-bs.process.Closing():
+		return nil, errors.New("bitswap is closed")
+	default:
+	}
+
+	ctx, cancelFunc := context.WithCancel(parent)
+	defer cancelFunc()
+
+	ctx = eventlog.ContextWithLoggable(ctx, eventlog.Uuid("GetBlockFromRequest"))
+	defer log.EventBegin(ctx, "GetBlockFromRequest", &k, p).Done()
+
+	// subscribed before asking p, so that the block cannot slip by
+	hinted := bs.notifications.Subscribe(ctx, k)
+
+	want := bsmsg.New()
+	want.SetFull(false)
+	want.AddEntry(k, kMaxPriority)
+	if err := bs.send(ctx, p, want); err != nil {
+		log.Debugf("asking hinted peer %s for %s: %s", p, k, err)
+	} else {
+		select {
+		case blk, ok := <-hinted:
+			if ok {
+				return blk, nil
+			}
+			return nil, promiseClosedErr(parent)
+		case <-time.After(providerHintTimeout):
+			log.Debugf("hinted peer %s did not send %s, searching the network", p, k)
+		case <-parent.Done():
+			// the want was not added to the wantlist, so p is told by hand
+			cancel := bsmsg.New()
+			cancel.SetFull(false)
+			cancel.Cancel(k)
+			cctx, cancelCtx := context.WithTimeout(context.Background(), provideTimeout)
+			defer cancelCtx()
+			if err := bs.send(cctx, p, cancel); err != nil {
+				log.Debugf("cancelling want of %s with %s: %s", k, p, err)
+			}
+			return nil, parent.Err()
+		}
+	}
+
+	promise, err := bs.GetBlocks(ctx, []u.Key{k})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case blk, ok := <-hinted:
+		if ok {
+			return blk, nil
+		}
+	case blk, ok := <-promise:
+		if ok {
+			return blk, nil
+		}
+	}
+	return nil, promiseClosedErr(parent)
+}
+
+// promiseClosedErr tells why a block promise was closed before the block
+// arrived.
+func promiseClosedErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.New("promise channel was closed")
+}
+
 // GetBlocks returns a channel where the caller may receive blocks that
 // correspond to the provided |keys|. Returns an error if BitSwap is unable to
 // begin this request within the deadline enforced by the context.
 //
 // NB: Your request remains open until the context expires. To conserve
 // resources, provide a context with a reasonably short deadline (ie. not one
-// that lasts throughout the lifetime of the server)
+// that lasts throughout the lifetime of the server). Once it expires, the
+// keys that were not received are taken off the wantlist, unless other
+// requests still want them, and peers are told to cancel them.
 func (bs *Bitswap) GetBlocks(ctx context.Context, keys []u.Key) (<-chan *blocks.Block, error) {
+	return bs.getBlocks(ctx, keys, nil)
+}
+
+// getBlocks requests keys like GetBlocks, on behalf of the session s if it
+// is not nil. Once s knows of peers that sent it blocks, the keys are asked
+// of them only, and of the whole network once they did not send any of the
+// keys for sessionPeerTimeout.
+func (bs *Bitswap) getBlocks(ctx context.Context, keys []u.Key, s *requestSession) (<-chan *blocks.Block, error) {
 	select {
 	case <-bs.process.Closing():
 		return nil, errors.New("bitswap is closed")
@@ -187,16 +308,116 @@ func (bs *Bitswap) GetBlocks(ctx context.Context, keys []u.Key) (<-chan *blocks.
 	}
 	promise := bs.notifications.Subscribe(ctx, keys...)
 
+	for i, k := range keys {
+		bs.wantlist.Add(k, kMaxPriority-i)
+	}
+
+	var peers []peer.ID
+	if s != nil {
+		s.want(keys)
+		peers = s.livePeers()
+	}
+
 	req := &blockRequest{
 		keys: keys,
 		ctx:  ctx,
 	}
-	select {
-	case bs.batchRequests <- req:
-		return promise, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	if len(peers) == 0 {
+		select {
+		case bs.batchRequests <- req:
+		case <-ctx.Done():
+			bs.releaseWants(keys)
+			if s != nil {
+				s.unwant(keys)
+			}
+			return nil, ctx.Err()
+		}
+		req = nil
+	} else {
+		go bs.sendWants(ctx, keys, peers)
+	}
+
+	out := make(chan *blocks.Block, len(keys))
+	go func() {
+		defer close(out)
+
+		remaining := make(map[u.Key]int, len(keys))
+		for _, k := range keys {
+			remaining[k]++
+		}
+		// the promise is closed once all blocks arrived or ctx expired
+		for {
+			// req is set until it went to the whole network
+			var fallback <-chan time.Time
+			var timer *time.Timer
+			if req != nil {
+				timer = time.NewTimer(sessionPeerTimeout)
+				fallback = timer.C
+			}
+
+			var blk *blocks.Block
+			var ok bool
+			select {
+			case blk, ok = <-promise:
+			case <-fallback:
+				ok = true
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			if !ok {
+				break
+			}
+
+			if blk != nil {
+				delete(remaining, blk.Key())
+				out <- blk
+				continue
+			}
+
+			log.Debugf("session peers did not send %d blocks, asking the network", len(remaining))
+			req.keys = make([]u.Key, 0, len(remaining))
+			for k := range remaining {
+				req.keys = append(req.keys, k)
+			}
+			select {
+			case bs.batchRequests <- req:
+			case <-ctx.Done():
+			}
+			req = nil
+		}
+
+		var unfulfilled []u.Key
+		for k, n := range remaining {
+			for i := 0; i < n; i++ {
+				unfulfilled = append(unfulfilled, k)
+			}
+		}
+		bs.releaseWants(unfulfilled)
+		if s != nil {
+			s.unwant(keys)
+		}
+	}()
+	return out, nil
+}
+
+// releaseWants drops this request's interest in keys, cancelling the ones
+// nobody else wants anymore with our partners.
+func (bs *Bitswap) releaseWants(keys []u.Key) {
+	var cancel []u.Key
+	for _, k := range keys {
+		if bs.wantlist.Release(k) {
+			cancel = append(cancel, k)
+		}
+	}
+	if len(cancel) == 0 {
+		return
 	}
+
+	// the requesting context is done, so the cancels get their own
+	ctx, cancelFunc := context.WithTimeout(context.Background(), provideTimeout)
+	defer cancelFunc()
+	bs.cancelBlocks(ctx, cancel, "")
 }
 
 // HasBlock announces the existance of a block to this bitswap service. The
@@ -307,23 +528,95 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 	// TODO: this is bad, and could be easily abused.
 	// Should only track *useful* messages in ledger
 
-	for _, block := range incoming.Blocks() {
+	bs.counterLk.Lock()
+	bs.blocksRecvd += len(incoming.Blocks())
+	bs.counterLk.Unlock()
+
+	received := bs.rehashUnwanted(incoming.Blocks())
+
+	// tell the other partners right away that the wanted blocks arrived,
+	// so that fewer of them send the blocks too
+	var wanted []u.Key
+	for _, block := range received {
+		if _, ok := bs.wantlist.Contains(block.Key()); ok {
+			wanted = append(wanted, block.Key())
+		}
+	}
+	cancelled := make(chan struct{})
+	go func() {
+		defer close(cancelled)
+		bs.cancelBlocks(ctx, wanted, p)
+	}()
+
+	// before publishing them, while the sessions still want them
+	bs.sessionsReceived(p, received)
+	dups := 0
+	for _, block := range received {
+		k := block.Key()
+		log.Event(ctx, "blockReceived", &k, p)
+		if has, err := bs.blockstore.Has(block.Key()); err == nil && has {
+			dups++
+			// requests for blocks stored already may still wait for them
+			if _, ok := bs.wantlist.Contains(block.Key()); ok {
+				bs.wantlist.Remove(block.Key())
+				bs.notifications.Publish(block)
+			}
+			continue
+		}
 		hasBlockCtx, _ := context.WithTimeout(ctx, hasBlockTimeout)
 		if err := bs.HasBlock(hasBlockCtx, block); err != nil {
 			log.Debug(err)
 		}
 	}
-
-	var keys []u.Key
-	for _, block := range incoming.Blocks() {
-		keys = append(keys, block.Key())
+	if dups > 0 {
+		bs.counterLk.Lock()
+		bs.dupBlocksRecvd += dups
+		bs.counterLk.Unlock()
 	}
-	bs.cancelBlocks(ctx, keys)
+	<-cancelled
 
 	// TODO: consider changing this function to not return anything
 	return "", nil
 }
 
+// rehashUnwanted keys received blocks we did not ask for with the hash
+// functions of the wanted keys. Messages only carry block data, which is
+// hashed with the default function when decoded, so blocks wanted under a
+// key of another hash function would go unnoticed otherwise.
+func (bs *Bitswap) rehashUnwanted(blks []*blocks.Block) []*blocks.Block {
+	var codes []int
+	seen := make(map[int]bool)
+	for _, e := range bs.wantlist.Entries() {
+		dh, err := mh.Decode([]byte(e.Key))
+		if err != nil || dh.Code == mh.SHA2_256 || seen[dh.Code] {
+			continue
+		}
+		seen[dh.Code] = true
+		codes = append(codes, dh.Code)
+	}
+	if len(codes) == 0 {
+		return blks
+	}
+
+	out := make([]*blocks.Block, 0, len(blks))
+	for _, b := range blks {
+		if _, ok := bs.wantlist.Contains(b.Key()); !ok {
+			for _, code := range codes {
+				rb, err := blocks.NewBlockWithHashFunc(b.Data, code)
+				if err != nil {
+					continue
+				}
+				if _, ok := bs.wantlist.Contains(rb.Key()); ok {
+					b = rb
+					break
+				}
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
 // Connected/Disconnected warns bitswap about peer connections
 func (bs *Bitswap) PeerConnected(p peer.ID) {
 	// TODO: add to clientWorker??
@@ -341,7 +634,9 @@ func (bs *Bitswap) PeerDisconnected(p peer.ID) {
 	bs.engine.PeerDisconnected(p)
 }
 
-func (bs *Bitswap) cancelBlocks(ctx context.Context, bkeys []u.Key) {
+// cancelBlocks tells our partners, except the peer skip, that we no longer
+// want bkeys.
+func (bs *Bitswap) cancelBlocks(ctx context.Context, bkeys []u.Key, skip peer.ID) {
 	if len(bkeys) < 1 {
 		return
 	}
@@ -350,15 +645,30 @@ func (bs *Bitswap) cancelBlocks(ctx context.Context, bkeys []u.Key) {
 	for _, k := range bkeys {
 		message.Cancel(k)
 	}
+
+	wg := sync.WaitGroup{}
 	for _, p := range bs.engine.Peers() {
-		err := bs.send(ctx, p, message)
-		if err != nil {
-			log.Debugf("Error sending message: %s", err)
+		if p == skip {
+			continue
 		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			if err := bs.send(ctx, p, message); err != nil {
+				log.Debugf("Error sending message: %s", err)
+			}
+		}(p)
 	}
+	wg.Wait()
 }
 
 func (bs *Bitswap) wantNewBlocks(ctx context.Context, bkeys []u.Key) {
+	bs.sendWants(ctx, bkeys, bs.engine.Peers())
+}
+
+// sendWants tells peers that we want bkeys, without sending them the rest of
+// the wantlist.
+func (bs *Bitswap) sendWants(ctx context.Context, bkeys []u.Key, peers []peer.ID) {
 	if len(bkeys) < 1 {
 		return
 	}
@@ -370,7 +680,7 @@ func (bs *Bitswap) wantNewBlocks(ctx context.Context, bkeys []u.Key) {
 	}
 
 	wg := sync.WaitGroup{}
-	for _, p := range bs.engine.Peers() {
+	for _, p := range peers {
 		wg.Add(1)
 		go func(p peer.ID) {
 			defer wg.Done()
@@ -396,6 +706,11 @@ func (bs *Bitswap) send(ctx context.Context, p peer.ID, m bsmsg.BitSwapMessage)
 	if err := bs.network.SendMessage(ctx, p, m); err != nil {
 		return errors.Wrap(err)
 	}
+
+	bs.counterLk.Lock()
+	bs.blocksSent += len(m.Blocks())
+	bs.counterLk.Unlock()
+
 	return bs.engine.MessageSent(p, m)
 }
 
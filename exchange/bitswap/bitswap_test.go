@@ -6,12 +6,18 @@ import (
 	"testing"
 	"time"
 
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	ds_sync "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
 	detectrace "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-detect-race"
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	blocks "github.com/jbenet/go-ipfs/blocks"
+	blockstore "github.com/jbenet/go-ipfs/blocks/blockstore"
 	blocksutil "github.com/jbenet/go-ipfs/blocks/blocksutil"
+	bsmsg "github.com/jbenet/go-ipfs/exchange/bitswap/message"
+	bsnet "github.com/jbenet/go-ipfs/exchange/bitswap/network"
 	tn "github.com/jbenet/go-ipfs/exchange/bitswap/testnet"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
 	p2ptestutil "github.com/jbenet/go-ipfs/p2p/test/util"
 	mockrouting "github.com/jbenet/go-ipfs/routing/mock"
 	delay "github.com/jbenet/go-ipfs/thirdparty/delay"
@@ -89,6 +95,119 @@ func TestGetBlockFromPeerAfterPeerAnnounces(t *testing.T) {
 	if !bytes.Equal(block.Data, received.Data) {
 		t.Fatal("Data doesn't match")
 	}
+
+	st, err := wantsBlock.Exchange.(*Bitswap).Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the block may arrive more than once if the wantlist was sent twice
+	if st.BlocksReceived < 1 {
+		t.Fatal("expected the received block to be counted")
+	}
+}
+
+func TestGetBlockFromHintedPeer(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	// the block is not provided, so only the hint leads to it
+	block := blocks.NewBlock([]byte("block"))
+	hasBlock := g.Next()
+	defer hasBlock.Exchange.Close()
+	if err := hasBlock.Blockstore().Put(block); err != nil {
+		t.Fatal(err)
+	}
+
+	wantsBlock := g.Next()
+	defer wantsBlock.Exchange.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	received, err := wantsBlock.Exchange.(*Bitswap).GetBlockFrom(ctx, block.Key(), hasBlock.Peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.Data, received.Data) {
+		t.Fatal("Data doesn't match")
+	}
+}
+
+func TestGetBlockFromFallsBack(t *testing.T) {
+	defer func(d time.Duration) { providerHintTimeout = d }(providerHintTimeout)
+	providerHintTimeout = 10 * time.Millisecond
+
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	block := blocks.NewBlock([]byte("block"))
+	hasBlock := g.Next()
+	defer hasBlock.Exchange.Close()
+	if err := hasBlock.Exchange.HasBlock(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+
+	hinted := g.Next()
+	defer hinted.Exchange.Close()
+	wantsBlock := g.Next()
+	defer wantsBlock.Exchange.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	received, err := wantsBlock.Exchange.(*Bitswap).GetBlockFrom(ctx, block.Key(), hinted.Peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.Data, received.Data) {
+		t.Fatal("Data doesn't match")
+	}
+}
+
+func TestCancelledRequestLeavesWantlist(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	inst := g.Next()
+	defer inst.Exchange.Close()
+	bs := inst.Exchange.(*Bitswap)
+
+	k := blocks.NewBlock([]byte("nobody has this")).Key()
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	if _, err := bs.GetBlocks(ctx1, []u.Key{k}); err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	if _, err := bs.GetBlocks(ctx2, []u.Key{k}); err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := func() bool {
+		for _, w := range bs.GetWantlist() {
+			if w == k {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the key is still wanted by the second request
+	cancel1()
+	time.Sleep(50 * time.Millisecond)
+	if !wanted() {
+		t.Fatal("key removed from the wantlist while still wanted")
+	}
+
+	cancel2()
+	for i := 0; wanted(); i++ {
+		if i > 100 {
+			t.Fatal("key stayed on the wantlist after its requests were cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
 func TestLargeSwarm(t *testing.T) {
@@ -258,3 +377,186 @@ func TestBasicBitswap(t *testing.T) {
 		}
 	}
 }
+
+func TestSession(t *testing.T) {
+	defer func(d time.Duration) { sessionPeerTimeout = d }(sessionPeerTimeout)
+	sessionPeerTimeout = time.Millisecond * 100
+
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	instances := sg.Instances(3)
+	a := instances[0].Exchange.(*Bitswap)
+	b := instances[1].Exchange.(*Bitswap)
+	c := instances[2].Exchange.(*Bitswap)
+	blks := bg.Blocks(3)
+	for _, blk := range blks[:2] {
+		if err := b.HasBlock(context.TODO(), blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, blk := range blks[1:] {
+		if err := c.HasBlock(context.TODO(), blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+	s := a.NewSession(ctx)
+
+	// only b provides the first block, so the session learns of b
+	if _, err := s.GetBlock(ctx, blks[0].Key()); err != nil {
+		t.Fatal(err)
+	}
+	peers := s.(*requestSession).livePeers()
+	if len(peers) != 1 || peers[0] != instances[1].Peer {
+		t.Fatalf("expected b to be the peer of the session, got %v", peers)
+	}
+
+	// both have the second block, but only b is asked for it
+	if _, err := s.GetBlock(ctx, blks[1].Key()); err != nil {
+		t.Fatal(err)
+	}
+	c.counterLk.Lock()
+	sent := c.blocksSent
+	c.counterLk.Unlock()
+	if sent != 0 {
+		t.Fatalf("expected c not to be asked for blocks, but it sent %d", sent)
+	}
+
+	// b does not have the third block, so the network is asked once b does
+	// not send it
+	if _, err := s.GetBlock(ctx, blks[2].Key()); err != nil {
+		t.Fatal(err)
+	}
+	peers = s.(*requestSession).livePeers()
+	if len(peers) != 2 || peers[1] != instances[2].Peer {
+		t.Fatalf("expected c to join the peers of the session, got %v", peers)
+	}
+
+	cancel()
+	if _, err := s.GetBlock(context.TODO(), blks[0].Key()); err == nil {
+		t.Fatal("expected requests to fail once the session ended")
+	}
+}
+
+func TestDuplicateBlocksReceived(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	instances := sg.Instances(3)
+	a := instances[0].Exchange.(*Bitswap)
+	blk := bg.Next()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+	promise, err := a.GetBlocks(ctx, []u.Key{blk.Key()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both partners send the block, the second one too late
+	for _, inst := range instances[1:] {
+		msg := bsmsg.New()
+		msg.AddBlock(blk)
+		a.ReceiveMessage(ctx, inst.Peer, msg)
+	}
+	if got := <-promise; got == nil || got.Key() != blk.Key() {
+		t.Fatalf("expected to receive %s, got %v", blk.Key(), got)
+	}
+
+	st, err := a.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.BlocksReceived != 2 || st.DupBlksReceived != 1 {
+		t.Fatalf("expected 2 blocks received, 1 of them a duplicate, got %d and %d", st.BlocksReceived, st.DupBlksReceived)
+	}
+}
+
+// countingNetwork counts the provider searches made through it
+type countingNetwork struct {
+	bsnet.BitSwapNetwork
+
+	lk       sync.Mutex
+	searches int
+}
+
+func (n *countingNetwork) FindProvidersAsync(ctx context.Context, k u.Key, max int) <-chan peer.ID {
+	n.lk.Lock()
+	n.searches++
+	n.lk.Unlock()
+	return n.BitSwapNetwork.FindProvidersAsync(ctx, k, max)
+}
+
+func (n *countingNetwork) Searches() int {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return n.searches
+}
+
+func TestProviderSearchDelay(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	partner := g.Next()
+	defer partner.Exchange.Close()
+	stranger := g.Next()
+	defer stranger.Exchange.Close()
+
+	ident := p2ptestutil.RandTestBogusIdentityOrFatal(t)
+	cnet := &countingNetwork{BitSwapNetwork: net.Adapter(ident)}
+	bstore := blockstore.NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	bs := New(context.Background(), ident.ID(), cnet, bstore, true).(*Bitswap)
+	defer bs.Close()
+	bs.ProviderSearchDelay.Set(0)
+
+	get := func(b *blocks.Block) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := bs.GetBlock(ctx, b.Key()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// found through the routing system, which makes partner a partner
+	bgen := blocksutil.NewBlockGenerator()
+	first := bgen.Next()
+	if err := partner.Exchange.HasBlock(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	get(first)
+	searches := cnet.Searches()
+	if searches == 0 {
+		t.Fatal("expected the providers of the first block to be searched for")
+	}
+
+	// the partners send the block before the delay is over
+	bs.ProviderSearchDelay.Set(time.Minute)
+	second := bgen.Next()
+	if err := partner.Exchange.HasBlock(context.Background(), second); err != nil {
+		t.Fatal(err)
+	}
+	get(second)
+	if cnet.Searches() != searches {
+		t.Fatal("expected no provider search for a block sent by a partner")
+	}
+
+	// the partners do not have the block, so its providers are searched for
+	// once the delay is over
+	bs.ProviderSearchDelay.Set(50 * time.Millisecond)
+	third := bgen.Next()
+	if err := stranger.Exchange.HasBlock(context.Background(), third); err != nil {
+		t.Fatal(err)
+	}
+	get(third)
+	if cnet.Searches() != searches+1 {
+		t.Fatalf("expected a provider search after the delay, got %d", cnet.Searches()-searches)
+	}
+}
@@ -0,0 +1,160 @@
+package bitswap
+
+import (
+	"sync"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/jbenet/go-ipfs/blocks"
+	exchange "github.com/jbenet/go-ipfs/exchange"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	u "github.com/jbenet/go-ipfs/util"
+	errors "github.com/jbenet/go-ipfs/util/debugerror"
+)
+
+const (
+	// maxSessionPeers is how many of the peers that sent it blocks a
+	// session asks for the next ones.
+	maxSessionPeers = 8
+)
+
+var (
+	// sessionPeerTimeout is how long the peers of a session may take to
+	// send one of the blocks asked of them, before they are asked of the
+	// whole network.
+	sessionPeerTimeout = time.Second * 2
+)
+
+// requestSession groups related requests, such as those for the blocks of
+// one file. It remembers the peers that sent blocks it wanted, and asks
+// them for the next blocks instead of broadcasting the wants to every
+// partner.
+type requestSession struct {
+	bs  *Bitswap
+	ctx context.Context
+
+	lk     sync.Mutex
+	peers  []peer.ID // most recent senders last
+	wanted map[u.Key]int
+}
+
+// NewSession returns a Fetcher whose requests are grouped in one session.
+// The session ends with ctx; its requests fail from then on.
+func (bs *Bitswap) NewSession(ctx context.Context) exchange.Fetcher {
+	s := &requestSession{bs: bs, ctx: ctx, wanted: make(map[u.Key]int)}
+
+	bs.sessionsLk.Lock()
+	bs.sessions[s] = struct{}{}
+	bs.sessionsLk.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-bs.process.Closing():
+		}
+		bs.sessionsLk.Lock()
+		delete(bs.sessions, s)
+		bs.sessionsLk.Unlock()
+	}()
+	return s
+}
+
+func (s *requestSession) GetBlock(ctx context.Context, k u.Key) (*blocks.Block, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	return s.bs.getBlock(ctx, k, s)
+}
+
+func (s *requestSession) GetBlocks(ctx context.Context, keys []u.Key) (<-chan *blocks.Block, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	return s.bs.getBlocks(ctx, keys, s)
+}
+
+func (s *requestSession) err() error {
+	if s.ctx.Err() != nil {
+		return errors.New("bitswap session has ended")
+	}
+	return nil
+}
+
+func (s *requestSession) want(keys []u.Key) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, k := range keys {
+		s.wanted[k]++
+	}
+}
+
+func (s *requestSession) unwant(keys []u.Key) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, k := range keys {
+		if s.wanted[k]--; s.wanted[k] <= 0 {
+			delete(s.wanted, k)
+		}
+	}
+}
+
+// received records p as a peer of the session if it sent any of the blocks
+// the session wants.
+func (s *requestSession) received(p peer.ID, blks []*blocks.Block) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	for _, b := range blks {
+		if _, ok := s.wanted[b.Key()]; !ok {
+			continue
+		}
+		for i, sp := range s.peers {
+			if sp == p {
+				s.peers = append(s.peers[:i], s.peers[i+1:]...)
+				break
+			}
+		}
+		s.peers = append(s.peers, p)
+		if len(s.peers) > maxSessionPeers {
+			s.peers = s.peers[1:]
+		}
+		return
+	}
+}
+
+// livePeers returns the peers of the session we are still connected to.
+func (s *requestSession) livePeers() []peer.ID {
+	partners := make(map[peer.ID]bool)
+	for _, p := range s.bs.engine.Peers() {
+		partners[p] = true
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	var live []peer.ID
+	for _, p := range s.peers {
+		if partners[p] {
+			live = append(live, p)
+		}
+	}
+	return live
+}
+
+// sessionsReceived tells the open sessions that p sent blks.
+func (bs *Bitswap) sessionsReceived(p peer.ID, blks []*blocks.Block) {
+	if len(blks) == 0 {
+		return
+	}
+	bs.sessionsLk.Lock()
+	sessions := make([]*requestSession, 0, len(bs.sessions))
+	for s := range bs.sessions {
+		sessions = append(sessions, s)
+	}
+	bs.sessionsLk.Unlock()
+
+	for _, s := range sessions {
+		s.received(p, blks)
+	}
+}
+
+var _ exchange.SessionExchange = &Bitswap{}
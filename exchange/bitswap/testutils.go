@@ -95,6 +95,8 @@ func session(ctx context.Context, net tn.Network, p testutil.Identity) Instance
 	const alwaysSendToPeer = true
 
 	bs := New(ctx, p.ID(), adapter, bstore, alwaysSendToPeer)
+	// the tests expect the providers to be searched for right away
+	bs.(*Bitswap).ProviderSearchDelay.Set(0)
 
 	return Instance{
 		Peer:            p.ID(),
@@ -24,6 +24,9 @@ type Entry struct {
 	// slices can be copied efficiently.
 	Key      u.Key
 	Priority int
+
+	// number of times the key was added and not yet released
+	refcnt int
 }
 
 type entrySlice []Entry
@@ -58,6 +61,14 @@ func (w *ThreadSafe) Remove(k u.Key) {
 	w.Wantlist.Remove(k)
 }
 
+// Release drops one reference to k, added by Add. It returns true if that
+// was the last one and k was removed from the wantlist.
+func (w *ThreadSafe) Release(k u.Key) bool {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	return w.Wantlist.Release(k)
+}
+
 func (w *ThreadSafe) Contains(k u.Key) (Entry, bool) {
 	// TODO rm defer for perf
 	w.lk.RLock()
@@ -87,20 +98,42 @@ func (w *Wantlist) Len() int {
 	return len(w.set)
 }
 
+// Add adds k to the wantlist. Adding a key that is already wanted keeps its
+// priority, and takes another reference to it.
 func (w *Wantlist) Add(k u.Key, priority int) {
-	if _, ok := w.set[k]; ok {
+	if e, ok := w.set[k]; ok {
+		e.refcnt++
+		w.set[k] = e
 		return
 	}
 	w.set[k] = Entry{
 		Key:      k,
 		Priority: priority,
+		refcnt:   1,
 	}
 }
 
+// Remove removes k from the wantlist, regardless of how often it was added.
 func (w *Wantlist) Remove(k u.Key) {
 	delete(w.set, k)
 }
 
+// Release drops one reference to k. It returns true if that was the last one
+// and k was removed from the wantlist.
+func (w *Wantlist) Release(k u.Key) bool {
+	e, ok := w.set[k]
+	if !ok {
+		return false
+	}
+	e.refcnt--
+	if e.refcnt > 0 {
+		w.set[k] = e
+		return false
+	}
+	delete(w.set, k)
+	return true
+}
+
 func (w *Wantlist) Contains(k u.Key) (Entry, bool) {
 	e, ok := w.set[k]
 	return e, ok
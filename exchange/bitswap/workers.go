@@ -6,6 +6,7 @@ import (
 	inflect "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/chuckpreslar/inflect"
 	process "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	u "github.com/jbenet/go-ipfs/util"
 )
 
 func (bs *Bitswap) startWorkers(px process.Process, ctx context.Context) {
@@ -14,6 +15,11 @@ func (bs *Bitswap) startWorkers(px process.Process, ctx context.Context) {
 		bs.clientWorker(ctx)
 	})
 
+	// Start up a worker to search for the providers of the blocks requested
+	px.Go(func(px process.Process) {
+		bs.providerSearchWorker(ctx)
+	})
+
 	// Start up a worker to handle requests from other nodes for the data on this node
 	px.Go(func(px process.Process) {
 		bs.taskWorker(ctx)
@@ -86,29 +92,59 @@ func (bs *Bitswap) clientWorker(parent context.Context) {
 				log.Warning("Received batch request for zero blocks")
 				continue
 			}
-			for i, k := range keys {
-				bs.wantlist.Add(k, kMaxPriority-i)
-			}
+			go bs.searchProvidersLater(req)
+			bs.wantNewBlocks(req.ctx, keys)
+
+		case <-parent.Done():
+			return
+		}
+	}
+}
+
+// searchProvidersLater hands req to the provider search worker once it
+// waited for ProviderSearchDelay, unless it is done by then.
+func (bs *Bitswap) searchProvidersLater(req *blockRequest) {
+	timer := time.NewTimer(bs.ProviderSearchDelay.Get())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-req.ctx.Done():
+		return
+	}
+	select {
+	case bs.findProviders <- req:
+	case <-req.ctx.Done():
+	}
+}
 
-			done := make(chan struct{})
-			go func() {
-				bs.wantNewBlocks(req.ctx, keys)
-				close(done)
-			}()
+func (bs *Bitswap) providerSearchWorker(parent context.Context) {
+	defer log.Info("bitswap provider search worker shutting down...")
+
+	for {
+		select {
+		case req := <-bs.findProviders:
+			var wanted []u.Key
+			for _, k := range req.keys {
+				if _, ok := bs.wantlist.Contains(k); ok {
+					wanted = append(wanted, k)
+				}
+			}
+			if len(wanted) == 0 {
+				log.Debugf("the %d blocks requested arrived, not searching for providers", len(req.keys))
+				continue
+			}
 
 			// NB: Optimization. Assumes that providers of key[0] are likely to
 			// be able to provide for all keys. This currently holds true in most
 			// every situation. Later, this assumption may not hold as true.
-			child, _ := context.WithTimeout(req.ctx, providerRequestTimeout)
-			providers := bs.network.FindProvidersAsync(child, keys[0], maxProvidersPerRequest)
+			child, cancel := context.WithTimeout(req.ctx, providerRequestTimeout)
+			providers := bs.network.FindProvidersAsync(child, wanted[0], maxProvidersPerRequest)
 			err := bs.sendWantlistToPeers(req.ctx, providers)
+			cancel()
 			if err != nil {
 				log.Debugf("error sending wantlist: %s", err)
 			}
 
-			// Wait for wantNewBlocks to finish
-			<-done
-
 		case <-parent.Done():
 			return
 		}
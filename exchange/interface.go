@@ -12,10 +12,7 @@ import (
 // Any type that implements exchange.Interface may be used as an IPFS block
 // exchange protocol.
 type Interface interface {
-	// GetBlock returns the block associated with a given key.
-	GetBlock(context.Context, u.Key) (*blocks.Block, error)
-
-	GetBlocks(context.Context, []u.Key) (<-chan *blocks.Block, error)
+	Fetcher
 
 	// TODO Should callers be concerned with whether the block was made
 	// available on the network?
@@ -23,3 +20,22 @@ type Interface interface {
 
 	io.Closer
 }
+
+// Fetcher fetches blocks from the network.
+type Fetcher interface {
+	// GetBlock returns the block associated with a given key.
+	GetBlock(context.Context, u.Key) (*blocks.Block, error)
+
+	GetBlocks(context.Context, []u.Key) (<-chan *blocks.Block, error)
+}
+
+// SessionExchange is an exchange that can group related requests, e.g. for
+// the blocks of one file, into a session. The session learns which peers
+// have the content, and asks them for the next blocks rather than everyone.
+type SessionExchange interface {
+	Interface
+
+	// NewSession returns a Fetcher whose requests belong to a new session,
+	// which ends with ctx.
+	NewSession(context.Context) Fetcher
+}
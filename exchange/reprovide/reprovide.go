@@ -6,25 +6,62 @@ import (
 	backoff "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/cenkalti/backoff"
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/jbenet/go-ipfs/blocks/blockstore"
+	pin "github.com/jbenet/go-ipfs/pin"
 	routing "github.com/jbenet/go-ipfs/routing"
 	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
+	u "github.com/jbenet/go-ipfs/util"
 	debugerror "github.com/jbenet/go-ipfs/util/debugerror"
 )
 
 var log = eventlog.Logger("reprovider")
 
+// KeyChanFunc returns the keys a Reprovider should announce
+type KeyChanFunc func(context.Context) (<-chan u.Key, error)
+
 type Reprovider struct {
 	// The routing system to provide values through
 	rsys routing.IpfsRouting
 
-	// The backing store for blocks to be provided
-	bstore blocks.Blockstore
+	// The strategy selecting which keys to provide
+	keyProvider KeyChanFunc
 }
 
+// NewReprovider creates a Reprovider announcing every block in bstore
 func NewReprovider(rsys routing.IpfsRouting, bstore blocks.Blockstore) *Reprovider {
+	return NewReproviderWithStrategy(rsys, NewBlockstoreProvider(bstore))
+}
+
+// NewReproviderWithStrategy creates a Reprovider announcing the keys
+// returned by the given strategy
+func NewReproviderWithStrategy(rsys routing.IpfsRouting, keyProvider KeyChanFunc) *Reprovider {
 	return &Reprovider{
-		rsys:   rsys,
-		bstore: bstore,
+		rsys:        rsys,
+		keyProvider: keyProvider,
+	}
+}
+
+// NewBlockstoreProvider returns a strategy providing every block in bstore
+func NewBlockstoreProvider(bstore blocks.Blockstore) KeyChanFunc {
+	return bstore.AllKeysChan
+}
+
+// NewPinnedRootsProvider returns a strategy providing only the roots of
+// direct and recursive pins
+func NewPinnedRootsProvider(pinning pin.Pinner) KeyChanFunc {
+	return func(ctx context.Context) (<-chan u.Key, error) {
+		keys := append(pinning.RecursiveKeys(), pinning.DirectKeys()...)
+		out := make(chan u.Key)
+		go func() {
+			defer close(out)
+			for _, k := range keys {
+				select {
+				case out <- k:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out, nil
 	}
 }
 
@@ -48,9 +85,9 @@ func (rp *Reprovider) ProvideEvery(ctx context.Context, tick time.Duration) {
 }
 
 func (rp *Reprovider) Reprovide(ctx context.Context) error {
-	keychan, err := rp.bstore.AllKeysChan(ctx)
+	keychan, err := rp.keyProvider(ctx)
 	if err != nil {
-		return debugerror.Errorf("Failed to get key chan from blockstore: %s", err)
+		return debugerror.Errorf("Failed to get key chan: %s", err)
 	}
 	for k := range keychan {
 		op := func() error {
@@ -8,6 +8,10 @@ import (
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/jbenet/go-ipfs/blocks"
 	blockstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	blockservice "github.com/jbenet/go-ipfs/blockservice"
+	offline "github.com/jbenet/go-ipfs/exchange/offline"
+	mdag "github.com/jbenet/go-ipfs/merkledag"
+	pin "github.com/jbenet/go-ipfs/pin"
 	mock "github.com/jbenet/go-ipfs/routing/mock"
 	testutil "github.com/jbenet/go-ipfs/util/testutil"
 
@@ -50,3 +54,60 @@ func TestReprovide(t *testing.T) {
 		t.Fatal("Somehow got the wrong peer back as a provider.")
 	}
 }
+
+func TestReprovidePinnedRoots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+
+	idA := testutil.RandIdentityOrFatal(t)
+	idB := testutil.RandIdentityOrFatal(t)
+
+	clA := mrserv.Client(idA)
+	clB := mrserv.Client(idB)
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := blockservice.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dserv := mdag.NewDAGService(bserv)
+	pinner := pin.NewPinner(dstore, dserv)
+
+	pinned := &mdag.Node{Data: []byte("pinned")}
+	if _, err := dserv.Add(pinned); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(pinned, false); err != nil {
+		t.Fatal(err)
+	}
+	unpinned := &mdag.Node{Data: []byte("not pinned")}
+	if _, err := dserv.Add(unpinned); err != nil {
+		t.Fatal(err)
+	}
+
+	reprov := NewReproviderWithStrategy(clA, NewPinnedRootsProvider(pinner))
+	if err := reprov.Reprovide(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	pk, _ := pinned.Key()
+	provs, err := clB.FindProviders(ctx, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) == 0 {
+		t.Fatal("pinned root should have been provided")
+	}
+
+	uk, _ := unpinned.Key()
+	provs, err = clB.FindProviders(ctx, uk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provs) != 0 {
+		t.Fatal("unpinned block should not have been provided")
+	}
+}
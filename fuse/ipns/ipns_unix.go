@@ -104,7 +104,7 @@ func CreateRoot(n *core.IpfsNode, keys []ci.PrivKey, ipfsroot string) (*Root, er
 			return nil, nil
 		}
 
-		node, err := n.Resolver.ResolvePath(path.Path(pointsTo.B58String()))
+		node, err := n.Resolver.ResolvePath(n.Context(), path.Path(pointsTo.B58String()))
 		if err != nil {
 			log.Warning("Failed to resolve value from ipns entry in ipfs")
 			continue
@@ -259,7 +259,7 @@ func (s *Node) Attr() fuse.Attr {
 
 // Lookup performs a lookup under this node.
 func (s *Node) Lookup(ctx context.Context, name string) (fs.Node, error) {
-	nodes, err := s.Ipfs.Resolver.ResolveLinks(s.Nd, []string{name})
+	nodes, err := s.Ipfs.Resolver.ResolveLinks(ctx, s.Nd, []string{name})
 	if err != nil {
 		// todo: make this error more versatile.
 		return nil, fuse.ENOENT
@@ -344,13 +344,13 @@ func (n *Node) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 
 	if n.dagMod == nil {
 		// Create a DagModifier to allow us to change the existing dag node
-		dmod, err := uio.NewDagModifier(n.Nd, n.Ipfs.DAG, chunk.DefaultSplitter)
+		dmod, err := uio.NewDagModifier(n.Nd, n.Ipfs.DAG, n.Ipfs.CapSplitter(chunk.DefaultSplitter))
 		if err != nil {
 			return err
 		}
 		n.dagMod = dmod
 	}
-	wrote, err := n.dagMod.WriteAt(req.Data, uint64(req.Offset))
+	wrote, err := n.dagMod.WriteAt(req.Data, req.Offset)
 	if err != nil {
 		return err
 	}
@@ -489,6 +489,7 @@ func (n *Node) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenR
 	if req.Flags&fuse.OpenTruncate != 0 {
 		log.Warning("Need to truncate file!")
 		n.cached = nil
+		n.dagMod = nil
 		n.Nd = &mdag.Node{Data: ft.FilePBData(nil, 0)}
 	} else if req.Flags&fuse.OpenAppend != 0 {
 		log.Warning("Need to append to file!")
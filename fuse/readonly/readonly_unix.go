@@ -57,7 +57,7 @@ func (s *Root) Lookup(ctx context.Context, name string) (fs.Node, error) {
 		return nil, fuse.ENOENT
 	}
 
-	nd, err := s.Ipfs.Resolver.ResolvePath(path.Path(name))
+	nd, err := s.Ipfs.Resolver.ResolvePath(ctx, path.Path(name))
 	if err != nil {
 		// todo: make this error more versatile.
 		return nil, fuse.ENOENT
@@ -107,6 +107,11 @@ func (s *Node) Attr() fuse.Attr {
 			Size:   uint64(len(s.cached.GetData())),
 			Blocks: uint64(len(s.Nd.Links)),
 		}
+	case ftpb.Data_Symlink:
+		return fuse.Attr{
+			Mode: os.ModeSymlink | 0555,
+			Size: uint64(len(s.cached.GetData())),
+		}
 
 	default:
 		log.Debug("Invalid data type.")
@@ -117,7 +122,7 @@ func (s *Node) Attr() fuse.Attr {
 // Lookup performs a lookup under this node.
 func (s *Node) Lookup(ctx context.Context, name string) (fs.Node, error) {
 	log.Debugf("Lookup '%s'", name)
-	nodes, err := s.Ipfs.Resolver.ResolveLinks(s.Nd, []string{name})
+	nodes, err := s.Ipfs.Resolver.ResolveLinks(ctx, s.Nd, []string{name})
 	if err != nil {
 		// todo: make this error more versatile.
 		return nil, fuse.ENOENT
@@ -179,6 +184,15 @@ func (s *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	return nil // may be non-nil / not succeeded
 }
 
+// Readlink returns the target of a symlink node
+func (s *Node) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	target, err := uio.ResolveSymlink(s.Nd)
+	if err != nil {
+		return "", fuse.EIO
+	}
+	return target, nil
+}
+
 // to check that out Node implements all the interfaces we want
 type roRoot interface {
 	fs.Node
@@ -193,6 +207,7 @@ type roNode interface {
 	fs.HandleReader
 	fs.Node
 	fs.NodeStringLookuper
+	fs.NodeReadlinker
 }
 
 var _ roNode = (*Node)(nil)
@@ -0,0 +1,358 @@
+// package adder imports files, directories and readers into a DAG as unixfs
+// objects, pinning them and keeping track of the blocks it stores. The add
+// functions of core and coreunix are all built on it, so that they store
+// the same objects for the same data.
+package adder
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	gopath "path"
+	"sort"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	files "github.com/jbenet/go-ipfs/commands/files"
+	importer "github.com/jbenet/go-ipfs/importer"
+	chunk "github.com/jbenet/go-ipfs/importer/chunk"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	pin "github.com/jbenet/go-ipfs/pin"
+	unixfs "github.com/jbenet/go-ipfs/unixfs"
+	u "github.com/jbenet/go-ipfs/util"
+	debugerror "github.com/jbenet/go-ipfs/util/debugerror"
+)
+
+// Stats tells how many of the blocks of an add were new to the blockstore,
+// and how many were already stored, e.g. by an earlier add of the same data.
+type Stats struct {
+	NewBlocks      int
+	NewBytes       uint64
+	ExistingBlocks int
+	ExistingBytes  uint64
+}
+
+// Adder adds data to DAG, whose blocks are stored in Blockstore.
+//
+// Every add stores the whole DAG of what is added, and pins its root
+// recursively with Pinner if there is one. If any of it fails, or the context
+// is cancelled before the add is complete, the blocks stored so far are left
+// unpinned for the garbage collector to remove: other adds running at the
+// same time may share them. Callers sharing the pinner with a garbage
+// collector must hold off collections during adds.
+type Adder struct {
+	DAG        merkledag.DAGService
+	Blockstore bstore.Blockstore
+
+	// Pinner pins the roots of the adds. It is optional.
+	Pinner pin.Pinner
+
+	// Splitter chunks file data, chunk.DefaultSplitter if nil.
+	Splitter chunk.BlockSplitter
+
+	// MaxBlockSize, if positive, is the size of the largest blocks DAG
+	// takes. Larger chunks of the splitter are cut to fit.
+	MaxBlockSize int
+}
+
+// AddReader chunks the data read from r into a unixfs file and adds it. The
+// data is streamed: only the chunks being assembled are held in memory,
+// however long r is.
+func (a *Adder) AddReader(ctx context.Context, r io.Reader) (*merkledag.Node, Stats, error) {
+	return a.add(func(dag merkledag.DAGService) (*merkledag.Node, error) {
+		return a.addReader(ctx, dag, r)
+	})
+}
+
+// AddWrapped adds the data read from r as a file called filename, in a
+// directory holding only that file, and returns the directory.
+func (a *Adder) AddWrapped(ctx context.Context, r io.Reader, filename string) (*merkledag.Node, Stats, error) {
+	return a.add(func(dag merkledag.DAGService) (*merkledag.Node, error) {
+		file, err := a.addReader(ctx, dag, r)
+		if err != nil {
+			return nil, err
+		}
+		dir := &merkledag.Node{Data: unixfs.FolderPBData()}
+		if err := dir.AddNodeLinkClean(filename, file); err != nil {
+			return nil, err
+		}
+		if _, err := dag.Add(dir); err != nil {
+			return nil, err
+		}
+		return dir, nil
+	})
+}
+
+// AddFile adds the tree of files yielded by f, like AddReader does for a
+// single file. Every directory is stored as a single unixfs directory node
+// linking to its entries by name. Entries reporting a symlink mode through
+// files.StatFile are stored as unixfs symlinks to the target read from the
+// filesystem.
+func (a *Adder) AddFile(ctx context.Context, f files.File) (*merkledag.Node, Stats, error) {
+	return a.add(func(dag merkledag.DAGService) (*merkledag.Node, error) {
+		return a.addTree(ctx, dag, f)
+	})
+}
+
+// AddPath adds the file or directory at root from the local filesystem like
+// AddFile, leaving out the entries whose name matches any of the ignore
+// patterns (see path.Match). Symlinks are stored as such, not followed, and
+// special files such as devices and named pipes are skipped.
+func (a *Adder) AddPath(ctx context.Context, root string, ignore []string) (*merkledag.Node, Stats, error) {
+	for _, pattern := range ignore {
+		if _, err := gopath.Match(pattern, ""); err != nil {
+			return nil, Stats{}, debugerror.Errorf("invalid ignore pattern %q: %s", pattern, err)
+		}
+	}
+	stat, err := os.Lstat(root)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	f, err := newOSFile(root, stat, ignore)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	defer f.Close()
+	return a.AddFile(ctx, f)
+}
+
+// add stores the dag built by build and pins its root recursively.
+func (a *Adder) add(build func(merkledag.DAGService) (*merkledag.Node, error)) (*merkledag.Node, Stats, error) {
+	dag := &addedBlocksDAG{DAGService: a.DAG, bs: a.Blockstore}
+	root, err := build(dag)
+	if err == nil && a.Pinner != nil {
+		err = a.Pinner.Pin(root, true)
+		if err == nil {
+			err = a.Pinner.Flush()
+		}
+	}
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	return root, dag.stats, nil
+}
+
+func (a *Adder) splitter() chunk.BlockSplitter {
+	spl := a.Splitter
+	if spl == nil {
+		spl = chunk.DefaultSplitter
+	}
+	if a.MaxBlockSize <= 0 {
+		return spl
+	}
+	return chunk.Cap(spl, chunk.MaxSizeFor(a.MaxBlockSize))
+}
+
+func (a *Adder) addReader(ctx context.Context, dag merkledag.DAGService, r io.Reader) (*merkledag.Node, error) {
+	cr := &ctxReader{ctx: ctx, r: r}
+	nd, err := importer.BuildDagFromReader(cr, dag, nil, a.splitter())
+	if err != nil {
+		return nil, err
+	}
+	// the splitter ends the file on read errors, failing nothing
+	if cr.err != nil {
+		return nil, cr.err
+	}
+	return nd, nil
+}
+
+func (a *Adder) addTree(ctx context.Context, dag merkledag.DAGService, f files.File) (*merkledag.Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if sf, ok := f.(files.StatFile); ok {
+		if stat := sf.Stat(); stat != nil && stat.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(f.FileName())
+			if err != nil {
+				return nil, err
+			}
+			data, err := unixfs.SymlinkData(target)
+			if err != nil {
+				return nil, err
+			}
+			nd := &merkledag.Node{Data: data}
+			if _, err := dag.Add(nd); err != nil {
+				return nil, err
+			}
+			return nd, nil
+		}
+	}
+
+	if !f.IsDirectory() {
+		return a.addReader(ctx, dag, f)
+	}
+
+	tree := &merkledag.Node{Data: unixfs.FolderPBData()}
+	for {
+		child, err := f.NextFile()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		nd, err := a.addTree(ctx, dag, child)
+		if err != nil {
+			return nil, err
+		}
+		// link without keeping the child in memory
+		if err := tree.AddNodeLinkClean(gopath.Base(child.FileName()), nd); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dag.Add(tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// addedBlocksDAG is a DAG service counting the nodes added through it that
+// were not stored already, and the ones that were.
+type addedBlocksDAG struct {
+	merkledag.DAGService
+	bs    bstore.Blockstore
+	stats Stats
+}
+
+func (d *addedBlocksDAG) Add(nd *merkledag.Node) (u.Key, error) {
+	k, err := nd.Key()
+	if err != nil {
+		return "", err
+	}
+	has, err := d.bs.Has(k)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.DAGService.Add(nd); err != nil {
+		return "", err
+	}
+	// cached since adding the node
+	encoded, err := nd.Encoded(false)
+	if err != nil {
+		return "", err
+	}
+
+	if has {
+		d.stats.ExistingBlocks++
+		d.stats.ExistingBytes += uint64(len(encoded))
+	} else {
+		d.stats.NewBlocks++
+		d.stats.NewBytes += uint64(len(encoded))
+	}
+	return k, nil
+}
+
+// ctxReader fails reads once its context is done, remembering the first
+// error other than io.EOF.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	err error
+}
+
+func (cr *ctxReader) Read(b []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		cr.err = err
+		return 0, err
+	}
+	n, err := cr.r.Read(b)
+	if err != nil && err != io.EOF {
+		cr.err = err
+	}
+	return n, err
+}
+
+// osDir is a directory of the local filesystem, yielding its entries in
+// name order. Like files.NewSerialFile, it opens one entry at a time.
+type osDir struct {
+	path    string
+	stat    os.FileInfo
+	entries []os.FileInfo
+	ignore  []string
+	current io.Closer
+}
+
+// newOSFile returns the file or directory at path, as described by stat.
+func newOSFile(path string, stat os.FileInfo, ignore []string) (files.File, error) {
+	switch {
+	case stat.IsDir():
+		d, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := d.Readdir(0)
+		d.Close()
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(byName(entries))
+		return &osDir{path: path, stat: stat, entries: entries, ignore: ignore}, nil
+	case stat.Mode()&os.ModeSymlink != 0:
+		// addTree reads the link itself
+		return files.NewReaderFile(path, ioutil.NopCloser(new(bytes.Reader)), stat), nil
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return files.NewReaderFile(path, f, stat), nil
+	}
+}
+
+func (d *osDir) NextFile() (files.File, error) {
+	if err := d.Close(); err != nil {
+		return nil, err
+	}
+
+	for len(d.entries) > 0 {
+		stat := d.entries[0]
+		d.entries = d.entries[1:]
+		if d.ignored(stat.Name()) {
+			continue
+		}
+		if !stat.Mode().IsRegular() && !stat.IsDir() && stat.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		f, err := newOSFile(gopath.Join(d.path, stat.Name()), stat, d.ignore)
+		if err != nil {
+			return nil, err
+		}
+		d.current = f
+		return f, nil
+	}
+	return nil, io.EOF
+}
+
+func (d *osDir) ignored(name string) bool {
+	for _, pattern := range d.ignore {
+		if ok, _ := gopath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the entry last returned by NextFile.
+func (d *osDir) Close() error {
+	if d.current == nil {
+		return nil
+	}
+	err := d.current.Close()
+	d.current = nil
+	return err
+}
+
+func (d *osDir) Read([]byte) (int, error) { return 0, files.ErrNotReader }
+func (d *osDir) FileName() string         { return d.path }
+func (d *osDir) IsDirectory() bool        { return true }
+func (d *osDir) Stat() os.FileInfo        { return d.stat }
+
+type byName []os.FileInfo
+
+func (es byName) Len() int           { return len(es) }
+func (es byName) Swap(i, j int)      { es[i], es[j] = es[j], es[i] }
+func (es byName) Less(i, j int) bool { return es[i].Name() < es[j].Name() }
@@ -0,0 +1,55 @@
+package adder
+
+import (
+	"bytes"
+	"testing"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	bserv "github.com/jbenet/go-ipfs/blockservice"
+	offline "github.com/jbenet/go-ipfs/exchange/offline"
+	chunk "github.com/jbenet/go-ipfs/importer/chunk"
+	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	uio "github.com/jbenet/go-ipfs/unixfs/io"
+)
+
+func newAdder(t *testing.T) *Adder {
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bsrv, err := bserv.New(bs, offline.Exchange(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Adder{DAG: merkledag.NewDAGService(bsrv), Blockstore: bs}
+}
+
+func TestAddWrapped(t *testing.T) {
+	ctx := context.Background()
+	a := newAdder(t)
+	a.Splitter = &chunk.SizeSplitter{Size: 4}
+
+	data := []byte("some data split in many chunks")
+	dir, stats, err := a.AddWrapped(ctx, bytes.NewReader(data), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the directory, the file root and its 8 chunks
+	if stats.NewBlocks != 10 || stats.ExistingBlocks != 0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	if len(dir.Links) != 1 || dir.Links[0].Name != "file" {
+		t.Fatal("expected the directory to link to the file only")
+	}
+	file, err := dir.Links[0].GetNode(ctx, a.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := uio.ReadAll(ctx, file, a.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("read back the wrong data")
+	}
+}
@@ -1,4 +1,4 @@
-package balanced
+package balanced_test
 
 import (
 	"bytes"
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	. "github.com/jbenet/go-ipfs/importer/balanced"
 	chunk "github.com/jbenet/go-ipfs/importer/chunk"
 	h "github.com/jbenet/go-ipfs/importer/helpers"
 	merkledag "github.com/jbenet/go-ipfs/merkledag"
@@ -441,3 +442,42 @@ func TestSeekingConsistency(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBalancedAppend(t *testing.T) {
+	ds := mdtest.Mock(t)
+	spl := &chunk.SizeSplitter{Size: 100}
+	data := make([]byte, 1000*100)
+	u.NewTimeSeededRand().Read(data)
+
+	whole, err := buildTestDag(bytes.NewReader(data), ds, spl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wk, err := whole.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// appending at a chunk boundary builds the same dag as adding it whole
+	for _, chunks := range []int{1, 7, h.DefaultLinksPerBlock, h.DefaultLinksPerBlock + 1, 950} {
+		base, err := buildTestDag(bytes.NewReader(data[:chunks*100]), ds, spl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbp := h.DagBuilderParams{
+			Dagserv:  ds,
+			Maxlinks: h.DefaultLinksPerBlock,
+		}
+		nd, err := BalancedAppend(context.Background(), base, dbp.New(spl.Split(bytes.NewReader(data[chunks*100:]))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := nd.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != wk {
+			t.Fatalf("appending to %d chunks built another dag than adding the data whole", chunks)
+		}
+	}
+}
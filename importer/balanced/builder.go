@@ -3,6 +3,7 @@ package balanced
 import (
 	"errors"
 
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	h "github.com/jbenet/go-ipfs/importer/helpers"
 	dag "github.com/jbenet/go-ipfs/merkledag"
 )
@@ -34,6 +35,77 @@ func BalancedLayout(db *h.DagBuilderHelper) (*dag.Node, error) {
 	return db.Add(root)
 }
 
+// BalancedAppend appends the data from db to the end of the file rooted at
+// base, which must be in the layout BalancedLayout builds, and returns the new
+// root. The rightmost subtrees are filled up first and the tree grows new
+// levels on top, like BalancedLayout does, so that all the leaves stay at the
+// same depth.
+func BalancedAppend(ctx context.Context, base *dag.Node, db *h.DagBuilderHelper) (*dag.Node, error) {
+	root, err := h.NewUnixfsNodeFromDag(base)
+	if err != nil {
+		return nil, err
+	}
+	if root.NumChildren() == 0 && root.FileSize() == 0 {
+		// nothing to keep
+		return BalancedLayout(db)
+	}
+
+	depth, err := treeDepth(ctx, root, db)
+	if err != nil {
+		return nil, err
+	}
+	if depth > 0 {
+		if err := appendRec(ctx, db, root, depth); err != nil {
+			return nil, err
+		}
+	}
+
+	for level := depth + 1; !db.Done(); level++ {
+		nroot := h.NewUnixfsNode()
+		if err := nroot.AddChild(root, db); err != nil {
+			return nil, err
+		}
+		if err := fillNodeRec(db, nroot, level); err != nil {
+			return nil, err
+		}
+		root = nroot
+	}
+	return db.Add(root)
+}
+
+// treeDepth returns the number of levels of nodes below node.
+func treeDepth(ctx context.Context, node *h.UnixfsNode, db *h.DagBuilderHelper) (int, error) {
+	depth := 0
+	for node.NumChildren() > 0 {
+		child, err := node.GetChild(ctx, 0, db)
+		if err != nil {
+			return 0, err
+		}
+		node = child
+		depth++
+	}
+	return depth, nil
+}
+
+// appendRec fills up the last child of node, which sits depth levels above
+// the leaves, and then node itself with data from db.
+func appendRec(ctx context.Context, db *h.DagBuilderHelper, node *h.UnixfsNode, depth int) error {
+	if last := node.NumChildren() - 1; last >= 0 && depth > 1 && !db.Done() {
+		child, err := node.GetChild(ctx, last, db)
+		if err != nil {
+			return err
+		}
+		if err := appendRec(ctx, db, child, depth-1); err != nil {
+			return err
+		}
+		node.RemoveChild(last)
+		if err := node.AddChild(child, db); err != nil {
+			return err
+		}
+	}
+	return fillNodeRec(db, node, depth)
+}
+
 // fillNodeRec will fill the given node with data from the dagBuilders input
 // source down to an indirection depth as specified by 'depth'
 // it returns the total dataSize of the node, and a potential error
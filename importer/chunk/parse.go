@@ -0,0 +1,47 @@
+package chunk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FromString returns the splitter described by spec. Accepted specs are
+// "size-<bytes>" for fixed size chunks, and "rabin" or "rabin-<avg bytes>"
+// for content defined chunks. An empty spec selects DefaultSplitter.
+func FromString(spec string) (BlockSplitter, error) {
+	switch {
+	case spec == "":
+		return DefaultSplitter, nil
+	case spec == "rabin":
+		return NewMaybeRabin(DefaultBlockSize), nil
+	case strings.HasPrefix(spec, "rabin-"):
+		size, err := parseSize(spec[len("rabin-"):])
+		if err != nil {
+			return nil, err
+		}
+		return NewMaybeRabin(size), nil
+	case strings.HasPrefix(spec, "size-"):
+		size, err := parseSize(spec[len("size-"):])
+		if err != nil {
+			return nil, err
+		}
+		return &SizeSplitter{Size: size}, nil
+	default:
+		return nil, fmt.Errorf("unrecognized chunker: %q", spec)
+	}
+}
+
+func parseSize(s string) (int, error) {
+	size, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size %q: %s", s, err)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+	if size > MaxSize {
+		return 0, fmt.Errorf("chunk size %d is above the maximum of %d", size, MaxSize)
+	}
+	return size, nil
+}
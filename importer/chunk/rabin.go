@@ -3,7 +3,6 @@ package chunk
 import (
 	"bufio"
 	"bytes"
-	"fmt"
 	"io"
 	"math"
 )
@@ -22,12 +21,20 @@ func NewMaybeRabin(avgBlkSize int) *MaybeRabin {
 	rb.windowSize = 16 // probably a good number...
 	rb.MinBlockSize = avgBlkSize / 2
 	rb.MaxBlockSize = (avgBlkSize / 2) * 3
+	if rb.MaxBlockSize > MaxSize {
+		rb.MaxBlockSize = MaxSize
+	}
 	return rb
 }
 
+// Split cuts r into content defined chunks: a chunk ends where the rolling
+// hash of the last windowSize bytes matches the mask, so inserting or
+// removing data only changes the chunks around the edit.
 func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 	out := make(chan []byte, 16)
 	go func() {
+		defer close(out)
+
 		inbuf := bufio.NewReader(r)
 		blkbuf := new(bytes.Buffer)
 
@@ -52,43 +59,38 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 			return d
 		}
 
-		// Fill up the window
-		i := 0
-		for ; i < mr.windowSize; i++ {
+		for i := 0; ; i++ {
 			b, err := inbuf.ReadByte()
 			if err != nil {
-				fmt.Println(err)
-				return
+				if err != io.EOF {
+					log.Debugf("Block split error: %s", err)
+				}
+				break
 			}
 			blkbuf.WriteByte(b)
-			push(i, b)
-			rollingHash = (rollingHash*a + int(b)) % MOD
-			an = (an * a) % MOD
-		}
+			outval := push(i, b)
 
-		for ; true; i++ {
-			b, err := inbuf.ReadByte()
-			if err != nil {
-				break
+			// Fill up the window
+			if i < mr.windowSize {
+				rollingHash = (rollingHash*a + int(b)) % MOD
+				an = (an * a) % MOD
+				continue
 			}
-			outval := push(i, b)
-			blkbuf.WriteByte(b)
+
 			rollingHash = (rollingHash*a + int(b) - an*outval) % MOD
+			if rollingHash < 0 {
+				rollingHash += MOD
+			}
 			if (rollingHash&mr.mask == mr.mask && blkbuf.Len() > mr.MinBlockSize) ||
 				blkbuf.Len() >= mr.MaxBlockSize {
 				out <- dup(blkbuf.Bytes())
 				blkbuf.Reset()
 			}
+		}
 
-			// Check if there are enough remaining
-			peek, err := inbuf.Peek(mr.windowSize)
-			if err != nil || len(peek) != mr.windowSize {
-				break
-			}
+		if blkbuf.Len() > 0 {
+			out <- blkbuf.Bytes()
 		}
-		io.Copy(blkbuf, inbuf)
-		out <- blkbuf.Bytes()
-		close(out)
 	}()
 	return out
 }
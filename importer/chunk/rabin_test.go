@@ -0,0 +1,92 @@
+package chunk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func collectChunks(spl BlockSplitter, b []byte) [][]byte {
+	var out [][]byte
+	for chunk := range spl.Split(bytes.NewReader(b)) {
+		out = append(out, chunk)
+	}
+	return out
+}
+
+func TestRabinReassembles(t *testing.T) {
+	for _, size := range []int{0, 5, 100, 300000} {
+		b := randBuf(t, size)
+		chunks := collectChunks(NewMaybeRabin(4096), b)
+
+		var whole []byte
+		for _, c := range chunks {
+			if len(c) == 0 {
+				t.Fatal("got an empty chunk")
+			}
+			whole = append(whole, c...)
+		}
+		if !bytes.Equal(whole, b) {
+			t.Fatalf("chunks of %d bytes did not reassemble", size)
+		}
+	}
+}
+
+func TestRabinSurvivesInsert(t *testing.T) {
+	b := randBuf(t, 500000)
+	shifted := append([]byte{42}, b...)
+
+	before := make(map[string]bool)
+	for _, c := range collectChunks(NewMaybeRabin(4096), b) {
+		before[string(c)] = true
+	}
+
+	after := collectChunks(NewMaybeRabin(4096), shifted)
+	same := 0
+	for _, c := range after {
+		if before[string(c)] {
+			same++
+		}
+	}
+
+	// only the chunks around the inserted byte should differ
+	if same < len(after)-3 {
+		t.Fatalf("only %d of %d chunks survived a one byte insert", same, len(after))
+	}
+}
+
+func TestFromString(t *testing.T) {
+	spl, err := FromString("")
+	if err != nil || spl != DefaultSplitter {
+		t.Fatal("empty spec should select the default splitter")
+	}
+
+	spl, err = FromString("size-1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss, ok := spl.(*SizeSplitter); !ok || ss.Size != 1000 {
+		t.Fatal("expected a 1000 byte size splitter")
+	}
+
+	spl, err = FromString("rabin-8192")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := spl.(*MaybeRabin); !ok {
+		t.Fatal("expected a rabin splitter")
+	}
+
+	spl, err = FromString("rabin-1000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr := spl.(*MaybeRabin); mr.MaxBlockSize > MaxSize {
+		t.Fatalf("rabin chunks may be %d bytes, above MaxSize", mr.MaxBlockSize)
+	}
+
+	for _, bad := range []string{"size-", "size-0", "size-1048576", "rabin-x", "fixed"} {
+		if _, err := FromString(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
@@ -12,6 +12,27 @@ var log = util.Logger("chunk")
 var DefaultBlockSize = 1024 * 256
 var DefaultSplitter = &SizeSplitter{Size: DefaultBlockSize}
 
+// Overhead is the room a chunk leaves in its block for the unixfs and
+// merkledag framing of the leaf holding it.
+const Overhead = 1024
+
+// MaxSize is the largest chunk size FromString accepts and the largest chunk
+// a MaybeRabin cuts. It leaves room for the framing of a leaf below the
+// default maximum block size of the block service, so every leaf can be
+// added and fetched.
+const MaxSize = 1024*1024 - Overhead
+
+// MaxSizeFor returns the largest chunk size whose leaves fit in blocks of
+// maxBlockSize bytes, and MaxSize if that is smaller or maxBlockSize is not
+// positive, meaning no limit. It is not positive itself if even an empty
+// leaf may not fit.
+func MaxSizeFor(maxBlockSize int) int {
+	if maxBlockSize <= 0 || maxBlockSize-Overhead > MaxSize {
+		return MaxSize
+	}
+	return maxBlockSize - Overhead
+}
+
 type BlockSplitter interface {
 	Split(r io.Reader) chan []byte
 }
@@ -45,3 +66,33 @@ func (ss *SizeSplitter) Split(r io.Reader) chan []byte {
 	}()
 	return out
 }
+
+// Cap returns a splitter cutting the chunks spl makes into chunks of at most
+// max bytes. It returns spl itself if max is not positive.
+func Cap(spl BlockSplitter, max int) BlockSplitter {
+	if max <= 0 {
+		return spl
+	}
+	return &capSplitter{spl: spl, max: max}
+}
+
+type capSplitter struct {
+	spl BlockSplitter
+	max int
+}
+
+func (cs *capSplitter) Split(r io.Reader) chan []byte {
+	in := cs.spl.Split(r)
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for chunk := range in {
+			for len(chunk) > cs.max {
+				out <- chunk[:cs.max]
+				chunk = chunk[cs.max:]
+			}
+			out <- chunk
+		}
+	}()
+	return out
+}
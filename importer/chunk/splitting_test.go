@@ -103,3 +103,35 @@ func (s *clipReader) Read(buf []byte) (int, error) {
 
 	return s.r.Read(buf)
 }
+
+func TestCap(t *testing.T) {
+	buf := randBuf(t, 1000)
+	spl := Cap(&SizeSplitter{Size: 300}, 128)
+
+	var sizes []int
+	var out []byte
+	for chunk := range spl.Split(bytes.NewReader(copyBuf(buf))) {
+		sizes = append(sizes, len(chunk))
+		out = append(out, chunk...)
+	}
+	if !bytes.Equal(out, buf) {
+		t.Fatal("chunks do not add up to the data")
+	}
+	// every 300 bytes chunk is cut in 128, 128 and 44 bytes
+	for i, size := range sizes {
+		expected := []int{128, 128, 44}[i%3]
+		if i == len(sizes)-1 {
+			expected = 100 // the last 100 bytes
+		}
+		if size != expected {
+			t.Fatalf("chunk %d is %d bytes, expected %d", i, size, expected)
+		}
+	}
+
+	if MaxSizeFor(0) != MaxSize || MaxSizeFor(1<<30) != MaxSize {
+		t.Fatal("expected no limit to allow MaxSize")
+	}
+	if MaxSizeFor(256*1024) != 256*1024-Overhead {
+		t.Fatal("expected the chunks to leave room for the framing")
+	}
+}
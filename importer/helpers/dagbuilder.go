@@ -13,6 +13,7 @@ type DagBuilderHelper struct {
 	in       <-chan []byte
 	nextData []byte // the next item to return.
 	maxlinks int
+	progress *dag.ProgressTracker
 }
 
 type DagBuilderParams struct {
@@ -24,6 +25,10 @@ type DagBuilderParams struct {
 
 	// Pinner to use for pinning files (optionally nil)
 	Pinner pin.ManualPinner
+
+	// Progress is told the number of bytes of data and blocks stored so
+	// far (optionally nil)
+	Progress dag.ProgressFunc
 }
 
 // Generate a new DagBuilderHelper from the given params, using 'in' as a
@@ -34,6 +39,7 @@ func (dbp *DagBuilderParams) New(in <-chan []byte) *DagBuilderHelper {
 		mp:       dbp.Pinner,
 		in:       in,
 		maxlinks: dbp.Maxlinks,
+		progress: dag.NewProgressTracker(dbp.Progress),
 	}
 }
 
@@ -124,6 +130,7 @@ func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	db.stored(node)
 
 	if db.mp != nil {
 		db.mp.PinWithMode(key, pin.Recursive)
@@ -139,3 +146,8 @@ func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
 func (db *DagBuilderHelper) Maxlinks() int {
 	return db.maxlinks
 }
+
+// stored reports the progress made by storing node
+func (db *DagBuilderHelper) stored(node *UnixfsNode) {
+	db.progress.Add(uint64(len(node.ufmt.Data)), 1)
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"fmt"
 
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	chunk "github.com/jbenet/go-ipfs/importer/chunk"
 	dag "github.com/jbenet/go-ipfs/merkledag"
 	"github.com/jbenet/go-ipfs/pin"
@@ -48,10 +49,44 @@ func NewUnixfsNode() *UnixfsNode {
 	}
 }
 
+// NewUnixfsNodeFromDag returns a UnixfsNode holding a copy of the file node
+// nd, to add more children to it.
+func NewUnixfsNodeFromDag(nd *dag.Node) (*UnixfsNode, error) {
+	mb, err := ft.MultiBlockFromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &UnixfsNode{
+		node: nd.Copy(),
+		ufmt: mb,
+	}, nil
+}
+
 func (n *UnixfsNode) NumChildren() int {
 	return n.ufmt.NumChildren()
 }
 
+// FileSize returns the size of the data of the file the node represents.
+func (n *UnixfsNode) FileSize() uint64 {
+	return n.ufmt.FileSize()
+}
+
+// GetChild fetches the i-th child of the node from the DAG service of db.
+func (n *UnixfsNode) GetChild(ctx context.Context, i int, db *DagBuilderHelper) (*UnixfsNode, error) {
+	nd, err := n.node.Links[i].GetNode(ctx, db.dserv)
+	if err != nil {
+		return nil, err
+	}
+	return NewUnixfsNodeFromDag(nd)
+}
+
+// RemoveChild removes the link to the i-th child of the node. The child is
+// left in the DAG service.
+func (n *UnixfsNode) RemoveChild(i int) {
+	n.ufmt.RemoveBlockSize(i)
+	n.node.Links = append(n.node.Links[:i], n.node.Links[i+1:]...)
+}
+
 // addChild will add the given UnixfsNode as a child of the receiver.
 // the passed in DagBuilderHelper is used to store the child node an
 // pin it locally so it doesnt get lost
@@ -74,6 +109,7 @@ func (n *UnixfsNode) AddChild(child *UnixfsNode, db *DagBuilderHelper) error {
 	if err != nil {
 		return err
 	}
+	db.stored(child)
 
 	// Pin the child node indirectly
 	if db.mp != nil {
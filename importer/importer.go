@@ -40,6 +40,12 @@ func BuildDagFromFile(fpath string, ds dag.DAGService, mp pin.ManualPinner) (*da
 }
 
 func BuildDagFromReader(r io.Reader, ds dag.DAGService, mp pin.ManualPinner, spl chunk.BlockSplitter) (*dag.Node, error) {
+	return BuildDagFromReaderWithProgress(r, ds, mp, spl, nil)
+}
+
+// BuildDagFromReaderWithProgress builds a dag like BuildDagFromReader, telling
+// progress how many bytes of r and blocks were stored so far as it goes.
+func BuildDagFromReaderWithProgress(r io.Reader, ds dag.DAGService, mp pin.ManualPinner, spl chunk.BlockSplitter, progress dag.ProgressFunc) (*dag.Node, error) {
 	// Start the splitter
 	blkch := spl.Split(r)
 
@@ -47,6 +53,7 @@ func BuildDagFromReader(r io.Reader, ds dag.DAGService, mp pin.ManualPinner, spl
 		Dagserv:  ds,
 		Maxlinks: h.DefaultLinksPerBlock,
 		Pinner:   mp,
+		Progress: progress,
 	}
 
 	return bal.BalancedLayout(dbp.New(blkch))
@@ -60,6 +60,43 @@ func TestBalancedDag(t *testing.T) {
 	}
 }
 
+func countNodes(t *testing.T, ds dag.DAGService, nd *dag.Node) int {
+	n := 1
+	for _, l := range nd.Links {
+		child, err := l.GetNode(context.Background(), ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += countNodes(t, ds, child)
+	}
+	return n
+}
+
+func TestBuildDagProgress(t *testing.T) {
+	ds := mdtest.Mock(t)
+	size := 100000
+	r := io.LimitReader(u.NewTimeSeededRand(), int64(size))
+
+	var bytes uint64
+	var blocks int
+	progress := func(b uint64, n int) {
+		if b < bytes || n <= blocks {
+			t.Fatal("progress went backwards")
+		}
+		bytes, blocks = b, n
+	}
+	nd, err := BuildDagFromReaderWithProgress(r, ds, nil, &chunk.SizeSplitter{Size: 1000}, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes != uint64(size) {
+		t.Fatalf("progress reported %d bytes, expected %d", bytes, size)
+	}
+	if n := countNodes(t, ds, nd); blocks != n {
+		t.Fatalf("progress reported %d blocks, expected %d", blocks, n)
+	}
+}
+
 func BenchmarkBalancedReadSmallBlock(b *testing.B) {
 	b.StopTimer()
 	nbytes := int64(10000000)
@@ -0,0 +1,78 @@
+// package keystore holds private keys a node can sign with, besides the key
+// of its network identity.
+package keystore
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	ci "github.com/jbenet/go-ipfs/p2p/crypto"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+)
+
+// ErrNoSuchKey is returned when a key is not in the keystore.
+var ErrNoSuchKey = errors.New("no key with this id in the keystore")
+
+// Keystore is an in-memory set of private keys, indexed by the peer.ID
+// derived from their public key. It is safe for concurrent use.
+type Keystore struct {
+	lk   sync.RWMutex
+	keys map[peer.ID]ci.PrivKey
+}
+
+// New returns an empty Keystore
+func New() *Keystore {
+	return &Keystore{keys: make(map[peer.ID]ci.PrivKey)}
+}
+
+// Add stores sk and returns the id it is stored under. Adding a key
+// that is already present does nothing.
+func (ks *Keystore) Add(sk ci.PrivKey) (peer.ID, error) {
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return "", err
+	}
+
+	ks.lk.Lock()
+	ks.keys[id] = sk
+	ks.lk.Unlock()
+	return id, nil
+}
+
+// Get returns the key stored under id.
+func (ks *Keystore) Get(id peer.ID) (ci.PrivKey, error) {
+	ks.lk.RLock()
+	defer ks.lk.RUnlock()
+
+	sk, ok := ks.keys[id]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return sk, nil
+}
+
+// Remove deletes the key stored under id.
+func (ks *Keystore) Remove(id peer.ID) error {
+	ks.lk.Lock()
+	defer ks.lk.Unlock()
+
+	if _, ok := ks.keys[id]; !ok {
+		return ErrNoSuchKey
+	}
+	delete(ks.keys, id)
+	return nil
+}
+
+// List returns the ids of all stored keys, sorted.
+func (ks *Keystore) List() []peer.ID {
+	ks.lk.RLock()
+	defer ks.lk.RUnlock()
+
+	ids := make([]peer.ID, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Sort(peer.IDSlice(ids))
+	return ids
+}
@@ -0,0 +1,49 @@
+package keystore
+
+import (
+	"testing"
+
+	ci "github.com/jbenet/go-ipfs/p2p/crypto"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+)
+
+func TestKeystore(t *testing.T) {
+	ks := New()
+
+	var ids []peer.ID
+	for i := 0; i < 3; i++ {
+		sk, _, err := ci.GenerateKeyPair(ci.RSA, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := ks.Add(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ks.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equals(sk) {
+			t.Fatal("got a different key back")
+		}
+		ids = append(ids, id)
+	}
+
+	if l := ks.List(); len(l) != 3 {
+		t.Fatalf("expected three keys, got %d", len(l))
+	}
+
+	if err := ks.Remove(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get(ids[0]); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+	if err := ks.Remove(ids[0]); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+	if l := ks.List(); len(l) != 2 {
+		t.Fatalf("expected two keys, got %d", len(l))
+	}
+}
@@ -0,0 +1,188 @@
+package merkledag
+
+import (
+	"container/list"
+	"sync"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// CachedDAGService is a DAGService that keeps recently fetched nodes in
+// memory, evicting the least recently used ones once the encoded size of the
+// cached nodes exceeds its limit. Nodes handed out are copies, so callers
+// may modify them freely.
+type CachedDAGService struct {
+	DAGService
+
+	lk       sync.Mutex
+	maxBytes int
+	curBytes int
+	lru      *list.List // front is most recently used
+	entries  map[u.Key]*list.Element
+
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	key  u.Key
+	nd   *Node
+	size int
+}
+
+// NewCachedDAGService wraps inner with a read cache holding at most
+// maxBytes of encoded nodes.
+func NewCachedDAGService(inner DAGService, maxBytes int) *CachedDAGService {
+	return &CachedDAGService{
+		DAGService: inner,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[u.Key]*list.Element),
+	}
+}
+
+// Get returns the node for the given key, from the cache if possible.
+func (c *CachedDAGService) Get(ctx context.Context, k u.Key) (*Node, error) {
+	if nd, ok := c.lookup(k); ok {
+		return nd, nil
+	}
+
+	nd, err := c.DAGService.Get(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	c.insert(k, nd)
+	return nd.Copy(), nil
+}
+
+// Remove drops the node from the cache and the underlying DAGService.
+func (c *CachedDAGService) Remove(nd *Node) error {
+	k, err := nd.Key()
+	if err != nil {
+		return err
+	}
+
+	c.lk.Lock()
+	if e, ok := c.entries[k]; ok {
+		c.removeElement(e)
+	}
+	c.lk.Unlock()
+
+	return c.DAGService.Remove(nd)
+}
+
+// GetDAG returns promises for the children of root, served from the cache
+// when possible.
+func (c *CachedDAGService) GetDAG(ctx context.Context, root *Node) []NodeGetter {
+	var keys []u.Key
+	for _, lnk := range root.Links {
+		keys = append(keys, u.Key(lnk.Hash))
+	}
+
+	return c.GetNodes(ctx, keys)
+}
+
+// GetNodes returns promises for the given keys. Cached nodes are returned
+// right away, the others are fetched from the underlying DAGService and
+// cached as they arrive.
+func (c *CachedDAGService) GetNodes(ctx context.Context, keys []u.Key) []NodeGetter {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	promises := make([]NodeGetter, len(keys))
+	var missing []u.Key
+	var missingIdx []int
+	for i, k := range keys {
+		if nd, ok := c.lookup(k); ok {
+			promises[i] = &cachedGetter{nd: nd}
+			continue
+		}
+		missing = append(missing, k)
+		missingIdx = append(missingIdx, i)
+	}
+
+	if len(missing) > 0 {
+		fetched := c.DAGService.GetNodes(ctx, missing)
+		for j, i := range missingIdx {
+			promises[i] = &cachedGetter{cache: c, key: missing[j], ng: fetched[j]}
+		}
+	}
+	return promises
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *CachedDAGService) Stats() (hits, misses uint64) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.hits, c.misses
+}
+
+func (c *CachedDAGService) lookup(k u.Key) (*Node, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[k]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).nd.Copy(), true
+}
+
+func (c *CachedDAGService) insert(k u.Key, nd *Node) {
+	enc, err := nd.Encoded(false)
+	if err != nil {
+		return
+	}
+	size := len(enc)
+	if size > c.maxBytes {
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if _, ok := c.entries[k]; ok {
+		return
+	}
+	c.entries[k] = c.lru.PushFront(&cacheEntry{key: k, nd: nd, size: size})
+	c.curBytes += size
+
+	for c.curBytes > c.maxBytes {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *CachedDAGService) removeElement(e *list.Element) {
+	ent := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, ent.key)
+	c.curBytes -= ent.size
+}
+
+// cachedGetter is a NodeGetter either holding a cached node, or wrapping a
+// promise from the underlying DAGService whose result gets cached.
+type cachedGetter struct {
+	nd *Node
+
+	cache *CachedDAGService
+	key   u.Key
+	ng    NodeGetter
+}
+
+func (cg *cachedGetter) Get() (*Node, error) {
+	if cg.nd != nil {
+		return cg.nd, nil
+	}
+
+	nd, err := cg.ng.Get()
+	if err != nil {
+		return nil, err
+	}
+	cg.cache.insert(cg.key, nd)
+	cg.nd = nd.Copy()
+	return cg.nd, nil
+}
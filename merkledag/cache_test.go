@@ -0,0 +1,124 @@
+package merkledag_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	imp "github.com/jbenet/go-ipfs/importer"
+	chunk "github.com/jbenet/go-ipfs/importer/chunk"
+	. "github.com/jbenet/go-ipfs/merkledag"
+	uio "github.com/jbenet/go-ipfs/unixfs/io"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+func TestCachedDAGServiceRereads(t *testing.T) {
+	dsp := getDagservAndPinner(t)
+	data := make([]byte, 20000)
+	u.NewTimeSeededRand().Read(data)
+
+	root, err := imp.BuildDagFromReader(bytes.NewReader(data), dsp.ds, dsp.mp, &chunk.SizeSplitter{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cds := NewCachedDAGService(dsp.ds, 1<<20)
+	read := func() {
+		dr, err := uio.NewDagReader(context.Background(), root, cds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatal("read wrong data")
+		}
+	}
+
+	read()
+	hits, misses := cds.Stats()
+	if misses == 0 {
+		t.Fatal("expected the first read to miss the cache")
+	}
+
+	read()
+	hits2, misses2 := cds.Stats()
+	if misses2 != misses {
+		t.Fatalf("second read missed the cache %d times", misses2-misses)
+	}
+	if hits2 <= hits {
+		t.Fatal("expected the second read to hit the cache")
+	}
+}
+
+func TestCachedDAGServiceEvicts(t *testing.T) {
+	dsp := getDagservAndPinner(t)
+
+	var keys []u.Key
+	for i := 0; i < 10; i++ {
+		nd := &Node{Data: bytes.Repeat([]byte{byte(i)}, 100)}
+		k, err := dsp.ds.Add(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+
+	// room for about three nodes
+	cds := NewCachedDAGService(dsp.ds, 350)
+	for _, k := range keys {
+		if _, err := cds.Get(context.Background(), k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, misses := cds.Stats()
+	if _, err := cds.Get(context.Background(), keys[len(keys)-1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, m := cds.Stats(); m != misses {
+		t.Fatal("expected the most recent node to still be cached")
+	}
+
+	if _, err := cds.Get(context.Background(), keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, m := cds.Stats(); m != misses+1 {
+		t.Fatal("expected the oldest node to have been evicted")
+	}
+}
+
+func TestCachedDAGServiceCopies(t *testing.T) {
+	dsp := getDagservAndPinner(t)
+	k, err := dsp.ds.Add(&Node{Data: []byte("beep")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cds := NewCachedDAGService(dsp.ds, 1024)
+	nd, err := cds.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd.Data[0] = 'x'
+
+	nd, err = cds.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "beep" {
+		t.Fatal("modifying a returned node changed the cached one")
+	}
+
+	ngs := cds.GetNodes(context.Background(), []u.Key{k})
+	nd, err = ngs[0].Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nd.Data) != "beep" {
+		t.Fatal("wrong data from GetNodes")
+	}
+}
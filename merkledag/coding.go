@@ -6,8 +6,8 @@ import (
 
 	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 
+	blocks "github.com/jbenet/go-ipfs/blocks"
 	pb "github.com/jbenet/go-ipfs/merkledag/internal/pb"
-	u "github.com/jbenet/go-ipfs/util"
 )
 
 // for now, we use a PBNode intermediate thing.
@@ -84,12 +84,34 @@ func (n *Node) Encoded(force bool) ([]byte, error) {
 		if err != nil {
 			return []byte{}, err
 		}
-		n.cached = u.Hash(n.encoded)
+		n.cached, err = n.hash(n.encoded)
+		if err != nil {
+			n.encoded = nil
+			return []byte{}, err
+		}
 	}
 
 	return n.encoded, nil
 }
 
+// decodeBlock decodes the node stored in b. The node is hashed with the same
+// function as the block, so its key is the block's.
+func decodeBlock(b *blocks.Block) (*Node, error) {
+	n, err := Decoded(b.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	dh, err := mh.Decode(b.Multihash)
+	if err != nil {
+		return nil, err
+	}
+	if dh.Code != mh.SHA2_256 {
+		n.hashFunc = dh.Code
+	}
+	return n, nil
+}
+
 // Decoded decodes raw data and returns a new Node instance.
 func Decoded(encoded []byte) (*Node, error) {
 	n := new(Node)
@@ -0,0 +1,148 @@
+package merkledag
+
+import (
+	"bytes"
+	"fmt"
+	gopath "path"
+	"sort"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// ChangeType tells how a path differs between two DAGs.
+type ChangeType int
+
+const (
+	Add    ChangeType = iota // the path only exists in the second DAG
+	Remove                   // the path only exists in the first DAG
+	Mod                      // the path leads to different nodes
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Add:
+		return "added"
+	case Remove:
+		return "removed"
+	case Mod:
+		return "modified"
+	default:
+		return fmt.Sprintf("ChangeType(%d)", int(t))
+	}
+}
+
+// Change is a difference between two DAGs, found by DiffDAG. Path is the
+// path of link names from the roots, "" for the roots themselves. Before
+// is empty for added paths, After for removed ones.
+type Change struct {
+	Type   ChangeType
+	Path   string
+	Before u.Key
+	After  u.Key
+}
+
+// DiffDAG returns the changes from the DAG rooted at a to the one rooted at
+// b, ordered by path, so that "a-b" comes before "a/x". Nodes whose links all have distinct names, such as
+// unixfs directories, are compared link by link; other nodes, such as
+// files, are reported as modified as a whole. Subtrees with the same key in
+// both DAGs are skipped without fetching them, so only the nodes on the
+// paths to the changes are fetched.
+func DiffDAG(ctx context.Context, a, b u.Key, ds DAGService) ([]Change, error) {
+	if a == b {
+		return nil, nil
+	}
+	na, err := getNode(ctx, ds, a)
+	if err != nil {
+		return nil, err
+	}
+	nb, err := getNode(ctx, ds, b)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := diffNodes(ctx, ds, "", a, b, na, nb)
+	if err != nil {
+		return nil, err
+	}
+	// the walk yields the changes under a node before those of its next
+	// sibling, whatever their names
+	sort.Sort(byPath(changes))
+	return changes, nil
+}
+
+func diffNodes(ctx context.Context, ds DAGService, path string, ka, kb u.Key, a, b *Node) ([]Change, error) {
+	la, aok := namedLinks(a)
+	lb, bok := namedLinks(b)
+	if !aok || !bok {
+		return []Change{{Type: Mod, Path: path, Before: ka, After: kb}}, nil
+	}
+
+	var changes []Change
+	if !bytes.Equal(a.Data, b.Data) {
+		changes = append(changes, Change{Type: Mod, Path: path, Before: ka, After: kb})
+	}
+
+	names := make([]string, 0, len(la)+len(lb))
+	for name := range la {
+		names = append(names, name)
+	}
+	for name := range lb {
+		if _, ok := la[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		lnka, ina := la[name]
+		lnkb, inb := lb[name]
+		child := gopath.Join(path, name)
+		switch {
+		case !inb:
+			changes = append(changes, Change{Type: Remove, Path: child, Before: u.Key(lnka.Hash)})
+		case !ina:
+			changes = append(changes, Change{Type: Add, Path: child, After: u.Key(lnkb.Hash)})
+		case !bytes.Equal(lnka.Hash, lnkb.Hash):
+			ca, err := getNode(ctx, ds, u.Key(lnka.Hash))
+			if err != nil {
+				return nil, err
+			}
+			cb, err := getNode(ctx, ds, u.Key(lnkb.Hash))
+			if err != nil {
+				return nil, err
+			}
+			sub, err := diffNodes(ctx, ds, child, u.Key(lnka.Hash), u.Key(lnkb.Hash), ca, cb)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, sub...)
+		}
+	}
+	return changes, nil
+}
+
+// namedLinks maps the names of the links of nd to them. It returns false if
+// a link has no name, or the same name as another one.
+func namedLinks(nd *Node) (map[string]*Link, bool) {
+	links := make(map[string]*Link, len(nd.Links))
+	for _, l := range nd.Links {
+		if l.Name == "" {
+			return nil, false
+		}
+		if _, dup := links[l.Name]; dup {
+			return nil, false
+		}
+		links[l.Name] = l
+	}
+	return links, true
+}
+
+type byPath []Change
+
+func (cs byPath) Len() int           { return len(cs) }
+func (cs byPath) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+func (cs byPath) Less(i, j int) bool { return cs[i].Path < cs[j].Path }
+
+func getNode(ctx context.Context, ds DAGService, k u.Key) (*Node, error) {
+	return ds.GetNodes(ctx, []u.Key{k})[0].Get()
+}
@@ -0,0 +1,142 @@
+package merkledag_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	. "github.com/jbenet/go-ipfs/merkledag"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+func TestDiffDAG(t *testing.T) {
+	dserv := getDagservAndPinner(t).ds
+
+	add := func(nd *Node) u.Key {
+		k, err := dserv.Add(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	dir := func(entries map[string]*Node) *Node {
+		nd := &Node{Data: []byte("dir")}
+		for name, child := range entries {
+			if err := nd.AddNodeLinkClean(name, child); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nd
+	}
+
+	// never stored: diffing fails if the subtree is fetched
+	unfetched := &Node{Data: []byte("unchanged")}
+	shared := dir(map[string]*Node{"leaf": unfetched})
+	add(shared)
+
+	file1 := &Node{Data: []byte("file 1")}
+	file1.AddNodeLinkClean("", &Node{Data: []byte("chunk")})
+	file2 := &Node{Data: []byte("file 2")}
+	gone := &Node{Data: []byte("gone")}
+	fresh := &Node{Data: []byte("fresh")}
+	for _, nd := range []*Node{file1, file2, gone, fresh} {
+		add(nd)
+	}
+
+	subA := dir(map[string]*Node{"file": file1, "gone": gone})
+	subB := dir(map[string]*Node{"file": file2, "fresh": fresh})
+	add(subA)
+	add(subB)
+	a := add(dir(map[string]*Node{"shared": shared, "sub": subA}))
+	b := add(dir(map[string]*Node{"shared": shared, "sub": subB, "new": fresh}))
+
+	k := func(nd *Node) u.Key {
+		k, err := nd.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	expected := []Change{
+		{Type: Add, Path: "new", After: k(fresh)},
+		{Type: Mod, Path: "sub/file", Before: k(file1), After: k(file2)},
+		{Type: Add, Path: "sub/fresh", After: k(fresh)},
+		{Type: Remove, Path: "sub/gone", Before: k(gone)},
+	}
+
+	changes, err := DiffDAG(context.Background(), a, b, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected changes %v, got %v", expected, changes)
+	}
+
+	changes, err = DiffDAG(context.Background(), a, a, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes between equal roots, got %v", changes)
+	}
+
+	// roots of files are compared as a whole
+	changes, err = DiffDAG(context.Background(), k(file1), k(file2), dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Change{{Type: Mod, Path: "", Before: k(file1), After: k(file2)}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected changes %v, got %v", expected, changes)
+	}
+}
+
+func TestDiffDAGOrder(t *testing.T) {
+	dserv := getDagservAndPinner(t).ds
+
+	add := func(nd *Node) u.Key {
+		k, err := dserv.Add(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	x := &Node{Data: []byte("x")}
+	ab := &Node{Data: []byte("a-b")}
+	add(x)
+	add(ab)
+
+	dirA := &Node{Data: []byte("dir")}
+	add(dirA)
+	subB := &Node{Data: []byte("dir")}
+	if err := subB.AddNodeLinkClean("x", x); err != nil {
+		t.Fatal(err)
+	}
+	add(subB)
+
+	rootA := &Node{Data: []byte("dir")}
+	if err := rootA.AddNodeLinkClean("a", dirA); err != nil {
+		t.Fatal(err)
+	}
+	rootB := &Node{Data: []byte("dir")}
+	if err := rootB.AddNodeLinkClean("a", subB); err != nil {
+		t.Fatal(err)
+	}
+	if err := rootB.AddNodeLinkClean("a-b", ab); err != nil {
+		t.Fatal(err)
+	}
+
+	// "a" sorts before "a-b", but "a/x" after it
+	changes, err := DiffDAG(context.Background(), add(rootA), add(rootB), dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	expected := []string{"a-b", "a/x"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected changes to %v, got %v", expected, paths)
+	}
+}
@@ -4,7 +4,6 @@ package merkledag
 import (
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/jbenet/go-ipfs/blocks"
@@ -19,7 +18,7 @@ var ErrNotFound = fmt.Errorf("merkledag: not found")
 type DAGService interface {
 	Add(*Node) (u.Key, error)
 	AddRecursive(*Node) error
-	Get(u.Key) (*Node, error)
+	Get(context.Context, u.Key) (*Node, error)
 	Remove(*Node) error
 
 	// GetDAG returns, in order, all the single leve child
@@ -29,7 +28,25 @@ type DAGService interface {
 }
 
 func NewDAGService(bs *bserv.BlockService) DAGService {
-	return &dagService{bs}
+	return &dagService{Blocks: bs, fetcher: bs}
+}
+
+// NewSession returns a DAGService getting nodes like ds, but fetching them
+// within one session of the exchange (see blockservice.Session), which ends
+// with ctx. Use it for related nodes, e.g. to read one file. DAGServices
+// other than the ones of NewDAGService are returned as is.
+func NewSession(ctx context.Context, ds DAGService) DAGService {
+	n, ok := ds.(*dagService)
+	if !ok {
+		return ds
+	}
+	return &dagService{Blocks: n.Blocks, fetcher: n.Blocks.NewSession(ctx)}
+}
+
+// blockFetcher gets blocks: a BlockService or one of its sessions.
+type blockFetcher interface {
+	GetBlock(context.Context, u.Key) (*blocks.Block, error)
+	GetBlocks(context.Context, []u.Key) <-chan *blocks.Block
 }
 
 // dagService is an IPFS Merkle DAG service.
@@ -39,6 +56,9 @@ func NewDAGService(bs *bserv.BlockService) DAGService {
 //       able to free some of them when vm pressure is high
 type dagService struct {
 	Blocks *bserv.BlockService
+
+	// fetcher gets the blocks of Blocks
+	fetcher blockFetcher
 }
 
 // Add adds a node to the dagService, storing the block in the BlockService
@@ -82,23 +102,20 @@ func (n *dagService) AddRecursive(nd *Node) error {
 	return nil
 }
 
-// Get retrieves a node from the dagService, fetching the block in the BlockService
-func (n *dagService) Get(k u.Key) (*Node, error) {
+// Get retrieves a node from the dagService, fetching the block in the
+// BlockService. Besides ctx, the fetch timeout of the block service bounds
+// the search for blocks not stored locally.
+func (n *dagService) Get(ctx context.Context, k u.Key) (*Node, error) {
 	if n == nil {
 		return nil, fmt.Errorf("dagService is nil")
 	}
 
-	ctx, _ := context.WithTimeout(context.TODO(), time.Minute)
-	// we shouldn't use an arbitrary timeout here.
-	// since Get doesnt take in a context yet, we give a large upper bound.
-	// think of an http request. we want it to go on as long as the client requests it.
-
-	b, err := n.Blocks.GetBlock(ctx, k)
+	b, err := n.fetcher.GetBlock(ctx, k)
 	if err != nil {
 		return nil, err
 	}
 
-	return Decoded(b.Data)
+	return decodeBlock(b)
 }
 
 // Remove deletes the given node and all of its children from the BlockService
@@ -133,7 +150,7 @@ func FetchGraph(ctx context.Context, root *Node, serv DAGService) chan struct{}
 				return
 			}
 
-			nd, err := lnk.GetNode(serv)
+			nd, err := lnk.GetNode(ctx, serv)
 			if err != nil {
 				log.Debug(err)
 				return
@@ -152,6 +169,92 @@ func FetchGraph(ctx context.Context, root *Node, serv DAGService) chan struct{}
 	return done
 }
 
+// EnumerateChildrenAsync fetches every node below root, calling visit once
+// for each distinct key as its node arrives. Up to workers nodes are fetched
+// at a time, which hides the latency of fetching them one after the other
+// over the network. visit is called from a single goroutine. If progress is
+// not nil, it is told the number of data bytes and nodes fetched so far.
+//
+// It returns the first error fetching a node, or the context's error once
+// ctx is cancelled.
+func EnumerateChildrenAsync(ctx context.Context, root *Node, ds DAGService, visit func(u.Key), workers int, progress ProgressFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type fetched struct {
+		key  u.Key
+		node *Node
+	}
+	pt := NewProgressTracker(progress)
+	feed := make(chan u.Key)
+	out := make(chan fetched)
+	errs := make(chan error, 1)
+	defer close(feed)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for k := range feed {
+				nd, err := ds.GetNodes(ctx, []u.Key{k})[0].Get()
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+				pt.Add(uint64(len(nd.Data)), 1)
+				select {
+				case out <- fetched{k, nd}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	visited := make(map[u.Key]struct{})
+	var queue []u.Key
+	enqueue := func(nd *Node) {
+		for _, lnk := range nd.Links {
+			k := u.Key(lnk.Hash)
+			if _, ok := visited[k]; !ok {
+				visited[k] = struct{}{}
+				queue = append(queue, k)
+			}
+		}
+	}
+	enqueue(root)
+
+	inflight := 0
+	for len(queue) > 0 || inflight > 0 {
+		// only offer work while there is some
+		var send chan<- u.Key
+		var next u.Key
+		if len(queue) > 0 {
+			send = feed
+			next = queue[0]
+		}
+
+		select {
+		case send <- next:
+			queue = queue[1:]
+			inflight++
+		case f := <-out:
+			inflight--
+			visit(f.key)
+			enqueue(f.node)
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 // FindLinks searches this nodes links for the given key,
 // returns the indexes of any links pointing to it
 func FindLinks(links []u.Key, k u.Key, start int) []int {
@@ -196,7 +299,18 @@ func (ds *dagService) GetNodes(ctx context.Context, keys []u.Key) []NodeGetter {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		blkchan := ds.Blocks.GetBlocks(ctx, dedupedKeys)
+		// fail the promises of the nodes that never came, instead of
+		// leaving them waiting for the context
+		sent := make([]bool, len(keys))
+		defer func() {
+			for i, ch := range sendChans {
+				if !sent[i] {
+					close(ch)
+				}
+			}
+		}()
+
+		blkchan := ds.fetcher.GetBlocks(ctx, dedupedKeys)
 
 		for count := 0; count < len(keys); {
 			select {
@@ -205,7 +319,7 @@ func (ds *dagService) GetNodes(ctx context.Context, keys []u.Key) []NodeGetter {
 					return
 				}
 
-				nd, err := Decoded(blk.Data)
+				nd, err := decodeBlock(blk)
 				if err != nil {
 					// NB: can happen with improperly formatted input data
 					log.Debug("Got back bad block!")
@@ -214,6 +328,7 @@ func (ds *dagService) GetNodes(ctx context.Context, keys []u.Key) []NodeGetter {
 				is := FindLinks(keys, blk.Key(), 0)
 				for _, i := range is {
 					count++
+					sent[i] = true
 					sendChans[i] <- nd
 				}
 			case <-ctx.Done():
@@ -265,7 +380,15 @@ func (np *nodePromise) Get() (*Node, error) {
 	}
 
 	select {
-	case blk := <-np.recv:
+	case blk, ok := <-np.recv:
+		if !ok {
+			// the block service gave up on the node, e.g. because it is
+			// not stored locally and there is no exchange to fetch it from
+			if err := np.ctx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrNotFound
+		}
 		np.cache = blk
 	case <-np.ctx.Done():
 		return nil, np.ctx.Err()
@@ -2,14 +2,17 @@ package merkledag_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"sync"
 	"testing"
+	"time"
 
 	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	dssync "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
 	blockservice "github.com/jbenet/go-ipfs/blockservice"
@@ -190,7 +193,7 @@ func runBatchFetchTest(t *testing.T, read io.Reader) {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			first, err := dagservs[i].Get(k)
+			first, err := dagservs[i].Get(context.Background(), k)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -213,3 +216,166 @@ func runBatchFetchTest(t *testing.T, read io.Reader) {
 
 	wg.Wait()
 }
+
+func TestNodeHashFunc(t *testing.T) {
+	dsp := getDagservAndPinner(t)
+
+	child := &Node{Data: []byte("child")}
+	nd := &Node{Data: []byte("parent")}
+	if err := nd.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	def, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nd.SetHashFunc(mh.SHA3); err != nil {
+		t.Fatal(err)
+	}
+	if err := nd.SetHashFunc(0x99); err == nil {
+		t.Fatal("expected an unsupported hash function to fail")
+	}
+	k, err := dsp.ds.Add(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k == def {
+		t.Fatal("expected the key to change with the hash function")
+	}
+	dh, err := mh.Decode([]byte(k))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dh.Code != mh.SHA3 {
+		t.Fatalf("expected a sha3 key, got code %x", dh.Code)
+	}
+
+	// nodes read back keep their key
+	got, err := dsp.ds.Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gk, err := got.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gk != k {
+		t.Fatalf("node read back has key %s, expected %s", gk, k)
+	}
+	ng := dsp.ds.GetNodes(context.Background(), []u.Key{k})
+	got, err = ng[0].Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gk, _ := got.Key(); gk != k {
+		t.Fatalf("node from GetNodes has key %s, expected %s", gk, k)
+	}
+}
+
+// collectKeys walks the dag below nd serially, returning its distinct keys
+func collectKeys(t *testing.T, ds DAGService, nd *Node, keys map[u.Key]struct{}) {
+	for _, lnk := range nd.Links {
+		child, err := lnk.GetNode(context.Background(), ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[u.Key(lnk.Hash)] = struct{}{}
+		collectKeys(t, ds, child, keys)
+	}
+}
+
+func TestEnumerateChildrenAsync(t *testing.T) {
+	for _, read := range []io.Reader{
+		io.LimitReader(u.NewTimeSeededRand(), 1024*32),
+		io.LimitReader(devZero{}, 1024*32), // repeats the same leaf
+	} {
+		dagservs := []DAGService{}
+		for _, bsi := range blockservice.Mocks(t, 2) {
+			dagservs = append(dagservs, NewDAGService(bsi))
+		}
+		root, err := imp.BuildDagFromReader(read, dagservs[0], nil, &chunk.SizeSplitter{Size: 512})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := make(map[u.Key]struct{})
+		collectKeys(t, dagservs[0], root, expected)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		visited := make(map[u.Key]int)
+		var calls, blocks int
+		progress := func(_ uint64, b int) {
+			// calls are serialized, so this does not race
+			calls++
+			blocks = b
+		}
+		err = EnumerateChildrenAsync(ctx, root, dagservs[1], func(k u.Key) { visited[k]++ }, 4, progress)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != len(expected) || blocks != len(expected) {
+			t.Fatalf("progress reported %d blocks in %d calls, expected %d", blocks, calls, len(expected))
+		}
+		if len(visited) != len(expected) {
+			t.Fatalf("visited %d keys, expected %d", len(visited), len(expected))
+		}
+		for k, n := range visited {
+			if _, ok := expected[k]; !ok {
+				t.Fatalf("visited %s, which is not in the dag", k)
+			}
+			if n != 1 {
+				t.Fatalf("visited %s %d times", k, n)
+			}
+		}
+	}
+}
+
+// failingDagServ fails to get any node
+type failingDagServ struct {
+	DAGService
+}
+
+var errFetch = errors.New("fetch failed")
+
+type failedGetter struct{}
+
+func (failedGetter) Get() (*Node, error) { return nil, errFetch }
+
+func (failingDagServ) GetNodes(ctx context.Context, keys []u.Key) []NodeGetter {
+	out := make([]NodeGetter, len(keys))
+	for i := range out {
+		out[i] = failedGetter{}
+	}
+	return out
+}
+
+func TestEnumerateChildrenAsyncErrors(t *testing.T) {
+	dsp := getDagservAndPinner(t)
+	root, err := imp.BuildDagFromReader(io.LimitReader(u.NewTimeSeededRand(), 1024*8), dsp.ds, nil, &chunk.SizeSplitter{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EnumerateChildrenAsync(context.Background(), root, failingDagServ{dsp.ds}, func(u.Key) {}, 4, nil)
+	if err != errFetch {
+		t.Fatalf("expected the fetch error, got %v", err)
+	}
+
+	// nodes missing from an offline dag service are not found
+	missing := &Node{}
+	if err := missing.AddNodeLink("gone", &Node{Data: []byte("not stored")}); err != nil {
+		t.Fatal(err)
+	}
+	err = EnumerateChildrenAsync(context.Background(), missing, dsp.ds, func(u.Key) {}, 4, nil)
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = EnumerateChildrenAsync(ctx, root, dsp.ds, func(u.Key) {}, 4, nil)
+	if err != context.Canceled {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
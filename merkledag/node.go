@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
@@ -22,6 +23,9 @@ type Node struct {
 	encoded []byte
 
 	cached mh.Multihash
+
+	// multihash function computing cached, zero for the default
+	hashFunc int
 }
 
 // NodeStat is a statistics object for a Node. Mostly sizes.
@@ -77,12 +81,12 @@ func MakeLink(n *Node) (*Link, error) {
 }
 
 // GetNode returns the MDAG Node that this link points to
-func (l *Link) GetNode(serv DAGService) (*Node, error) {
+func (l *Link) GetNode(ctx context.Context, serv DAGService) (*Node, error) {
 	if l.Node != nil {
 		return l.Node, nil
 	}
 
-	return serv.Get(u.Key(l.Hash))
+	return serv.Get(ctx, u.Key(l.Hash))
 }
 
 // AddNodeLink adds a link to another node.
@@ -131,9 +135,29 @@ func (n *Node) Copy() *Node {
 
 	nnode.Links = make([]*Link, len(n.Links))
 	copy(nnode.Links, n.Links)
+	nnode.hashFunc = n.hashFunc
 	return nnode
 }
 
+// SetHashFunc sets the multihash function (e.g. mh.SHA3) used to compute the
+// node's key. Nodes are hashed with sha2-256 by default.
+func (n *Node) SetHashFunc(code int) error {
+	if _, err := mh.Sum(nil, code, -1); err != nil {
+		return err
+	}
+	n.hashFunc = code
+	n.encoded = nil // rehash
+	return nil
+}
+
+// hash hashes the encoded node with the node's hash function
+func (n *Node) hash(encoded []byte) (mh.Multihash, error) {
+	if n.hashFunc == 0 {
+		return u.Hash(encoded), nil
+	}
+	return mh.Sum(encoded, n.hashFunc, -1)
+}
+
 // UpdateNodeLink return a copy of the node with the link name set to point to
 // that. If a link of the same name existed, it is removed.
 func (n *Node) UpdateNodeLink(name string, that *Node) (*Node, error) {
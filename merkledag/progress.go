@@ -0,0 +1,38 @@
+package merkledag
+
+import "sync"
+
+// ProgressFunc is told how many bytes and blocks a long running operation on
+// a dag, like adding or fetching it, has processed so far. Calls are
+// serialized, but may come from any goroutine.
+type ProgressFunc func(bytes uint64, blocks int)
+
+// ProgressTracker adds up the progress of an operation, reporting the
+// totals to a ProgressFunc. A nil *ProgressTracker tracks nothing.
+type ProgressTracker struct {
+	lk     sync.Mutex
+	f      ProgressFunc
+	bytes  uint64
+	blocks int
+}
+
+// NewProgressTracker returns a tracker reporting to f, or nil if f is nil.
+func NewProgressTracker(f ProgressFunc) *ProgressTracker {
+	if f == nil {
+		return nil
+	}
+	return &ProgressTracker{f: f}
+}
+
+// Add records that the given bytes and blocks were processed, and reports
+// the new totals.
+func (pt *ProgressTracker) Add(bytes uint64, blocks int) {
+	if pt == nil {
+		return
+	}
+	pt.lk.Lock()
+	defer pt.lk.Unlock()
+	pt.bytes += bytes
+	pt.blocks += blocks
+	pt.f(pt.bytes, pt.blocks)
+}
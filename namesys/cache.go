@@ -0,0 +1,106 @@
+package namesys
+
+import (
+	"sync"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// DefaultResolveCacheTTL is how long a resolved name is served from the
+// cache before it gets refreshed.
+const DefaultResolveCacheTTL = time.Minute
+
+// refreshTimeout bounds background refreshes of stale cache entries
+const refreshTimeout = time.Minute
+
+// eolResolver is implemented by resolvers that know until when the value
+// they resolved stays valid.
+type eolResolver interface {
+	resolveWithEOL(ctx context.Context, name string) (u.Key, time.Time, error)
+}
+
+type cacheEntry struct {
+	val u.Key
+
+	// the entry is served as is until refreshAt, then served while being
+	// refreshed in the background until eol, after which it is unusable.
+	refreshAt  time.Time
+	eol        time.Time
+	refreshing bool
+}
+
+// resolveCache maps names to their resolved values
+type resolveCache struct {
+	lk      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+func newResolveCache(ttl time.Duration) *resolveCache {
+	return &resolveCache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// get returns the cached value for name. If the entry should be refreshed,
+// refresh is true and the caller is responsible for doing so.
+func (c *resolveCache) get(name string) (val u.Key, refresh bool, ok bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[name]
+	if !ok {
+		return "", false, false
+	}
+
+	now := time.Now()
+	if now.After(e.eol) {
+		delete(c.entries, name)
+		return "", false, false
+	}
+
+	if now.After(e.refreshAt) && !e.refreshing {
+		e.refreshing = true
+		refresh = true
+	}
+	return e.val, refresh, true
+}
+
+// put caches val for name. eol is the end of validity of the record val was
+// resolved from, or the zero time when unknown.
+func (c *resolveCache) put(name string, val u.Key, eol time.Time) {
+	now := time.Now()
+	refreshAt := now.Add(c.ttl)
+	if eol.IsZero() {
+		// without a record validity, allow serving a stale value for one
+		// more ttl while it is being refreshed.
+		eol = refreshAt.Add(c.ttl)
+	}
+	if eol.Before(refreshAt) {
+		refreshAt = eol
+	}
+
+	c.lk.Lock()
+	c.entries[name] = &cacheEntry{val: val, refreshAt: refreshAt, eol: eol}
+	c.lk.Unlock()
+}
+
+// done clears the refreshing flag of name after a failed refresh, so the
+// next lookup tries again.
+func (c *resolveCache) done(name string) {
+	c.lk.Lock()
+	if e, ok := c.entries[name]; ok {
+		e.refreshing = false
+	}
+	c.lk.Unlock()
+}
+
+// remove drops the cached value of name
+func (c *resolveCache) remove(name string) {
+	c.lk.Lock()
+	delete(c.entries, name)
+	c.lk.Unlock()
+}
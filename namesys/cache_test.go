@@ -0,0 +1,99 @@
+package namesys
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	mockrouting "github.com/jbenet/go-ipfs/routing/mock"
+	u "github.com/jbenet/go-ipfs/util"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestCachedResolve(t *testing.T) {
+	ctx := context.Background()
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+
+	ns := NewCachedNameSystem(d, 50*time.Millisecond)
+	publisher := NewRoutingPublisher(d)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := u.Key(pkhash).Pretty()
+
+	first := u.Key(u.Hash([]byte("first")))
+	second := u.Key(u.Hash([]byte("second")))
+
+	if err := ns.Publish(ctx, privk, first); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ns.Resolve(ctx, name); err != nil || res != first {
+		t.Fatalf("expected %s, got %s (%v)", first, res, err)
+	}
+
+	// update the record behind the cache's back
+	if err := publisher.Publish(ctx, privk, second); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ns.Resolve(ctx, name); err != nil || res != first {
+		t.Fatal("expected the cached value")
+	}
+
+	// once stale, the cached value is still served while refreshing
+	time.Sleep(60 * time.Millisecond)
+	if res, err := ns.Resolve(ctx, name); err != nil || res != first {
+		t.Fatal("expected the stale value while refreshing")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		res, err := ns.Resolve(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res == second {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale value was never refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := publisher.Publish(ctx, privk, first); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ResolveUncached(ctx, ns, name); err != nil || res != first {
+		t.Fatal("expected an uncached resolve to see the new value")
+	}
+	if res, err := ns.Resolve(ctx, name); err != nil || res != first {
+		t.Fatal("expected an uncached resolve to update the cache")
+	}
+}
+
+func TestResolveCacheHonorsEOL(t *testing.T) {
+	c := newResolveCache(time.Hour)
+
+	c.put("expired", "val", time.Now().Add(-time.Second))
+	if _, _, ok := c.get("expired"); ok {
+		t.Fatal("expected an expired record not to be served")
+	}
+
+	c.put("soon", "val", time.Now().Add(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	if _, _, ok := c.get("soon"); ok {
+		t.Fatal("expected the cache entry to end with its record")
+	}
+
+	c.put("valid", "val", time.Now().Add(time.Minute))
+	val, refresh, ok := c.get("valid")
+	if !ok || val != "val" || refresh {
+		t.Fatal("expected a fresh cached value")
+	}
+}
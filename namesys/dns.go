@@ -1,7 +1,10 @@
 package namesys
 
 import (
+	"errors"
 	"net"
+	"path"
+	"strings"
 
 	b58 "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
 	isd "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-is-domain"
@@ -11,10 +14,27 @@ import (
 	u "github.com/jbenet/go-ipfs/util"
 )
 
+// ErrResolveRecursion is returned when a chain of dnslink records pointing
+// to other domains is longer than MaxDNSLinkDepth, e.g. because it loops.
+var ErrResolveRecursion = errors.New("could not resolve name (dnslink recursion limit exceeded).")
+
+// MaxDNSLinkDepth is how many dnslink records pointing to other domains are
+// followed when resolving a domain.
+const MaxDNSLinkDepth = 8
+
+const dnsLinkPrefix = "dnslink="
+
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
 	// TODO: maybe some sort of caching?
 	// cache would need a timeout
+
+	// resolves the /ipns/ names other than domains dnslink records point
+	// to. Without it, such records cannot be followed.
+	ipns Resolver
+
+	// looks up the TXT records of a domain, net.LookupTXT when nil
+	lookupTXT func(name string) ([]string, error)
 }
 
 // CanResolve implements Resolver
@@ -23,16 +43,40 @@ func (r *DNSResolver) CanResolve(name string) bool {
 }
 
 // Resolve implements Resolver
-// TXT records for a given domain name should contain a b58
-// encoded multihash.
+// TXT records for a given domain name should contain either a b58
+// encoded multihash, or a dnslink=/ipfs/<hash> or dnslink=/ipns/<name>
+// value. /ipns/ names are resolved in turn.
 func (r *DNSResolver) Resolve(ctx context.Context, name string) (u.Key, error) {
-	log.Info("DNSResolver resolving %v", name)
-	txt, err := net.LookupTXT(name)
+	return r.resolve(ctx, name, 0)
+}
+
+func (r *DNSResolver) resolve(ctx context.Context, name string, depth int) (u.Key, error) {
+	if depth > MaxDNSLinkDepth {
+		return "", ErrResolveRecursion
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	log.Infof("DNSResolver resolving %v", name)
+	lookup := r.lookupTXT
+	if lookup == nil {
+		lookup = net.LookupTXT
+	}
+	txt, err := lookup(name)
 	if err != nil {
 		return "", err
 	}
 
 	for _, t := range txt {
+		if strings.HasPrefix(t, dnsLinkPrefix) {
+			k, err := r.resolveLink(ctx, t[len(dnsLinkPrefix):], depth)
+			if err == errBadDNSLink {
+				continue
+			}
+			return k, err
+		}
+
 		chk := b58.Decode(t)
 		if len(chk) == 0 {
 			continue
@@ -47,3 +91,33 @@ func (r *DNSResolver) Resolve(ctx context.Context, name string) (u.Key, error) {
 
 	return "", ErrResolveFailed
 }
+
+var errBadDNSLink = errors.New("malformed dnslink value")
+
+// resolveLink resolves the /ipfs/ or /ipns/ path of a dnslink record found
+// depth records away from the domain being resolved.
+func (r *DNSResolver) resolveLink(ctx context.Context, link string, depth int) (u.Key, error) {
+	segments := strings.Split(strings.TrimPrefix(path.Clean(link), "/"), "/")
+	if len(segments) != 2 {
+		return "", errBadDNSLink
+	}
+
+	switch name := segments[1]; segments[0] {
+	case "ipfs":
+		h, err := mh.FromB58String(name)
+		if err != nil {
+			return "", errBadDNSLink
+		}
+		return u.Key(h), nil
+	case "ipns":
+		if r.CanResolve(name) {
+			return r.resolve(ctx, name, depth+1)
+		}
+		if r.ipns == nil || !r.ipns.CanResolve(name) {
+			return "", ErrResolveFailed
+		}
+		return r.ipns.Resolve(ctx, name)
+	default:
+		return "", errBadDNSLink
+	}
+}
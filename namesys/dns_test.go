@@ -0,0 +1,80 @@
+package namesys
+
+import (
+	"errors"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+type mockDNS map[string][]string
+
+func (m mockDNS) lookupTXT(name string) ([]string, error) {
+	txt, ok := m[name]
+	if !ok {
+		return nil, errors.New("no such domain")
+	}
+	return txt, nil
+}
+
+// mockResolver resolves the names in it
+type mockResolver map[string]u.Key
+
+func (m mockResolver) CanResolve(name string) bool {
+	_, ok := m[name]
+	return ok
+}
+
+func (m mockResolver) Resolve(ctx context.Context, name string) (u.Key, error) {
+	return m[name], nil
+}
+
+func TestDNSResolve(t *testing.T) {
+	ctx := context.Background()
+	h := u.Key(u.Hash([]byte("website")))
+	keyName := u.Key(u.Hash([]byte("a public key"))).Pretty()
+
+	r := &DNSResolver{
+		ipns: mockResolver{keyName: h},
+		lookupTXT: mockDNS{
+			"legacy.com":   []string{h.Pretty()},
+			"ipfs.com":     []string{"v=spf1 -all", "dnslink=/ipfs/" + h.Pretty()},
+			"alias.com":    []string{"dnslink=/ipns/ipfs.com"},
+			"key.com":      []string{"dnslink=/ipns/" + keyName},
+			"bad.com":      []string{"dnslink=/ipfs/nothash", "dnslink=/ipfs/" + h.Pretty()},
+			"subpath.com":  []string{"dnslink=/ipfs/" + h.Pretty() + "/index.html"},
+			"unknown.com":  []string{"dnslink=/ipns/" + u.Key(u.Hash([]byte("other"))).Pretty()},
+			"loop-a.com":   []string{"dnslink=/ipns/loop-b.com"},
+			"loop-b.com":   []string{"dnslink=/ipns/loop-a.com"},
+			"nothing.com":  []string{"v=spf1 -all"},
+			"missing.com":  []string{"dnslink=/ipns/nowhere.com"},
+			"trailing.com": []string{"dnslink=/ipfs/" + h.Pretty() + "/"},
+		}.lookupTXT,
+	}
+
+	for _, name := range []string{"legacy.com", "ipfs.com", "alias.com", "key.com", "bad.com", "trailing.com"} {
+		if !r.CanResolve(name) {
+			t.Fatalf("expected to resolve %s", name)
+		}
+		res, err := r.Resolve(ctx, name)
+		if err != nil {
+			t.Fatalf("resolving %s: %s", name, err)
+		}
+		if res != h {
+			t.Fatalf("%s resolved to %s, expected %s", name, res, h)
+		}
+	}
+
+	for _, name := range []string{"subpath.com", "unknown.com", "nothing.com"} {
+		if _, err := r.Resolve(ctx, name); err != ErrResolveFailed {
+			t.Fatalf("resolving %s: expected ErrResolveFailed, got %v", name, err)
+		}
+	}
+	if _, err := r.Resolve(ctx, "loop-a.com"); err != ErrResolveRecursion {
+		t.Fatalf("expected ErrResolveRecursion, got %v", err)
+	}
+	if _, err := r.Resolve(ctx, "missing.com"); err == nil {
+		t.Fatal("expected a missing domain to fail")
+	}
+}
@@ -3,6 +3,7 @@ package namesys
 
 import (
 	"errors"
+	"time"
 
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	ci "github.com/jbenet/go-ipfs/p2p/crypto"
@@ -44,3 +45,13 @@ type Publisher interface {
 	// TODO make this not PrivKey specific.
 	Publish(ctx context.Context, name ci.PrivKey, value u.Key) error
 }
+
+// LifetimePublisher is a Publisher able to choose how long the records it
+// publishes stay valid.
+type LifetimePublisher interface {
+	Publisher
+
+	// PublishWithLifetime establishes a name-value mapping that expires at
+	// eol, instead of after DefaultRecordLifetime.
+	PublishWithLifetime(ctx context.Context, name ci.PrivKey, value u.Key, eol time.Time) error
+}
@@ -1,9 +1,12 @@
 package namesys
 
 import (
+	"time"
+
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	ci "github.com/jbenet/go-ipfs/p2p/crypto"
 	routing "github.com/jbenet/go-ipfs/routing"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
@@ -15,32 +18,131 @@ import (
 // (c) proquints: interprets string as the raw byte data.
 //
 // It can only publish to: (a) ipfs routing naming.
-//
 type ipns struct {
 	resolvers []Resolver
 	publisher Publisher
+
+	cache *resolveCache // nil when resolutions aren't cached
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
 func NewNameSystem(r routing.IpfsRouting) NameSystem {
-	return &ipns{
+	return newNameSystem(r, NewRoutingResolver(r))
+}
+
+// NewProxyNameSystem constructs the IPFS naming system like NewNameSystem,
+// but resolves the names of keys with proxy, e.g. a ProxyResolver, instead
+// of the routing system. Names are still published through the routing
+// system. Resolutions are cached for ttl as with NewCachedNameSystem, or
+// not at all if ttl is zero.
+func NewProxyNameSystem(r routing.IpfsRouting, proxy Resolver, ttl time.Duration) NameSystem {
+	ns := newNameSystem(r, proxy)
+	if ttl > 0 {
+		ns.cache = newResolveCache(ttl)
+	}
+	return ns
+}
+
+// newNameSystem constructs the naming system, resolving the names of keys
+// with keys.
+func newNameSystem(r routing.IpfsRouting, keys Resolver) *ipns {
+	dns := new(DNSResolver)
+	ns := &ipns{
 		resolvers: []Resolver{
-			new(DNSResolver),
+			dns,
 			new(ProquintResolver),
-			NewRoutingResolver(r),
+			keys,
 		},
 		publisher: NewRoutingPublisher(r),
 	}
+	// dnslink records may point to any other name
+	dns.ipns = ns
+	return ns
+}
+
+// NewCachedNameSystem constructs the IPFS naming system like NewNameSystem,
+// caching resolved names for the given ttl, or until the end of validity of
+// their record if that comes first. Stale names are refreshed in the
+// background while their cached value is still returned.
+func NewCachedNameSystem(r routing.IpfsRouting, ttl time.Duration) NameSystem {
+	ns := newNameSystem(r, NewRoutingResolver(r))
+	ns.cache = newResolveCache(ttl)
+	return ns
+}
+
+// ResolveUncached resolves name without looking at the cache of ns, and
+// updates the cache with the result.
+func ResolveUncached(ctx context.Context, ns NameSystem, name string) (u.Key, error) {
+	if n, ok := ns.(*ipns); ok {
+		return n.resolveAndCache(ctx, name)
+	}
+	return ns.Resolve(ctx, name)
 }
 
 // Resolve implements Resolver
-func (ns *ipns) Resolve(ctx context.Context, name string) (u.Key, error) {
+func (ns *ipns) Resolve(ctx context.Context, name string) (val u.Key, err error) {
+	e := log.EventBegin(ctx, "resolve", eventlog.LoggableMap{"name": name})
+	defer func() {
+		if err != nil {
+			e.SetError(err)
+		} else {
+			e.Append(&val)
+		}
+		e.Done()
+	}()
+
+	if ns.cache == nil {
+		val, _, err := ns.resolveOnce(ctx, name)
+		return val, err
+	}
+
+	if val, refresh, ok := ns.cache.get(name); ok {
+		e.Append(eventlog.LoggableMap{"cached": true})
+		if refresh {
+			go ns.refresh(name)
+		}
+		return val, nil
+	}
+	return ns.resolveAndCache(ctx, name)
+}
+
+func (ns *ipns) resolveAndCache(ctx context.Context, name string) (u.Key, error) {
+	val, eol, err := ns.resolveOnce(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if ns.cache != nil {
+		ns.cache.put(name, val, eol)
+	}
+	return val, nil
+}
+
+func (ns *ipns) refresh(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	if _, err := ns.resolveAndCache(ctx, name); err != nil {
+		log.Debugf("failed to refresh cached name %s: %s", name, err)
+		ns.cache.done(name)
+	}
+}
+
+// resolveOnce resolves name with the first resolver able to, also returning
+// the end of validity of the result when known.
+func (ns *ipns) resolveOnce(ctx context.Context, name string) (u.Key, time.Time, error) {
 	for _, r := range ns.resolvers {
-		if r.CanResolve(name) {
-			return r.Resolve(ctx, name)
+		if !r.CanResolve(name) {
+			continue
 		}
+
+		if er, ok := r.(eolResolver); ok {
+			return er.resolveWithEOL(ctx, name)
+		}
+		val, err := r.Resolve(ctx, name)
+		return val, time.Time{}, err
 	}
-	return "", ErrResolveFailed
+	return "", time.Time{}, ErrResolveFailed
 }
 
 // CanResolve implements Resolver
@@ -55,5 +157,35 @@ func (ns *ipns) CanResolve(name string) bool {
 
 // Publish implements Publisher
 func (ns *ipns) Publish(ctx context.Context, name ci.PrivKey, value u.Key) error {
-	return ns.publisher.Publish(ctx, name, value)
+	err := ns.publisher.Publish(ctx, name, value)
+	if err != nil {
+		return err
+	}
+	return ns.forget(name)
+}
+
+// PublishWithLifetime implements LifetimePublisher
+func (ns *ipns) PublishWithLifetime(ctx context.Context, name ci.PrivKey, value u.Key, eol time.Time) error {
+	lp, ok := ns.publisher.(LifetimePublisher)
+	if !ok {
+		return ErrPublishFailed
+	}
+	err := lp.PublishWithLifetime(ctx, name, value, eol)
+	if err != nil {
+		return err
+	}
+	return ns.forget(name)
+}
+
+// forget drops the cached value of the name of the given key, so the newly
+// published value gets resolved.
+func (ns *ipns) forget(name ci.PrivKey) error {
+	if ns.cache != nil {
+		h, err := name.GetPublic().Hash()
+		if err != nil {
+			return err
+		}
+		ns.cache.remove(u.Key(h).Pretty())
+	}
+	return nil
 }
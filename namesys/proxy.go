@@ -0,0 +1,77 @@
+package namesys
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// ProxyResolver implements a Resolver asking the HTTP API of another IPFS
+// node to resolve the names of keys, so that nodes not taking part in the
+// DHT can still resolve them.
+type ProxyResolver struct {
+	api    string
+	client *http.Client
+}
+
+// NewProxyResolver constructs a resolver using the API served at the given
+// base URL, e.g. "http://127.0.0.1:5001".
+func NewProxyResolver(api string) *ProxyResolver {
+	return &ProxyResolver{
+		api:    strings.TrimSuffix(api, "/"),
+		client: http.DefaultClient,
+	}
+}
+
+// CanResolve implements Resolver. Checks whether name is a b58 encoded
+// multihash, like the names resolved through the routing system.
+func (r *ProxyResolver) CanResolve(name string) bool {
+	_, err := mh.FromB58String(name)
+	return err == nil
+}
+
+// Resolve implements Resolver, with a GET /api/v0/name/resolve request.
+func (r *ProxyResolver) Resolve(ctx context.Context, name string) (u.Key, error) {
+	log.Debugf("ProxyResolver resolving %s through %s", name, r.api)
+
+	q := url.Values{"arg": {name}, "encoding": {"json"}}
+	req, err := http.NewRequest("GET", r.api+"/api/v0/name/resolve?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Cancel = ctx.Done()
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		// the API reports errors as a JSON encoded commands.Error
+		var e struct{ Message string }
+		if json.NewDecoder(res.Body).Decode(&e) == nil && e.Message != "" {
+			return "", fmt.Errorf("resolving %s through %s: %s", name, r.api, e.Message)
+		}
+		return "", ErrResolveFailed
+	}
+
+	var out struct{ Key u.Key }
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.Key == "" {
+		return "", ErrResolveFailed
+	}
+	return out.Key, nil
+}
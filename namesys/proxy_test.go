@@ -0,0 +1,64 @@
+package namesys
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	mockrouting "github.com/jbenet/go-ipfs/routing/mock"
+	u "github.com/jbenet/go-ipfs/util"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestProxyResolve(t *testing.T) {
+	ctx := context.Background()
+	name := u.Key(u.Hash([]byte("a public key"))).Pretty()
+	h := u.Key(u.Hash([]byte("resolved")))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/name/resolve" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("arg") != name {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Message":"could not resolve name.","Code":0}`))
+			return
+		}
+		w.Write([]byte(`{"Key":"` + h.Pretty() + `"}`))
+	}))
+	defer ts.Close()
+
+	r := NewProxyResolver(ts.URL + "/")
+	if !r.CanResolve(name) || r.CanResolve("example.com") {
+		t.Fatal("expected to resolve the names of keys only")
+	}
+	res, err := r.Resolve(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != h {
+		t.Fatalf("resolved to %s, expected %s", res, h)
+	}
+
+	other := u.Key(u.Hash([]byte("another key"))).Pretty()
+	if _, err := r.Resolve(ctx, other); err == nil {
+		t.Fatal("expected the remote error")
+	}
+
+	// the proxy takes the place of the routing system in a name system
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	ns := NewProxyNameSystem(d, r, 0)
+	if res, err := ns.Resolve(ctx, name); err != nil || res != h {
+		t.Fatalf("expected %s, got %s (%v)", h, res, err)
+	}
+
+	// a cancelled context stops the request
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := r.Resolve(cctx, name); err != context.Canceled {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
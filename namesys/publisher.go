@@ -25,6 +25,9 @@ var ErrExpiredRecord = errors.New("expired record")
 // unknown validity type.
 var ErrUnrecognizedValidity = errors.New("unrecognized validity type")
 
+// DefaultRecordLifetime is how long published ipns records stay valid
+const DefaultRecordLifetime = time.Hour * 24
+
 // ipnsPublisher is capable of publishing and resolving names to the IPFS
 // routing system.
 type ipnsPublisher struct {
@@ -39,15 +42,25 @@ func NewRoutingPublisher(route routing.IpfsRouting) Publisher {
 // Publish implements Publisher. Accepts a keypair and a value,
 // and publishes it out to the routing system
 func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value u.Key) error {
+	return p.PublishWithLifetime(ctx, k, value, time.Now().Add(DefaultRecordLifetime))
+}
+
+// PublishWithLifetime implements LifetimePublisher. It publishes value under
+// the name of k, in a record valid until eol, which must be in the future.
+func (p *ipnsPublisher) PublishWithLifetime(ctx context.Context, k ci.PrivKey, value u.Key, eol time.Time) error {
 	log.Debugf("namesys: Publish %s", value)
 
+	if !eol.After(time.Now()) {
+		return ErrExpiredRecord
+	}
+
 	// validate `value` is a ref (multihash)
 	_, err := mh.FromB58String(value.Pretty())
 	if err != nil {
 		return fmt.Errorf("publish value must be str multihash. %v", err)
 	}
 
-	data, err := createRoutingEntryData(k, value)
+	data, err := createRoutingEntryData(k, value, eol)
 	if err != nil {
 		return err
 	}
@@ -59,6 +72,12 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value u.Key)
 
 	nameb := u.Hash(pkbytes)
 	namekey := u.Key("/pk/" + string(nameb))
+	ipnskey := u.Key("/ipns/" + string(nameb))
+
+	// never store a record the other nodes would refuse
+	if err := ValidateIpnsRecord(ipnskey, data); err != nil {
+		return err
+	}
 
 	log.Debugf("Storing pubkey at: %s", namekey)
 	// Store associated public key
@@ -68,8 +87,6 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value u.Key)
 		return err
 	}
 
-	ipnskey := u.Key("/ipns/" + string(nameb))
-
 	log.Debugf("Storing ipns entry at: %s", ipnskey)
 	// Store ipns entry at "/ipns/"+b58(h(pubkey))
 	timectx, _ = context.WithDeadline(ctx, time.Now().Add(time.Second*10))
@@ -81,13 +98,13 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value u.Key)
 	return nil
 }
 
-func createRoutingEntryData(pk ci.PrivKey, val u.Key) ([]byte, error) {
+func createRoutingEntryData(pk ci.PrivKey, val u.Key, eol time.Time) ([]byte, error) {
 	entry := new(pb.IpnsEntry)
 
 	entry.Value = []byte(val)
 	typ := pb.IpnsEntry_EOL
 	entry.ValidityType = &typ
-	entry.Validity = []byte(u.FormatRFC3339(time.Now().Add(time.Hour * 24)))
+	entry.Validity = []byte(u.FormatRFC3339(eol))
 
 	sig, err := pk.Sign(ipnsEntryDataForSig(entry))
 	if err != nil {
@@ -0,0 +1,124 @@
+package namesys
+
+import (
+	"sync"
+	"time"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	ci "github.com/jbenet/go-ipfs/p2p/crypto"
+	routing "github.com/jbenet/go-ipfs/routing"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// DefaultRepublishInterval is how often names are republished by default
+const DefaultRepublishInterval = time.Hour * 4
+
+// Republisher periodically publishes the current value of a set of names
+// again, in records with a fresh validity, so they don't expire from the
+// routing system.
+type Republisher struct {
+	resolver  *routingResolver
+	publisher *ipnsPublisher
+
+	Interval       time.Duration // time between republishes
+	RecordLifetime time.Duration // validity of the republished records
+
+	lk   sync.Mutex
+	keys map[string]ci.PrivKey // name -> key signing its records
+}
+
+// NewRepublisher creates a Republisher publishing through the given routing
+// system. Names to republish are added with AddName.
+func NewRepublisher(r routing.IpfsRouting, interval, lifetime time.Duration) *Republisher {
+	return &Republisher{
+		resolver:       &routingResolver{routing: r},
+		publisher:      &ipnsPublisher{routing: r},
+		Interval:       interval,
+		RecordLifetime: lifetime,
+		keys:           make(map[string]ci.PrivKey),
+	}
+}
+
+// AddName makes the Republisher republish the name of the given key
+func (rp *Republisher) AddName(k ci.PrivKey) error {
+	h, err := k.GetPublic().Hash()
+	if err != nil {
+		return err
+	}
+
+	rp.lk.Lock()
+	rp.keys[u.Key(h).Pretty()] = k
+	rp.lk.Unlock()
+	return nil
+}
+
+// RemoveName stops the Republisher from republishing the name of the given
+// key.
+func (rp *Republisher) RemoveName(k ci.PrivKey) error {
+	h, err := k.GetPublic().Hash()
+	if err != nil {
+		return err
+	}
+
+	rp.lk.Lock()
+	delete(rp.keys, u.Key(h).Pretty())
+	rp.lk.Unlock()
+	return nil
+}
+
+// Run republishes all names every Interval, until ctx is cancelled.
+func (rp *Republisher) Run(ctx context.Context) {
+	tick := time.NewTicker(rp.Interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if err := rp.Republish(ctx); err != nil {
+				log.Debugf("republishing names failed: %s", err)
+			}
+		}
+	}
+}
+
+// Republish publishes the current value of every name once. Names that were
+// never published are skipped. It returns the first error encountered.
+func (rp *Republisher) Republish(ctx context.Context) error {
+	rp.lk.Lock()
+	keys := make(map[string]ci.PrivKey, len(rp.keys))
+	for name, k := range rp.keys {
+		keys[name] = k
+	}
+	rp.lk.Unlock()
+
+	var firstErr error
+	for name, k := range keys {
+		if err := rp.republishName(ctx, name, k); err != nil {
+			log.Debugf("failed to republish %s: %s", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (rp *Republisher) republishName(ctx context.Context, name string, k ci.PrivKey) error {
+	// the routing system returns our own record from the local store
+	val, err := rp.resolver.Resolve(ctx, name)
+	if err == routing.ErrNotFound || err == ds.ErrNotFound {
+		return nil
+	}
+	// records published with a short lifetime are left to expire
+	if err == ErrExpiredRecord {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return rp.publisher.PublishWithLifetime(ctx, k, val, time.Now().Add(rp.RecordLifetime))
+}
@@ -0,0 +1,65 @@
+package namesys
+
+import (
+	"testing"
+	"time"
+
+	proto "github.com/jbenet/go-ipfs/Godeps/_workspace/src/code.google.com/p/goprotobuf/proto"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	pb "github.com/jbenet/go-ipfs/namesys/internal/pb"
+	mockrouting "github.com/jbenet/go-ipfs/routing/mock"
+	u "github.com/jbenet/go-ipfs/util"
+	testutil "github.com/jbenet/go-ipfs/util/testutil"
+)
+
+func TestRepublish(t *testing.T) {
+	ctx := context.Background()
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rp := NewRepublisher(d, time.Hour, 48*time.Hour)
+	if err := rp.AddName(privk); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing was published yet, so there is nothing to republish
+	if err := rp.Republish(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	h := u.Key(u.Hash([]byte("Hello")))
+	if err := NewRoutingPublisher(d).Publish(ctx, privk, h); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Republish(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := d.GetValue(ctx, u.Key("/ipns/"+string(pkhash)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(val, entry); err != nil {
+		t.Fatal(err)
+	}
+	if u.Key(entry.GetValue()) != h {
+		t.Fatal("republished the wrong value")
+	}
+
+	eol, err := u.ParseRFC3339(string(entry.GetValidity()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eol.Before(time.Now().Add(47 * time.Hour)) {
+		t.Fatalf("republished record has the wrong lifetime, valid until %s", eol)
+	}
+}
@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"testing"
+	"time"
 
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	mockrouting "github.com/jbenet/go-ipfs/routing/mock"
@@ -46,3 +47,46 @@ func TestRoutingResolve(t *testing.T) {
 		t.Fatal("Got back incorrect value.")
 	}
 }
+
+func TestPublishWithLifetime(t *testing.T) {
+	ctx := context.Background()
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	ns := NewNameSystem(d).(LifetimePublisher)
+	resolver := NewRoutingResolver(d)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := u.Key(pkhash).Pretty()
+	h := u.Key(u.Hash([]byte("short lived")))
+
+	if err := ns.PublishWithLifetime(ctx, privk, h, time.Now().Add(-time.Second)); err != ErrExpiredRecord {
+		t.Fatalf("expected ErrExpiredRecord, got %v", err)
+	}
+
+	if err := ns.PublishWithLifetime(ctx, privk, h, time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := resolver.Resolve(ctx, name); err != nil || res != h {
+		t.Fatalf("expected %s, got %s (%v)", h, res, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := resolver.Resolve(ctx, name); err != ErrExpiredRecord {
+		t.Fatalf("expected ErrExpiredRecord, got %v", err)
+	}
+
+	// the dht validator rejects it too
+	data, err := createRoutingEntryData(privk, h, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateIpnsRecord("", data); err != ErrExpiredRecord {
+		t.Fatalf("expected ErrExpiredRecord, got %v", err)
+	}
+}
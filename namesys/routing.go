@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/code.google.com/p/goprotobuf/proto"
 	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
@@ -9,10 +10,11 @@ import (
 	pb "github.com/jbenet/go-ipfs/namesys/internal/pb"
 	ci "github.com/jbenet/go-ipfs/p2p/crypto"
 	routing "github.com/jbenet/go-ipfs/routing"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
-var log = u.Logger("namesys")
+var log = eventlog.Logger("namesys")
 
 // routingResolver implements NSResolver for the main IPFS SFS-like naming
 type routingResolver struct {
@@ -38,11 +40,19 @@ func (r *routingResolver) CanResolve(name string) bool {
 // Resolve implements Resolver. Uses the IPFS routing system to resolve SFS-like
 // names.
 func (r *routingResolver) Resolve(ctx context.Context, name string) (u.Key, error) {
+	val, _, err := r.resolveWithEOL(ctx, name)
+	return val, err
+}
+
+// resolveWithEOL resolves name like Resolve, and also returns the end of
+// validity of the record it was resolved from, or the zero time if the
+// record carries none.
+func (r *routingResolver) resolveWithEOL(ctx context.Context, name string) (u.Key, time.Time, error) {
 	log.Debugf("RoutingResolve: '%s'", name)
 	hash, err := mh.FromB58String(name)
 	if err != nil {
-		log.Warning("RoutingResolve: bad input hash: [%s]\n", name)
-		return "", err
+		log.Warningf("RoutingResolve: bad input hash: [%s]", name)
+		return "", time.Time{}, err
 	}
 	// name should be a multihash. if it isn't, error out here.
 
@@ -54,13 +64,13 @@ func (r *routingResolver) Resolve(ctx context.Context, name string) (u.Key, erro
 	val, err := r.routing.GetValue(ctx, ipnsKey)
 	if err != nil {
 		log.Warning("RoutingResolve get failed.")
-		return "", err
+		return "", time.Time{}, err
 	}
 
 	entry := new(pb.IpnsEntry)
 	err = proto.Unmarshal(val, entry)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
 	// name should be a public key retrievable from ipfs
@@ -69,22 +79,33 @@ func (r *routingResolver) Resolve(ctx context.Context, name string) (u.Key, erro
 	pkval, err := r.routing.GetValue(ctx, key)
 	if err != nil {
 		log.Warning("RoutingResolve PubKey Get failed.")
-		return "", err
+		return "", time.Time{}, err
 	}
 
 	// get PublicKey from node.Data
 	pk, err := ci.UnmarshalPublicKey(pkval)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 	hsh, _ := pk.Hash()
 	log.Debugf("pk hash = %s", u.Key(hsh))
 
 	// check sig with pk
 	if ok, err := pk.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
-		return "", fmt.Errorf("Invalid value. Not signed by PrivateKey corresponding to %v", pk)
+		return "", time.Time{}, fmt.Errorf("Invalid value. Not signed by PrivateKey corresponding to %v", pk)
+	}
+
+	var eol time.Time
+	if entry.GetValidityType() == pb.IpnsEntry_EOL {
+		eol, err = u.ParseRFC3339(string(entry.GetValidity()))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if time.Now().After(eol) {
+			return "", time.Time{}, ErrExpiredRecord
+		}
 	}
 
 	// ok sig checks out. this is a valid name.
-	return u.Key(entry.GetValue()), nil
+	return u.Key(entry.GetValue()), eol, nil
 }
@@ -94,6 +94,24 @@ func GenerateKeyPairWithReader(typ, bits int, src io.Reader) (PrivKey, PubKey, e
 	}
 }
 
+// GenerateDeterministicKeyPair generates a keypair of the given type and
+// bitsize from the bytes read from src. Unlike with GenerateKeyPairWithReader,
+// whose output also depends on the Go version and on chance, the same bytes
+// always yield the same keys, so that e.g. a seeded math/rand source gives
+// reproducible identities. It is meant for tests, not for real keys.
+func GenerateDeterministicKeyPair(typ, bits int, src io.Reader) (PrivKey, PubKey, error) {
+	switch typ {
+	case RSA:
+		priv, err := deterministicRSAKey(src, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &RsaPrivateKey{sk: priv}, &RsaPublicKey{&priv.PublicKey}, nil
+	default:
+		return nil, nil, ErrBadKeyType
+	}
+}
+
 // Generates an ephemeral public key and returns a function that will compute
 // the shared secret key.  Used in the identify module.
 //
@@ -4,6 +4,7 @@ import (
 	. "github.com/jbenet/go-ipfs/p2p/crypto"
 
 	"bytes"
+	u "github.com/jbenet/go-ipfs/util"
 	tu "github.com/jbenet/go-ipfs/util/testutil"
 	"testing"
 )
@@ -120,3 +121,19 @@ func (pk testkey) Equals(k Key) bool {
 func (pk testkey) Hash() ([]byte, error) {
 	return KeyHash(pk)
 }
+
+func TestDeterministicRsaKeys(t *testing.T) {
+	sk1, _, err := GenerateDeterministicKeyPair(RSA, 512, u.NewSeededRand(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk2, _, err := GenerateDeterministicKeyPair(RSA, 512, u.NewSeededRand(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk1.Equals(sk2) {
+		t.Fatal("same bytes generated different keys")
+	}
+	testKeySignature(t, sk1)
+	testKeyEncoding(t, sk1)
+}
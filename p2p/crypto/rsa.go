@@ -7,6 +7,8 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"errors"
+	"io"
+	"math/big"
 
 	proto "github.com/jbenet/go-ipfs/Godeps/_workspace/src/code.google.com/p/goprotobuf/proto"
 
@@ -124,3 +126,74 @@ func UnmarshalRsaPublicKey(b []byte) (*RsaPublicKey, error) {
 func MarshalRsaPublicKey(k *RsaPublicKey) ([]byte, error) {
 	return x509.MarshalPKIXPublicKey(k.k)
 }
+
+// deterministicRSAKey generates an RSA key whose primes are the first
+// probable primes among the candidates read from src.
+func deterministicRSAKey(src io.Reader, bits int) (*rsa.PrivateKey, error) {
+	if bits < 64 || bits%2 != 0 {
+		return nil, errors.New("rsa: key size must be even, and at least 64 bits")
+	}
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	for {
+		p, err := readPrime(src, bits/2, e)
+		if err != nil {
+			return nil, err
+		}
+		q, err := readPrime(src, bits/2, e)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		n := new(big.Int).Mul(p, q)
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil || n.BitLen() != bits {
+			continue
+		}
+		sk := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		sk.Precompute()
+		if err := sk.Validate(); err != nil {
+			return nil, err
+		}
+		return sk, nil
+	}
+}
+
+// readPrime reads candidates of the given size from src until one of them is
+// a probable prime p for which p-1 is coprime with e.
+func readPrime(src io.Reader, bits int, e *big.Int) (*big.Int, error) {
+	buf := make([]byte, (bits+7)/8)
+	p := new(big.Int)
+	pm1 := new(big.Int)
+	gcd := new(big.Int)
+	for {
+		if _, err := io.ReadFull(src, buf); err != nil {
+			return nil, err
+		}
+		// exactly bits long, with the top two bits set so that the product
+		// of two such primes has twice as many bits, and odd
+		if extra := uint(len(buf)*8 - bits); extra > 0 {
+			buf[0] &= byte(0xff >> extra)
+		}
+		p.SetBytes(buf)
+		p.SetBit(p, bits-1, 1)
+		p.SetBit(p, bits-2, 1)
+		p.SetBit(p, 0, 1)
+
+		if !p.ProbablyPrime(20) {
+			continue
+		}
+		pm1.Sub(p, big.NewInt(1))
+		if gcd.GCD(nil, nil, pm1, e).Cmp(big.NewInt(1)) == 0 {
+			return p, nil
+		}
+	}
+}
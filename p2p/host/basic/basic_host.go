@@ -6,7 +6,9 @@ import (
 	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 
+	inat "github.com/jbenet/go-ipfs/p2p/nat"
 	inet "github.com/jbenet/go-ipfs/p2p/net"
+	filter "github.com/jbenet/go-ipfs/p2p/net/filter"
 	peer "github.com/jbenet/go-ipfs/p2p/peer"
 	protocol "github.com/jbenet/go-ipfs/p2p/protocol"
 	identify "github.com/jbenet/go-ipfs/p2p/protocol/identify"
@@ -109,6 +111,16 @@ func (h *BasicHost) IDService() *identify.IDService {
 	return h.ids
 }
 
+// NAT returns the NAT device the host opens port mappings in. It is nil if
+// the host was constructed without the NATPortMap option, or if no device
+// was found (yet).
+func (h *BasicHost) NAT() *inat.NAT {
+	if h.natmgr == nil {
+		return nil
+	}
+	return h.natmgr.NAT()
+}
+
 // SetStreamHandler sets the protocol handler on the Host's Mux.
 // This is equivalent to:
 //   host.Mux().SetHandler(proto, handler)
@@ -203,9 +215,18 @@ func (h *BasicHost) Addrs() []ma.Multiaddr {
 		}
 	}
 
+	// never advertise addresses the network refuses to use
+	if fn, ok := h.network.(filteringNetwork); ok {
+		addrs = fn.Filters().FilterAddrs(addrs)
+	}
 	return addrs
 }
 
+// filteringNetwork is a network with address filters, like the swarm.
+type filteringNetwork interface {
+	Filters() *filter.Filters
+}
+
 // Close shuts down the Host's services (network, etc).
 func (h *BasicHost) Close() error {
 	return h.proc.Close()
@@ -0,0 +1,194 @@
+package meteredhost
+
+import (
+	"sync"
+	"sync/atomic"
+
+	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/jbenet/go-ipfs/p2p/host"
+	inet "github.com/jbenet/go-ipfs/p2p/net"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	protocol "github.com/jbenet/go-ipfs/p2p/protocol"
+)
+
+// Stats is the amount of data exchanged with a peer over a protocol.
+type Stats struct {
+	TotalIn  uint64
+	TotalOut uint64
+}
+
+// counter holds the live byte counts of one protocol and peer. It is only
+// accessed atomically.
+type counter struct {
+	in  uint64
+	out uint64
+}
+
+// Meter counts the bytes read from and written to streams, bucketed by
+// protocol and peer. It is safe for concurrent use.
+type Meter struct {
+	lk       sync.RWMutex
+	counters map[protocol.ID]map[peer.ID]*counter
+}
+
+// NewMeter returns an empty Meter
+func NewMeter() *Meter {
+	return &Meter{counters: make(map[protocol.ID]map[peer.ID]*counter)}
+}
+
+// counter returns the counter for pid and p, creating it if needed.
+func (m *Meter) counter(pid protocol.ID, p peer.ID) *counter {
+	m.lk.RLock()
+	c, ok := m.counters[pid][p]
+	m.lk.RUnlock()
+	if ok {
+		return c
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	peers, ok := m.counters[pid]
+	if !ok {
+		peers = make(map[peer.ID]*counter)
+		m.counters[pid] = peers
+	}
+	c, ok = peers[p]
+	if !ok {
+		c = new(counter)
+		peers[p] = c
+	}
+	return c
+}
+
+// Stats returns a snapshot of the counts, by protocol and then by peer.
+func (m *Meter) Stats() map[protocol.ID]map[peer.ID]Stats {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	out := make(map[protocol.ID]map[peer.ID]Stats, len(m.counters))
+	for pid, peers := range m.counters {
+		ps := make(map[peer.ID]Stats, len(peers))
+		for p, c := range peers {
+			ps[p] = Stats{
+				TotalIn:  atomic.LoadUint64(&c.in),
+				TotalOut: atomic.LoadUint64(&c.out),
+			}
+		}
+		out[pid] = ps
+	}
+	return out
+}
+
+// Reset sets all counts back to zero.
+func (m *Meter) Reset() {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	// open streams hold on to their counters, so zero them in place
+	for _, peers := range m.counters {
+		for _, c := range peers {
+			atomic.StoreUint64(&c.in, 0)
+			atomic.StoreUint64(&c.out, 0)
+		}
+	}
+}
+
+// MeteredHost is a p2p Host counting the data sent and received on the
+// streams it opens and handles. Streams of handlers registered directly on
+// the wrapped host (such as its identify service) are not counted.
+type MeteredHost struct {
+	host  host.Host
+	meter *Meter
+}
+
+// Wrap returns a MeteredHost recording into m the traffic of streams going
+// through h.
+func Wrap(h host.Host, m *Meter) *MeteredHost {
+	return &MeteredHost{h, m}
+}
+
+// Meter returns the Meter the host records into
+func (mh *MeteredHost) Meter() *Meter {
+	return mh.meter
+}
+
+// Host returns the wrapped host
+func (mh *MeteredHost) Host() host.Host {
+	return mh.host
+}
+
+func (mh *MeteredHost) ID() peer.ID {
+	return mh.host.ID()
+}
+
+func (mh *MeteredHost) Peerstore() peer.Peerstore {
+	return mh.host.Peerstore()
+}
+
+func (mh *MeteredHost) Addrs() []ma.Multiaddr {
+	return mh.host.Addrs()
+}
+
+func (mh *MeteredHost) Network() inet.Network {
+	return mh.host.Network()
+}
+
+func (mh *MeteredHost) Mux() *protocol.Mux {
+	return mh.host.Mux()
+}
+
+func (mh *MeteredHost) Connect(ctx context.Context, pi peer.PeerInfo) error {
+	return mh.host.Connect(ctx, pi)
+}
+
+// SetStreamHandler sets a handler for pid on the wrapped host, counting the
+// traffic of the streams it is handed.
+func (mh *MeteredHost) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	mh.host.SetStreamHandler(pid, func(s inet.Stream) {
+		handler(mh.wrapStream(pid, s))
+	})
+}
+
+func (mh *MeteredHost) RemoveStreamHandler(pid protocol.ID) {
+	mh.host.RemoveStreamHandler(pid)
+}
+
+// NewStream opens a stream through the wrapped host, counting its traffic.
+func (mh *MeteredHost) NewStream(pid protocol.ID, p peer.ID) (inet.Stream, error) {
+	s, err := mh.host.NewStream(pid, p)
+	if err != nil {
+		return nil, err
+	}
+	return mh.wrapStream(pid, s), nil
+}
+
+func (mh *MeteredHost) Close() error {
+	return mh.host.Close()
+}
+
+func (mh *MeteredHost) wrapStream(pid protocol.ID, s inet.Stream) inet.Stream {
+	return &meteredStream{
+		Stream:  s,
+		counter: mh.meter.counter(pid, s.Conn().RemotePeer()),
+	}
+}
+
+// meteredStream counts the bytes read from and written to a stream
+type meteredStream struct {
+	inet.Stream
+	counter *counter
+}
+
+func (s *meteredStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	atomic.AddUint64(&s.counter.in, uint64(n))
+	return n, err
+}
+
+func (s *meteredStream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	atomic.AddUint64(&s.counter.out, uint64(n))
+	return n, err
+}
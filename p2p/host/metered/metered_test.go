@@ -0,0 +1,60 @@
+package meteredhost
+
+import (
+	"io"
+	"testing"
+
+	inet "github.com/jbenet/go-ipfs/p2p/net"
+	protocol "github.com/jbenet/go-ipfs/p2p/protocol"
+	testutil "github.com/jbenet/go-ipfs/p2p/test/util"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestMeteredHost(t *testing.T) {
+	ctx := context.Background()
+	m1, m2 := NewMeter(), NewMeter()
+	h1 := Wrap(testutil.GenHostSwarm(t, ctx), m1)
+	h2 := Wrap(testutil.GenHostSwarm(t, ctx), m2)
+	defer h1.Close()
+	defer h2.Close()
+
+	h2pi := h2.Peerstore().PeerInfo(h2.ID())
+	if err := h1.Connect(ctx, h2pi); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	h2.SetStreamHandler(protocol.TestingID, func(s inet.Stream) {
+		defer close(done)
+		defer s.Close()
+		io.CopyN(s, s, 12) // echo
+	})
+
+	s, err := h1.NewStream(protocol.TestingID, h2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("abcdefghijkl")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	<-done
+
+	expect := Stats{TotalIn: 12, TotalOut: 12}
+	if st := m1.Stats()[protocol.TestingID][h2.ID()]; st != expect {
+		t.Fatalf("wrong stats for the opening side: %+v", st)
+	}
+	if st := m2.Stats()[protocol.TestingID][h1.ID()]; st != expect {
+		t.Fatalf("wrong stats for the handling side: %+v", st)
+	}
+
+	m1.Reset()
+	if st := m1.Stats()[protocol.TestingID][h2.ID()]; st != (Stats{}) {
+		t.Fatalf("expected reset stats, got %+v", st)
+	}
+}
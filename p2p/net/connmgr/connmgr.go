@@ -0,0 +1,196 @@
+// Package connmgr keeps the number of open connections of a network within
+// bounds.
+package connmgr
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	inet "github.com/jbenet/go-ipfs/p2p/net"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("p2p/net/connmgr")
+
+// ConnManager closes connections once the network has more than HighWater
+// of them, until it is down to LowWater. Peers are dropped starting with the
+// ones that were useful the longest time ago, or never. Protected peers and
+// peers connected for less than GracePeriod are kept.
+type ConnManager struct {
+	HighWater   int
+	LowWater    int
+	GracePeriod time.Duration
+
+	net inet.Network
+
+	lk         sync.Mutex
+	connected  map[peer.ID]time.Time // when we connected to the peer
+	lastUseful map[peer.ID]time.Time
+	protected  map[peer.ID]struct{}
+
+	trimming int32 // set while a trim triggered by a new connection runs
+}
+
+// New returns a ConnManager keeping the connections of n between the given
+// watermarks. It starts watching n right away.
+func New(n inet.Network, low, high int, grace time.Duration) *ConnManager {
+	cm := &ConnManager{
+		HighWater:   high,
+		LowWater:    low,
+		GracePeriod: grace,
+		net:         n,
+		connected:   make(map[peer.ID]time.Time),
+		lastUseful:  make(map[peer.ID]time.Time),
+		protected:   make(map[peer.ID]struct{}),
+	}
+
+	now := time.Now()
+	for _, p := range n.Peers() {
+		cm.connected[p] = now
+	}
+	n.Notify((*cmNotifee)(cm))
+	return cm
+}
+
+// TagUseful records that p was useful just now, e.g. because we exchanged
+// blocks with it.
+func (cm *ConnManager) TagUseful(p peer.ID) {
+	cm.lk.Lock()
+	cm.lastUseful[p] = time.Now()
+	cm.lk.Unlock()
+}
+
+// Protect keeps the connections to p from being trimmed.
+func (cm *ConnManager) Protect(p peer.ID) {
+	cm.lk.Lock()
+	cm.protected[p] = struct{}{}
+	cm.lk.Unlock()
+}
+
+// Unprotect lets the connections to p be trimmed again.
+func (cm *ConnManager) Unprotect(p peer.ID) {
+	cm.lk.Lock()
+	delete(cm.protected, p)
+	cm.lk.Unlock()
+}
+
+// TrimOpenConns closes connections down to LowWater if there are more than
+// HighWater of them. It returns the peers it disconnected from.
+func (cm *ConnManager) TrimOpenConns() []peer.ID {
+	if cm.HighWater <= 0 {
+		return nil
+	}
+	open := len(cm.net.Conns())
+	if open <= cm.HighWater {
+		return nil
+	}
+
+	var closed []peer.ID
+	for _, p := range cm.trimCandidates() {
+		if open <= cm.LowWater {
+			break
+		}
+
+		n := len(cm.net.ConnsToPeer(p))
+		// the swarm removes the connections as it closes them
+		if err := cm.net.ClosePeer(p); err != nil {
+			log.Debugf("closing connections to %s: %s", p, err)
+			continue
+		}
+		open -= n
+		closed = append(closed, p)
+	}
+	log.Debugf("trimmed connections to %d peers, %d connections left", len(closed), open)
+	return closed
+}
+
+// Close stops watching the network. It does not close any connections.
+func (cm *ConnManager) Close() error {
+	cm.net.StopNotify((*cmNotifee)(cm))
+	return nil
+}
+
+// trimCandidates returns the peers that may be disconnected from, least
+// useful first.
+func (cm *ConnManager) trimCandidates() []peer.ID {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	now := time.Now()
+	var peers []peer.ID
+	for _, p := range cm.net.Peers() {
+		if _, ok := cm.protected[p]; ok {
+			continue
+		}
+		if t, ok := cm.connected[p]; ok && now.Sub(t) < cm.GracePeriod {
+			continue
+		}
+		peers = append(peers, p)
+	}
+
+	sort.Sort(byLastUseful{peers, cm.lastUseful})
+	return peers
+}
+
+type byLastUseful struct {
+	peers []peer.ID
+	last  map[peer.ID]time.Time
+}
+
+func (s byLastUseful) Len() int      { return len(s.peers) }
+func (s byLastUseful) Swap(i, j int) { s.peers[i], s.peers[j] = s.peers[j], s.peers[i] }
+func (s byLastUseful) Less(i, j int) bool {
+	return s.last[s.peers[i]].Before(s.last[s.peers[j]])
+}
+
+// cmNotifee tracks the connections of the network, trimming them when a new
+// one goes over the high watermark.
+type cmNotifee ConnManager
+
+func (nn *cmNotifee) cm() *ConnManager {
+	return (*ConnManager)(nn)
+}
+
+func (nn *cmNotifee) Connected(n inet.Network, c inet.Conn) {
+	cm := nn.cm()
+	p := c.RemotePeer()
+
+	cm.lk.Lock()
+	if _, ok := cm.connected[p]; !ok {
+		cm.connected[p] = time.Now()
+	}
+	cm.lk.Unlock()
+
+	if cm.HighWater <= 0 || len(n.Conns()) <= cm.HighWater {
+		return
+	}
+	// trim in the background, not to hold up the network notifying others
+	if atomic.CompareAndSwapInt32(&cm.trimming, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&cm.trimming, 0)
+			cm.TrimOpenConns()
+		}()
+	}
+}
+
+func (nn *cmNotifee) Disconnected(n inet.Network, c inet.Conn) {
+	cm := nn.cm()
+	p := c.RemotePeer()
+	if len(n.ConnsToPeer(p)) > 0 {
+		return
+	}
+
+	cm.lk.Lock()
+	delete(cm.connected, p)
+	delete(cm.lastUseful, p)
+	cm.lk.Unlock()
+}
+
+func (nn *cmNotifee) Listen(n inet.Network, addr ma.Multiaddr)      {}
+func (nn *cmNotifee) ListenClose(n inet.Network, addr ma.Multiaddr) {}
+func (nn *cmNotifee) OpenedStream(n inet.Network, s inet.Stream)    {}
+func (nn *cmNotifee) ClosedStream(n inet.Network, s inet.Stream)    {}
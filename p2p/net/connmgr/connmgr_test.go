@@ -0,0 +1,103 @@
+package connmgr
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	inet "github.com/jbenet/go-ipfs/p2p/net"
+	mocknet "github.com/jbenet/go-ipfs/p2p/net/mock"
+)
+
+// connectedNet returns a network connected to n-1 others
+func connectedNet(t *testing.T, ctx context.Context, n int) inet.Network {
+	mn, err := mocknet.FullMeshLinked(ctx, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nets := mn.Nets()
+	for _, other := range nets[1:] {
+		if _, err := mn.ConnectNets(nets[0], other); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return nets[0]
+}
+
+func TestTrimOpenConns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	net := connectedNet(t, ctx, 6)
+	others := net.Peers()
+
+	cm := New(net, 2, 3, 0)
+	defer cm.Close()
+
+	protected, useful := others[0], others[1]
+	cm.Protect(protected)
+	cm.TagUseful(useful)
+
+	closed := cm.TrimOpenConns()
+	if len(closed) != 3 {
+		t.Fatalf("expected to disconnect from 3 peers, got %d", len(closed))
+	}
+	for _, p := range closed {
+		if p == protected || p == useful {
+			t.Fatalf("disconnected from %s, which should have been kept", p)
+		}
+	}
+	if n := len(net.Conns()); n != 2 {
+		t.Fatalf("expected 2 connections left, got %d", n)
+	}
+
+	// below the high watermark, nothing happens
+	if closed := cm.TrimOpenConns(); len(closed) != 0 {
+		t.Fatal("expected no connections to be trimmed")
+	}
+}
+
+func TestTrimGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	net := connectedNet(t, ctx, 4)
+
+	cm := New(net, 0, 1, time.Hour)
+	defer cm.Close()
+
+	if closed := cm.TrimOpenConns(); len(closed) != 0 {
+		t.Fatal("expected new connections to be kept")
+	}
+
+	cm.GracePeriod = 0
+	if closed := cm.TrimOpenConns(); len(closed) != 3 {
+		t.Fatalf("expected to disconnect from 3 peers, got %d", len(closed))
+	}
+}
+
+func TestTrimOnConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshLinked(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nets := mn.Nets()
+	cm := New(nets[0], 1, 2, 0)
+	defer cm.Close()
+
+	for _, n := range nets[1:] {
+		if _, err := mn.ConnectNets(nets[0], n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; len(nets[0].Conns()) > 2; i++ {
+		if i > 100 {
+			t.Fatalf("still %d connections open", len(nets[0].Conns()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,93 @@
+// package filter implements address filters, restricting the networks a
+// swarm dials and listens in.
+package filter
+
+import (
+	"net"
+	"sync"
+
+	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+)
+
+// Filters block addresses by the IP network they are in. An address is
+// blocked if it is in a denied network, or if networks were allowed and it
+// is in none of them. Addresses not starting with an IP, and unspecified
+// IPs (0.0.0.0 and ::), are never blocked.
+//
+// Filters are safe for concurrent use.
+type Filters struct {
+	lk    sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// New returns Filters blocking no address.
+func New() *Filters {
+	return &Filters{}
+}
+
+// Allow restricts the allowed addresses to ipnet and the other allowed
+// networks.
+func (f *Filters) Allow(ipnet *net.IPNet) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.allow = append(f.allow, ipnet)
+}
+
+// Deny blocks the addresses in ipnet, even if they are allowed.
+func (f *Filters) Deny(ipnet *net.IPNet) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.deny = append(f.deny, ipnet)
+}
+
+// AddrBlocked returns whether a is blocked by the filters.
+func (f *Filters) AddrBlocked(a ma.Multiaddr) bool {
+	ip := addrIP(a)
+	if ip == nil || ip.IsUnspecified() {
+		return false
+	}
+
+	f.lk.RLock()
+	defer f.lk.RUnlock()
+	for _, ipnet := range f.deny {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	if len(f.allow) == 0 {
+		return false
+	}
+	for _, ipnet := range f.allow {
+		if ipnet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterAddrs returns the addresses in addrs not blocked by the filters.
+func (f *Filters) FilterAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	var out []ma.Multiaddr
+	for _, a := range addrs {
+		if !f.AddrBlocked(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// addrIP returns the IP a starts with, or nil.
+func addrIP(a ma.Multiaddr) net.IP {
+	parts := ma.Split(a)
+	if len(parts) == 0 {
+		return nil
+	}
+	b := parts[0].Bytes()
+	code, n := ma.ReadVarintCode(b)
+	switch code {
+	case ma.P_IP4, ma.P_IP6:
+		return net.IP(b[n:])
+	}
+	return nil
+}
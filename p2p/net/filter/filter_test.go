@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"net"
+	"testing"
+
+	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ipnet
+}
+
+func TestAddrBlocked(t *testing.T) {
+	f := New()
+	f.Deny(mustCIDR(t, "10.0.0.0/8"))
+
+	cases := map[string]bool{
+		"/ip4/10.1.2.3/tcp/4001":    true,
+		"/ip4/1.2.3.4/tcp/4001":     false,
+		"/ip4/0.0.0.0/tcp/4001":     false,
+		"/ip6/::1/tcp/4001":         false,
+		"/ip6/fc00::1/udp/4001/utp": false,
+	}
+	for s, blocked := range cases {
+		if f.AddrBlocked(ma.StringCast(s)) != blocked {
+			t.Fatalf("expected %s blocked: %t", s, blocked)
+		}
+	}
+
+	// once networks are allowed, all other addresses are blocked
+	f.Allow(mustCIDR(t, "fc00::/7"))
+	f.Allow(mustCIDR(t, "10.0.0.0/16"))
+	cases = map[string]bool{
+		"/ip4/10.0.2.3/tcp/4001":    true, // denied wins
+		"/ip4/1.2.3.4/tcp/4001":     true,
+		"/ip4/0.0.0.0/tcp/4001":     false,
+		"/ip6/fc00::1/udp/4001/utp": false,
+	}
+	for s, blocked := range cases {
+		if f.AddrBlocked(ma.StringCast(s)) != blocked {
+			t.Fatalf("expected %s blocked: %t", s, blocked)
+		}
+	}
+}
+
+func TestFilterAddrs(t *testing.T) {
+	f := New()
+	f.Deny(mustCIDR(t, "192.168.0.0/16"))
+
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/192.168.1.1/tcp/4001"),
+		ma.StringCast("/ip4/8.8.8.8/tcp/4001"),
+	}
+	out := f.FilterAddrs(addrs)
+	if len(out) != 1 || !out[0].Equal(addrs[1]) {
+		t.Fatalf("unexpected filtered addresses: %s", out)
+	}
+}
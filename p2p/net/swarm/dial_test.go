@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	filter "github.com/jbenet/go-ipfs/p2p/net/filter"
 	addrutil "github.com/jbenet/go-ipfs/p2p/net/swarm/addr"
 	peer "github.com/jbenet/go-ipfs/p2p/peer"
 
@@ -440,3 +441,45 @@ func TestDialBackoffClears(t *testing.T) {
 		t.Log("correctly cleared backoff")
 	}
 }
+
+func TestDialFiltered(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	swarms := makeSwarms(ctx, t, 2)
+	s1 := swarms[0]
+	s2 := swarms[1]
+	defer s1.Close()
+	defer s2.Close()
+
+	_, loopback, err := net.ParseCIDR("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := filter.New()
+	fs.Deny(loopback)
+	s1.SetFilters(fs)
+
+	// s1 neither advertises nor dials the loopback addresses
+	addrs, err := s1.InterfaceListenAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addrs {
+		if manet.IsIPLoopback(a) {
+			t.Fatalf("filtered address %s still listed", a)
+		}
+	}
+	s1.peers.AddAddr(s2.local, s2.ListenAddresses()[0], peer.PermanentAddrTTL)
+	if _, err := s1.Dial(ctx, s2.local); err != ErrAddrFiltered {
+		t.Fatalf("expected ErrAddrFiltered, got %v", err)
+	}
+
+	// and refuses the connections from them
+	s2.peers.AddAddr(s1.local, s1.ListenAddresses()[0], peer.PermanentAddrTTL)
+	s2.Dial(ctx, s1.local)
+	time.Sleep(100 * time.Millisecond)
+	if len(s1.ConnectionsToPeer(s2.local)) != 0 {
+		t.Fatal("connection from a filtered address was accepted")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	inet "github.com/jbenet/go-ipfs/p2p/net"
+	filter "github.com/jbenet/go-ipfs/p2p/net/filter"
 	addrutil "github.com/jbenet/go-ipfs/p2p/net/swarm/addr"
 	peer "github.com/jbenet/go-ipfs/p2p/peer"
 	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
@@ -42,6 +43,9 @@ type Swarm struct {
 	notifmu sync.RWMutex
 	notifs  map[inet.Notifiee]ps.Notifiee
 
+	filtersLk sync.RWMutex
+	filters   *filter.Filters
+
 	cg ctxgroup.ContextGroup
 }
 
@@ -49,18 +53,19 @@ type Swarm struct {
 func NewSwarm(ctx context.Context, listenAddrs []ma.Multiaddr,
 	local peer.ID, peers peer.Peerstore) (*Swarm, error) {
 
-	listenAddrs, err := filterAddrs(listenAddrs)
-	if err != nil {
-		return nil, err
+	s := &Swarm{
+		swarm:   ps.NewSwarm(PSTransport),
+		local:   local,
+		peers:   peers,
+		cg:      ctxgroup.WithContext(ctx),
+		dialT:   DialTimeout,
+		notifs:  make(map[inet.Notifiee]ps.Notifiee),
+		filters: filter.New(),
 	}
 
-	s := &Swarm{
-		swarm:  ps.NewSwarm(PSTransport),
-		local:  local,
-		peers:  peers,
-		cg:     ctxgroup.WithContext(ctx),
-		dialT:  DialTimeout,
-		notifs: make(map[inet.Notifiee]ps.Notifiee),
+	listenAddrs, err := s.filterAddrs(listenAddrs)
+	if err != nil {
+		return nil, err
 	}
 
 	// configure Swarm
@@ -74,10 +79,11 @@ func (s *Swarm) teardown() error {
 	return s.swarm.Close()
 }
 
-// CtxGroup returns the Context Group of the swarm
-func filterAddrs(listenAddrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+// filterAddrs returns the listen addresses that are usable and not blocked
+// by the address filters.
+func (s *Swarm) filterAddrs(listenAddrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
 	if len(listenAddrs) > 0 {
-		filtered := addrutil.FilterUsableAddrs(listenAddrs)
+		filtered := s.Filters().FilterAddrs(addrutil.FilterUsableAddrs(listenAddrs))
 		if len(filtered) < 1 {
 			return nil, fmt.Errorf("swarm cannot use any addr in: %s", listenAddrs)
 		}
@@ -88,7 +94,7 @@ func filterAddrs(listenAddrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
 
 // CtxGroup returns the Context Group of the swarm
 func (s *Swarm) Listen(addrs ...ma.Multiaddr) error {
-	addrs, err := filterAddrs(addrs)
+	addrs, err := s.filterAddrs(addrs)
 	if err != nil {
 		return err
 	}
@@ -96,6 +102,23 @@ func (s *Swarm) Listen(addrs ...ma.Multiaddr) error {
 	return s.listen(addrs)
 }
 
+// Filters returns the address filters of the swarm. Addresses they block
+// are neither listened on, dialed nor advertised, and connections from them
+// are refused.
+func (s *Swarm) Filters() *filter.Filters {
+	s.filtersLk.RLock()
+	defer s.filtersLk.RUnlock()
+	return s.filters
+}
+
+// SetFilters replaces the address filters of the swarm. Listeners already
+// open are kept.
+func (s *Swarm) SetFilters(f *filter.Filters) {
+	s.filtersLk.Lock()
+	defer s.filtersLk.Unlock()
+	s.filters = f
+}
+
 // CtxGroup returns the Context Group of the swarm
 func (s *Swarm) CtxGroup() ctxgroup.ContextGroup {
 	return s.cg
@@ -21,9 +21,14 @@ func (s *Swarm) ListenAddresses() []ma.Multiaddr {
 
 // InterfaceListenAddresses returns a list of addresses at which this swarm
 // listens. It expands "any interface" addresses (/ip4/0.0.0.0, /ip6/::) to
-// use the known local interfaces.
+// use the known local interfaces. Addresses blocked by the filters are left
+// out.
 func (s *Swarm) InterfaceListenAddresses() ([]ma.Multiaddr, error) {
-	return addrutil.ResolveUnspecifiedAddresses(s.ListenAddresses(), nil)
+	addrs, err := addrutil.ResolveUnspecifiedAddresses(s.ListenAddresses(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.Filters().FilterAddrs(addrs), nil
 }
 
 // checkNATWarning checks if our observed addresses differ. if so,
@@ -35,6 +35,10 @@ var (
 	ErrDialBackoff = errors.New("dial backoff")
 	ErrDialFailed  = errors.New("dial attempt failed")
 	ErrDialToSelf  = errors.New("dial to self attempted")
+
+	// ErrAddrFiltered is returned by dials to peers whose addresses are all
+	// blocked by the address filters of the swarm.
+	ErrAddrFiltered = errors.New("all addresses of the peer are blocked by the address filters")
 )
 
 // dialAttempts governs how many times a goroutine will try to dial a given peer.
@@ -231,6 +235,10 @@ func (s *Swarm) gatedDialAttempt(ctx context.Context, p peer.ID) (*Conn, error)
 		conn, err := s.dial(ctxT, p)
 		s.dsync.Unlock(p)
 		log.Debugf("dial end %s", conn)
+		if err == ErrAddrFiltered {
+			// backing off would not unblock the addresses
+			return nil, err
+		}
 		if err != nil {
 			log.Event(ctx, "swarmDialBackoffAdd", logdial)
 			s.backf.AddBackoff(p) // let others know to backoff
@@ -295,6 +303,13 @@ func (s *Swarm) dial(ctx context.Context, p peer.ID) (*Conn, error) {
 	remoteAddrs := s.peers.Addrs(p)
 	// make sure we can use the addresses.
 	remoteAddrs = addrutil.FilterUsableAddrs(remoteAddrs)
+	if len(remoteAddrs) > 0 {
+		remoteAddrs = s.Filters().FilterAddrs(remoteAddrs)
+		if len(remoteAddrs) == 0 {
+			logdial["error"] = ErrAddrFiltered
+			return nil, ErrAddrFiltered
+		}
+	}
 	// drop out any addrs that would just dial ourselves. use ListenAddresses
 	// as that is a more authoritative view than localAddrs.
 	ila, _ := s.InterfaceListenAddresses()
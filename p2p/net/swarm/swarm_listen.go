@@ -120,6 +120,12 @@ func (s *Swarm) connHandler(c *ps.Conn) *Conn {
 	// Q: why not have a shorter handshake? think about an HTTP server on really slow conns.
 	// as long as the conn is live (TCP says its online), it tries its best. we follow suit.)
 
+	if nc, ok := c.NetConn().(conn.Conn); ok && s.Filters().AddrBlocked(nc.RemoteMultiaddr()) {
+		log.Debugf("refusing connection from blocked address %s", nc.RemoteMultiaddr())
+		c.Close()
+		return nil
+	}
+
 	sc, err := s.newConnSetup(ctx, c)
 	if err != nil {
 		log.Debug(err)
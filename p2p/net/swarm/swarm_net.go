@@ -6,6 +6,7 @@ import (
 	peer "github.com/jbenet/go-ipfs/p2p/peer"
 
 	inet "github.com/jbenet/go-ipfs/p2p/net"
+	filter "github.com/jbenet/go-ipfs/p2p/net/filter"
 
 	ctxgroup "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-ctxgroup"
 	ma "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
@@ -119,6 +120,11 @@ func (n *Network) InterfaceListenAddresses() ([]ma.Multiaddr, error) {
 	return n.Swarm().InterfaceListenAddresses()
 }
 
+// Filters returns the address filters of the network. See Swarm.Filters.
+func (n *Network) Filters() *filter.Filters {
+	return n.Swarm().Filters()
+}
+
 // Connectedness returns a state signaling connection capabilities
 // For now only returns Connected || NotConnected. Expand into more later.
 func (n *Network) Connectedness(p peer.ID) inet.Connectedness {
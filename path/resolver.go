@@ -3,13 +3,17 @@ package path
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	mh "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	merkledag "github.com/jbenet/go-ipfs/merkledag"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	u "github.com/jbenet/go-ipfs/util"
 )
 
-var log = u.Logger("path")
+var log = eventlog.Logger("path")
 
 // ErrNoLink is returned when a link is not found in a path
 type ErrNoLink struct {
@@ -55,41 +59,73 @@ func SplitAbsPath(fpath Path) (mh.Multihash, []string, error) {
 
 // ResolvePath fetches the node for given path. It returns the last item
 // returned by ResolvePathComponents.
-func (s *Resolver) ResolvePath(fpath Path) (*merkledag.Node, error) {
-	nodes, err := s.ResolvePathComponents(fpath)
-	if err != nil || nodes == nil {
+func (s *Resolver) ResolvePath(ctx context.Context, fpath Path) (*merkledag.Node, error) {
+	nd, rest, err := s.ResolvePathWithRemainder(ctx, fpath)
+	if err != nil {
 		return nil, err
-	} else {
-		return nodes[len(nodes)-1], err
 	}
+	if len(rest) > 0 {
+		h, _ := nd.Multihash()
+		return nil, ErrNoLink{name: rest[0], node: h}
+	}
+	return nd, nil
+}
+
+// ResolvePathWithRemainder resolves as much of the given path as there are
+// links for. It returns the last node it got to, and the path segments it
+// could not resolve from there, if any. An error is only returned if a node
+// could not be fetched.
+func (s *Resolver) ResolvePathWithRemainder(ctx context.Context, fpath Path) (*merkledag.Node, []string, error) {
+	defer log.EventBegin(ctx, "resolvePath", eventlog.LoggableMap{"path": fpath.String()}).Done()
+
+	h, parts, err := SplitAbsPath(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nd, err := s.DAG.Get(ctx, u.Key(h))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes, err := s.ResolveLinks(ctx, nd, parts)
+	if _, ok := err.(ErrNoLink); ok {
+		// nodes holds the root and one node per resolved segment
+		return nodes[len(nodes)-1], parts[len(nodes)-1:], nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes[len(nodes)-1], nil, nil
 }
 
 // ResolvePathComponents fetches the nodes for each segment of the given path.
 // It uses the first path component as a hash (key) of the first node, then
 // resolves all other components walking the links, with ResolveLinks.
-func (s *Resolver) ResolvePathComponents(fpath Path) ([]*merkledag.Node, error) {
+func (s *Resolver) ResolvePathComponents(ctx context.Context, fpath Path) ([]*merkledag.Node, error) {
 	h, parts, err := SplitAbsPath(fpath)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Debug("Resolve dag get.\n")
-	nd, err := s.DAG.Get(u.Key(h))
+	nd, err := s.DAG.Get(ctx, u.Key(h))
 	if err != nil {
 		return nil, err
 	}
 
-	return s.ResolveLinks(nd, parts)
+	return s.ResolveLinks(ctx, nd, parts)
 }
 
 // ResolveLinks iteratively resolves names by walking the link hierarchy.
-// Every node is fetched from the DAGService, resolving the next name.
+// Every node is fetched from the DAGService, resolving the next name. A name
+// of the form "@<n>" that matches no link name selects the n-th link.
 // Returns the list of nodes forming the path, starting with ndd. This list is
 // guaranteed never to be empty.
 //
-// ResolveLinks(nd, []string{"foo", "bar", "baz"})
+// ResolveLinks(ctx, nd, []string{"foo", "bar", "baz"})
 // would retrieve "baz" in ("bar" in ("foo" in nd.Links).Links).Links
-func (s *Resolver) ResolveLinks(ndd *merkledag.Node, names []string) (
+func (s *Resolver) ResolveLinks(ctx context.Context, ndd *merkledag.Node, names []string) (
 	result []*merkledag.Node, err error) {
 
 	result = make([]*merkledag.Node, 0, len(names)+1)
@@ -110,6 +146,14 @@ func (s *Resolver) ResolveLinks(ndd *merkledag.Node, names []string) (
 			}
 		}
 
+		if next == "" {
+			// unnamed links can be addressed by index
+			if link, ok := linkByIndex(nd, name); ok {
+				next = u.Key(link.Hash)
+				nlink = link
+			}
+		}
+
 		if next == "" {
 			n, _ := nd.Multihash()
 			return result, ErrNoLink{name: name, node: n}
@@ -117,7 +161,7 @@ func (s *Resolver) ResolveLinks(ndd *merkledag.Node, names []string) (
 
 		if nlink.Node == nil {
 			// fetch object for link and assign to nd
-			nd, err = s.DAG.Get(next)
+			nd, err = s.DAG.Get(ctx, next)
 			if err != nil {
 				return append(result, nd), err
 			}
@@ -130,3 +174,15 @@ func (s *Resolver) ResolveLinks(ndd *merkledag.Node, names []string) (
 	}
 	return
 }
+
+// linkByIndex returns the link selected by an "@<index>" path segment.
+func linkByIndex(nd *merkledag.Node, name string) (*merkledag.Link, bool) {
+	if !strings.HasPrefix(name, "@") {
+		return nil, false
+	}
+	i, err := strconv.Atoi(name[1:])
+	if err != nil || i < 0 || i >= len(nd.Links) {
+		return nil, false
+	}
+	return nd.Links[i], true
+}
@@ -31,8 +31,22 @@ const (
 	NotPinned
 )
 
+func (m PinMode) String() string {
+	switch m {
+	case Recursive:
+		return "recursive"
+	case Direct:
+		return "direct"
+	case Indirect:
+		return "indirect"
+	default:
+		return "not pinned"
+	}
+}
+
 type Pinner interface {
 	IsPinned(util.Key) bool
+	Mode(util.Key) PinMode
 	Pin(*mdag.Node, bool) error
 	Unpin(util.Key, bool) error
 	Flush() error
@@ -120,7 +134,7 @@ func (p *pinner) Unpin(k util.Key, recursive bool) error {
 	if p.recursePin.HasKey(k) {
 		if recursive {
 			p.recursePin.RemoveBlock(k)
-			node, err := p.dserv.Get(k)
+			node, err := p.dserv.Get(context.TODO(), k)
 			if err != nil {
 				return err
 			}
@@ -141,7 +155,7 @@ func (p *pinner) Unpin(k util.Key, recursive bool) error {
 
 func (p *pinner) unpinLinks(node *mdag.Node) error {
 	for _, l := range node.Links {
-		node, err := l.GetNode(p.dserv)
+		node, err := l.GetNode(context.TODO(), p.dserv)
 		if err != nil {
 			return err
 		}
@@ -196,6 +210,23 @@ func (p *pinner) IsPinned(key util.Key) bool {
 		p.indirPin.HasKey(key)
 }
 
+// Mode returns how the given key is pinned, or NotPinned. A key pinned both
+// explicitly and as the child of a recursive pin reports the explicit mode.
+func (p *pinner) Mode(key util.Key) PinMode {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	switch {
+	case p.recursePin.HasKey(key):
+		return Recursive
+	case p.directPin.HasKey(key):
+		return Direct
+	case p.indirPin.HasKey(key):
+		return Indirect
+	default:
+		return NotPinned
+	}
+}
+
 // LoadPinner loads a pinner and its keysets from the given datastore
 func LoadPinner(d ds.ThreadSafeDatastore, dserv mdag.DAGService) (Pinner, error) {
 	p := new(pinner)
@@ -88,6 +88,11 @@ func TestPinnerBasic(t *testing.T) {
 		t.Fatal("Recursively pinned node not found..")
 	}
 
+	// a is pinned both directly and through b
+	if p.Mode(ak) != Direct || p.Mode(bk) != Recursive || p.Mode(ck) != Indirect {
+		t.Fatal("wrong pin modes reported")
+	}
+
 	d, _ := randNode()
 	d.AddNodeLink("a", a)
 	d.AddNodeLink("c", c)
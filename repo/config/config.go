@@ -25,6 +25,11 @@ type Config struct {
 	Tour             Tour                  // local node's tour position
 	Gateway          Gateway               // local node's gateway server options
 	SupernodeRouting SupernodeClientConfig // local node's routing servers (if SupernodeRouting enabled)
+	Reprovider       Reprovider            // local node's reprovider options
+	Ipns             Ipns                  // local node's ipns resolution options
+	ConnMgr          ConnMgr               // local node's connection limits
+	Swarm            Swarm                 // local node's swarm address filters
+	Exchange         Exchange              // local node's block fetching options
 	Log              Log
 }
 
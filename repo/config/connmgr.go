@@ -0,0 +1,16 @@
+package config
+
+// ConnMgr contains options for limiting the number of open connections.
+type ConnMgr struct {
+	// HighWater is the number of connections above which connections get
+	// closed. Zero disables the connection manager.
+	HighWater int
+
+	// LowWater is the number of connections left open after trimming.
+	LowWater int
+
+	// GracePeriod is how long new connections are kept open regardless of
+	// the watermarks (e.g. "20s").
+	// (Note: cannot use time.Duration because marshalling with json breaks it)
+	GracePeriod string
+}
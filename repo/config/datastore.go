@@ -7,6 +7,20 @@ const DefaultDataStoreDirectory = "datastore"
 type Datastore struct {
 	Type string
 	Path string
+
+	// MaxBlockSize is the size in bytes above which new blocks are refused.
+	// Zero selects the default of 1MiB, a negative value removes the limit.
+	MaxBlockSize int
+
+	// VerifyBlocks rehashes every block read from the datastore, refusing
+	// those whose data does not match their key, e.g. because of a failing
+	// disk. It costs CPU time on every read.
+	VerifyBlocks bool
+
+	// StorageMax is the total size in bytes of the blocks the node may
+	// store, above which new blocks are refused. Zero means no limit. A
+	// limit makes the node read all its blocks when starting, to count them.
+	StorageMax uint64
 }
 
 // DataStorePath returns the default data store path given a configuration root
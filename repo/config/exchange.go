@@ -0,0 +1,17 @@
+package config
+
+// Exchange contains options for fetching blocks from other peers.
+type Exchange struct {
+	// FetchTimeout is how long a block is searched for on the network before
+	// giving up on it (e.g. "30s"), unless the caller sets a deadline. Empty
+	// selects the default of one minute, "0" searches until the caller gives
+	// up.
+	// (Note: cannot use time.Duration because marshalling with json breaks it)
+	FetchTimeout string
+
+	// ProviderSearchDelay is how long the blocks wanted are only asked of the
+	// connected peers, before their providers are searched for in the
+	// routing system (e.g. "500ms"). Empty selects the default of one
+	// second, "0" searches right away.
+	ProviderSearchDelay string
+}
@@ -1,24 +1,146 @@
 package config
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+
 	ic "github.com/jbenet/go-ipfs/p2p/crypto"
 )
 
+// ErrWrongPassphrase is returned when an encrypted private key can not be
+// decrypted with the given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase for the private key")
+
+// encryptedKeyPrefix marks an encrypted PrivKey. The rest is the base64 of
+// the salt, the nonce and the AES-GCM sealed key.
+const encryptedKeyPrefix = "encrypted:"
+
+const (
+	keySaltLen    = 16
+	keyIterations = 4096
+)
+
 // Identity tracks the configuration of the local node's identity.
 type Identity struct {
 	PeerID  string
 	PrivKey string
 }
 
-// DecodePrivateKey is a helper to decode the users PrivateKey
+// Encrypted reports whether the private key is passphrase protected.
+func (i *Identity) Encrypted() bool {
+	return strings.HasPrefix(i.PrivKey, encryptedKeyPrefix)
+}
+
+// DecodePrivateKey is a helper to decode the users PrivateKey. The
+// passphrase is only used if the key is encrypted.
 func (i *Identity) DecodePrivateKey(passphrase string) (ic.PrivKey, error) {
-	pkb, err := base64.StdEncoding.DecodeString(i.PrivKey)
+	if !i.Encrypted() {
+		pkb, err := base64.StdEncoding.DecodeString(i.PrivKey)
+		if err != nil {
+			return nil, err
+		}
+		return ic.UnmarshalPrivateKey(pkb)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(i.PrivKey, encryptedKeyPrefix))
 	if err != nil {
 		return nil, err
 	}
+	if len(data) < keySaltLen {
+		return nil, errors.New("encrypted private key too short")
+	}
+
+	aead, err := keyCipher(passphrase, data[:keySaltLen])
+	if err != nil {
+		return nil, err
+	}
+	data = data[keySaltLen:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted private key too short")
+	}
 
-	// currently storing key unencrypted. in the future we need to encrypt it.
-	// TODO(security)
+	pkb, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
 	return ic.UnmarshalPrivateKey(pkb)
 }
+
+// EncryptPrivateKey replaces the private key with one encrypted with the
+// given passphrase.
+func (i *Identity) EncryptPrivateKey(passphrase string) error {
+	if i.Encrypted() {
+		return errors.New("private key is already encrypted")
+	}
+	pkb, err := base64.StdEncoding.DecodeString(i.PrivKey)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, keySaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := keyCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data := append(salt, nonce...)
+	data = aead.Seal(data, nonce, pkb, nil)
+	i.PrivKey = encryptedKeyPrefix + base64.StdEncoding.EncodeToString(data)
+	return nil
+}
+
+// keyCipher derives the cipher protecting the private key from the
+// passphrase.
+func keyCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), salt, keyIterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key of keyLen bytes as specified in RFC 2898, using
+// HMAC-SHA256.
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
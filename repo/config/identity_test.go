@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	ic "github.com/jbenet/go-ipfs/p2p/crypto"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// test vectors for PBKDF2-HMAC-SHA256 from RFC 7914
+	for _, tc := range []struct {
+		iter int
+		dk   string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	} {
+		dk := hex.EncodeToString(pbkdf2([]byte("password"), []byte("salt"), tc.iter, 32))
+		if dk != tc.dk {
+			t.Fatalf("%d iterations: got %s, expected %s", tc.iter, dk, tc.dk)
+		}
+	}
+}
+
+func TestEncryptedPrivateKey(t *testing.T) {
+	sk, _, err := ic.GenerateKeyPair(ic.RSA, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skb, err := sk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ident := Identity{PrivKey: base64.StdEncoding.EncodeToString(skb)}
+
+	// the passphrase of an unencrypted key is ignored
+	if _, err := ident.DecodePrivateKey("anything"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ident.EncryptPrivateKey("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !ident.Encrypted() {
+		t.Fatal("expected the key to be encrypted")
+	}
+
+	if _, err := ident.DecodePrivateKey("wrong"); err != ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+	dec, err := ident.DecodePrivateKey("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dec.Equals(sk) {
+		t.Fatal("decrypted a different key")
+	}
+}
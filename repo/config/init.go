@@ -11,12 +11,28 @@ import (
 )
 
 func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
-	ds, err := datastoreConfig()
+	identity, err := identityConfig(out, nBitsForKeypair)
 	if err != nil {
 		return nil, err
 	}
+	return initWithIdentity(identity)
+}
 
-	identity, err := identityConfig(out, nBitsForKeypair)
+// InitFromReader returns the config Init does, except that the keypair of
+// the identity is generated from the bytes read from r, with
+// crypto.GenerateDeterministicKeyPair. Reading the same bytes, e.g. from a
+// math/rand source with a fixed seed, always yields the same peer ID. It is
+// meant for tests and must not be used for real nodes.
+func InitFromReader(r io.Reader, nBitsForKeypair int) (*Config, error) {
+	identity, err := deterministicIdentity(r, nBitsForKeypair)
+	if err != nil {
+		return nil, err
+	}
+	return initWithIdentity(identity)
+}
+
+func initWithIdentity(identity Identity) (*Config, error) {
+	ds, err := datastoreConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +83,23 @@ func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
 			RootRedirect: "",
 			Writable:     false,
 		},
+
+		Reprovider: Reprovider{
+			Interval: "12h",
+			Strategy: "all",
+		},
+
+		Ipns: Ipns{
+			ResolveCacheTTL: "1m",
+			RepublishPeriod: "4h",
+			RecordLifetime:  "24h",
+		},
+
+		ConnMgr: ConnMgr{
+			HighWater:   900,
+			LowWater:    600,
+			GracePeriod: "20s",
+		},
 	}
 
 	return conf, nil
@@ -98,6 +131,26 @@ func identityConfig(out io.Writer, nbits int) (Identity, error) {
 	}
 	fmt.Fprintf(out, "done\n")
 
+	ident, err = identityFromKeys(sk, pk)
+	if err != nil {
+		return ident, err
+	}
+	fmt.Fprintf(out, "peer identity: %s\n", ident.PeerID)
+	return ident, nil
+}
+
+// deterministicIdentity generates an identity from the bytes read from r.
+func deterministicIdentity(r io.Reader, nbits int) (Identity, error) {
+	sk, pk, err := ci.GenerateDeterministicKeyPair(ci.RSA, nbits, r)
+	if err != nil {
+		return Identity{}, err
+	}
+	return identityFromKeys(sk, pk)
+}
+
+func identityFromKeys(sk ci.PrivKey, pk ci.PubKey) (Identity, error) {
+	ident := Identity{}
+
 	// currently storing key unencrypted. in the future we need to encrypt it.
 	// TODO(security)
 	skbytes, err := sk.Bytes()
@@ -111,6 +164,5 @@ func identityConfig(out io.Writer, nbits int) (Identity, error) {
 		return ident, err
 	}
 	ident.PeerID = id.Pretty()
-	fmt.Fprintf(out, "peer identity: %s\n", ident.PeerID)
 	return ident, nil
 }
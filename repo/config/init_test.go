@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+func TestInitFromReader(t *testing.T) {
+	c1, err := InitFromReader(u.NewSeededRand(1), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := InitFromReader(u.NewSeededRand(1), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1.Identity != c2.Identity {
+		t.Fatal("same seed generated different identities")
+	}
+
+	c3, err := InitFromReader(u.NewSeededRand(2), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3.Identity.PeerID == c1.Identity.PeerID {
+		t.Fatal("different seeds generated the same identity")
+	}
+
+	sk, err := c1.Identity.DecodePrivateKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Pretty() != c1.Identity.PeerID {
+		t.Fatal("peer ID does not match the private key")
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+// Ipns contains options for resolving ipns names.
+type Ipns struct {
+	// ResolveCacheTTL is how long resolved names are cached before being
+	// looked up again (e.g. "1m"). An empty value uses the default, "0"
+	// disables the cache.
+	// (Note: cannot use time.Duration because marshalling with json breaks it)
+	ResolveCacheTTL string
+
+	// RepublishPeriod is the time between republishes of the names
+	// published by this node (e.g. "4h"). An empty value uses the default,
+	// "0" disables republishing.
+	RepublishPeriod string
+
+	// RecordLifetime is how long republished records stay valid (e.g.
+	// "24h"). It should be longer than RepublishPeriod.
+	RecordLifetime string
+
+	// ResolveProxy is the API address of a node to resolve the names of
+	// keys through instead of the DHT (e.g. "http://127.0.0.1:5001"), for
+	// nodes not taking part in the DHT. An empty value resolves them through
+	// the node's own routing system.
+	ResolveProxy string
+}
@@ -0,0 +1,15 @@
+package config
+
+// Reprovider contains options for periodically re-announcing local content
+// to the routing system.
+type Reprovider struct {
+	// Interval is the time duration between reprovides (e.g. "12h"). An
+	// empty value uses the default, "0" disables reproviding entirely.
+	// (Note: cannot use time.Duration because marshalling with json breaks it)
+	Interval string
+
+	// Strategy selects which keys to reprovide:
+	// - "all" (default) for every block in the blockstore
+	// - "roots" for the roots of direct and recursive pins only
+	Strategy string
+}
@@ -0,0 +1,16 @@
+package config
+
+// Swarm contains options for the connections of the swarm.
+type Swarm struct {
+	// AllowCIDRs restricts the addresses dialed, listened on and advertised
+	// to the listed networks (e.g. "10.0.0.0/8"). Empty allows all of them.
+	AllowCIDRs []string
+
+	// DenyCIDRs lists networks whose addresses are never dialed, listened
+	// on or advertised, even if allowed. Connections from them are refused.
+	DenyCIDRs []string
+
+	// DisableNatPortMap turns off opening port mappings in the NAT device,
+	// which is slow to probe for and useless on hosts with public addresses.
+	DisableNatPortMap bool
+}
@@ -6,7 +6,6 @@ import (
 	"sync"
 
 	datastore "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
-	levelds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/leveldb"
 	ldbopts "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
 	config "github.com/jbenet/go-ipfs/repo/config"
 	counter "github.com/jbenet/go-ipfs/repo/fsrepo/counter"
@@ -74,7 +73,7 @@ func (dsc *DatastoreComponent) Open(*config.Config) error {
 	// if no other goroutines have the datastore Open, initialize it and assign
 	// it to the package-scoped map for the goroutines that follow.
 	if openersCounter.NumOpeners(dsc.path) == 0 {
-		ds, err := levelds.NewDatastore(dsc.path, &levelds.Options{
+		ds, err := ds2.NewLevelDatastore(dsc.path, &ldbopts.Options{
 			Compression: ldbopts.NoCompression,
 		})
 		if err != nil {
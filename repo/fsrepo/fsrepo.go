@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
 
 	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
@@ -38,6 +41,20 @@ var (
 	openersCounter *counter.Openers
 )
 
+var (
+	// ErrRepoLocked is returned by Open when another process, such as a
+	// running daemon, holds the repo lock.
+	ErrRepoLocked = errors.New("repo is locked by another process, is a daemon running?")
+
+	// ErrStaleLock is returned by Open when the repo lock was left behind by
+	// a process that is no longer running. ReclaimLock removes it.
+	ErrStaleLock = errors.New("repo lock was left behind by a process that is no longer running")
+)
+
+// VersionFile is the filename, relative to the repo root, recording the
+// version of the repo format.
+const VersionFile = "version"
+
 func init() {
 	openersCounter = counter.NewOpenersCounter()
 	lockfiles = make(map[string]io.Closer)
@@ -106,7 +123,7 @@ func Init(path string, conf *config.Config) error {
 			return err
 		}
 	}
-	return nil
+	return writeVersion(path, repo.CurrentVersion)
 }
 
 // Remove recursively removes the FSRepo at |path|.
@@ -124,8 +141,37 @@ func Remove(repoPath string) error {
 	return os.RemoveAll(repoPath)
 }
 
+// LockStatus returns the PID of the process holding the lock of the repo at
+// repoPath, or zero if it is not known, and whether the lock is stale: left
+// behind by a process that is no longer running, e.g. after a crash.
+func LockStatus(repoPath string) (pid int, stale bool) {
+	repoPath = path.Clean(repoPath)
+
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	pid, alive := lockfile.Owner(repoPath)
+	return pid, pid != 0 && !alive
+}
+
+// ReclaimLock removes a stale lock of the repo at repoPath, after which the
+// repo can be opened again. It fails, leaving the lock alone, unless the
+// lock is stale as reported by LockStatus.
+func ReclaimLock(repoPath string) error {
+	repoPath = path.Clean(repoPath)
+
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if openersCounter.NumOpeners(repoPath) != 0 {
+		return errors.New("repo in use")
+	}
+	return lockfile.Reclaim(repoPath)
+}
+
 // LockedByOtherProcess returns true if the FSRepo is locked by another
-// process. If true, then the repo cannot be opened by this process.
+// process. If true, then the repo cannot be opened by this process. A stale
+// lock, see LockStatus, is not held by any process.
 func LockedByOtherProcess(repoPath string) bool {
 	repoPath = path.Clean(repoPath)
 
@@ -134,7 +180,7 @@ func LockedByOtherProcess(repoPath string) bool {
 	defer packageLock.Unlock()
 
 	// NB: the lock is only held when repos are Open
-	return lockfile.Locked(repoPath) && openersCounter.NumOpeners(repoPath) == 0
+	return lockfile.Locked(repoPath) && !lockfile.Stale(repoPath) && openersCounter.NumOpeners(repoPath) == 0
 }
 
 // Open returns an error if the repo is not initialized.
@@ -159,14 +205,19 @@ func (r *FSRepo) Open() error {
 		return debugerror.New("ipfs not initialized, please run 'ipfs init'")
 	}
 	// check repo path, then check all constituent parts.
-	// TODO acquire repo lock
 	// TODO if err := initCheckDir(logpath); err != nil { // }
 	if err := dir.Writable(r.path); err != nil {
 		return err
 	}
 
+	// the lock is taken first, so that a running daemon is reported as such
+	// instead of by the datastore failing to open
+	if err := r.acquireLock(); err != nil {
+		return err
+	}
 	for _, b := range componentBuilders() {
 		if err := b.OpenHandler(r); err != nil {
+			r.releaseLock()
 			return err
 		}
 	}
@@ -243,6 +294,27 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 	return r.configComponent.SetConfigKey(key, value)
 }
 
+// Version returns the version of the repo format, as recorded in the
+// version file. Repos without one predate it, and are version 1.
+func (r *FSRepo) Version() (int, error) {
+	b, err := ioutil.ReadFile(path.Join(r.path, VersionFile))
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, debugerror.Errorf("invalid repo version file: %s", err)
+	}
+	return v, nil
+}
+
+func writeVersion(repoPath string, v int) error {
+	return ioutil.WriteFile(path.Join(repoPath, VersionFile), []byte(strconv.Itoa(v)+"\n"), 0644)
+}
+
 // Datastore returns a repo-owned datastore. If FSRepo is Closed, return value
 // is undefined.
 func (r *FSRepo) Datastore() ds.ThreadSafeDatastore {
@@ -254,6 +326,7 @@ func (r *FSRepo) Datastore() ds.ThreadSafeDatastore {
 
 var _ io.Closer = &FSRepo{}
 var _ repo.Repo = &FSRepo{}
+var _ repo.Versioned = &FSRepo{}
 
 // IsInitialized returns true if the repo is initialized at provided |path|.
 func IsInitialized(path string) bool {
@@ -278,17 +351,42 @@ func isInitializedUnsynced(path string) bool {
 	return true
 }
 
-// transitionToOpened manages the state transition to |opened|. Caller must hold
-// the package mutex.
+// acquireLock takes the repo lock, unless the repo is open already. Caller
+// must hold the package mutex.
+func (r *FSRepo) acquireLock() error {
+	if openersCounter.NumOpeners(r.path) > 0 {
+		return nil
+	}
+	closer, err := lockfile.Lock(r.path)
+	switch err {
+	case nil:
+	case lockfile.ErrLocked:
+		return ErrRepoLocked
+	case lockfile.ErrStale:
+		return ErrStaleLock
+	default:
+		return err
+	}
+	lockfiles[r.path] = closer
+	return nil
+}
+
+// releaseLock releases the lock taken by acquireLock, unless the repo is
+// open. Caller must hold the package mutex.
+func (r *FSRepo) releaseLock() {
+	if openersCounter.NumOpeners(r.path) > 0 {
+		return
+	}
+	if closer, ok := lockfiles[r.path]; ok {
+		closer.Close()
+		delete(lockfiles, r.path)
+	}
+}
+
+// transitionToOpened manages the state transition to |opened|. The repo
+// lock must be held already. Caller must hold the package mutex.
 func (r *FSRepo) transitionToOpened() error {
 	r.state = opened
-	if countBefore := openersCounter.NumOpeners(r.path); countBefore == 0 { // #first
-		closer, err := lockfile.Lock(r.path)
-		if err != nil {
-			return err
-		}
-		lockfiles[r.path] = closer
-	}
 	return openersCounter.AddOpener(r.path)
 }
 
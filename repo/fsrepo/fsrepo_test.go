@@ -3,10 +3,14 @@ package fsrepo
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	datastore "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/jbenet/go-ipfs/repo"
 	"github.com/jbenet/go-ipfs/repo/config"
+	lockfile "github.com/jbenet/go-ipfs/repo/fsrepo/lock"
 	"github.com/jbenet/go-ipfs/thirdparty/assert"
 )
 
@@ -139,3 +143,51 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestOpenStaleLock(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("TestOpenStaleLock", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+
+	// as left behind by a crashed daemon
+	assert.Nil(ioutil.WriteFile(filepath.Join(path, lockfile.LockFile), []byte("{}"), 0644), t)
+	assert.Nil(ioutil.WriteFile(filepath.Join(path, lockfile.PIDFile), []byte("1073741824"), 0644), t)
+
+	pid, stale := LockStatus(path)
+	assert.True(stale, t, "lock should be stale")
+	if pid != 1073741824 {
+		t.Fatalf("expected lock owner 1073741824, got %d", pid)
+	}
+	assert.False(LockedByOtherProcess(path), t, "a stale lock is not held by another process")
+	assert.Err(At(path).Open(), t, "should not open with a stale lock")
+	assert.True(At(path).Open() == ErrStaleLock, t, "should fail with ErrStaleLock")
+
+	assert.Nil(ReclaimLock(path), t, "should reclaim a stale lock")
+	r := At(path)
+	assert.Nil(r.Open(), t, "should open after reclaiming the lock")
+	assert.Err(ReclaimLock(path), t, "should not reclaim the lock of an open repo")
+	assert.Nil(r.Close(), t)
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("TestVersion", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+
+	v, err := At(path).Version()
+	assert.Nil(err, t)
+	assert.True(v == repo.CurrentVersion, t, "initialized repo should have the current version")
+	assert.Nil(repo.CheckVersion(At(path)), t)
+
+	assert.Nil(ioutil.WriteFile(filepath.Join(path, VersionFile), []byte("2\n"), 0644), t)
+	err = repo.CheckVersion(At(path))
+	if nm, ok := err.(*repo.ErrNeedsMigration); !ok || nm.From != 2 || nm.To != repo.CurrentVersion {
+		t.Fatalf("expected ErrNeedsMigration from version 2, got %v", err)
+	}
+
+	// repos initialized before the version file was introduced
+	assert.Nil(os.Remove(filepath.Join(path, VersionFile)), t)
+	v, err = At(path).Version()
+	assert.Nil(err, t)
+	assert.True(v == 1, t, "repo without version file should be version 1")
+}
@@ -1,21 +1,72 @@
 package lock
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
+	"os"
 	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 
 	lock "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/camlistore/lock"
 	"github.com/jbenet/go-ipfs/util"
 	"github.com/jbenet/go-ipfs/util/debugerror"
 )
 
+var log = util.Logger("lock")
+
 // LockFile is the filename of the daemon lock, relative to config dir
 // TODO rename repo lock and hide name
 const LockFile = "daemon.lock"
 
+// PIDFile is the filename, relative to config dir, holding the PID of the
+// process that holds the lock
+const PIDFile = "daemon.pid"
+
+var (
+	// ErrLocked is returned by Lock when another process holds the lock.
+	ErrLocked = errors.New("lock is held by another process")
+
+	// ErrStale is returned by Lock when the lock was left behind by a
+	// process that is no longer running, and cannot be taken over. Reclaim
+	// removes it.
+	ErrStale = errors.New("lock was left behind by a process that is no longer running")
+
+	// ErrNotStale is returned by Reclaim when there is no stale lock.
+	ErrNotStale = errors.New("lock is not stale")
+)
+
+// Lock takes the lock of the repo at confdir, recording the PID of this
+// process next to it. Only the lock itself tells whether the repo is in use:
+// a PID left behind by a crashed process does not keep it from being taken.
 func Lock(confdir string) (io.Closer, error) {
-	c, err := lock.Lock(path.Join(confdir, LockFile))
-	return c, debugerror.Wrap(err)
+	lockPath := path.Join(confdir, LockFile)
+	if Stale(confdir) {
+		// a lock file with content is refused by the locking, which would
+		// then keep failing within this process even once it is reclaimed
+		if fi, err := os.Stat(lockPath); err == nil && fi.Size() > 0 {
+			return nil, ErrStale
+		}
+	}
+
+	c, err := lock.Lock(lockPath)
+	if err != nil {
+		if !util.FileExists(lockPath) {
+			return nil, debugerror.Wrap(err)
+		}
+		return nil, ErrLocked
+	}
+
+	pidPath := path.Join(confdir, PIDFile)
+	if err := ioutil.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		c.Close()
+		return nil, debugerror.Wrap(err)
+	}
+	return &pidLock{lock: c, pidPath: pidPath}, nil
 }
 
 func Locked(confdir string) bool {
@@ -29,3 +80,93 @@ func Locked(confdir string) bool {
 		return false
 	}
 }
+
+// Owner returns the PID of the process that took the lock of the repo at
+// confdir, and whether that process is still running. The PID is zero if
+// it is not known, e.g. because the repo is not locked. It is only a hint:
+// the PID of a crashed process may since have been reused.
+func Owner(confdir string) (pid int, alive bool) {
+	if !util.FileExists(path.Join(confdir, LockFile)) {
+		return 0, false
+	}
+	pid = readPID(confdir)
+	if pid == 0 {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+// Stale reports whether the lock of the repo at confdir was left behind by
+// a process that is no longer running, e.g. after a crash.
+func Stale(confdir string) bool {
+	pid, alive := Owner(confdir)
+	return pid != 0 && !alive
+}
+
+// Reclaim removes a stale lock of the repo at confdir, so that it can be
+// locked again. It fails with ErrNotStale, leaving the lock alone, unless
+// Stale reports the lock as stale.
+func Reclaim(confdir string) error {
+	if !Stale(confdir) {
+		return ErrNotStale
+	}
+	if err := os.Remove(path.Join(confdir, LockFile)); err != nil {
+		return debugerror.Wrap(err)
+	}
+	if err := os.Remove(path.Join(confdir, PIDFile)); err != nil && !os.IsNotExist(err) {
+		return debugerror.Wrap(err)
+	}
+	return nil
+}
+
+// readPID returns the PID recorded in the PID file, or in the lock file as
+// written by the portable lock implementation, or zero.
+func readPID(confdir string) int {
+	if b, err := ioutil.ReadFile(path.Join(confdir, PIDFile)); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil && pid > 0 {
+			return pid
+		}
+	}
+
+	var meta struct {
+		OwnerPID int
+	}
+	b, err := ioutil.ReadFile(path.Join(confdir, LockFile))
+	if err != nil || len(b) == 0 {
+		return 0
+	}
+	if err := json.Unmarshal(b, &meta); err != nil || meta.OwnerPID < 0 {
+		return 0
+	}
+	return meta.OwnerPID
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// finding the process already failed if it is gone
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	// EPERM: running, but owned by another user
+	return err == nil || err == syscall.EPERM
+}
+
+// pidLock removes the PID file before releasing the lock.
+type pidLock struct {
+	lock    io.Closer
+	pidPath string
+}
+
+func (pl *pidLock) Close() error {
+	if err := os.Remove(pl.pidPath); err != nil && !os.IsNotExist(err) {
+		log.Debugf("removing lock PID file: %s", err)
+	}
+	return pl.lock.Close()
+}
@@ -0,0 +1,121 @@
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+// deadPID is above the largest PID Linux hands out
+const deadPID = 1 << 30
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLockRecordsPID(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	lk, err := Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, alive := Owner(dir); pid != os.Getpid() || !alive {
+		t.Fatalf("owner is %d (alive: %t), expected this process (%d)", pid, alive, os.Getpid())
+	}
+	if Stale(dir) {
+		t.Fatal("lock held by this process reported as stale")
+	}
+	if err := Reclaim(dir); err != ErrNotStale {
+		t.Fatalf("reclaiming a held lock: expected ErrNotStale, got %v", err)
+	}
+
+	if err := lk.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dir, PIDFile)); !os.IsNotExist(err) {
+		t.Fatal("PID file left behind after unlocking")
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// as left behind by a crashed process
+	if err := ioutil.WriteFile(path.Join(dir, LockFile), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, PIDFile), []byte(strconv.Itoa(deadPID)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if pid, alive := Owner(dir); pid != deadPID || alive {
+		t.Fatalf("owner is %d (alive: %t), expected %d, not running", pid, alive, deadPID)
+	}
+	if !Stale(dir) {
+		t.Fatal("lock not reported as stale")
+	}
+	if _, err := Lock(dir); err != ErrStale {
+		t.Fatalf("expected ErrStale, got %v", err)
+	}
+
+	if err := Reclaim(dir); err != nil {
+		t.Fatal(err)
+	}
+	if Stale(dir) {
+		t.Fatal("lock still stale after reclaiming it")
+	}
+	lk, err := Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lk.Close()
+}
+
+func TestOwnerFromLockFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// the portable lock implementation records the owner in the lock file
+	data := []byte(`{"OwnerPID":` + strconv.Itoa(deadPID) + `}`)
+	if err := ioutil.WriteFile(path.Join(dir, LockFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, _ := Owner(dir); pid != deadPID {
+		t.Fatalf("expected owner %d, got %d", deadPID, pid)
+	}
+	if !Stale(dir) {
+		t.Fatal("lock not reported as stale")
+	}
+}
+
+func TestLockWithReusedPID(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// as left behind by a crashed process whose PID was handed out again:
+	// the lock itself is free
+	if err := ioutil.WriteFile(path.Join(dir, LockFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, PIDFile), []byte(strconv.Itoa(os.Getppid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lk, err := Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lk.Close()
+	if pid, _ := Owner(dir); pid != os.Getpid() {
+		t.Fatalf("expected the PID file to name this process (%d), got %d", os.Getpid(), pid)
+	}
+}
@@ -1,17 +1,26 @@
 package fsrepo
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	config "github.com/jbenet/go-ipfs/repo/config"
 )
 
 func TestConfig(t *testing.T) {
-	const filename = ".ipfsconfig"
+	dir, err := ioutil.TempDir("", "serialize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, ".ipfsconfig")
 	const dsPath = "/path/to/datastore"
 	cfgWritten := new(config.Config)
 	cfgWritten.Datastore.Path = dsPath
-	err := WriteConfigFile(filename, cfgWritten)
+	err = WriteConfigFile(filename, cfgWritten)
 	if err != nil {
 		t.Error(err)
 	}
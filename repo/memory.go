@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"io/ioutil"
+	"strconv"
+	"sync"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	syncds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	common "github.com/jbenet/go-ipfs/repo/common"
+	config "github.com/jbenet/go-ipfs/repo/config"
+	ds2 "github.com/jbenet/go-ipfs/util/datastore2"
+)
+
+// Memory is a repo keeping its config and datastore in memory, for tests and
+// ephemeral nodes. Nothing of it outlives the process. It is safe for
+// concurrent use.
+type Memory struct {
+	lk sync.Mutex
+	c  config.Config
+	d  ds2.ThreadSafeDatastoreCloser
+}
+
+// NewMemory returns a Memory repo with a freshly generated identity, using a
+// key of the given size, and the default config otherwise. Unlike with the
+// default config, the node built on it listens on a random port, and has no
+// bootstrap peers.
+func NewMemory(nBitsForKeypair int) (*Memory, error) {
+	c, err := config.Init(ioutil.Discard, nBitsForKeypair)
+	if err != nil {
+		return nil, err
+	}
+	c.Datastore = config.Datastore{Type: "memory"}
+	c.Addresses.Swarm = []string{"/ip4/0.0.0.0/tcp/0"}
+	c.Bootstrap = nil
+	return &Memory{c: *c, d: ds2.CloserWrap(syncds.MutexWrap(ds.NewMapDatastore()))}, nil
+}
+
+func (m *Memory) Config() *config.Config {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return &m.c
+}
+
+func (m *Memory) SetConfig(updated *config.Config) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.c = *updated
+	return nil
+}
+
+// GetConfigKey retrieves only the value of a particular key, like
+// fsrepo.FSRepo does.
+func (m *Memory) GetConfigKey(key string) (interface{}, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	mapconf, err := config.ToMap(&m.c)
+	if err != nil {
+		return nil, err
+	}
+	return common.MapGetKV(mapconf, key)
+}
+
+// SetConfigKey writes the value of a particular key, like fsrepo.FSRepo
+// does.
+func (m *Memory) SetConfigKey(key string, value interface{}) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if v, ok := value.(string); ok {
+		if i, err := strconv.Atoi(v); err == nil {
+			value = i
+		}
+	}
+	mapconf, err := config.ToMap(&m.c)
+	if err != nil {
+		return err
+	}
+	if err := common.MapSetKV(mapconf, key, value); err != nil {
+		return err
+	}
+	conf, err := config.FromMap(mapconf)
+	if err != nil {
+		return err
+	}
+	m.c = *conf
+	return nil
+}
+
+func (m *Memory) Datastore() ds.ThreadSafeDatastore { return m.d }
+
+// Version always returns CurrentVersion.
+func (m *Memory) Version() (int, error) { return CurrentVersion, nil }
+
+func (m *Memory) Close() error { return m.d.Close() }
+
+var _ Repo = &Memory{}
+var _ Versioned = &Memory{}
@@ -0,0 +1,28 @@
+package repo
+
+import "testing"
+
+func TestMemoryConfigKeys(t *testing.T) {
+	r, err := NewMemory(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Config().Identity.PeerID == "" {
+		t.Fatal("no identity generated")
+	}
+	if err := r.SetConfigKey("ConnMgr.HighWater", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if hw := r.Config().ConnMgr.HighWater; hw != 10 {
+		t.Fatalf("expected ConnMgr.HighWater 10, got %d", hw)
+	}
+	v, err := r.GetConfigKey("Datastore.Type")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "memory" {
+		t.Fatalf("expected Datastore.Type memory, got %v", v)
+	}
+}
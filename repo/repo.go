@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"fmt"
 	"io"
 
 	datastore "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
@@ -20,6 +21,44 @@ type Repo interface {
 	io.Closer
 }
 
+// CurrentVersion is the version of the repo format this package reads and
+// writes.
+const CurrentVersion = 1
+
+// Versioned is implemented by repos that record the version of their format.
+type Versioned interface {
+	// Version returns the version of the format of the repo.
+	Version() (int, error)
+}
+
+// ErrNeedsMigration is returned for repos whose format is not
+// CurrentVersion. They have to be migrated from one version to the other
+// before they can be used.
+type ErrNeedsMigration struct {
+	From, To int
+}
+
+func (e *ErrNeedsMigration) Error() string {
+	return fmt.Sprintf("repo needs migration from version %d to version %d", e.From, e.To)
+}
+
+// CheckVersion returns an ErrNeedsMigration if r is Versioned, and its
+// version is not CurrentVersion.
+func CheckVersion(r Repo) error {
+	vr, ok := r.(Versioned)
+	if !ok {
+		return nil
+	}
+	v, err := vr.Version()
+	if err != nil {
+		return err
+	}
+	if v != CurrentVersion {
+		return &ErrNeedsMigration{From: v, To: CurrentVersion}
+	}
+	return nil
+}
+
 // IsInitialized returns true if the path is home to an initialized IPFS
 // repository.
 func IsInitialized(path string) bool {
@@ -0,0 +1,59 @@
+// package nilrouting implements a routing system that does not route: it
+// finds nothing and stores nothing. It lets a node run online, talking to
+// peers it was connected to explicitly, without joining a DHT.
+package nilrouting
+
+import (
+	"errors"
+	"time"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	p2phost "github.com/jbenet/go-ipfs/p2p/host"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	routing "github.com/jbenet/go-ipfs/routing"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// ErrNoRouting is returned by operations that need a working routing system.
+var ErrNoRouting = errors.New("routing disabled")
+
+type nilclient struct{}
+
+// ConstructNilRouting returns a routing system in which every lookup fails
+// with routing.ErrNotFound and every announcement is dropped.
+func ConstructNilRouting(ctx context.Context, host p2phost.Host, d ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
+	return &nilclient{}, nil
+}
+
+func (c *nilclient) PutValue(_ context.Context, _ u.Key, _ []byte) error {
+	return nil
+}
+
+func (c *nilclient) GetValue(_ context.Context, _ u.Key) ([]byte, error) {
+	return nil, routing.ErrNotFound
+}
+
+func (c *nilclient) FindPeer(_ context.Context, _ peer.ID) (peer.PeerInfo, error) {
+	return peer.PeerInfo{}, routing.ErrNotFound
+}
+
+func (c *nilclient) FindProvidersAsync(_ context.Context, _ u.Key, _ int) <-chan peer.PeerInfo {
+	out := make(chan peer.PeerInfo)
+	close(out)
+	return out
+}
+
+func (c *nilclient) Provide(_ context.Context, _ u.Key) error {
+	return nil
+}
+
+func (c *nilclient) Ping(_ context.Context, _ peer.ID) (time.Duration, error) {
+	return 0, ErrNoRouting
+}
+
+func (c *nilclient) Bootstrap(_ context.Context) error {
+	return nil
+}
+
+var _ routing.IpfsRouting = &nilclient{}
@@ -0,0 +1,192 @@
+// package tiered implements a routing system that combines several others,
+// preferring them in the order given.
+package tiered
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	routing "github.com/jbenet/go-ipfs/routing"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+var log = eventlog.Logger("tieredrouting")
+
+// ErrNoRouters is returned when a Tiered router has no routers to ask.
+var ErrNoRouters = errors.New("tiered routing: no routers")
+
+// Tiered is a routing system made of several others. Lookups ask each router
+// in turn and return the first answer, while announcements go to all of
+// them.
+type Tiered []routing.IpfsRouting
+
+var _ routing.IpfsRouting = Tiered{}
+
+// PutValue stores the value in all routers. It only fails if all of them do.
+func (t Tiered) PutValue(ctx context.Context, key u.Key, val []byte) error {
+	return t.all(func(r routing.IpfsRouting) error {
+		return r.PutValue(ctx, key, val)
+	})
+}
+
+// GetValue returns the value from the first router that has it.
+func (t Tiered) GetValue(ctx context.Context, key u.Key) ([]byte, error) {
+	var val []byte
+	err := t.first(func(r routing.IpfsRouting) error {
+		var err error
+		val, err = r.GetValue(ctx, key)
+		return err
+	})
+	return val, err
+}
+
+// Provide announces the key to all routers. It only fails if all of them do.
+func (t Tiered) Provide(ctx context.Context, key u.Key) error {
+	return t.all(func(r routing.IpfsRouting) error {
+		return r.Provide(ctx, key)
+	})
+}
+
+// FindProvidersAsync asks all routers for providers at once, returning up to
+// count distinct ones.
+func (t Tiered) FindProvidersAsync(ctx context.Context, key u.Key, count int) <-chan peer.PeerInfo {
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan peer.PeerInfo)
+
+	merged := make(chan peer.PeerInfo)
+	var wg sync.WaitGroup
+	for _, r := range t {
+		wg.Add(1)
+		go func(r routing.IpfsRouting) {
+			defer wg.Done()
+			for pi := range r.FindProvidersAsync(ctx, key, count) {
+				select {
+				case merged <- pi:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(r)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		seen := make(map[peer.ID]struct{})
+		for pi := range merged {
+			if _, ok := seen[pi.ID]; ok {
+				continue
+			}
+			seen[pi.ID] = struct{}{}
+
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+				return
+			}
+			if len(seen) >= count {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FindPeer returns the peer info from the first router that finds the peer.
+func (t Tiered) FindPeer(ctx context.Context, p peer.ID) (peer.PeerInfo, error) {
+	var pi peer.PeerInfo
+	err := t.first(func(r routing.IpfsRouting) error {
+		var err error
+		pi, err = r.FindPeer(ctx, p)
+		return err
+	})
+	return pi, err
+}
+
+// Ping pings the peer through the first router able to.
+func (t Tiered) Ping(ctx context.Context, p peer.ID) (time.Duration, error) {
+	var d time.Duration
+	err := t.first(func(r routing.IpfsRouting) error {
+		var err error
+		d, err = r.Ping(ctx, p)
+		return err
+	})
+	return d, err
+}
+
+// Bootstrap bootstraps all routers. It only fails if all of them do.
+func (t Tiered) Bootstrap(ctx context.Context) error {
+	return t.all(func(r routing.IpfsRouting) error {
+		return r.Bootstrap(ctx)
+	})
+}
+
+// Close closes the routers that can be closed, returning the first error.
+func (t Tiered) Close() error {
+	var firstErr error
+	for _, r := range t {
+		c, ok := r.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// first calls f on each router in order until one succeeds. It returns the
+// last error if none does.
+func (t Tiered) first(f func(routing.IpfsRouting) error) error {
+	err := ErrNoRouters
+	for _, r := range t {
+		if err = f(r); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// all calls f on all routers concurrently. It returns nil if any call
+// succeeds, the first error otherwise.
+func (t Tiered) all(f func(routing.IpfsRouting) error) error {
+	if len(t) == 0 {
+		return ErrNoRouters
+	}
+
+	errs := make(chan error, len(t))
+	for _, r := range t {
+		go func(r routing.IpfsRouting) {
+			errs <- f(r)
+		}(r)
+	}
+
+	var firstErr error
+	succeeded := false
+	for range t {
+		err := <-errs
+		if err == nil {
+			succeeded = true
+			continue
+		}
+		log.Debugf("tiered routing: %s", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if succeeded {
+		return nil
+	}
+	return firstErr
+}
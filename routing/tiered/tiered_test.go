@@ -0,0 +1,125 @@
+package tiered
+
+import (
+	"errors"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	peer "github.com/jbenet/go-ipfs/p2p/peer"
+	routing "github.com/jbenet/go-ipfs/routing"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// mapRouter serves values and providers from maps, and fails for anything
+// it doesn't know.
+type mapRouter struct {
+	routing.IpfsRouting
+	values    map[u.Key][]byte
+	providers []peer.PeerInfo
+	putErr    error
+}
+
+func newMapRouter() *mapRouter {
+	return &mapRouter{values: make(map[u.Key][]byte)}
+}
+
+func (m *mapRouter) GetValue(ctx context.Context, k u.Key) ([]byte, error) {
+	v, ok := m.values[k]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return v, nil
+}
+
+func (m *mapRouter) PutValue(ctx context.Context, k u.Key, v []byte) error {
+	if m.putErr != nil {
+		return m.putErr
+	}
+	m.values[k] = v
+	return nil
+}
+
+func (m *mapRouter) FindProvidersAsync(ctx context.Context, k u.Key, count int) <-chan peer.PeerInfo {
+	out := make(chan peer.PeerInfo, len(m.providers))
+	for _, pi := range m.providers {
+		out <- pi
+	}
+	close(out)
+	return out
+}
+
+func TestGetValueFallsBack(t *testing.T) {
+	ctx := context.Background()
+	first, second := newMapRouter(), newMapRouter()
+	second.values["fallback"] = []byte("second")
+	first.values["both"] = []byte("first")
+	second.values["both"] = []byte("second")
+
+	tr := Tiered{first, second}
+
+	v, err := tr.GetValue(ctx, "fallback")
+	if err != nil || string(v) != "second" {
+		t.Fatalf("expected the fallback value, got %q, %v", v, err)
+	}
+	v, err = tr.GetValue(ctx, "both")
+	if err != nil || string(v) != "first" {
+		t.Fatalf("expected the first router's value, got %q, %v", v, err)
+	}
+	if _, err := tr.GetValue(ctx, "none"); err != routing.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := (Tiered{}).GetValue(ctx, "none"); err != ErrNoRouters {
+		t.Fatalf("expected ErrNoRouters, got %v", err)
+	}
+}
+
+func TestPutValueFansOut(t *testing.T) {
+	ctx := context.Background()
+	first, second := newMapRouter(), newMapRouter()
+	tr := Tiered{first, second}
+
+	if err := tr.PutValue(ctx, "k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if string(first.values["k"]) != "v" || string(second.values["k"]) != "v" {
+		t.Fatal("value not stored in all routers")
+	}
+
+	// one router failing is fine, all of them failing is not
+	first.putErr = errors.New("put failed")
+	if err := tr.PutValue(ctx, "k2", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	second.putErr = first.putErr
+	if err := tr.PutValue(ctx, "k3", []byte("v")); err != first.putErr {
+		t.Fatalf("expected the put error, got %v", err)
+	}
+}
+
+func TestFindProvidersMerges(t *testing.T) {
+	first, second := newMapRouter(), newMapRouter()
+	first.providers = []peer.PeerInfo{{ID: "a"}, {ID: "b"}}
+	second.providers = []peer.PeerInfo{{ID: "b"}, {ID: "c"}}
+	tr := Tiered{first, second}
+
+	seen := make(map[peer.ID]int)
+	for pi := range tr.FindProvidersAsync(context.Background(), "k", 10) {
+		seen[pi.ID]++
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected three providers, got %v", seen)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Fatalf("provider %s returned %d times", id, n)
+		}
+	}
+
+	n := 0
+	for _ = range tr.FindProvidersAsync(context.Background(), "k", 2) {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected the provider count to be limited, got %d", n)
+	}
+}
@@ -25,12 +25,12 @@ type ipfsHandler struct {
 }
 
 func (i *ipfsHandler) ResolvePath(fpath string) (*dag.Node, error) {
-	return i.node.Resolver.ResolvePath(path.Path(fpath))
+	return i.node.Resolver.ResolvePath(context.TODO(), path.Path(fpath))
 }
 
 func (i *ipfsHandler) NewDagFromReader(r io.Reader) (*dag.Node, error) {
 	return importer.BuildDagFromReader(
-		r, i.node.DAG, i.node.Pinning.GetManual(), chunk.DefaultSplitter)
+		r, i.node.DAG, i.node.Pinning.GetManual(), i.node.CapSplitter(chunk.DefaultSplitter))
 }
 
 func (i *ipfsHandler) AddNodeToDAG(nd *dag.Node) (u.Key, error) {
@@ -28,12 +28,18 @@ func (e *entry) log() {
 		accum = DeepMerge(accum, loggable.Loggable())
 	}
 
-	// apply final attributes to reserved keys
+	now := time.Now()
+	notify(Event{System: e.system, Name: e.event, Time: now, Metadata: accum})
+
+	// apply final attributes to reserved keys, on a copy since the
+	// observers may keep accum
 	// TODO accum["level"] = level
-	accum["event"] = e.event
-	accum["system"] = e.system
-	accum["time"] = util.FormatRFC3339(time.Now())
+	fields := DeepMerge(accum, Metadata{
+		"event":  e.event,
+		"system": e.system,
+		"time":   util.FormatRFC3339(now),
+	})
 
 	// TODO roll our own event logger
-	logrus.WithFields(map[string]interface{}(accum)).Info(e.event)
+	logrus.WithFields(map[string]interface{}(fields)).Info(e.event)
 }
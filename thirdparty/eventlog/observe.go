@@ -0,0 +1,72 @@
+package eventlog
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is an event logged by an EventLogger, as passed to observers.
+type Event struct {
+	System string    // the system of the logger, e.g. "bitswap"
+	Name   string    // the name of the event, e.g. "GetBlockRequest"
+	Time   time.Time // when the event was logged
+
+	// Metadata holds the loggables of the event merged together, e.g. the
+	// "key" of a block or the "peerID" of a peer. Events ending an
+	// EventBegin also hold its "duration", a time.Duration.
+	Metadata Metadata
+}
+
+// Observer is called with the events logged, see Observe.
+type Observer func(Event)
+
+var observers struct {
+	sync.Mutex
+	next int
+	m    map[int]Observer
+}
+
+// Observe calls o with every event logged from now on, whatever the log
+// level, until the returned function is called. It lets events be sent
+// elsewhere than the log output, e.g. to a metrics system.
+//
+// o is called synchronously by the goroutine logging the event, so it must
+// return quickly. It must not modify the Metadata of the events, which is
+// shared with the other observers.
+func Observe(o Observer) (stop func()) {
+	observers.Lock()
+	defer observers.Unlock()
+	if observers.m == nil {
+		observers.m = make(map[int]Observer)
+	}
+	id := observers.next
+	observers.next++
+	observers.m[id] = o
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			observers.Lock()
+			delete(observers.m, id)
+			observers.Unlock()
+		})
+	}
+}
+
+// notify passes e to the observers, if any.
+func notify(e Event) {
+	observers.Lock()
+	if len(observers.m) == 0 {
+		observers.Unlock()
+		return
+	}
+	obs := make([]Observer, 0, len(observers.m))
+	for _, o := range observers.m {
+		obs = append(obs, o)
+	}
+	observers.Unlock()
+
+	for _, o := range obs {
+		o(e)
+	}
+}
@@ -0,0 +1,52 @@
+package eventlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestObserve(t *testing.T) {
+	var events []Event
+	stop := Observe(func(e Event) {
+		if e.System == "observetest" {
+			events = append(events, e)
+		}
+	})
+
+	log := Logger("observetest")
+	ctx := ContextWithLoggable(context.Background(), Metadata{"request": "r1"})
+	e := log.EventBegin(ctx, "fetch", LoggableMap{"key": "k1"})
+	e.Append(LoggableMap{"peerID": "p1"})
+	e.Done()
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Name != "fetchBegin" || events[1].Name != "fetch" {
+		t.Fatalf("wrong event names: %s, %s", events[0].Name, events[1].Name)
+	}
+
+	done := events[1]
+	if done.Time.IsZero() {
+		t.Fatal("event has no time")
+	}
+	for k, v := range map[string]string{"request": "r1", "key": "k1", "peerID": "p1"} {
+		if done.Metadata[k] != v {
+			t.Fatalf("expected %s=%s in the metadata, got %v", k, v, done.Metadata[k])
+		}
+	}
+	if _, ok := done.Metadata["duration"].(time.Duration); !ok {
+		t.Fatalf("expected a duration in the metadata, got %v", done.Metadata["duration"])
+	}
+	if _, ok := done.Metadata["event"]; ok {
+		t.Fatal("reserved keys should not be in the metadata")
+	}
+
+	stop()
+	log.Event(ctx, "afterStop")
+	if len(events) != 2 {
+		t.Fatal("observer called after being stopped")
+	}
+}
@@ -55,6 +55,16 @@ func FolderPBData() []byte {
 	return data
 }
 
+// SymlinkData returns the bytes of a node representing a symlink to path
+func SymlinkData(path string) ([]byte, error) {
+	pbdata := new(pb.Data)
+	typ := pb.Data_Symlink
+	pbdata.Data = []byte(path)
+	pbdata.Type = &typ
+
+	return proto.Marshal(pbdata)
+}
+
 func WrapData(b []byte) []byte {
 	pbdata := new(pb.Data)
 	typ := pb.Data_Raw
@@ -104,11 +114,40 @@ type MultiBlock struct {
 	subtotal   uint64
 }
 
+// MultiBlockFromBytes returns the MultiBlock of the file node whose data is
+// given, to add more blocks to it.
+func MultiBlockFromBytes(data []byte) (*MultiBlock, error) {
+	pbdata, err := FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pbdata.GetType() {
+	case pb.Data_File, pb.Data_Raw:
+	case pb.Data_Directory:
+		return nil, ErrInvalidDirLocation
+	default:
+		return nil, ErrUnrecognizedType
+	}
+
+	mb := &MultiBlock{Data: pbdata.GetData()}
+	for _, s := range pbdata.Blocksizes {
+		mb.AddBlockSize(s)
+	}
+	return mb, nil
+}
+
 func (mb *MultiBlock) AddBlockSize(s uint64) {
 	mb.subtotal += s
 	mb.blocksizes = append(mb.blocksizes, s)
 }
 
+// RemoveBlockSize removes the size of the i-th block.
+func (mb *MultiBlock) RemoveBlockSize(i int) {
+	mb.subtotal -= mb.blocksizes[i]
+	mb.blocksizes = append(mb.blocksizes[:i], mb.blocksizes[i+1:]...)
+}
+
 func (mb *MultiBlock) GetBytes() ([]byte, error) {
 	pbn := new(pb.Data)
 	t := pb.Data_File
@@ -0,0 +1,37 @@
+package io
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// DetectContentType determines the MIME type of the file read by dr from its
+// first bytes, as http.DetectContentType does. If those are inconclusive, the
+// MIME type stored in the file's metadata is used, if any. The returned
+// reader yields the whole file, including the bytes read for sniffing; it
+// should be used instead of dr afterwards.
+func DetectContentType(dr *DagReader) (string, io.Reader, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(dr, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	buf = buf[:n]
+	r := io.MultiReader(bytes.NewReader(buf), dr)
+
+	ctype := http.DetectContentType(buf)
+	if ctype == "application/octet-stream" {
+		md, err := dr.Metadata()
+		if err != nil {
+			return "", nil, err
+		}
+		if md.GetMimeType() != "" {
+			ctype = md.GetMimeType()
+		}
+	}
+	return ctype, r, nil
+}
@@ -3,17 +3,23 @@ package io
 import (
 	"bytes"
 	"errors"
+	"os"
 
 	proto "github.com/jbenet/go-ipfs/Godeps/_workspace/src/code.google.com/p/goprotobuf/proto"
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	balanced "github.com/jbenet/go-ipfs/importer/balanced"
 	chunk "github.com/jbenet/go-ipfs/importer/chunk"
+	h "github.com/jbenet/go-ipfs/importer/helpers"
 	mdag "github.com/jbenet/go-ipfs/merkledag"
+	eventlog "github.com/jbenet/go-ipfs/thirdparty/eventlog"
 	ft "github.com/jbenet/go-ipfs/unixfs"
 	ftpb "github.com/jbenet/go-ipfs/unixfs/pb"
-	u "github.com/jbenet/go-ipfs/util"
 )
 
-var log = u.Logger("dagio")
+var log = eventlog.Logger("dagio")
+
+var ErrInvalidOffset = errors.New("invalid offset")
 
 // DagModifier is the only struct licensed and able to correctly
 // perform surgery on a DAG 'file'
@@ -24,6 +30,9 @@ type DagModifier struct {
 
 	pbdata   *ftpb.Data
 	splitter chunk.BlockSplitter
+
+	// current write offset, used by Write and Seek
+	curWrOff int64
 }
 
 func NewDagModifier(from *mdag.Node, serv mdag.DAGService, spl chunk.BlockSplitter) (*DagModifier, error) {
@@ -40,137 +49,334 @@ func NewDagModifier(from *mdag.Node, serv mdag.DAGService, spl chunk.BlockSplitt
 	}, nil
 }
 
-// WriteAt will modify a dag file in place
-// NOTE: it currently assumes only a single level of indirection
-func (dm *DagModifier) WriteAt(b []byte, offset uint64) (int, error) {
+// WriteAt will modify a dag file in place. Only the blocks that overlap the
+// written range are rewritten, all other links are left untouched. Writes
+// that extend past the end of the file append new leaf blocks, and writes
+// starting past the end of the file fill the gap with zeros.
+func (dm *DagModifier) WriteAt(b []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, ErrInvalidOffset
+	}
+	origlen := len(b)
 
-	// Check bounds
-	if dm.pbdata.GetFilesize() < offset {
-		return 0, errors.New("Attempted to perform write starting past end of file")
+	size := dm.pbdata.GetFilesize()
+	start := uint64(offset)
+	if start > size {
+		// Fill the hole between the end of the file and our write
+		b = append(make([]byte, start-size), b...)
+		start = size
 	}
 
-	// First need to find where we are writing at
-	end := uint64(len(b)) + offset
+	// Separate the bytes that overwrite existing data from the ones
+	// that need to be appended to the end of the file
+	var tail []byte
+	if start+uint64(len(b)) > size {
+		tail = b[size-start:]
+		b = b[:size-start]
+	}
 
-	// This shouldnt be necessary if we do subblocks sizes properly
-	newsize := dm.pbdata.GetFilesize()
-	if end > dm.pbdata.GetFilesize() {
-		newsize = end
+	if len(b) > 0 {
+		if err := dm.syncRoot(); err != nil {
+			return 0, err
+		}
+
+		nd, err := dm.overwrite(dm.curNode, start, b)
+		if err != nil {
+			return 0, err
+		}
+
+		pbd, err := ft.FromBytes(nd.Data)
+		if err != nil {
+			return 0, err
+		}
+		dm.curNode = nd
+		dm.pbdata = pbd
+	}
+
+	if len(tail) > 0 {
+		if err := dm.appendData(tail); err != nil {
+			return 0, err
+		}
+	}
+
+	return origlen, nil
+}
+
+// Write writes b at the current write offset, and advances it
+func (dm *DagModifier) Write(b []byte) (int, error) {
+	n, err := dm.WriteAt(b, dm.curWrOff)
+	dm.curWrOff += int64(n)
+	return n, err
+}
+
+// Seek sets the offset used by the next Write, interface matches
+// standard unix seek
+func (dm *DagModifier) Seek(offset int64, whence int) (int64, error) {
+	var noffset int64
+	switch whence {
+	case os.SEEK_SET:
+		noffset = offset
+	case os.SEEK_CUR:
+		noffset = dm.curWrOff + offset
+	case os.SEEK_END:
+		noffset = int64(dm.pbdata.GetFilesize()) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if noffset < 0 {
+		return 0, ErrInvalidOffset
+	}
+	dm.curWrOff = noffset
+	return noffset, nil
+}
+
+// overwrite replaces the data of the file represented by nd, starting at
+// offset, with the given bytes and returns the new node. The write may not
+// extend past the end of nd. Children that do not overlap the written range
+// keep their existing links.
+func (dm *DagModifier) overwrite(nd *mdag.Node, offset uint64, data []byte) (*mdag.Node, error) {
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return nil, err
 	}
-	zeroblocklen := uint64(len(dm.pbdata.Data))
-	origlen := len(b)
 
-	if end <= zeroblocklen {
-		log.Debug("Writing into zero block")
-		// Replacing zeroeth data block (embedded in the root node)
-		//TODO: check chunking here
-		copy(dm.pbdata.Data[offset:], b)
-		return len(b), nil
+	switch pbd.GetType() {
+	case ftpb.Data_File, ftpb.Data_Raw:
+	case ftpb.Data_Directory:
+		return nil, ft.ErrInvalidDirLocation
+	default:
+		return nil, ft.ErrUnrecognizedType
 	}
 
-	// Find where write should start
-	var traversed uint64
-	startsubblk := len(dm.pbdata.Blocksizes)
-	if offset < zeroblocklen {
-		dm.pbdata.Data = dm.pbdata.Data[:offset]
-		startsubblk = 0
+	nd = nd.Copy()
+
+	// Data embedded directly in this node comes first
+	if offset < uint64(len(pbd.Data)) {
+		n := copy(pbd.Data[offset:], data)
+		data = data[n:]
+		offset = 0
 	} else {
-		traversed = uint64(zeroblocklen)
-		for i, size := range dm.pbdata.Blocksizes {
-			if uint64(offset) < traversed+size {
-				log.Debugf("Starting mod at block %d. [%d < %d + %d]", i, offset, traversed, size)
-				// Here is where we start
-				startsubblk = i
-				lnk := dm.curNode.Links[i]
-				node, err := dm.dagserv.Get(u.Key(lnk.Hash))
-				if err != nil {
-					return 0, err
-				}
-				data, err := ft.UnwrapData(node.Data)
-				if err != nil {
-					return 0, err
-				}
+		offset -= uint64(len(pbd.Data))
+	}
 
-				// We have to rewrite the data before our write in this block.
-				b = append(data[:offset-traversed], b...)
-				break
-			}
-			traversed += size
+	for i, bs := range pbd.Blocksizes {
+		if len(data) == 0 {
+			break
 		}
-		if startsubblk == len(dm.pbdata.Blocksizes) {
-			// TODO: Im not sure if theres any case that isnt being handled here.
-			// leaving this note here as a future reference in case something breaks
+		if offset >= bs {
+			offset -= bs
+			continue
 		}
-	}
 
-	// Find blocks that need to be overwritten
-	var changed []int
-	mid := -1
-	var midoff uint64
-	for i, size := range dm.pbdata.Blocksizes[startsubblk:] {
-		if end > traversed {
-			changed = append(changed, i+startsubblk)
-		} else {
-			break
+		n := bs - offset
+		if n > uint64(len(data)) {
+			n = uint64(len(data))
 		}
-		traversed += size
-		if end < traversed {
-			mid = i + startsubblk
-			midoff = end - (traversed - size)
-			break
+
+		child, err := nd.Links[i].GetNode(context.TODO(), dm.dagserv)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	// If our write starts in the middle of a block...
-	var midlnk *mdag.Link
-	if mid >= 0 {
-		midlnk = dm.curNode.Links[mid]
-		midnode, err := dm.dagserv.Get(u.Key(midlnk.Hash))
+		nchild, err := dm.overwrite(child, offset, data[:n])
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
-		// NOTE: this may have to be changed later when we have multiple
-		// layers of indirection
-		data, err := ft.UnwrapData(midnode.Data)
+		lnk, err := dm.addLinkedNode(nchild)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		b = append(b, data[midoff:]...)
+		lnk.Name = nd.Links[i].Name
+		nd.Links[i] = lnk
+
+		data = data[n:]
+		offset = 0
+	}
+
+	if len(data) > 0 {
+		return nil, errors.New("write extends past end of node")
+	}
+
+	nd.Data, err = proto.Marshal(pbd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// Truncate changes the size of the file to the given size. Data past the new
+// end of the file is dropped, and growing the file pads it with zeros.
+func (dm *DagModifier) Truncate(size int64) error {
+	if size < 0 {
+		return ErrInvalidOffset
+	}
+
+	if uint64(size) >= dm.pbdata.GetFilesize() {
+		_, err := dm.WriteAt(nil, size)
+		return err
+	}
+
+	if err := dm.syncRoot(); err != nil {
+		return err
+	}
+
+	nd, err := dm.truncate(dm.curNode, uint64(size))
+	if err != nil {
+		return err
 	}
 
-	// Generate new sub-blocks, and sizes
-	subblocks := splitBytes(b, dm.splitter)
-	var links []*mdag.Link
-	var sizes []uint64
-	for _, sb := range subblocks {
-		n := &mdag.Node{Data: ft.WrapData(sb)}
-		_, err := dm.dagserv.Add(n)
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return err
+	}
+	dm.curNode = nd
+	dm.pbdata = pbd
+	return nil
+}
+
+// truncate returns a copy of nd holding only the first size bytes of its
+// data. Children that lie entirely before the cut keep their links.
+func (dm *DagModifier) truncate(nd *mdag.Node, size uint64) (*mdag.Node, error) {
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pbd.GetType() {
+	case ftpb.Data_File, ftpb.Data_Raw:
+	case ftpb.Data_Directory:
+		return nil, ft.ErrInvalidDirLocation
+	default:
+		return nil, ft.ErrUnrecognizedType
+	}
+
+	nd = nd.Copy()
+
+	if size <= uint64(len(pbd.Data)) {
+		pbd.Data = pbd.Data[:size]
+		pbd.Blocksizes = nil
+		nd.Links = nil
+	} else {
+		left := size - uint64(len(pbd.Data))
+		keep := len(pbd.Blocksizes)
+		for i, bs := range pbd.Blocksizes {
+			if left >= bs {
+				left -= bs
+				continue
+			}
+
+			keep = i
+			if left > 0 {
+				// the cut falls inside of this child
+				child, err := nd.Links[i].GetNode(context.TODO(), dm.dagserv)
+				if err != nil {
+					return nil, err
+				}
+
+				nchild, err := dm.truncate(child, left)
+				if err != nil {
+					return nil, err
+				}
+
+				lnk, err := dm.addLinkedNode(nchild)
+				if err != nil {
+					return nil, err
+				}
+				lnk.Name = nd.Links[i].Name
+				nd.Links[i] = lnk
+				pbd.Blocksizes[i] = left
+				keep++
+			}
+			break
+		}
+		nd.Links = nd.Links[:keep]
+		pbd.Blocksizes = pbd.Blocksizes[:keep]
+	}
+
+	if pbd.GetType() == ftpb.Data_File {
+		pbd.Filesize = proto.Uint64(size)
+	}
+
+	nd.Data, err = proto.Marshal(pbd)
+	if err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// appendData adds the given bytes to the end of the file, in the balanced
+// layout of the importer so that the leaves stay at the same depth. The last
+// leaf of the file is cut off and split again with the new data, so that many
+// small appends don't produce many tiny blocks.
+func (dm *DagModifier) appendData(data []byte) error {
+	if err := dm.syncRoot(); err != nil {
+		return err
+	}
+
+	last, err := dm.lastLeafData(dm.curNode)
+	if err != nil {
+		return err
+	}
+	base := dm.curNode
+	if len(last) > 0 {
+		base, err = dm.truncate(dm.curNode, dm.pbdata.GetFilesize()-uint64(len(last)))
 		if err != nil {
-			log.Warningf("Failed adding node to DAG service: %s", err)
-			return 0, err
+			return err
 		}
-		lnk, err := mdag.MakeLink(n)
+		data = append(last, data...)
+	}
+
+	dbp := h.DagBuilderParams{
+		Dagserv:  dm.dagserv,
+		Maxlinks: h.DefaultLinksPerBlock,
+	}
+	nd, err := balanced.BalancedAppend(context.TODO(), base, dbp.New(dm.splitter.Split(bytes.NewReader(data))))
+	if err != nil {
+		return err
+	}
+
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return err
+	}
+	dm.curNode = nd
+	dm.pbdata = pbd
+	return nil
+}
+
+// lastLeafData returns the data of the rightmost leaf below nd, or the data
+// of nd itself if it has no children.
+func (dm *DagModifier) lastLeafData(nd *mdag.Node) ([]byte, error) {
+	for len(nd.Links) > 0 {
+		child, err := nd.Links[len(nd.Links)-1].GetNode(context.TODO(), dm.dagserv)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		links = append(links, lnk)
-		sizes = append(sizes, uint64(len(sb)))
+		nd = child
 	}
+	return ft.UnwrapData(nd.Data)
+}
 
-	// This is disgusting (and can be rewritten if performance demands)
-	if len(changed) > 0 {
-		sechalflink := append(links, dm.curNode.Links[changed[len(changed)-1]+1:]...)
-		dm.curNode.Links = append(dm.curNode.Links[:changed[0]], sechalflink...)
-		sechalfblks := append(sizes, dm.pbdata.Blocksizes[changed[len(changed)-1]+1:]...)
-		dm.pbdata.Blocksizes = append(dm.pbdata.Blocksizes[:changed[0]], sechalfblks...)
-	} else {
-		dm.curNode.Links = append(dm.curNode.Links, links...)
-		dm.pbdata.Blocksizes = append(dm.pbdata.Blocksizes, sizes...)
+// addLinkedNode adds the given node to the DAG service and returns a link to it
+func (dm *DagModifier) addLinkedNode(nd *mdag.Node) (*mdag.Link, error) {
+	_, err := dm.dagserv.Add(nd)
+	if err != nil {
+		log.Warningf("Failed adding node to DAG service: %s", err)
+		return nil, err
 	}
-	dm.pbdata.Filesize = proto.Uint64(newsize)
+	return mdag.MakeLink(nd)
+}
 
-	return origlen, nil
+// syncRoot writes the cached protobuf data back into the root node
+func (dm *DagModifier) syncRoot() error {
+	b, err := proto.Marshal(dm.pbdata)
+	if err != nil {
+		return err
+	}
+	dm.curNode.Data = b
+	return nil
 }
 
 func (dm *DagModifier) Size() uint64 {
@@ -180,23 +386,10 @@ func (dm *DagModifier) Size() uint64 {
 	return dm.pbdata.GetFilesize()
 }
 
-// splitBytes uses a splitterFunc to turn a large array of bytes
-// into many smaller arrays of bytes
-func splitBytes(b []byte, spl chunk.BlockSplitter) [][]byte {
-	out := spl.Split(bytes.NewReader(b))
-	var arr [][]byte
-	for blk := range out {
-		arr = append(arr, blk)
-	}
-	return arr
-}
-
 // GetNode gets the modified DAG Node
 func (dm *DagModifier) GetNode() (*mdag.Node, error) {
-	b, err := proto.Marshal(dm.pbdata)
-	if err != nil {
+	if err := dm.syncRoot(); err != nil {
 		return nil, err
 	}
-	dm.curNode.Data = b
 	return dm.curNode.Copy(), nil
 }
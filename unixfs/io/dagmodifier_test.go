@@ -61,7 +61,7 @@ func testModWrite(t *testing.T, beg, size uint64, orig []byte, dm *DagModifier)
 	}
 	copy(orig[beg:], newdata)
 
-	nmod, err := dm.WriteAt(newdata, uint64(beg))
+	nmod, err := dm.WriteAt(newdata, int64(beg))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -93,7 +93,6 @@ func testModWrite(t *testing.T, beg, size uint64, orig []byte, dm *DagModifier)
 }
 
 func TestDagModifierBasic(t *testing.T) {
-	t.Skip("DAGModifier needs to be fixed to work with indirect blocks.")
 	if err := u.SetLogLevel("blockservice", "critical"); err != nil {
 		t.Fatalf("testlog prepare failed: %s", err)
 	}
@@ -151,7 +150,6 @@ func TestDagModifierBasic(t *testing.T) {
 }
 
 func TestMultiWrite(t *testing.T) {
-	t.Skip("DAGModifier needs to be fixed to work with indirect blocks.")
 	dserv := getMockDagServ(t)
 	_, n := getNode(t, dserv, 0)
 
@@ -164,7 +162,7 @@ func TestMultiWrite(t *testing.T) {
 	u.NewTimeSeededRand().Read(data)
 
 	for i := 0; i < len(data); i++ {
-		n, err := dagmod.WriteAt(data[i:i+1], uint64(i))
+		n, err := dagmod.WriteAt(data[i:i+1], int64(i))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -193,7 +191,6 @@ func TestMultiWrite(t *testing.T) {
 }
 
 func TestMultiWriteCoal(t *testing.T) {
-	t.Skip("Skipping test until DagModifier is fixed")
 	dserv := getMockDagServ(t)
 	_, n := getNode(t, dserv, 0)
 
@@ -234,6 +231,165 @@ func TestMultiWriteCoal(t *testing.T) {
 	}
 }
 
+func TestDagModifierKeepsUntouchedLinks(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 50000)
+
+	dagmod, err := NewDagModifier(n, dserv, &chunk.SizeSplitter{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = testModWrite(t, 1000, 10, b, dagmod)
+
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := leafKeys(t, dserv, n)
+	after := leafKeys(t, dserv, nd)
+	if len(before) != len(after) {
+		t.Fatalf("number of leaves changed: %d != %d", len(before), len(after))
+	}
+
+	changed := 0
+	for i := range before {
+		if before[i] != after[i] {
+			changed++
+		}
+	}
+	if changed != 1 {
+		t.Fatalf("expected exactly one leaf to change, got %d", changed)
+	}
+}
+
+func TestDagModifierWritePastEnd(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 1000)
+
+	dagmod, err := NewDagModifier(n, dserv, &chunk.SizeSplitter{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the gap between the old end and the write should read back as zeros
+	testModWrite(t, 3000, 700, b, dagmod)
+
+	if dagmod.Size() != 3700 {
+		t.Fatalf("expected size 3700, got %d", dagmod.Size())
+	}
+}
+
+func TestDagTruncate(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 50000)
+
+	dagmod, err := NewDagModifier(n, dserv, &chunk.SizeSplitter{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int64{30000, 12345, 500, 0, 800} {
+		err := dagmod.Truncate(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if int64(len(b)) > size {
+			b = b[:size]
+		} else {
+			b = append(b, make([]byte, size-int64(len(b)))...)
+		}
+
+		nd, err := dagmod.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rd, err := NewDagReader(context.Background(), nd, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arrComp(out, b); err != nil {
+			t.Fatalf("after truncating to %d: %s", size, err)
+		}
+	}
+}
+
+func TestDagModifierAppendMultiLevel(t *testing.T) {
+	dserv := getMockDagServ(t)
+	// 100 leaves, more than fit in the links of one node
+	b, n := getNode(t, dserv, 50000)
+	if depths := leafDepths(t, dserv, n, 0); len(depths) != 1 || depths[0] < 2 {
+		t.Fatalf("expected a dag of more than one level, got leaves at depths %v", depths)
+	}
+
+	dagmod, err := NewDagModifier(n, dserv, &chunk.SizeSplitter{Size: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []uint64{1, 700, 3, 30000} {
+		b = testModWrite(t, uint64(len(b)), size, b, dagmod)
+
+		nd, err := dagmod.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if depths := leafDepths(t, dserv, nd, 0); len(depths) != 1 {
+			t.Fatalf("expected all leaves at the same depth after appending, got depths %v", depths)
+		}
+	}
+}
+
+// leafDepths returns the distinct depths of the leaves below nd, which is at
+// the given depth.
+func leafDepths(t *testing.T, dserv mdag.DAGService, nd *mdag.Node, depth int) []int {
+	if len(nd.Links) == 0 {
+		return []int{depth}
+	}
+
+	var out []int
+	for _, lnk := range nd.Links {
+		child, err := lnk.GetNode(context.Background(), dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range leafDepths(t, dserv, child, depth+1) {
+			if len(out) == 0 || out[len(out)-1] != d {
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+func leafKeys(t *testing.T, dserv mdag.DAGService, nd *mdag.Node) []u.Key {
+	if len(nd.Links) == 0 {
+		k, err := nd.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []u.Key{k}
+	}
+
+	var out []u.Key
+	for _, lnk := range nd.Links {
+		child, err := lnk.GetNode(context.Background(), dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, leafKeys(t, dserv, child)...)
+	}
+	return out
+}
+
 func arrComp(a, b []byte) error {
 	if len(a) != len(b) {
 		return fmt.Errorf("Arrays differ in length. %d != %d", len(a), len(b))
@@ -11,11 +11,29 @@ import (
 	mdag "github.com/jbenet/go-ipfs/merkledag"
 	ft "github.com/jbenet/go-ipfs/unixfs"
 	ftpb "github.com/jbenet/go-ipfs/unixfs/pb"
+	u "github.com/jbenet/go-ipfs/util"
 )
 
 var ErrIsDir = errors.New("this dag node is a directory")
 
+// ErrCantReadSymlinks is returned when trying to read a symlink node as a
+// file. Use ResolveSymlink to get its target instead.
+var ErrCantReadSymlinks = errors.New("cannot currently read symlinks")
+
+// ErrNotSymlink is returned by ResolveSymlink for nodes that aren't symlinks
+var ErrNotSymlink = errors.New("this dag node is not a symlink")
+
+// ErrExceedsLimit is returned by ReadAllN when the file is larger than the
+// requested maximum.
+var ErrExceedsLimit = errors.New("file exceeds read limit")
+
+// DefaultPrefetchWindow is the number of child blocks a DagReader requests
+// ahead of the one being read.
+var DefaultPrefetchWindow = 4
+
 // DagReader provides a way to easily read the data contained in a dag.
+// A DagReader is not safe for concurrent use, except for ReadAt: readers
+// in other goroutines should each get their own with Clone.
 type DagReader struct {
 	serv mdag.DAGService
 
@@ -29,9 +47,12 @@ type DagReader struct {
 	// will either be a bytes.Reader or a child DagReader
 	buf ReadSeekCloser
 
-	// NodeGetters for each of 'nodes' child links
+	// NodeGetters for each of 'nodes' child links, nil until requested
 	promises []mdag.NodeGetter
 
+	// number of child links requested ahead of the read head
+	prefetch int
+
 	// the index of the child link currently being read from
 	linkPosition int
 
@@ -43,6 +64,9 @@ type DagReader struct {
 
 	// context cancel for children
 	cancel func()
+
+	// raw metadata of the wrapping node, if the root was a metadata node
+	metadata []byte
 }
 
 type ReadSeekCloser interface {
@@ -69,28 +93,49 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 		fallthrough
 	case ftpb.Data_File:
 		return newDataFileReader(ctx, n, pb, serv), nil
+	case ftpb.Data_Symlink:
+		return nil, ErrCantReadSymlinks
 	case ftpb.Data_Metadata:
 		if len(n.Links) == 0 {
 			return nil, errors.New("incorrectly formatted metadata object")
 		}
-		child, err := n.Links[0].GetNode(serv)
+		child, err := n.Links[0].GetNode(ctx, serv)
+		if err != nil {
+			return nil, err
+		}
+		dr, err := NewDagReader(ctx, child, serv)
 		if err != nil {
 			return nil, err
 		}
-		return NewDagReader(ctx, child, serv)
+		dr.metadata = pb.GetData()
+		return dr, nil
 	default:
 		return nil, ft.ErrUnrecognizedType
 	}
 }
 
+// ResolveSymlink returns the target path stored in a symlink node
+func ResolveSymlink(n *mdag.Node) (string, error) {
+	pb := new(ftpb.Data)
+	err := proto.Unmarshal(n.Data, pb)
+	if err != nil {
+		return "", err
+	}
+
+	if pb.GetType() != ftpb.Data_Symlink {
+		return "", ErrNotSymlink
+	}
+	return string(pb.GetData()), nil
+}
+
 func newDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv mdag.DAGService) *DagReader {
 	fctx, cancel := context.WithCancel(ctx)
-	promises := serv.GetDAG(fctx, n)
 	return &DagReader{
 		node:     n,
 		serv:     serv,
 		buf:      NewRSNCFromBytes(pb.GetData()),
-		promises: promises,
+		promises: make([]mdag.NodeGetter, len(n.Links)),
+		prefetch: DefaultPrefetchWindow,
 		ctx:      fctx,
 		cancel:   cancel,
 		pbdata:   pb,
@@ -100,28 +145,50 @@ func newDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv md
 // precalcNextBuf follows the next link in line and loads it from the DAGService,
 // setting the next buffer to read from
 func (dr *DagReader) precalcNextBuf() error {
+	nxt, pb, err := dr.nextChild()
+	if err != nil {
+		return err
+	}
+	return dr.setBuf(nxt, pb)
+}
+
+// nextChild follows the next link in line and loads it from the DAGService,
+// returning the child node and its unixfs data.
+func (dr *DagReader) nextChild() (*mdag.Node, *ftpb.Data, error) {
 	dr.buf.Close() // Just to make sure
 	if dr.linkPosition >= len(dr.promises) {
-		return io.EOF
+		return nil, nil, io.EOF
 	}
+	dr.requestLinks(dr.linkPosition)
+	k := u.Key(dr.node.Links[dr.linkPosition].Hash)
+	e := log.EventBegin(dr.ctx, "dagReaderGetChild", &k)
 	nxt, err := dr.promises[dr.linkPosition].Get()
 	if err != nil {
-		return err
+		e.SetError(err)
+		e.Done()
+		return nil, nil, err
 	}
+	e.Done()
 	dr.linkPosition++
 
 	pb := new(ftpb.Data)
 	err = proto.Unmarshal(nxt.Data, pb)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	return nxt, pb, nil
+}
 
+// setBuf sets the buffer to read from to the contents of the child nxt
+func (dr *DagReader) setBuf(nxt *mdag.Node, pb *ftpb.Data) error {
 	switch pb.GetType() {
 	case ftpb.Data_Directory:
 		// A directory should not exist within a file
 		return ft.ErrInvalidDirLocation
 	case ftpb.Data_File:
-		dr.buf = newDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		child := newDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		child.prefetch = dr.prefetch
+		dr.buf = child
 		return nil
 	case ftpb.Data_Raw:
 		dr.buf = NewRSNCFromBytes(pb.GetData())
@@ -133,11 +200,65 @@ func (dr *DagReader) precalcNextBuf() error {
 	}
 }
 
+// requestLinks makes sure the child links from start up to the end of the
+// prefetch window have been requested from the DAGService, fetching the
+// missing ones in a single batch.
+func (dr *DagReader) requestLinks(start int) {
+	end := start + dr.prefetch
+	if dr.prefetch < 1 {
+		end = start + 1
+	}
+	if end > len(dr.promises) {
+		end = len(dr.promises)
+	}
+
+	var keys []u.Key
+	var idx []int
+	for i := start; i < end; i++ {
+		if dr.promises[i] == nil {
+			keys = append(keys, u.Key(dr.node.Links[i].Hash))
+			idx = append(idx, i)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	for j, ng := range dr.serv.GetNodes(dr.ctx, keys) {
+		dr.promises[idx[j]] = ng
+	}
+}
+
+// SetPrefetchWindow sets how many child blocks are requested ahead of the
+// one being read. It does not change the data returned, only how many
+// blocks are fetched concurrently.
+func (dr *DagReader) SetPrefetchWindow(n int) {
+	dr.prefetch = n
+	if child, ok := dr.buf.(*DagReader); ok {
+		child.SetPrefetchWindow(n)
+	}
+}
+
 // Size return the total length of the data from the DAG structured file.
 func (dr *DagReader) Size() int64 {
 	return int64(dr.pbdata.GetFilesize())
 }
 
+// Metadata returns the metadata stored in the node wrapping the file, or
+// nil if the file was not wrapped in a metadata node.
+func (dr *DagReader) Metadata() (*ftpb.Metadata, error) {
+	if dr.metadata == nil {
+		return nil, nil
+	}
+
+	md := new(ftpb.Metadata)
+	err := proto.Unmarshal(dr.metadata, md)
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
 // Read reads data from the DAG structured file
 func (dr *DagReader) Read(b []byte) (int, error) {
 	// If no cached buffer, load one
@@ -158,6 +279,9 @@ func (dr *DagReader) Read(b []byte) (int, error) {
 		if total == len(b) {
 			return total, nil
 		}
+		if dr.linkPosition >= len(dr.promises) {
+			return total, io.EOF
+		}
 
 		// Otherwise, load up the next block
 		err = dr.precalcNextBuf()
@@ -167,9 +291,12 @@ func (dr *DagReader) Read(b []byte) (int, error) {
 	}
 }
 
+// WriteTo writes the rest of the file to w. Raw leaves are written to w as
+// they are, without copying them through an intermediate buffer.
 func (dr *DagReader) WriteTo(w io.Writer) (int64, error) {
 	// If no cached buffer, load one
 	total := int64(0)
+	var empty ReadSeekCloser
 	for {
 		// Attempt to write bytes from cached buffer
 		n, err := dr.buf.WriteTo(w)
@@ -182,16 +309,46 @@ func (dr *DagReader) WriteTo(w io.Writer) (int64, error) {
 		}
 
 		// Otherwise, load up the next block
-		err = dr.precalcNextBuf()
+		nxt, pb, err := dr.nextChild()
 		if err != nil {
 			if err == io.EOF {
 				return total, nil
 			}
 			return total, err
 		}
+
+		if pb.GetType() != ftpb.Data_Raw {
+			if err := dr.setBuf(nxt, pb); err != nil {
+				return total, err
+			}
+			continue
+		}
+
+		// Raw leaves are written out directly instead of through a reader
+		data := pb.GetData()
+		wn, err := w.Write(data)
+		total += int64(wn)
+		dr.offset += int64(wn)
+		if err == nil && wn < len(data) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			// keep the unwritten part around for later reads
+			dr.buf = NewRSNCFromBytes(data[wn:])
+			return total, err
+		}
+
+		// the buffer must not claim the bytes written above, or seeking
+		// within it would go wrong
+		if empty == nil {
+			empty = NewRSNCFromBytes(nil)
+		}
+		dr.buf = empty
 	}
 }
 
+// Close cancels the block requests still outstanding for this reader, so
+// the exchange stops fetching blocks nobody is going to read.
 func (dr *DagReader) Close() error {
 	dr.cancel()
 	return nil
@@ -199,8 +356,8 @@ func (dr *DagReader) Close() error {
 
 // Seek implements io.Seeker, and will seek to a given offset in the file
 // interface matches standard unix seek
-// TODO: check if we can do relative seeks, to reduce the amount of dagreader
-// recreations that need to happen.
+// If the target offset lies within the currently loaded block, the seek is
+// delegated to it and no blocks need to be fetched.
 func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
 	case os.SEEK_SET:
@@ -208,6 +365,16 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 			return -1, errors.New("Invalid offset")
 		}
 
+		// Try to avoid reloading the current block
+		ok, err := dr.seekInBuf(offset)
+		if err != nil {
+			return -1, err
+		}
+		if ok {
+			dr.offset = offset
+			return offset, nil
+		}
+
 		// Grab cached protobuf object (solely to make code look cleaner)
 		pb := dr.pbdata
 
@@ -228,17 +395,28 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 		}
 
 		// iterate through links and find where we need to be
+		found := false
 		for i := 0; i < len(pb.Blocksizes); i++ {
 			if pb.Blocksizes[i] > uint64(left) {
 				dr.linkPosition = i
+				found = true
 				break
 			} else {
 				left -= int64(pb.Blocksizes[i])
 			}
 		}
+		if !found {
+			// at or past the end of the file, e.g. of an empty one: there
+			// is no child to load, and reads hit EOF right away
+			dr.buf.Close()
+			dr.buf = NewRSNCFromBytes(nil)
+			dr.linkPosition = len(dr.promises)
+			dr.offset = offset
+			return offset, nil
+		}
 
 		// start sub-block request
-		err := dr.precalcNextBuf()
+		err = dr.precalcNextBuf()
 		if err != nil {
 			return 0, err
 		}
@@ -257,7 +435,6 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 		dr.offset = offset
 		return offset, nil
 	case os.SEEK_CUR:
-		// TODO: be smarter here
 		noffset := dr.offset + offset
 		return dr.Seek(noffset, os.SEEK_SET)
 	case os.SEEK_END:
@@ -269,6 +446,110 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 	return 0, nil
 }
 
+// Clone returns a new reader over the same file, positioned at its start.
+// The clone shares nothing with dr that either of them modifies, so both can
+// be used concurrently; it does share the DAGService, so the blocks already
+// fetched for dr are only fetched again if the DAGService has no cache.
+// Closing dr closes its clones too.
+func (dr *DagReader) Clone() *DagReader {
+	c := newDataFileReader(dr.ctx, dr.node, dr.pbdata, dr.serv)
+	c.prefetch = dr.prefetch
+	c.metadata = dr.metadata
+	return c
+}
+
+// ReadAt implements io.ReaderAt. It reads through a clone of dr positioned
+// at off, so it leaves the offset of dr alone and is safe to call
+// concurrently, with other ReadAt calls as well as with Read and Seek.
+func (dr *DagReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= dr.Size() {
+		return 0, io.EOF
+	}
+
+	view := dr.Clone()
+	defer view.Close()
+
+	if _, err := view.Seek(off, os.SEEK_SET); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(view, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// seekInBuf seeks to the given absolute offset within the currently loaded
+// buffer. It returns false if the offset lies outside of that buffer.
+func (dr *DagReader) seekInBuf(offset int64) (bool, error) {
+	var pos, size int64
+	switch buf := dr.buf.(type) {
+	case *DagReader:
+		pos = buf.offset
+		size = buf.Size()
+	case *readSeekNopCloser:
+		cur, err := buf.Seek(0, os.SEEK_CUR)
+		if err != nil {
+			return false, err
+		}
+		pos = cur
+		size = cur + int64(buf.Len())
+	default:
+		return false, nil
+	}
+
+	start := dr.offset - pos
+	if offset < start || offset >= start+size {
+		return false, nil
+	}
+
+	_, err := dr.buf.Seek(offset-start, os.SEEK_SET)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReadAll reads all of the data represented by the given node into memory.
+func ReadAll(ctx context.Context, n *mdag.Node, serv mdag.DAGService) ([]byte, error) {
+	return ReadAllN(ctx, n, serv, -1)
+}
+
+// ReadAllN reads all of the data represented by the given node into memory,
+// failing with ErrExceedsLimit if there is more than max bytes of it. A max
+// of -1 means no limit. Cancelling the context stops any further blocks from
+// being fetched.
+func ReadAllN(ctx context.Context, n *mdag.Node, serv mdag.DAGService, max int64) ([]byte, error) {
+	dr, err := NewDagReader(ctx, n, serv)
+	if err != nil {
+		return nil, err
+	}
+	defer dr.Close()
+
+	var r io.Reader = dr
+	if max >= 0 {
+		if dr.Size() > max {
+			return nil, ErrExceedsLimit
+		}
+		// dont trust the reported size, read one byte past the limit
+		// so we can tell if there was more data.
+		r = io.LimitReader(dr, max+1)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	if max >= 0 && int64(buf.Len()) > max {
+		return nil, ErrExceedsLimit
+	}
+	return buf.Bytes(), nil
+}
+
 // readSeekNopCloser wraps a bytes.Reader to implement ReadSeekCloser
 type readSeekNopCloser struct {
 	*bytes.Reader
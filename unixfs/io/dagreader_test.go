@@ -0,0 +1,653 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	imp "github.com/jbenet/go-ipfs/importer"
+	"github.com/jbenet/go-ipfs/importer/chunk"
+	mdag "github.com/jbenet/go-ipfs/merkledag"
+	ft "github.com/jbenet/go-ipfs/unixfs"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// countingDagServ counts the number of nodes requested from it
+type countingDagServ struct {
+	mdag.DAGService
+	requested int
+}
+
+func (c *countingDagServ) GetDAG(ctx context.Context, nd *mdag.Node) []mdag.NodeGetter {
+	c.requested += len(nd.Links)
+	return c.DAGService.GetDAG(ctx, nd)
+}
+
+func (c *countingDagServ) GetNodes(ctx context.Context, keys []u.Key) []mdag.NodeGetter {
+	c.requested += len(keys)
+	return c.DAGService.GetNodes(ctx, keys)
+}
+
+func TestRelativeSeek(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 50000)
+
+	cds := &countingDagServ{DAGService: dserv}
+	dr, err := NewDagReader(context.Background(), n, cds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 10)
+	var off int64
+	for off+int64(len(buf)) < int64(len(b)) {
+		_, err := io.ReadFull(dr, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, b[off:off+int64(len(buf))]) {
+			t.Fatalf("read wrong bytes at offset %d", off)
+		}
+		off += int64(len(buf))
+
+		noff, err := dr.Seek(7, os.SEEK_CUR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		off += 7
+		if noff != off {
+			t.Fatalf("seek returned wrong offset: %d != %d", noff, off)
+		}
+	}
+
+	// Every block should only have been loaded once.
+	if cds.requested >= countNodes(t, dserv, n) {
+		t.Fatalf("relative seeks reloaded blocks: %d nodes requested", cds.requested)
+	}
+}
+
+func TestSeekBackwards(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 10000)
+
+	dr, err := NewDagReader(context.Background(), n, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 100)
+	for _, off := range []int64{9000, 4500, 4400, 4499, 0, 9899} {
+		_, err := dr.Seek(off, os.SEEK_SET)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadFull(dr, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, b[off:off+100]) {
+			t.Fatalf("read wrong bytes at offset %d", off)
+		}
+	}
+}
+
+func TestReadAllN(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 5000)
+
+	out, err := ReadAllN(context.Background(), n, dserv, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b) {
+		t.Fatal("read wrong bytes")
+	}
+
+	out, err = ReadAll(context.Background(), n, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b) {
+		t.Fatal("read wrong bytes")
+	}
+
+	_, err = ReadAllN(context.Background(), n, dserv, 4999)
+	if err != ErrExceedsLimit {
+		t.Fatalf("expected ErrExceedsLimit, got %v", err)
+	}
+}
+
+func TestMetadataNode(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 5000)
+
+	mdata, err := ft.BytesForMetadata(&ft.Metadata{MimeType: "text/plain", Size: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdnode := &mdag.Node{Data: mdata}
+	if err := mdnode.AddNodeLinkClean("file", n); err != nil {
+		t.Fatal(err)
+	}
+
+	dr, err := NewDagReader(context.Background(), mdnode, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := dr.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.GetMimeType() != "text/plain" {
+		t.Fatalf("wrong mime type: %s", md.GetMimeType())
+	}
+	if dr.Size() != int64(len(b)) {
+		t.Fatalf("wrong size: %d != %d", dr.Size(), len(b))
+	}
+
+	plain, err := NewDagReader(context.Background(), n, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err = plain.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md != nil {
+		t.Fatal("expected no metadata for plain file")
+	}
+}
+
+func countNodes(t *testing.T, dserv mdag.DAGService, nd *mdag.Node) int {
+	count := 1
+	for _, lnk := range nd.Links {
+		child, err := lnk.GetNode(context.Background(), dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count += countNodes(t, dserv, child)
+	}
+	return count
+}
+
+func TestSymlink(t *testing.T) {
+	dserv := getMockDagServ(t)
+
+	data, err := ft.SymlinkData("/some/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := &mdag.Node{Data: data}
+
+	target, err := ResolveSymlink(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "/some/target" {
+		t.Fatalf("wrong symlink target: %s", target)
+	}
+
+	_, err = NewDagReader(context.Background(), nd, dserv)
+	if err != ErrCantReadSymlinks {
+		t.Fatalf("expected ErrCantReadSymlinks, got %v", err)
+	}
+
+	_, n := getNode(t, dserv, 100)
+	_, err = ResolveSymlink(n)
+	if err != ErrNotSymlink {
+		t.Fatalf("expected ErrNotSymlink, got %v", err)
+	}
+}
+
+func TestPrefetchWindow(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 50000)
+
+	// number of nodes requested for the first read, by window size
+	requested := make(map[int]int)
+	for _, window := range []int{0, 1, 4, 1000} {
+		cds := &countingDagServ{DAGService: dserv}
+		dr, err := NewDagReader(context.Background(), n, cds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dr.SetPrefetchWindow(window)
+
+		buf := make([]byte, 10)
+		if _, err := io.ReadFull(dr, buf); err != nil {
+			t.Fatal(err)
+		}
+		requested[window] = cds.requested
+
+		rest, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(append(buf, rest...), b) {
+			t.Fatalf("window %d: read wrong bytes", window)
+		}
+	}
+
+	// without prefetching only the path to the first leaf is fetched
+	if requested[0] != requested[1] || requested[1] > 2 {
+		t.Fatalf("fetched %d nodes without prefetching", requested[1])
+	}
+	if requested[4] <= requested[1] || requested[1000] <= requested[4] {
+		t.Fatalf("larger windows should prefetch more: %v", requested)
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	dserv := getMockDagServ(t)
+
+	html := []byte("<html><body>" + string(bytes.Repeat([]byte("hello "), 200)) + "</body></html>")
+	nd, err := imp.BuildDagFromReader(bytes.NewReader(html), dserv, nil, &chunk.SizeSplitter{Size: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := NewDagReader(context.Background(), nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctype, r, err := DetectContentType(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctype != "text/html; charset=utf-8" {
+		t.Fatalf("wrong content type: %s", ctype)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, html) {
+		t.Fatal("the returned reader lost data")
+	}
+
+	// random data is not recognized, so the metadata is used
+	b, n := getNode(t, dserv, 5000)
+	mdata, err := ft.BytesForMetadata(&ft.Metadata{MimeType: "video/webm", Size: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdnode := &mdag.Node{Data: mdata}
+	if err := mdnode.AddNodeLinkClean("file", n); err != nil {
+		t.Fatal(err)
+	}
+	dr, err = NewDagReader(context.Background(), mdnode, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctype, r, err = DetectContentType(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctype != "video/webm" {
+		t.Fatalf("expected the stored mime type, got %s", ctype)
+	}
+	out, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b) {
+		t.Fatal("the returned reader lost data")
+	}
+}
+
+// getRawLeavesNode returns a file of the given size made of raw leaves
+func getRawLeavesNode(t *testing.T, dserv mdag.DAGService, size int) ([]byte, *mdag.Node) {
+	b, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), int64(size)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := new(mdag.Node)
+	var mb ft.MultiBlock
+	for rest := b; len(rest) > 0; {
+		chunk := rest
+		if len(chunk) > 500 {
+			chunk = chunk[:500]
+		}
+		rest = rest[len(chunk):]
+
+		leaf := &mdag.Node{Data: ft.WrapData(chunk)}
+		if _, err := dserv.Add(leaf); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.AddNodeLinkClean("", leaf); err != nil {
+			t.Fatal(err)
+		}
+		mb.AddBlockSize(uint64(len(chunk)))
+	}
+	root.Data, err = mb.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dserv.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	return b, root
+}
+
+// failingWriter fails once it has been written n bytes
+type failingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (fw *failingWriter) Write(b []byte) (int, error) {
+	if fw.Len()+len(b) > fw.n {
+		n, _ := fw.Buffer.Write(b[:fw.n-fw.Len()])
+		return n, io.ErrClosedPipe
+	}
+	return fw.Buffer.Write(b)
+}
+
+func TestWriteToRawLeaves(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getRawLeavesNode(t, dserv, 5000)
+
+	dr, err := NewDagReader(context.Background(), n, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dr.Seek(750, os.SEEK_SET); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	wn, err := dr.WriteTo(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wn != int64(len(b)-750) || !bytes.Equal(out.Bytes(), b[750:]) {
+		t.Fatalf("wrote wrong bytes: %d written", wn)
+	}
+
+	// seeking back relative to the end of the write reads the right bytes
+	off, err := dr.Seek(-100, os.SEEK_CUR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != int64(len(b)-100) {
+		t.Fatalf("wrong offset after WriteTo: %d", off+100)
+	}
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(dr, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, b[len(b)-100:]) {
+		t.Fatal("read wrong bytes after WriteTo")
+	}
+}
+
+func TestWriteToRawLeavesShortWrite(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getRawLeavesNode(t, dserv, 5000)
+
+	dr, err := NewDagReader(context.Background(), n, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw := &failingWriter{n: 1234}
+	wn, err := dr.WriteTo(fw)
+	if err != io.ErrClosedPipe {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if wn != 1234 || !bytes.Equal(fw.Bytes(), b[:1234]) {
+		t.Fatalf("wrote wrong bytes: %d written", wn)
+	}
+
+	// reading picks up where the write stopped
+	rest, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, b[1234:]) {
+		t.Fatal("read wrong bytes after a failed WriteTo")
+	}
+}
+
+func TestZeroLengthFile(t *testing.T) {
+	dserv := getMockDagServ(t)
+
+	leaf := &mdag.Node{Data: ft.FilePBData(nil, 0)}
+
+	// a file whose children are empty
+	mb := new(ft.MultiBlock)
+	var children []*mdag.Node
+	for i := 0; i < 2; i++ {
+		child := &mdag.Node{Data: ft.FilePBData(nil, 0)}
+		if _, err := dserv.Add(child); err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, child)
+		mb.AddBlockSize(0)
+	}
+	data, err := mb.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := &mdag.Node{Data: data}
+	for _, child := range children {
+		if err := parent.AddNodeLinkClean("", child); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imported, err := imp.BuildDagFromReader(bytes.NewReader(nil), dserv, nil, chunk.DefaultSplitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, nd := range map[string]*mdag.Node{"leaf": leaf, "empty children": parent, "imported": imported} {
+		cds := &countingDagServ{DAGService: dserv}
+		dr, err := NewDagReader(context.Background(), nd, cds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dr.Size() != 0 {
+			t.Fatalf("%s: expected size 0, got %d", name, dr.Size())
+		}
+
+		buf := make([]byte, 10)
+		if n, err := dr.Read(buf); n != 0 || err != io.EOF {
+			t.Fatalf("%s: expected (0, EOF) from Read, got (%d, %v)", name, n, err)
+		}
+		if off, err := dr.Seek(0, os.SEEK_END); off != 0 || err != nil {
+			t.Fatalf("%s: expected Seek(0, SEEK_END) to return 0, got (%d, %v)", name, off, err)
+		}
+		if n, err := dr.Read(buf); n != 0 || err != io.EOF {
+			t.Fatalf("%s: expected (0, EOF) from Read at the end, got (%d, %v)", name, n, err)
+		}
+		if off, err := dr.Seek(0, os.SEEK_SET); off != 0 || err != nil {
+			t.Fatalf("%s: expected Seek(0, SEEK_SET) to return 0, got (%d, %v)", name, off, err)
+		}
+		var out bytes.Buffer
+		if n, err := dr.WriteTo(&out); n != 0 || err != nil {
+			t.Fatalf("%s: expected WriteTo to write nothing, got (%d, %v)", name, n, err)
+		}
+		if off, err := dr.Seek(10, os.SEEK_SET); off != 10 || err != nil {
+			t.Fatalf("%s: expected seeking past the end to succeed, got (%d, %v)", name, off, err)
+		}
+		if n, err := dr.Read(buf); n != 0 || err != io.EOF {
+			t.Fatalf("%s: expected (0, EOF) from Read past the end, got (%d, %v)", name, n, err)
+		}
+		if len(nd.Links) == 0 && cds.requested != 0 {
+			t.Fatalf("%s: expected no nodes to be requested, got %d", name, cds.requested)
+		}
+	}
+}
+
+func TestSeekToEnd(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 5000)
+
+	cds := &countingDagServ{DAGService: dserv}
+	dr, err := NewDagReader(context.Background(), n, cds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	off, err := dr.Seek(0, os.SEEK_END)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != int64(len(b)) {
+		t.Fatalf("expected to seek to %d, got %d", len(b), off)
+	}
+	if n, err := dr.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("expected (0, EOF) from Read at the end, got (%d, %v)", n, err)
+	}
+	if cds.requested != 0 {
+		t.Fatalf("expected seeking to the end to fetch nothing, got %d nodes", cds.requested)
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 50000)
+
+	dr, err := NewDagReader(context.Background(), n, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dr.Close()
+
+	// ReadAt leaves the offset of the reader alone
+	if _, err := dr.Seek(100, os.SEEK_SET); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func(off int64) {
+			buf := make([]byte, 3000)
+			n, err := dr.ReadAt(buf, off)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if n != len(buf) || !bytes.Equal(buf, b[off:off+int64(n)]) {
+				errs <- errors.New("ReadAt read the wrong bytes")
+				return
+			}
+			errs <- nil
+		}(int64(i) * 4700)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := make([]byte, 10)
+	if _, err := io.ReadFull(dr, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b[100:110]) {
+		t.Fatal("ReadAt moved the offset of the reader")
+	}
+
+	// a read running past the end is short, and fails with EOF
+	buf := make([]byte, 100)
+	nr, err := dr.ReadAt(buf, int64(len(b)-10))
+	if nr != 10 || err != io.EOF {
+		t.Fatalf("expected (10, EOF) at the end, got (%d, %v)", nr, err)
+	}
+	if !bytes.Equal(buf[:nr], b[len(b)-10:]) {
+		t.Fatal("ReadAt read the wrong bytes at the end")
+	}
+
+	nr, err = dr.ReadAt(buf, int64(len(b)))
+	if nr != 0 || err != io.EOF {
+		t.Fatalf("expected (0, EOF) past the end, got (%d, %v)", nr, err)
+	}
+	if _, err := dr.ReadAt(buf, -1); err == nil {
+		t.Fatal("expected a negative offset to fail")
+	}
+}
+
+func TestClone(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 50000)
+
+	mdata, err := ft.BytesForMetadata(&ft.Metadata{MimeType: "text/plain", Size: 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdnode := &mdag.Node{Data: mdata}
+	if err := mdnode.AddNodeLinkClean("file", n); err != nil {
+		t.Fatal(err)
+	}
+
+	dr, err := NewDagReader(context.Background(), mdnode, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dr.Close()
+
+	if _, err := dr.Seek(20000, os.SEEK_SET); err != nil {
+		t.Fatal(err)
+	}
+
+	// each clone reads its own range, while dr reads too
+	errs := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func(off int64) {
+			c := dr.Clone()
+			defer c.Close()
+			if _, err := c.Seek(off, os.SEEK_SET); err != nil {
+				errs <- err
+				return
+			}
+			out := make([]byte, 5000)
+			if _, err := io.ReadFull(c, out); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(out, b[off:off+5000]) {
+				errs <- errors.New("clone read the wrong bytes")
+				return
+			}
+			errs <- nil
+		}(int64(i) * 9000)
+	}
+
+	out := make([]byte, 1000)
+	if _, err := io.ReadFull(dr, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b[20000:21000]) {
+		t.Fatal("clones moved the offset of the reader")
+	}
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a clone starts at the beginning, and keeps the metadata
+	c := dr.Clone()
+	defer c.Close()
+	all, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(all, b) {
+		t.Fatal("clone did not read the whole file")
+	}
+	md, err := c.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md == nil || md.GetMimeType() != "text/plain" {
+		t.Fatal("clone lost the metadata")
+	}
+}
@@ -1,6 +1,7 @@
 package io
 
 import (
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	mdag "github.com/jbenet/go-ipfs/merkledag"
 	format "github.com/jbenet/go-ipfs/unixfs"
 	u "github.com/jbenet/go-ipfs/util"
@@ -20,7 +21,7 @@ func NewDirectory(dserv mdag.DAGService) *directoryBuilder {
 }
 
 func (d *directoryBuilder) AddChild(name string, k u.Key) error {
-	cnode, err := d.dserv.Get(k)
+	cnode, err := d.dserv.Get(context.TODO(), k)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,70 @@
+package io
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrClientGone is returned by reads of content served by ServeDAGContent
+// after the client has gone away.
+var ErrClientGone = errors.New("client went away")
+
+// ServeDAGContent replies to the request with the size bytes of content,
+// like http.ServeContent: single and multiple byte ranges are served, with
+// the Accept-Ranges and Content-Range headers set, by seeking content
+// instead of buffering it. Content-Type is sniffed unless already set.
+//
+// Once the client goes away, reading and seeking content stops, so no
+// further blocks are fetched for it.
+func ServeDAGContent(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, size int64) {
+	rs := &servedContent{ReadSeeker: content, size: size}
+	if cn, ok := w.(http.CloseNotifier); ok {
+		rs.closed = cn.CloseNotify()
+	}
+
+	// no name or modification time: the type is sniffed, and the ranges
+	// always apply
+	http.ServeContent(w, r, "", time.Time{}, rs)
+}
+
+// servedContent is content of a known size, failing reads once the client
+// that requested it is gone.
+type servedContent struct {
+	io.ReadSeeker
+	size   int64
+	closed <-chan bool // receives a single value once the client is gone
+	gone   bool
+}
+
+func (sc *servedContent) clientGone() bool {
+	if !sc.gone {
+		select {
+		case <-sc.closed:
+			sc.gone = true
+		default:
+		}
+	}
+	return sc.gone
+}
+
+func (sc *servedContent) Read(b []byte) (int, error) {
+	if sc.clientGone() {
+		return 0, ErrClientGone
+	}
+	return sc.ReadSeeker.Read(b)
+}
+
+// Seek fails once the client is gone too, since seeking a DagReader fetches
+// blocks.
+func (sc *servedContent) Seek(offset int64, whence int) (int64, error) {
+	if sc.clientGone() {
+		return 0, ErrClientGone
+	}
+	if whence == os.SEEK_END {
+		return sc.ReadSeeker.Seek(sc.size+offset, os.SEEK_SET)
+	}
+	return sc.ReadSeeker.Seek(offset, whence)
+}
@@ -0,0 +1,122 @@
+package io
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	context "github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func serveRange(t *testing.T, dr *DagReader, rng string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	rec := httptest.NewRecorder()
+	ServeDAGContent(rec, req, dr, dr.Size())
+	return rec
+}
+
+func TestServeDAGContent(t *testing.T) {
+	dserv := getMockDagServ(t)
+	b, n := getNode(t, dserv, 5000)
+
+	newReader := func() *DagReader {
+		dr, err := NewDagReader(context.Background(), n, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dr
+	}
+
+	rec := serveRange(t, newReader(), "")
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), b) {
+		t.Fatalf("expected the whole file, got status %d", rec.Code)
+	}
+	if rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatal("expected range requests to be advertised")
+	}
+
+	rec = serveRange(t, newReader(), "bytes=1000-2999")
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected partial content, got status %d", rec.Code)
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes 1000-2999/5000" {
+		t.Fatalf("wrong Content-Range: %s", cr)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), b[1000:3000]) {
+		t.Fatal("wrong data for range")
+	}
+
+	rec = serveRange(t, newReader(), "bytes=0-9,4990-")
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected partial content, got status %d", rec.Code)
+	}
+	mt, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt != "multipart/byteranges" {
+		t.Fatalf("wrong content type for multiple ranges: %s", mt)
+	}
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for _, exp := range [][]byte{b[:10], b[4990:]} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, exp) {
+			t.Fatal("wrong data in multipart range")
+		}
+	}
+}
+
+// goneRecorder is a ResponseRecorder whose client has gone away
+type goneRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (gr goneRecorder) CloseNotify() <-chan bool {
+	ch := make(chan bool, 1)
+	ch <- true
+	return ch
+}
+
+func TestServeDAGContentClientGone(t *testing.T) {
+	dserv := getMockDagServ(t)
+	_, n := getNode(t, dserv, 50000)
+
+	cds := &countingDagServ{DAGService: dserv}
+	dr, err := NewDagReader(context.Background(), n, cds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := cds.requested
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := goneRecorder{httptest.NewRecorder()}
+	ServeDAGContent(rec, req, dr, dr.Size())
+
+	if rec.Code == http.StatusOK {
+		t.Fatal("served content to a client that was gone")
+	}
+	if cds.requested != before {
+		t.Fatalf("requested %d blocks for a client that was gone", cds.requested-before)
+	}
+}
@@ -0,0 +1,175 @@
+package tar
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	gopath "path"
+	"time"
+
+	proto "github.com/jbenet/go-ipfs/Godeps/_workspace/src/code.google.com/p/goprotobuf/proto"
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdag "github.com/jbenet/go-ipfs/merkledag"
+	ft "github.com/jbenet/go-ipfs/unixfs"
+	uio "github.com/jbenet/go-ipfs/unixfs/io"
+	upb "github.com/jbenet/go-ipfs/unixfs/pb"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+// DagArchive returns a reader producing a tar archive of the unixfs dag
+// rooted at nd. The dag is walked lazily while the archive is read, so only
+// the node currently being written is held in memory. Cancelling ctx aborts
+// the walk and makes further reads fail with the context's error.
+func DagArchive(ctx context.Context, nd *mdag.Node, name string, dag mdag.DAGService, compression int) (io.Reader, error) {
+	piper, pipew := io.Pipe()
+
+	var out io.Writer = pipew
+	var gzw *gzip.Writer
+	if compression != gzip.NoCompression {
+		var err error
+		gzw, err = gzip.NewWriterLevel(pipew, compression)
+		if err != nil {
+			return nil, err
+		}
+		out = gzw
+	}
+
+	w := NewWriter(ctx, out, dag)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := w.WriteNode(nd, name)
+		if err == nil {
+			err = w.Close()
+		}
+		if err == nil && gzw != nil {
+			err = gzw.Close()
+		}
+		// a nil error makes the reader see io.EOF
+		pipew.CloseWithError(err)
+	}()
+
+	// unblock the writer if nobody is reading anymore
+	go func() {
+		select {
+		case <-ctx.Done():
+			pipew.CloseWithError(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	return piper, nil
+}
+
+// Writer writes unixfs dags as tar archives
+type Writer struct {
+	Dag  mdag.DAGService
+	TarW *tar.Writer
+
+	ctx context.Context
+}
+
+// NewWriter returns a Writer writing a tar archive to w
+func NewWriter(ctx context.Context, w io.Writer, dag mdag.DAGService) *Writer {
+	return &Writer{
+		Dag:  dag,
+		TarW: tar.NewWriter(w),
+		ctx:  ctx,
+	}
+}
+
+// WriteNode adds the dag rooted at nd to the archive under fpath.
+// Directories are walked recursively, fetching one child at a time.
+func (w *Writer) WriteNode(nd *mdag.Node, fpath string) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	pb := new(upb.Data)
+	if err := proto.Unmarshal(nd.Data, pb); err != nil {
+		return err
+	}
+
+	switch pb.GetType() {
+	case upb.Data_Directory:
+		return w.writeDir(nd, fpath)
+	case upb.Data_File, upb.Data_Raw, upb.Data_Metadata:
+		return w.writeFile(nd, fpath)
+	case upb.Data_Symlink:
+		return w.writeSymlink(pb, fpath)
+	default:
+		return ft.ErrUnrecognizedType
+	}
+}
+
+// Close finishes the tar archive. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.TarW.Close()
+}
+
+func (w *Writer) writeDir(nd *mdag.Node, fpath string) error {
+	err := w.TarW.WriteHeader(&tar.Header{
+		Name:     fpath,
+		Typeflag: tar.TypeDir,
+		Mode:     0777,
+		ModTime:  time.Now(),
+		// TODO: set mode, dates, etc. when added to unixFS
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, lnk := range nd.Links {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+
+		child, err := w.Dag.Get(w.ctx, u.Key(lnk.Hash))
+		if err != nil {
+			return err
+		}
+
+		err = w.WriteNode(child, gopath.Join(fpath, lnk.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) writeFile(nd *mdag.Node, fpath string) error {
+	// DagReader unwraps metadata nodes to the file they describe
+	dr, err := uio.NewDagReader(w.ctx, nd, w.Dag)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	err = w.TarW.WriteHeader(&tar.Header{
+		Name:     fpath,
+		Size:     dr.Size(),
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		ModTime:  time.Now(),
+		// TODO: set mode, dates, etc. when added to unixFS
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w.TarW, dr)
+	return err
+}
+
+func (w *Writer) writeSymlink(pb *upb.Data, fpath string) error {
+	return w.TarW.WriteHeader(&tar.Header{
+		Name:     fpath,
+		Linkname: string(pb.GetData()),
+		Typeflag: tar.TypeSymlink,
+		Mode:     0777,
+		ModTime:  time.Now(),
+	})
+}
@@ -0,0 +1,183 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	bstore "github.com/jbenet/go-ipfs/blocks/blockstore"
+	bserv "github.com/jbenet/go-ipfs/blockservice"
+	offline "github.com/jbenet/go-ipfs/exchange/offline"
+	imp "github.com/jbenet/go-ipfs/importer"
+	chunk "github.com/jbenet/go-ipfs/importer/chunk"
+	mdag "github.com/jbenet/go-ipfs/merkledag"
+	path "github.com/jbenet/go-ipfs/path"
+	ft "github.com/jbenet/go-ipfs/unixfs"
+	u "github.com/jbenet/go-ipfs/util"
+)
+
+func getMockDagServ(t *testing.T) mdag.DAGService {
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bsrv, err := bserv.New(bs, offline.Exchange(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mdag.NewDAGService(bsrv)
+}
+
+func addFile(t *testing.T, dserv mdag.DAGService, size int64) ([]byte, *mdag.Node) {
+	data := make([]byte, size)
+	u.NewTimeSeededRand().Read(data)
+
+	nd, err := imp.BuildDagFromReader(bytes.NewReader(data), dserv, nil, &chunk.SizeSplitter{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, nd
+}
+
+func addNode(t *testing.T, dserv mdag.DAGService, nd *mdag.Node) *mdag.Node {
+	if _, err := dserv.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func TestDagArchive(t *testing.T) {
+	dserv := getMockDagServ(t)
+
+	fdata, file := addFile(t, dserv, 5000)
+	mdata, mfile := addFile(t, dserv, 700)
+
+	md, err := ft.BytesForMetadata(&ft.Metadata{MimeType: "text/plain", Size: 700})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := &mdag.Node{Data: md}
+	if err := wrapped.AddNodeLinkClean("", mfile); err != nil {
+		t.Fatal(err)
+	}
+	addNode(t, dserv, wrapped)
+
+	empty := addNode(t, dserv, &mdag.Node{Data: ft.FolderPBData()})
+
+	root := &mdag.Node{Data: ft.FolderPBData()}
+	if err := root.AddNodeLinkClean("file", file); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLinkClean("meta", wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLinkClean("empty", empty); err != nil {
+		t.Fatal(err)
+	}
+	addNode(t, dserv, root)
+
+	for _, compression := range []int{gzip.NoCompression, gzip.BestSpeed} {
+		r, err := DagArchive(context.Background(), root, "root", dserv, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if compression != gzip.NoCompression {
+			r, err = gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := []struct {
+			name string
+			typ  byte
+			data []byte
+		}{
+			// links are sorted by name when the node is encoded
+			{"root", tar.TypeDir, nil},
+			{"root/empty", tar.TypeDir, nil},
+			{"root/file", tar.TypeReg, fdata},
+			{"root/meta", tar.TypeReg, mdata},
+		}
+
+		tr := tar.NewReader(r)
+		for _, exp := range expected {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Name != exp.name || hdr.Typeflag != exp.typ {
+				t.Fatalf("unexpected entry %s (%c), wanted %s", hdr.Name, hdr.Typeflag, exp.name)
+			}
+
+			if exp.typ == tar.TypeReg {
+				if hdr.Size != int64(len(exp.data)) {
+					t.Fatalf("%s: wrong size %d", exp.name, hdr.Size)
+				}
+				out, err := ioutil.ReadAll(tr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out, exp.data) {
+					t.Fatalf("%s: wrong contents", exp.name)
+				}
+			}
+		}
+
+		if _, err := tr.Next(); err != io.EOF {
+			t.Fatalf("expected end of archive, got %v", err)
+		}
+	}
+}
+
+func TestDagArchiveCancel(t *testing.T) {
+	dserv := getMockDagServ(t)
+	_, file := addFile(t, dserv, 100000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := DagArchive(ctx, file, "file", dserv, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("expected reading a cancelled archive to fail")
+	}
+}
+
+func TestNewReaderCancel(t *testing.T) {
+	dserv := getMockDagServ(t)
+	_, file := addFile(t, dserv, 100000)
+	k, err := file.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resolver := &path.Resolver{DAG: dserv}
+	r, err := NewReader(ctx, path.Path(k.String()), dserv, resolver, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("expected reading a cancelled archive to fail")
+	}
+}
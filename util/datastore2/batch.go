@@ -0,0 +1,67 @@
+package datastore2
+
+import (
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+)
+
+// Batch gathers puts and deletes, to write them all at once on Commit. A
+// Batch is not safe for concurrent use, and cannot be reused once committed.
+type Batch interface {
+	Put(key datastore.Key, value interface{}) error
+	Delete(key datastore.Key) error
+	Commit() error
+}
+
+// Batching is a datastore able to write batches of changes in a single
+// transaction, all or nothing.
+type Batching interface {
+	datastore.Datastore
+	Batch() (Batch, error)
+}
+
+// NewBatch returns a batch of changes to ds. If ds is Batching, it is the
+// batch of ds; otherwise the changes are made one by one on Commit, which
+// stops at the first that fails.
+func NewBatch(ds datastore.Datastore) (Batch, error) {
+	if b, ok := ds.(Batching); ok {
+		return b.Batch()
+	}
+	return &basicBatch{ds: ds}, nil
+}
+
+type batchOp struct {
+	key    datastore.Key
+	value  interface{}
+	delete bool
+}
+
+type basicBatch struct {
+	ds  datastore.Datastore
+	ops []batchOp
+}
+
+func (b *basicBatch) Put(key datastore.Key, value interface{}) error {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+	return nil
+}
+
+func (b *basicBatch) Delete(key datastore.Key) error {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+	return nil
+}
+
+func (b *basicBatch) Commit() error {
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = b.ds.Delete(op.key)
+		} else {
+			err = b.ds.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b.ops = nil
+	return nil
+}
@@ -0,0 +1,153 @@
+package datastore2
+
+import (
+	ds "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb"
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/jbenet/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// LevelDatastore is a leveldb datastore like the one of go-datastore, that
+// is also Batching: its batches are written to leveldb atomically.
+type LevelDatastore struct {
+	DB *leveldb.DB
+}
+
+// NewLevelDatastore opens the leveldb database at path, creating it if
+// needed.
+func NewLevelDatastore(path string, opts *opt.Options) (*LevelDatastore, error) {
+	db, err := leveldb.OpenFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDatastore{DB: db}, nil
+}
+
+// Put returns ErrInvalidType if value is not of type []byte. Like the
+// writes of batches, it does not sync.
+func (d *LevelDatastore) Put(key ds.Key, value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	return d.DB.Put(key.Bytes(), val, nil)
+}
+
+func (d *LevelDatastore) Get(key ds.Key) (interface{}, error) {
+	val, err := d.DB.Get(key.Bytes(), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ds.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (d *LevelDatastore) Has(key ds.Key) (bool, error) {
+	return d.DB.Has(key.Bytes(), nil)
+}
+
+func (d *LevelDatastore) Delete(key ds.Key) error {
+	err := d.DB.Delete(key.Bytes(), nil)
+	if err == leveldb.ErrNotFound {
+		return ds.ErrNotFound
+	}
+	return err
+}
+
+func (d *LevelDatastore) Query(q dsq.Query) (dsq.Results, error) {
+	qrb := dsq.NewResultBuilder(q)
+	qrb.Process.Go(func(worker goprocess.Process) {
+		d.runQuery(worker, qrb)
+	})
+	go qrb.Process.CloseAfterChildren()
+
+	qr := qrb.Results()
+	for _, f := range q.Filters {
+		qr = dsq.NaiveFilter(qr, f)
+	}
+	for _, o := range q.Orders {
+		qr = dsq.NaiveOrder(qr, o)
+	}
+	return qr, nil
+}
+
+func (d *LevelDatastore) runQuery(worker goprocess.Process, qrb *dsq.ResultBuilder) {
+	var rnge *util.Range
+	if qrb.Query.Prefix != "" {
+		rnge = util.BytesPrefix([]byte(qrb.Query.Prefix))
+	}
+	i := d.DB.NewIterator(rnge, nil)
+	defer i.Release()
+
+	// advance the iterator past the offset
+	for j := 0; j < qrb.Query.Offset; j++ {
+		i.Next()
+	}
+
+	for sent := 0; i.Next(); sent++ {
+		if qrb.Query.Limit > 0 && sent >= qrb.Query.Limit {
+			break
+		}
+
+		e := dsq.Entry{Key: ds.NewKey(string(i.Key())).String()}
+		if !qrb.Query.KeysOnly {
+			buf := make([]byte, len(i.Value()))
+			copy(buf, i.Value())
+			e.Value = buf
+		}
+
+		select {
+		case qrb.Output <- dsq.Result{Entry: e}:
+		case <-worker.Closing():
+			return
+		}
+	}
+
+	if err := i.Error(); err != nil {
+		select {
+		case qrb.Output <- dsq.Result{Error: err}:
+		case <-worker.Closing():
+		}
+	}
+}
+
+// Batch returns a batch written with a single leveldb write.
+func (d *LevelDatastore) Batch() (Batch, error) {
+	return &levelBatch{db: d.DB, b: new(leveldb.Batch)}, nil
+}
+
+func (d *LevelDatastore) Close() error {
+	return d.DB.Close()
+}
+
+func (d *LevelDatastore) IsThreadSafe() {}
+
+type levelBatch struct {
+	db *leveldb.DB
+	b  *leveldb.Batch
+}
+
+func (b *levelBatch) Put(key ds.Key, value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+	b.b.Put(key.Bytes(), val)
+	return nil
+}
+
+func (b *levelBatch) Delete(key ds.Key) error {
+	b.b.Delete(key.Bytes())
+	return nil
+}
+
+func (b *levelBatch) Commit() error {
+	return b.db.Write(b.b, nil)
+}
+
+var _ ThreadSafeDatastoreCloser = &LevelDatastore{}
+var _ Batching = &LevelDatastore{}
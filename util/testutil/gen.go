@@ -34,7 +34,7 @@ func RandTestKeyPair(bits int) (ci.PrivKey, ci.PubKey, error) {
 }
 
 func SeededTestKeyPair(seed int64) (ci.PrivKey, ci.PubKey, error) {
-	return ci.GenerateKeyPairWithReader(ci.RSA, 512, u.NewSeededRand(seed))
+	return ci.GenerateDeterministicKeyPair(ci.RSA, 512, u.NewSeededRand(seed))
 }
 
 // RandPeerID generates random "valid" peer IDs. it does not NEED to generate